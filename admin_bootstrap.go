@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// bootstrapAdmin makes sure the configured account exists and has the admin role.
+// The account is created with the given password if it doesn't exist yet.
+func (cfg *apiConfig) bootstrapAdmin(ctx context.Context, email, password string) error {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+
+	if errors.Is(err, database.ErrNotFound) {
+		if password == "" {
+			return fmt.Errorf("admin %s doesn't exist and ADMIN_PASSWORD is not set", email)
+		}
+		hashedPassword, err := auth.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		created, err := cfg.db.CreateUser(ctx, database.CreateUserParams{
+			Email:    email,
+			Password: hashedPassword,
+			FullName: "Administrator",
+		})
+		if err != nil {
+			return err
+		}
+		// The operator configured this address, so there's nothing to verify
+		if err := cfg.db.MarkUserEmailVerified(ctx, created.ID); err != nil {
+			return err
+		}
+		user = *created
+		log.Printf("Created admin account %s", email)
+	}
+
+	if user.IsAdmin() {
+		return nil
+	}
+	log.Printf("Granting admin role to %s", email)
+	return cfg.db.UpdateUserRole(ctx, user.ID, database.RoleAdmin)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// analyticsFlushInterval is how often buffered analytics are written and rolled up
+	analyticsFlushInterval = time.Minute
+	// analyticsEventRetention is how long raw events are kept. Only the last
+	// two days are ever rolled up again, so anything older is only for debugging.
+	analyticsEventRetention = 7 * 24 * time.Hour
+	// maxPendingVideoEvents caps each video's share of the buffer, so neither
+	// a database that can't keep up nor one busy share link loses every other
+	// video's events
+	maxPendingVideoEvents = 1000
+)
+
+type bandwidthKey struct {
+	videoID uuid.UUID
+	day     string
+}
+
+// analyticsRecorder buffers playback events and bytes served, like
+// playbackRecorder, and writes them in batches. Each flush then rolls today's
+// and yesterday's events up into the daily stats.
+type analyticsRecorder struct {
+	db database.Store
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	events  []database.AnalyticsEvent
+	// pending counts the buffered events for each video
+	pending map[uuid.UUID]int
+	bytes   map[bandwidthKey]int64
+}
+
+func newAnalyticsRecorder(db database.Store) *analyticsRecorder {
+	return &analyticsRecorder{
+		db:      db,
+		pending: map[uuid.UUID]int{},
+		bytes:   map[bandwidthKey]int64{},
+	}
+}
+
+// recordEvent buffers a playback event. Events are dropped while the video
+// has maxPendingVideoEvents buffered.
+func (a *analyticsRecorder) recordEvent(event database.AnalyticsEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.pending[event.VideoID] >= maxPendingVideoEvents {
+		return
+	}
+	a.events = append(a.events, event)
+	a.pending[event.VideoID]++
+}
+
+// recordBytes adds to the bytes served today for the video's files
+func (a *analyticsRecorder) recordBytes(videoID uuid.UUID, n int64) {
+	if n <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.bytes[bandwidthKey{videoID, database.AnalyticsDay(time.Now())}] += n
+}
+
+// flush writes everything buffered and rolls up the days it could have
+// changed. Whatever couldn't be written goes back in the buffer for the next
+// flush to retry.
+func (a *analyticsRecorder) flush(ctx context.Context) error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+
+	a.mu.Lock()
+	events := a.events
+	bytes := a.bytes
+	a.events = nil
+	a.pending = map[uuid.UUID]int{}
+	a.bytes = map[bandwidthKey]int64{}
+	a.mu.Unlock()
+
+	if len(events) > 0 {
+		if err := a.db.SaveAnalyticsEvents(ctx, events); err != nil {
+			a.requeue(events, bytes)
+			return err
+		}
+	}
+	if len(bytes) > 0 {
+		usage := make([]database.BandwidthUsage, 0, len(bytes))
+		for key, n := range bytes {
+			usage = append(usage, database.BandwidthUsage{VideoID: key.videoID, Day: key.day, Bytes: n})
+		}
+		if err := a.db.AddBandwidthUsage(ctx, usage); err != nil {
+			a.requeue(nil, bytes)
+			return err
+		}
+	}
+	// Events are stamped when they arrive, so only today and yesterday can
+	// have new ones
+	return a.db.RollupAnalytics(ctx, database.AnalyticsDay(time.Now().Add(-24*time.Hour)))
+}
+
+// requeue puts unwritten events and bytes back ahead of anything newer, as
+// far as each video's budget allows
+func (a *analyticsRecorder) requeue(events []database.AnalyticsEvent, bytes map[bandwidthKey]int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	kept := events[:0]
+	for _, event := range events {
+		if a.pending[event.VideoID] < maxPendingVideoEvents {
+			kept = append(kept, event)
+			a.pending[event.VideoID]++
+		}
+	}
+	a.events = append(kept, a.events...)
+	for key, n := range bytes {
+		a.bytes[key] += n
+	}
+}
+
+// run flushes every analyticsFlushInterval and prunes old raw events until
+// ctx is done. The caller flushes once more after the server has stopped.
+func (a *analyticsRecorder) run(ctx context.Context) {
+	ticker := time.NewTicker(analyticsFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.flush(ctx); err != nil {
+				log.Printf("%s[ERROR]%s couldn't save analytics: %v", colorRed, colorReset, err)
+			}
+			if err := a.db.PruneAnalyticsEvents(ctx, database.AnalyticsDay(time.Now().Add(-analyticsEventRetention))); err != nil {
+				log.Printf("%s[ERROR]%s couldn't prune analytics events: %v", colorRed, colorReset, err)
+			}
+		}
+	}
+}
+
+// analyticsViewerKey identifies a viewer for counting unique viewers. Signed
+// in users are counted by account; anonymous share viewers by their IP
+// address and user agent. Either is keyed with the analytics secret, so the
+// stored key can't be matched to an address by hashing guesses.
+func (cfg *apiConfig) analyticsViewerKey(r *http.Request, userID *uuid.UUID) string {
+	identity := "anon:" + cfg.clientIP(r) + "\x00" + r.UserAgent()
+	if userID != nil {
+		identity = "user:" + userID.String()
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.analyticsSecret))
+	mac.Write([]byte(identity))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database/memory"
+	"github.com/google/uuid"
+)
+
+func TestAnalyticsBufferIsBudgetedPerVideo(t *testing.T) {
+	a := newAnalyticsRecorder(memory.New())
+	busy, quiet := uuid.New(), uuid.New()
+	for range maxPendingVideoEvents + 10 {
+		a.recordEvent(database.AnalyticsEvent{VideoID: busy, Type: database.AnalyticsEventPlay})
+	}
+	a.recordEvent(database.AnalyticsEvent{VideoID: quiet, Type: database.AnalyticsEventPlay})
+
+	if got := a.pending[busy]; got != maxPendingVideoEvents {
+		t.Errorf("busy video has %d events buffered, want the cap of %d", got, maxPendingVideoEvents)
+	}
+	if got := a.pending[quiet]; got != 1 {
+		t.Errorf("quiet video has %d events buffered, want 1", got)
+	}
+
+	// A failed write puts events back without going over either budget
+	events := a.events
+	a.events, a.pending = nil, map[uuid.UUID]int{}
+	a.recordEvent(database.AnalyticsEvent{VideoID: busy, Type: database.AnalyticsEventPlay})
+	a.requeue(events, nil)
+	if got := a.pending[busy]; got != maxPendingVideoEvents || len(a.events) != maxPendingVideoEvents+1 {
+		t.Errorf("after requeue busy video has %d of %d events buffered, want the cap", got, len(a.events))
+	}
+}
+
+func TestShareEventsNeedThePassword(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.createUser("owner@example.com")
+	video := api.createVideo(owner, "Protected")
+	hash, err := auth.HashPassword("open sesame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := api.db.CreateShareLink(context.Background(), database.CreateShareLinkParams{
+		Token:        "protected-token",
+		UserID:       owner.ID,
+		VideoID:      &video.ID,
+		PasswordHash: &hash,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(password string) int {
+		req := newJSONRequest(t, http.MethodPost, "/api/public/shares/"+link.Token+"/events", map[string]any{"type": "play"})
+		if password != "" {
+			req.Header.Set(sharePasswordHeader, password)
+		}
+		return api.serve(req).Code
+	}
+
+	if got := send(""); got != http.StatusUnauthorized {
+		t.Errorf("without a password got %d, want 401", got)
+	}
+	if got := send("wrong"); got != http.StatusUnauthorized {
+		t.Errorf("with the wrong password got %d, want 401", got)
+	}
+	if got := send("open sesame"); got != http.StatusNoContent {
+		t.Errorf("with the password got %d, want 204", got)
+	}
+	if got := api.cfg.analytics.pending[video.ID]; got != 1 {
+		t.Errorf("%d events buffered, want only the one sent with the password", got)
+	}
+
+	// Once the link is locked out, even the right password has to wait
+	key := shareLinkKey(link.ID)
+	if _, err := api.db.IncrementAuthThrottle(context.Background(), key, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.db.LockAuthThrottle(context.Background(), key, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := send("open sesame"); got != http.StatusTooManyRequests {
+		t.Errorf("while locked out got %d, want 429", got)
+	}
+}
+
+func TestAnalyticsViewerKeyNeedsTheSecret(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:5000"
+	req.Header.Set("User-Agent", "Viewer/1.0")
+
+	// Without the secret, hashing guessed addresses mustn't find the viewer
+	guess := sha256.Sum256([]byte("anon:203.0.113.7\x00Viewer/1.0"))
+	one := (&apiConfig{analyticsSecret: "one"}).analyticsViewerKey(req, nil)
+	if one == hex.EncodeToString(guess[:16]) {
+		t.Error("viewer key is a plain hash of the IP address and user agent")
+	}
+	if again := (&apiConfig{analyticsSecret: "one"}).analyticsViewerKey(req, nil); again != one {
+		t.Errorf("same viewer got keys %q and %q, want the same", one, again)
+	}
+	if other := (&apiConfig{analyticsSecret: "two"}).analyticsViewerKey(req, nil); other == one {
+		t.Error("viewer got the same key under different secrets")
+	}
+}
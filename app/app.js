@@ -7,6 +7,7 @@
 // State Management
 // ============================================
 const state = {
+  user: null,
   currentVideo: null,
   videos: [],
   collections: [],
@@ -76,9 +77,26 @@ const elements = {
 document.addEventListener("DOMContentLoaded", async () => {
   const token = localStorage.getItem("token");
 
-  if (token) {
+  // Links from emails land here with ?reset_token=, ?verify_token= or ?email_change_token=
+  const searchParams = new URLSearchParams(window.location.search);
+  const resetToken = searchParams.get("reset_token");
+  const verifyToken = searchParams.get("verify_token");
+  const emailChangeToken = searchParams.get("email_change_token");
+
+  if (verifyToken) {
+    await confirmEmailToken("/api/verify-email", verifyToken);
+  } else if (emailChangeToken) {
+    await confirmEmailToken("/api/confirm-email-change", emailChangeToken);
+  }
+
+  if (resetToken) {
+    showAuth();
+    document.getElementById("reset-token").value = resetToken;
+    showResetPasswordForm();
+    window.history.replaceState({}, "", window.location.pathname);
+  } else if (token) {
     showApp();
-    await loadVideos();
+    await Promise.all([loadCurrentUser(), loadVideos()]);
   } else {
     showAuth();
   }
@@ -154,7 +172,7 @@ async function login() {
         localStorage.setItem("refresh_token", data.refresh_token);
       }
       showApp();
-      await loadVideos();
+      await Promise.all([loadCurrentUser(), loadVideos()]);
       showToast("Welcome back!", "success");
     }
   } catch (error) {
@@ -185,7 +203,7 @@ async function signup() {
 
     if (!res.ok) {
       const data = await res.json();
-      throw new Error(data.error || "Signup failed");
+      throw new Error(apiErrorMessage(data, "Signup failed"));
     }
 
     showToast("Account created! Logging in...", "success");
@@ -222,12 +240,7 @@ async function forgotPassword() {
     }
 
     showToast(data.message, "success");
-
-    // For demo: if token is returned, pre-fill it
-    if (data.token) {
-      document.getElementById("reset-token").value = data.token;
-      showResetPasswordForm();
-    }
+    showLoginForm();
   } catch (error) {
     showToast(error.message, "error");
   }
@@ -252,7 +265,7 @@ async function resetPassword() {
     const data = await res.json();
 
     if (!res.ok) {
-      throw new Error(data.error || "Failed to reset password");
+      throw new Error(apiErrorMessage(data, "Failed to reset password"));
     }
 
     showToast(data.message, "success");
@@ -262,7 +275,30 @@ async function resetPassword() {
   }
 }
 
+async function confirmEmailToken(url, token) {
+  window.history.replaceState({}, "", window.location.pathname);
+
+  try {
+    const res = await fetch(url, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ token }),
+    });
+
+    const data = await res.json();
+
+    if (!res.ok) {
+      throw new Error(data.message || "Link is invalid or has expired");
+    }
+
+    showToast(data.message, "success");
+  } catch (error) {
+    showToast(error.message, "error");
+  }
+}
+
 function logout() {
+  state.user = null;
   localStorage.removeItem("token");
   localStorage.removeItem("refresh_token");
   state.videos = [];
@@ -332,17 +368,51 @@ async function authFetch(url, options = {}) {
 }
 
 // ============================================
-// Video Functions
+// User Functions
 // ============================================
-async function loadVideos() {
+async function loadCurrentUser() {
   try {
-    const res = await authFetch("/api/videos");
+    const res = await authFetch("/api/users/me");
 
     if (!res.ok) {
-      throw new Error("Failed to load videos");
+      throw new Error("Failed to load profile");
+    }
+
+    state.user = await res.json();
+    const nameEl = document.getElementById("header-user-name");
+    if (nameEl) {
+      nameEl.textContent = state.user.full_name || state.user.email;
+    }
+  } catch (error) {
+    if (error.message !== "Session expired") {
+      showToast(error.message, "error");
     }
+  }
+}
+
+// ============================================
+// Video Functions
+// ============================================
+async function loadVideos() {
+  try {
+    // The grid and storage stats need every video, so follow the cursors
+    const videos = [];
+    let cursor = "";
+    do {
+      const params = new URLSearchParams({ limit: "200" });
+      if (cursor) params.set("cursor", cursor);
+      const res = await authFetch(`/api/videos?${params}`);
+
+      if (!res.ok) {
+        throw new Error("Failed to load videos");
+      }
+
+      const page = await res.json();
+      videos.push(...page.videos);
+      cursor = page.next_cursor;
+    } while (cursor);
 
-    state.videos = await res.json();
+    state.videos = videos;
     renderVideos();
     updateStorageStats();
   } catch (error) {
@@ -1107,6 +1177,15 @@ function setupDropzone(dropzoneId, inputId, onFileSelect) {
 // ============================================
 // Utility Functions
 // ============================================
+// apiErrorMessage turns an API error body into a readable message,
+// listing every password policy violation when present
+function apiErrorMessage(data, fallback) {
+  if (data.violations && data.violations.length > 0) {
+    return data.violations.map((v) => v.message).join(". ");
+  }
+  return data.message || data.error || fallback;
+}
+
 function escapeHtml(text) {
   const div = document.createElement("div");
   div.textContent = text;
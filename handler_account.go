@@ -0,0 +1,218 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerDeleteAccount deletes the caller's account after re-checking their password.
+// The account is disabled immediately and the cascade runs in the background.
+func (cfg *apiConfig) handlerDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, "User", err)
+		return
+	}
+
+	// Re-authenticate so a stolen access token can't delete the account
+	match, err := auth.CheckPasswordHash(params.Password, user.Password)
+	if err != nil || !match {
+		event := auditUser(auditAccountDelete, user.ID)
+		event.Outcome = database.AuditOutcomeFailure
+		cfg.audit(r, event)
+		respondWithError(w, http.StatusUnauthorized, "Incorrect password", err)
+		return
+	}
+
+	if err := cfg.db.MarkUserForDeletion(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+	if err := cfg.db.RevokeUserRefreshTokens(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	cfg.audit(r, auditUser(auditAccountDelete, user.ID))
+	cfg.scheduleAccountDeletion(*user, user.ID)
+
+	respondWithSuccess(w, http.StatusAccepted, "Your account is being deleted. You'll receive a confirmation email when it's done.", nil)
+}
+
+// handlerExportAccount streams a ZIP with the caller's account info, video
+// metadata and original media files
+func (cfg *apiConfig) handlerExportAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, "User", err)
+		return
+	}
+
+	videos, err := cfg.db.GetVideos(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	collections, err := cfg.exportCollections(r, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve collections", err)
+		return
+	}
+
+	notes, err := cfg.db.ListUserNotes(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve notes", err)
+		return
+	}
+
+	filename := fmt.Sprintf("vaultstream-export-%s.zip", time.Now().UTC().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	cfg.audit(r, auditUser(auditAccountExport, user.ID))
+
+	// Headers are already sent, so failures from here on can only be logged
+	if err := cfg.writeAccountExport(r, w, *user, videos, collections, notes); err != nil {
+		log.Printf("%s[ERROR]%s couldn't write export for %s: %v", colorRed, colorReset, userID, err)
+	}
+}
+
+// exportedCollection is a collection in collections.json, with its videos as IDs in order
+type exportedCollection struct {
+	database.Collection
+	VideoIDs []uuid.UUID `json:"video_ids"`
+}
+
+func (cfg *apiConfig) exportCollections(r *http.Request, userID uuid.UUID) ([]exportedCollection, error) {
+	collections, err := cfg.db.ListCollections(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	exported := make([]exportedCollection, len(collections))
+	for i, collection := range collections {
+		items, err := cfg.db.GetCollectionItems(r.Context(), collection.ID)
+		if err != nil {
+			return nil, err
+		}
+		// The cover is one of the exported thumbnails, not a file of its own
+		collection.CoverThumbnailURL = nil
+		exported[i] = exportedCollection{Collection: collection, VideoIDs: make([]uuid.UUID, len(items))}
+		for j, item := range items {
+			exported[i].VideoIDs[j] = item.Video.ID
+		}
+	}
+	return exported, nil
+}
+
+func (cfg *apiConfig) writeAccountExport(r *http.Request, w io.Writer, user database.User, videos []database.Video, collections []exportedCollection, notes []database.Note) error {
+	archive := zip.NewWriter(w)
+
+	if err := writeZipJSON(archive, "account.json", user); err != nil {
+		return err
+	}
+	if err := writeZipJSON(archive, "videos.json", videos); err != nil {
+		return err
+	}
+	if err := writeZipJSON(archive, "collections.json", collections); err != nil {
+		return err
+	}
+	if err := writeZipJSON(archive, "notes.json", notes); err != nil {
+		return err
+	}
+
+	for _, video := range videos {
+		files := []struct {
+			name string
+			ref  *string
+		}{
+			{"video", video.VideoURL},
+			{"thumbnail", video.ThumbnailURL},
+			{"captions", video.CaptionsURL},
+		}
+		for _, file := range files {
+			if file.ref == nil || *file.ref == "" {
+				continue
+			}
+			name := fmt.Sprintf("media/%s/%s%s", video.ID, file.name, path.Ext(*file.ref))
+			if err := cfg.copyStoredFileToZip(r, archive, name, *file.ref); err != nil {
+				return err
+			}
+		}
+	}
+
+	return archive.Close()
+}
+
+// copyStoredFileToZip streams a file from storage into the archive without compressing it
+// (media is already compressed)
+func (cfg *apiConfig) copyStoredFileToZip(r *http.Request, archive *zip.Writer, name, storageRef string) error {
+	file, err := cfg.storage.Open(r.Context(), storageRef)
+	if err != nil {
+		// Skip missing files rather than failing the whole export
+		log.Printf("%s[WARN]%s export: couldn't open %s: %v", colorYellow, colorReset, storageRef, err)
+		return nil
+	}
+	defer file.Close()
+
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     strings.TrimPrefix(name, "/"),
+		Method:   zip.Store,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
+
+func writeZipJSON(archive *zip.Writer, name string, data any) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// adminTargetUser loads the user named by the {userID} path value, responding with an error if it can't
+func (cfg *apiConfig) adminTargetUser(w http.ResponseWriter, r *http.Request) (*database.User, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return nil, false
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, "User", err)
+		return nil, false
+	}
+	return user, true
+}
+
+// rejectSelfTarget stops admins from locking themselves out of their own account
+func rejectSelfTarget(w http.ResponseWriter, r *http.Request, target *database.User) bool {
+	adminID, _ := GetUserIDFromContext(r.Context())
+	if adminID == target.ID {
+		respondWithError(w, http.StatusBadRequest, "You can't do this to your own account", nil)
+		return true
+	}
+	return false
+}
+
+// handlerAdminListUsers lists and searches users (?q=, ?limit=, ?offset=)
+func (cfg *apiConfig) handlerAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Users  []database.User `json:"users"`
+		Total  int             `json:"total"`
+		Limit  int             `json:"limit"`
+		Offset int             `json:"offset"`
+	}
+
+	query := r.URL.Query()
+	limit, err := queryInt(query, "limit", 50)
+	if err != nil || limit < 1 || limit > 200 {
+		respondWithError(w, http.StatusBadRequest, "limit must be between 1 and 200", err)
+		return
+	}
+	offset, err := queryInt(query, "offset", 0)
+	if err != nil || offset < 0 {
+		respondWithError(w, http.StatusBadRequest, "offset must be a positive number", err)
+		return
+	}
+
+	users, total, err := cfg.db.GetUsers(r.Context(), database.ListUsersParams{
+		Search: query.Get("q"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list users", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Users:  users,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// handlerAdminGetUser returns a user together with their storage usage
+func (cfg *apiConfig) handlerAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		database.User
+		StorageUsage database.StorageUsage `json:"storage_usage"`
+	}
+
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	usage, err := cfg.db.GetUserStorageUsage(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get storage usage", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		User:         *user,
+		StorageUsage: usage,
+	})
+}
+
+// handlerAdminUpdateUserRole promotes or demotes a user
+func (cfg *apiConfig) handlerAdminUpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok || rejectSelfTarget(w, r, user) {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if params.Role != database.RoleUser && params.Role != database.RoleAdmin {
+		respondWithError(w, http.StatusBadRequest, "Role must be \"user\" or \"admin\"", nil)
+		return
+	}
+
+	if err := cfg.db.UpdateUserRole(r.Context(), user.ID, params.Role); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update role", err)
+		return
+	}
+
+	event := auditUser(auditAdminUserRole, user.ID)
+	event.Details = map[string]any{"from": user.Role, "to": params.Role}
+	cfg.audit(r, event)
+
+	respondWithSuccess(w, http.StatusOK, "Role updated", nil)
+}
+
+// handlerAdminDisableUser blocks the account from logging in and ends its sessions
+func (cfg *apiConfig) handlerAdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok || rejectSelfTarget(w, r, user) {
+		return
+	}
+
+	if err := cfg.db.SetUserDisabled(r.Context(), user.ID, true); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable account", err)
+		return
+	}
+	if err := cfg.db.RevokeUserRefreshTokens(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	cfg.audit(r, auditUser(auditAdminUserDisable, user.ID))
+
+	respondWithSuccess(w, http.StatusOK, "Account disabled", nil)
+}
+
+// handlerAdminEnableUser re-enables a disabled account
+func (cfg *apiConfig) handlerAdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.SetUserDisabled(r.Context(), user.ID, false); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable account", err)
+		return
+	}
+
+	cfg.audit(r, auditUser(auditAdminUserEnable, user.ID))
+
+	respondWithSuccess(w, http.StatusOK, "Account enabled", nil)
+}
+
+// handlerAdminForcePasswordReset ends the user's sessions, blocks login until the
+// password is changed, and emails them a reset link
+func (cfg *apiConfig) handlerAdminForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.RequirePasswordReset(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't require password reset", err)
+		return
+	}
+	if err := cfg.db.RevokeUserRefreshTokens(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	resetToken, err := cfg.db.CreatePasswordResetToken(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create reset token", err)
+		return
+	}
+
+	cfg.sendEmail(user.Email, "password_reset", map[string]string{
+		"Name":      user.FullName,
+		"Link":      cfg.publicLink("/app/", url.Values{"reset_token": {resetToken.Token}}),
+		"ExpiresIn": "1 hour",
+	})
+	cfg.audit(r, auditUser(auditAdminForcePasswordReset, user.ID))
+
+	respondWithSuccess(w, http.StatusOK, "Password reset required; a reset link has been sent to "+user.Email, nil)
+}
+
+// handlerAdminUnlockUser clears login and password reset lockouts for an account
+func (cfg *apiConfig) handlerAdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	for _, key := range []string{loginAccountKey(user.Email), forgotAccountKey(user.Email)} {
+		if err := cfg.db.ClearAuthThrottle(r.Context(), key); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't unlock account", err)
+			return
+		}
+	}
+
+	cfg.audit(r, auditUser(auditAdminUserUnlock, user.ID))
+
+	respondWithSuccess(w, http.StatusOK, "Account unlocked", nil)
+}
+
+// handlerAdminDeleteUser deletes a user together with all their videos and
+// files. Like self-service deletion, the account is locked at once and the
+// cascade runs in the background.
+func (cfg *apiConfig) handlerAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok || rejectSelfTarget(w, r, user) {
+		return
+	}
+	if user.DeletionRequestedAt != nil {
+		respondWithSuccess(w, http.StatusAccepted, "The user is already being deleted", nil)
+		return
+	}
+
+	if err := cfg.db.MarkUserForDeletion(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete user", err)
+		return
+	}
+	if err := cfg.db.RevokeUserRefreshTokens(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	event := auditUser(auditAdminUserDelete, user.ID)
+	event.Details = map[string]any{"email": user.Email}
+	cfg.audit(r, event)
+
+	adminID, _ := GetUserIDFromContext(r.Context())
+	cfg.scheduleAccountDeletion(*user, adminID)
+
+	respondWithSuccess(w, http.StatusAccepted, "The user is being deleted", nil)
+}
+
+// queryInt parses an optional integer query parameter
+func queryInt(query url.Values, key string, fallback int) (int, error) {
+	value := query.Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
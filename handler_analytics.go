@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxEventWatchSeconds caps the watch time a single event can report
+	maxEventWatchSeconds = 300
+	// defaultAnalyticsDays is the range analytics cover when none is given
+	defaultAnalyticsDays = 30
+	maxAnalyticsDays     = 366
+)
+
+// analyticsEventParameters is the body of both event endpoints
+type analyticsEventParameters struct {
+	Type         string  `json:"type"`
+	WatchSeconds float64 `json:"watch_seconds"`
+	// VideoID says which video of a shared collection is playing
+	VideoID *uuid.UUID `json:"video_id"`
+}
+
+func decodeAnalyticsEvent(r *http.Request) (analyticsEventParameters, error) {
+	params := analyticsEventParameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return params, errors.New("request body must be a JSON event")
+	}
+	switch params.Type {
+	case database.AnalyticsEventPlay, database.AnalyticsEventProgress, database.AnalyticsEventComplete:
+	default:
+		return params, errors.New("type must be play, progress or complete")
+	}
+	if params.WatchSeconds < 0 || params.WatchSeconds > maxEventWatchSeconds {
+		return params, fmt.Errorf("watch_seconds must be between 0 and %d", maxEventWatchSeconds)
+	}
+	return params, nil
+}
+
+// handlerVideoEvent ingests a playback event from the app. Send "play" when
+// playback starts, "progress" with the seconds watched since the last event,
+// and "complete" at the end. Owners watching their own videos aren't counted.
+func (cfg *apiConfig) handlerVideoEvent(w http.ResponseWriter, r *http.Request) {
+	video, role, ok := cfg.authorizeVideo(w, r, actionView, "")
+	if !ok {
+		return
+	}
+	userID, _ := GetUserIDFromContext(r.Context())
+
+	params, err := decodeAnalyticsEvent(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if role != roleOwner {
+		cfg.analytics.recordEvent(database.AnalyticsEvent{
+			CreatedAt:    time.Now(),
+			VideoID:      video.ID,
+			ViewerKey:    cfg.analyticsViewerKey(r, &userID),
+			Source:       database.AnalyticsSourceApp,
+			Type:         params.Type,
+			WatchSeconds: params.WatchSeconds,
+		})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerShareEvent ingests a playback event from someone watching through a
+// share link; the token is the credential, with the password for protected
+// links. Events keep coming after the link's last view is used, so that
+// viewer's watch time still counts, but stop once it is revoked or expires.
+func (cfg *apiConfig) handlerShareEvent(w http.ResponseWriter, r *http.Request) {
+	link, err := cfg.db.GetShareLinkByToken(r.Context(), r.PathValue("token"))
+	if err != nil {
+		respondWithDBError(w, "Share link", err)
+		return
+	}
+	if link.RevokedAt != nil || (link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now())) {
+		respondWithError(w, errShareLinkGone.code, errShareLinkGone.message, nil)
+		return
+	}
+	if link.PasswordHash != nil {
+		if !cfg.checkSharePassword(w, r, link) {
+			return
+		}
+	} else if !cfg.checkShareThrottle(w, r, link) {
+		return
+	}
+
+	params, err := decodeAnalyticsEvent(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var videoID uuid.UUID
+	switch {
+	case link.VideoID != nil:
+		if params.VideoID != nil && *params.VideoID != *link.VideoID {
+			respondWithError(w, http.StatusNotFound, "Video not found", nil)
+			return
+		}
+		videoID = *link.VideoID
+	case params.VideoID == nil:
+		respondWithError(w, http.StatusBadRequest, "video_id is required for collection links", nil)
+		return
+	default:
+		items, err := cfg.db.GetCollectionItems(r.Context(), *link.CollectionID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve collection", err)
+			return
+		}
+		found := false
+		for _, item := range items {
+			found = found || item.Video.ID == *params.VideoID
+		}
+		if !found {
+			respondWithError(w, http.StatusNotFound, "Video not found", nil)
+			return
+		}
+		videoID = *params.VideoID
+	}
+
+	cfg.analytics.recordEvent(database.AnalyticsEvent{
+		CreatedAt:    time.Now(),
+		VideoID:      videoID,
+		ViewerKey:    cfg.analyticsViewerKey(r, nil),
+		Source:       database.AnalyticsSourceShare,
+		Type:         params.Type,
+		WatchSeconds: params.WatchSeconds,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// analyticsResponse is a day-by-day report over a range of days
+type analyticsResponse struct {
+	From   string                     `json:"from"`
+	To     string                     `json:"to"`
+	Totals database.VideoStats        `json:"totals"`
+	Days   []database.DailyVideoStats `json:"days"`
+}
+
+// analyticsRange parses ?from= and ?to= (YYYY-MM-DD, UTC, inclusive). They
+// default to the last 30 days.
+func analyticsRange(query url.Values) (time.Time, time.Time, error) {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if value := query.Get("to"); value != "" {
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("to must be a date like 2024-01-31")
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, 1-defaultAnalyticsDays)
+	if value := query.Get("from"); value != "" {
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("from must be a date like 2024-01-01")
+		}
+		from = t
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, errors.New("from must not be after to")
+	}
+	if to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("the range can't be longer than %d days", maxAnalyticsDays)
+	}
+	return from, to, nil
+}
+
+// newAnalyticsResponse lists every day from from to to, with zeros for days
+// without activity, and totals them. uniqueViewers is counted over the whole
+// range, since the days' counts can't be added up.
+func newAnalyticsResponse(from, to time.Time, days []database.DailyVideoStats, uniqueViewers int) analyticsResponse {
+	byDay := map[string]database.VideoStats{}
+	for _, day := range days {
+		byDay[day.Day] = day.VideoStats
+	}
+	resp := analyticsResponse{
+		From: database.AnalyticsDay(from),
+		To:   database.AnalyticsDay(to),
+		Days: []database.DailyVideoStats{},
+	}
+	for t := from; !t.After(to); t = t.AddDate(0, 0, 1) {
+		day := database.AnalyticsDay(t)
+		resp.Days = append(resp.Days, database.DailyVideoStats{Day: day, VideoStats: byDay[day]})
+		resp.Totals.Add(byDay[day])
+	}
+	resp.Totals.UniqueViewers = uniqueViewers
+	return resp
+}
+
+// handlerVideoAnalytics reports a video's views, viewers, watch time and
+// bandwidth for each day in the range. Only the owner may see it. Buffered
+// events are left for the next flush, so reports lag by up to
+// analyticsFlushInterval.
+func (cfg *apiConfig) handlerVideoAnalytics(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.authorizeVideo(w, r, actionManage, "")
+	if !ok {
+		return
+	}
+	from, to, err := analyticsRange(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	fromDay, toDay := database.AnalyticsDay(from), database.AnalyticsDay(to)
+	days, err := cfg.db.ListVideoDailyStats(r.Context(), video.ID, fromDay, toDay)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve analytics", err)
+		return
+	}
+	viewers, err := cfg.db.CountVideoViewers(r.Context(), video.ID, fromDay, toDay)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve analytics", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newAnalyticsResponse(from, to, days, viewers))
+}
+
+// handlerAccountAnalytics is handlerVideoAnalytics across all the caller's
+// videos, plus a total for each video that had any activity
+func (cfg *apiConfig) handlerAccountAnalytics(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		analyticsResponse
+		Videos []database.VideoStatsSummary `json:"videos"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+	from, to, err := analyticsRange(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	fromDay, toDay := database.AnalyticsDay(from), database.AnalyticsDay(to)
+
+	days, err := cfg.db.ListUserDailyStats(r.Context(), userID, fromDay, toDay)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve analytics", err)
+		return
+	}
+	videos, err := cfg.db.ListUserVideoStats(r.Context(), userID, fromDay, toDay)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve analytics", err)
+		return
+	}
+	viewers, err := cfg.db.CountUserViewers(r.Context(), userID, fromDay, toDay)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve analytics", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		analyticsResponse: newAnalyticsResponse(from, to, days, viewers),
+		Videos:            videos,
+	})
+}
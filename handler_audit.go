@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerAdminAuditEvents lists audit events across all users. Filters:
+// ?actor_id=, ?target_type=, ?target_id=, ?action= (trailing * for a prefix),
+// ?outcome=, ?since=, ?until= (RFC 3339), ?limit=, ?offset=, ?format=jsonl
+func (cfg *apiConfig) handlerAdminAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := auditFilterFromQuery(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if actor := query.Get("actor_id"); actor != "" {
+		actorID, err := uuid.Parse(actor)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid actor_id", err)
+			return
+		}
+		filter.ActorID = &actorID
+	}
+	filter.TargetType = query.Get("target_type")
+	filter.TargetID = query.Get("target_id")
+
+	cfg.respondWithAuditEvents(w, r, filter, "audit-events")
+}
+
+// handlerAccountActivity lists audit events where the caller is the actor or the
+// target, so users can review sign-ins and changes to their account
+func (cfg *apiConfig) handlerAccountActivity(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	filter, err := auditFilterFromQuery(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	filter.InvolvingUser = &userID
+
+	cfg.respondWithAuditEvents(w, r, filter, "account-activity")
+}
+
+// auditFilterFromQuery parses the filters shared by the admin and account activity endpoints
+func auditFilterFromQuery(query url.Values) (database.AuditEventFilter, error) {
+	filter := database.AuditEventFilter{
+		Action:  query.Get("action"),
+		Outcome: query.Get("outcome"),
+	}
+
+	switch filter.Outcome {
+	case "", database.AuditOutcomeSuccess, database.AuditOutcomeFailure, database.AuditOutcomeDenied:
+	default:
+		return filter, errors.New("outcome must be success, failure or denied")
+	}
+
+	for key, dest := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := query.Get(key)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+		}
+		*dest = &t
+	}
+
+	// JSON-lines exports are unbounded unless a limit is given explicitly
+	var limit int
+	var err error
+	if isJSONLinesRequest(query) {
+		limit, err = queryInt(query, "limit", 0)
+		if err != nil || limit < 0 {
+			return filter, errors.New("limit must be a positive number")
+		}
+	} else {
+		limit, err = queryInt(query, "limit", 50)
+		if err != nil || limit < 1 || limit > 500 {
+			return filter, errors.New("limit must be between 1 and 500")
+		}
+	}
+	offset, err := queryInt(query, "offset", 0)
+	if err != nil || offset < 0 {
+		return filter, errors.New("offset must be a positive number")
+	}
+	filter.Limit = limit
+	filter.Offset = offset
+
+	return filter, nil
+}
+
+func isJSONLinesRequest(query url.Values) bool {
+	return query.Get("format") == "jsonl"
+}
+
+// respondWithAuditEvents writes events as a JSON page, or streams them as JSON
+// lines when ?format=jsonl is set
+func (cfg *apiConfig) respondWithAuditEvents(w http.ResponseWriter, r *http.Request, filter database.AuditEventFilter, exportName string) {
+	type response struct {
+		Events []database.AuditEvent `json:"events"`
+		Limit  int                   `json:"limit"`
+		Offset int                   `json:"offset"`
+	}
+
+	if !isJSONLinesRequest(r.URL.Query()) {
+		events, err := cfg.db.ListAuditEvents(r.Context(), filter)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't list audit events", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, response{
+			Events: events,
+			Limit:  filter.Limit,
+			Offset: filter.Offset,
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("vaultstream-%s-%s.jsonl", exportName, time.Now().UTC().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are already sent, so failures from here on can only be logged
+	encoder := json.NewEncoder(w)
+	err := cfg.db.StreamAuditEvents(r.Context(), filter, func(event database.AuditEvent) error {
+		return encoder.Encode(event)
+	})
+	if err != nil {
+		log.Printf("%s[ERROR]%s couldn't stream audit events: %v", colorRed, colorReset, err)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxCollectionTitleLength = 200
+	maxCollectionItems       = 1000
+)
+
+// collectionResponse is a collection with its videos in order
+type collectionResponse struct {
+	database.Collection
+	Items []database.CollectionItem `json:"items"`
+}
+
+// collectionPlacementParams is the optional before_id/after_id of item add and move requests
+type collectionPlacementParams struct {
+	BeforeID *uuid.UUID `json:"before_id"`
+	AfterID  *uuid.UUID `json:"after_id"`
+}
+
+func (p collectionPlacementParams) placement() (database.CollectionPlacement, error) {
+	if p.BeforeID != nil && p.AfterID != nil {
+		return database.CollectionPlacement{}, errors.New("set before_id or after_id, not both")
+	}
+	return database.CollectionPlacement{BeforeID: p.BeforeID, AfterID: p.AfterID}, nil
+}
+
+func validateCollectionTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", errors.New("title is required")
+	}
+	if utf8.RuneCountInString(title) > maxCollectionTitleLength {
+		return "", fmt.Errorf("title must be at most %d characters", maxCollectionTitleLength)
+	}
+	return title, nil
+}
+
+// signCollection presigns the cover thumbnail the same way video thumbnails are
+func (cfg *apiConfig) signCollection(collection database.Collection) (database.Collection, error) {
+	cover, err := cfg.dbVideoToSignedVideo(database.Video{ThumbnailURL: collection.CoverThumbnailURL})
+	if err != nil {
+		return database.Collection{}, err
+	}
+	collection.CoverThumbnailURL = cover.ThumbnailURL
+	return collection, nil
+}
+
+// respondWithCollection writes the collection with its items, all with presigned URLs
+func (cfg *apiConfig) respondWithCollection(w http.ResponseWriter, r *http.Request, code int, collectionID uuid.UUID) {
+	collection, err := cfg.db.GetCollection(r.Context(), collectionID)
+	if err != nil {
+		respondWithDBError(w, "Collection", err)
+		return
+	}
+	items, err := cfg.db.GetCollectionItems(r.Context(), collectionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve collection items", err)
+		return
+	}
+
+	collection, err = cfg.signCollection(collection)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+		return
+	}
+	for i, item := range items {
+		signedVideo, err := cfg.dbVideoToSignedVideo(item.Video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+			return
+		}
+		items[i].Video = signedVideo
+	}
+
+	respondWithJSON(w, code, collectionResponse{Collection: collection, Items: items})
+}
+
+// handlerCollectionsList lists the caller's collections, newest first, without their items
+func (cfg *apiConfig) handlerCollectionsList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	collections, err := cfg.db.ListCollections(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list collections", err)
+		return
+	}
+	for i, collection := range collections {
+		signed, err := cfg.signCollection(collection)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+			return
+		}
+		collections[i] = signed
+	}
+
+	respondWithJSON(w, http.StatusOK, collections)
+}
+
+func (cfg *apiConfig) handlerCollectionCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	title, err := validateCollectionTitle(params.Title)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	collection, err := cfg.db.CreateCollection(r.Context(), database.CreateCollectionParams{
+		UserID:      userID,
+		Title:       title,
+		Description: params.Description,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create collection", err)
+		return
+	}
+	cfg.audit(r, auditCollection(auditCollectionCreate, collection.ID))
+
+	cfg.respondWithCollection(w, r, http.StatusCreated, collection.ID)
+}
+
+func (cfg *apiConfig) handlerCollectionGet(w http.ResponseWriter, r *http.Request) {
+	collection, _, ok := cfg.authorizeCollection(w, r, actionView, "")
+	if !ok {
+		return
+	}
+	cfg.respondWithCollection(w, r, http.StatusOK, collection.ID)
+}
+
+func (cfg *apiConfig) handlerCollectionUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+
+	collection, _, ok := cfg.authorizeCollection(w, r, actionEdit, auditCollectionUpdate)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	title, err := validateCollectionTitle(params.Title)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	collection.Title = title
+	collection.Description = params.Description
+	if err := cfg.db.UpdateCollection(r.Context(), collection); err != nil {
+		respondWithDBError(w, "Collection", err)
+		return
+	}
+	cfg.audit(r, auditCollection(auditCollectionUpdate, collection.ID))
+
+	cfg.respondWithCollection(w, r, http.StatusOK, collection.ID)
+}
+
+// handlerCollectionDelete deletes the collection; its videos are kept
+func (cfg *apiConfig) handlerCollectionDelete(w http.ResponseWriter, r *http.Request) {
+	collection, _, ok := cfg.authorizeCollection(w, r, actionManage, auditCollectionDelete)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.DeleteCollection(r.Context(), collection.ID); err != nil {
+		respondWithDBError(w, "Collection", err)
+		return
+	}
+	cfg.audit(r, auditCollection(auditCollectionDelete, collection.ID))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerCollectionItemAdd adds one of the owner's videos to the collection,
+// at the end unless before_id or after_id says otherwise
+func (cfg *apiConfig) handlerCollectionItemAdd(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoID uuid.UUID `json:"video_id"`
+		collectionPlacementParams
+	}
+
+	collection, _, ok := cfg.authorizeCollection(w, r, actionEdit, auditCollectionItemAdd)
+	if !ok {
+		return
+	}
+	userID, _ := GetUserIDFromContext(r.Context())
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	placement, err := params.placement()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if collection.ItemCount >= maxCollectionItems {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("A collection can hold at most %d videos", maxCollectionItems), nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), params.VideoID)
+	if err != nil {
+		respondWithDBError(w, "Video", err)
+		return
+	}
+	// Collections only hold their owner's videos, and editors can't use one to
+	// reach a video they couldn't already see
+	videoRole, err := cfg.videoRole(r.Context(), video, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check access to video", err)
+		return
+	}
+	if !cfg.enforce(w, r, "Video", videoRole, actionView, auditCollection(auditCollectionItemAdd, collection.ID)) {
+		return
+	}
+	if video.UserID != collection.UserID {
+		cfg.audit(r, auditDenied(auditCollection(auditCollectionItemAdd, collection.ID)))
+		respondWithError(w, http.StatusForbidden, "Only the collection owner's videos can be added to it", nil)
+		return
+	}
+
+	err = cfg.db.AddCollectionItem(r.Context(), collection.ID, video.ID, placement)
+	if !cfg.respondToItemError(w, err) {
+		return
+	}
+
+	event := auditCollection(auditCollectionItemAdd, collection.ID)
+	event.Details = map[string]any{"video_id": video.ID}
+	cfg.audit(r, event)
+
+	cfg.respondWithCollection(w, r, http.StatusOK, collection.ID)
+}
+
+// handlerCollectionItemMove moves a video to just before or after another
+// one in the collection, or to the end when neither is given
+func (cfg *apiConfig) handlerCollectionItemMove(w http.ResponseWriter, r *http.Request) {
+	collection, _, ok := cfg.authorizeCollection(w, r, actionEdit, auditCollectionItemMove)
+	if !ok {
+		return
+	}
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := collectionPlacementParams{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	placement, err := params.placement()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	err = cfg.db.MoveCollectionItem(r.Context(), collection.ID, videoID, placement)
+	if !cfg.respondToItemError(w, err) {
+		return
+	}
+
+	event := auditCollection(auditCollectionItemMove, collection.ID)
+	event.Details = map[string]any{"video_id": videoID}
+	cfg.audit(r, event)
+
+	cfg.respondWithCollection(w, r, http.StatusOK, collection.ID)
+}
+
+// handlerCollectionItemRemove takes a video out of the collection without deleting it
+func (cfg *apiConfig) handlerCollectionItemRemove(w http.ResponseWriter, r *http.Request) {
+	collection, _, ok := cfg.authorizeCollection(w, r, actionEdit, auditCollectionItemRemove)
+	if !ok {
+		return
+	}
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	err = cfg.db.RemoveCollectionItem(r.Context(), collection.ID, videoID)
+	if !cfg.respondToItemError(w, err) {
+		return
+	}
+
+	event := auditCollection(auditCollectionItemRemove, collection.ID)
+	event.Details = map[string]any{"video_id": videoID}
+	cfg.audit(r, event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondToItemError writes the response for a failed item change and
+// reports whether the change succeeded
+func (cfg *apiConfig) respondToItemError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, database.ErrInvalidPlacement):
+		respondWithError(w, http.StatusBadRequest, "before_id or after_id must be another video in this collection", err)
+	case errors.Is(err, database.ErrNotFound):
+		respondWithError(w, http.StatusNotFound, "Video is not in this collection", err)
+	default:
+		respondWithDBError(w, "Collection", err)
+	}
+	return false
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxCommentLength = 5000
+
+// commentThread is a top-level comment with its replies, oldest first
+type commentThread struct {
+	database.Comment
+	Replies []database.Comment `json:"replies"`
+}
+
+// validateCommentBody trims a comment or note and checks its length
+func validateCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", errors.New("body is required")
+	}
+	if len([]rune(body)) > maxCommentLength {
+		return "", fmt.Errorf("body must be at most %d characters", maxCommentLength)
+	}
+	return body, nil
+}
+
+// validateAtSeconds checks a timestamp falls within the video, when its
+// duration is known
+func validateAtSeconds(atSeconds *float64, video database.Video) error {
+	if atSeconds == nil {
+		return nil
+	}
+	if *atSeconds < 0 {
+		return errors.New("at_seconds must be zero or more")
+	}
+	if video.DurationSeconds != nil && *atSeconds > *video.DurationSeconds {
+		return fmt.Errorf("at_seconds must be within the video (%.1f seconds long)", *video.DurationSeconds)
+	}
+	return nil
+}
+
+// handlerCommentsList returns the video's comment threads, ordered by where
+// they are in the video; comments without a timestamp come last. Filter with
+// ?resolved=true|false.
+func (cfg *apiConfig) handlerCommentsList(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.authorizeVideo(w, r, actionView, "")
+	if !ok {
+		return
+	}
+
+	var resolved *bool
+	if value := r.URL.Query().Get("resolved"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "resolved must be true or false", err)
+			return
+		}
+		resolved = &b
+	}
+
+	comments, err := cfg.db.ListVideoComments(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list comments", err)
+		return
+	}
+
+	threads := []commentThread{}
+	index := map[uuid.UUID]int{}
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			index[comment.ID] = len(threads)
+			threads = append(threads, commentThread{Comment: comment, Replies: []database.Comment{}})
+		}
+	}
+	for _, comment := range comments {
+		if comment.ParentID != nil {
+			if i, ok := index[*comment.ParentID]; ok {
+				threads[i].Replies = append(threads[i].Replies, comment)
+			}
+		}
+	}
+	if resolved != nil {
+		filtered := []commentThread{}
+		for _, thread := range threads {
+			if (thread.ResolvedAt != nil) == *resolved {
+				filtered = append(filtered, thread)
+			}
+		}
+		threads = filtered
+	}
+	sort.SliceStable(threads, func(i, j int) bool {
+		a, b := threads[i].AtSeconds, threads[j].AtSeconds
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return *a < *b
+	})
+
+	respondWithJSON(w, http.StatusOK, threads)
+}
+
+// handlerCommentCreate adds a comment, or a reply when parent_id is set.
+// Replying to a reply answers its thread.
+func (cfg *apiConfig) handlerCommentCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body      string     `json:"body"`
+		AtSeconds *float64   `json:"at_seconds"`
+		ParentID  *uuid.UUID `json:"parent_id"`
+	}
+
+	video, _, ok := cfg.authorizeVideo(w, r, actionComment, auditCommentCreate)
+	if !ok {
+		return
+	}
+	userID, _ := GetUserIDFromContext(r.Context())
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	body, err := validateCommentBody(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if err := validateAtSeconds(params.AtSeconds, video); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	parentID := params.ParentID
+	if parentID != nil {
+		if params.AtSeconds != nil {
+			respondWithError(w, http.StatusBadRequest, "Replies can't have at_seconds", nil)
+			return
+		}
+		parent, err := cfg.db.GetComment(r.Context(), *parentID)
+		if err == nil && parent.VideoID != video.ID {
+			err = database.ErrNotFound
+		}
+		if err != nil {
+			respondWithDBError(w, "Comment", err)
+			return
+		}
+		if parent.ParentID != nil {
+			parentID = parent.ParentID
+		}
+	}
+
+	comment, err := cfg.db.CreateComment(r.Context(), database.CreateCommentParams{
+		VideoID:   video.ID,
+		UserID:    userID,
+		ParentID:  parentID,
+		Body:      body,
+		AtSeconds: params.AtSeconds,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create comment", err)
+		return
+	}
+
+	event := auditComment(auditCommentCreate, comment.ID)
+	event.Details = map[string]any{"video_id": video.ID, "parent_id": comment.ParentID}
+	cfg.audit(r, event)
+
+	respondWithJSON(w, http.StatusCreated, comment)
+}
+
+// videoComment loads the comment named in the path, which must be on video
+func (cfg *apiConfig) videoComment(w http.ResponseWriter, r *http.Request, video database.Video) (database.Comment, bool) {
+	commentID, err := uuid.Parse(r.PathValue("commentID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid comment ID", err)
+		return database.Comment{}, false
+	}
+	comment, err := cfg.db.GetComment(r.Context(), commentID)
+	if err == nil && comment.VideoID != video.ID {
+		err = database.ErrNotFound
+	}
+	if err != nil {
+		respondWithDBError(w, "Comment", err)
+		return database.Comment{}, false
+	}
+	return comment, true
+}
+
+// handlerCommentUpdate lets the author change what their comment says
+func (cfg *apiConfig) handlerCommentUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body      string   `json:"body"`
+		AtSeconds *float64 `json:"at_seconds"`
+	}
+
+	video, _, ok := cfg.authorizeVideo(w, r, actionComment, auditCommentUpdate)
+	if !ok {
+		return
+	}
+	comment, ok := cfg.videoComment(w, r, video)
+	if !ok {
+		return
+	}
+	if !cfg.authorizeComment(w, r, comment, false, auditComment(auditCommentUpdate, comment.ID)) {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	body, err := validateCommentBody(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if err := validateAtSeconds(params.AtSeconds, video); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if comment.ParentID != nil && params.AtSeconds != nil {
+		respondWithError(w, http.StatusBadRequest, "Replies can't have at_seconds", nil)
+		return
+	}
+
+	if err := cfg.db.UpdateComment(r.Context(), comment.ID, body, params.AtSeconds); err != nil {
+		respondWithDBError(w, "Comment", err)
+		return
+	}
+	cfg.audit(r, auditComment(auditCommentUpdate, comment.ID))
+
+	comment, err = cfg.db.GetComment(r.Context(), comment.ID)
+	if err != nil {
+		respondWithDBError(w, "Comment", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, comment)
+}
+
+// handlerCommentDelete deletes a comment and its replies. Authors may delete
+// their own comments, and owners any comment on their videos.
+func (cfg *apiConfig) handlerCommentDelete(w http.ResponseWriter, r *http.Request) {
+	video, role, ok := cfg.authorizeVideo(w, r, actionComment, auditCommentDelete)
+	if !ok {
+		return
+	}
+	comment, ok := cfg.videoComment(w, r, video)
+	if !ok {
+		return
+	}
+	if !cfg.authorizeComment(w, r, comment, role == roleOwner, auditComment(auditCommentDelete, comment.ID)) {
+		return
+	}
+
+	if err := cfg.db.DeleteComment(r.Context(), comment.ID); err != nil {
+		respondWithDBError(w, "Comment", err)
+		return
+	}
+	event := auditComment(auditCommentDelete, comment.ID)
+	event.Details = map[string]any{"video_id": video.ID, "author_id": comment.UserID}
+	cfg.audit(r, event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerCommentResolve(w http.ResponseWriter, r *http.Request) {
+	cfg.setCommentResolved(w, r, true)
+}
+
+func (cfg *apiConfig) handlerCommentUnresolve(w http.ResponseWriter, r *http.Request) {
+	cfg.setCommentResolved(w, r, false)
+}
+
+// setCommentResolved resolves or reopens a thread. Its author may, and so may
+// anyone who can edit the video.
+func (cfg *apiConfig) setCommentResolved(w http.ResponseWriter, r *http.Request, resolved bool) {
+	action := auditCommentUnresolve
+	if resolved {
+		action = auditCommentResolve
+	}
+
+	video, role, ok := cfg.authorizeVideo(w, r, actionComment, action)
+	if !ok {
+		return
+	}
+	userID, _ := GetUserIDFromContext(r.Context())
+	comment, ok := cfg.videoComment(w, r, video)
+	if !ok {
+		return
+	}
+	if !cfg.authorizeComment(w, r, comment, allows(role, actionEdit), auditComment(action, comment.ID)) {
+		return
+	}
+	if comment.ParentID != nil {
+		respondWithError(w, http.StatusBadRequest, "Only top-level comments can be resolved", nil)
+		return
+	}
+
+	var resolvedBy *uuid.UUID
+	if resolved {
+		resolvedBy = &userID
+	}
+	if err := cfg.db.SetCommentResolved(r.Context(), comment.ID, resolvedBy); err != nil {
+		respondWithDBError(w, "Comment", err)
+		return
+	}
+	cfg.audit(r, auditComment(action, comment.ID))
+
+	comment, err := cfg.db.GetComment(r.Context(), comment.ID)
+	if err != nil {
+		respondWithDBError(w, "Comment", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, comment)
+}
+
+// handlerCommentFeed lists comments other people left on the caller's videos,
+// newest first. ?since= (RFC 3339) returns only newer ones; page with ?limit=
+// and ?offset=.
+func (cfg *apiConfig) handlerCommentFeed(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Comments []database.FeedComment `json:"comments"`
+		Limit    int                    `json:"limit"`
+		Offset   int                    `json:"offset"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	query := r.URL.Query()
+	params := database.CommentFeedParams{OwnerID: userID}
+	if value := query.Get("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp", err)
+			return
+		}
+		params.Since = &since
+	}
+	limit, err := queryInt(query, "limit", 50)
+	if err != nil || limit < 1 || limit > 200 {
+		respondWithError(w, http.StatusBadRequest, "limit must be between 1 and 200", err)
+		return
+	}
+	offset, err := queryInt(query, "offset", 0)
+	if err != nil || offset < 0 {
+		respondWithError(w, http.StatusBadRequest, "offset must be a positive number", err)
+		return
+	}
+	params.Limit, params.Offset = limit, offset
+
+	comments, err := cfg.db.ListCommentFeed(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list comments", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{Comments: comments, Limit: limit, Offset: offset})
+}
@@ -2,40 +2,17 @@ package main
 
 import (
 	"net/http"
-
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
-	"github.com/google/uuid"
+	"time"
 )
 
 // handlerDeleteThumbnail removes only the thumbnail from a video
 func (cfg *apiConfig) handlerDeleteThumbnail(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
-		return
-	}
-
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
-	}
-
-	video, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
-		return
-	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "You don't own this video", nil)
+	video, _, ok := cfg.authorizeVideo(w, r, actionEdit, auditThumbnailDelete)
+	if !ok {
 		return
 	}
+	videoID := video.ID
+	hadFile := video.ThumbnailURL != nil
 
 	// Delete from storage if exists
 	if video.ThumbnailURL != nil && *video.ThumbnailURL != "" {
@@ -45,11 +22,17 @@ func (cfg *apiConfig) handlerDeleteThumbnail(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Update video record
+	video.UpdatedAt = time.Now()
 	video.ThumbnailURL = nil
-	if err := cfg.db.UpdateVideo(video); err != nil {
+	video.ThumbnailSize = 0
+	if err := cfg.db.UpdateVideo(r.Context(), video); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
+	cfg.audit(r, auditVideo(auditThumbnailDelete, videoID))
+	if hadFile {
+		cfg.emitVideoEvent(r, webhookEventVideoUpdated, newWebhookVideo(video), []string{"thumbnail"})
+	}
 
 	respondWithJSON(w, http.StatusOK, map[string]string{
 		"message": "Thumbnail deleted successfully",
@@ -58,49 +41,69 @@ func (cfg *apiConfig) handlerDeleteThumbnail(w http.ResponseWriter, r *http.Requ
 
 // handlerDeleteVideoFile removes only the video file (keeps metadata and thumbnail)
 func (cfg *apiConfig) handlerDeleteVideoFile(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+	video, _, ok := cfg.authorizeVideo(w, r, actionEdit, auditVideoFileDelete)
+	if !ok {
 		return
 	}
+	videoID := video.ID
+	hadFile := video.VideoURL != nil
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
+	// Delete from storage if exists
+	if video.VideoURL != nil && *video.VideoURL != "" {
+		if err := cfg.storage.DeleteFile(*video.VideoURL); err != nil {
+			// Log error but continue - file might not exist
+		}
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+	// Update video record
+	video.UpdatedAt = time.Now()
+	video.VideoURL = nil
+	video.VideoSize = 0
+	video.DurationSeconds = nil
+	video.AspectRatio = nil
+	if err := cfg.db.UpdateVideo(r.Context(), video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "You don't own this video", nil)
+	cfg.audit(r, auditVideo(auditVideoFileDelete, videoID))
+	if hadFile {
+		cfg.emitVideoEvent(r, webhookEventVideoUpdated, newWebhookVideo(video), []string{"video"})
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Video file deleted successfully",
+	})
+}
+
+// handlerDeleteCaptions removes only the captions file from a video
+func (cfg *apiConfig) handlerDeleteCaptions(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.authorizeVideo(w, r, actionEdit, auditCaptionsDelete)
+	if !ok {
 		return
 	}
+	videoID := video.ID
+	hadFile := video.CaptionsURL != nil
 
 	// Delete from storage if exists
-	if video.VideoURL != nil && *video.VideoURL != "" {
-		if err := cfg.storage.DeleteFile(*video.VideoURL); err != nil {
+	if video.CaptionsURL != nil && *video.CaptionsURL != "" {
+		if err := cfg.storage.DeleteFile(*video.CaptionsURL); err != nil {
 			// Log error but continue - file might not exist
 		}
 	}
 
 	// Update video record
-	video.VideoURL = nil
-	if err := cfg.db.UpdateVideo(video); err != nil {
+	video.UpdatedAt = time.Now()
+	video.CaptionsURL = nil
+	if err := cfg.db.UpdateVideo(r.Context(), video); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
+	cfg.audit(r, auditVideo(auditCaptionsDelete, videoID))
+	if hadFile {
+		cfg.emitVideoEvent(r, webhookEventVideoUpdated, newWebhookVideo(video), []string{"captions"})
+	}
 
 	respondWithJSON(w, http.StatusOK, map[string]string{
-		"message": "Video file deleted successfully",
+		"message": "Captions deleted successfully",
 	})
 }
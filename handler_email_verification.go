@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	emailVerificationExpiry = 24 * time.Hour
+	emailChangeExpiry       = time.Hour
+)
+
+// sendVerificationEmail emails the user a signed link confirming their current address
+func (cfg *apiConfig) sendVerificationEmail(user database.User) error {
+	token, err := auth.MakeEmailToken(user.ID, user.Email, "", auth.TokenTypeEmailVerification, cfg.jwtKeys, emailVerificationExpiry)
+	if err != nil {
+		return err
+	}
+
+	cfg.sendEmail(user.Email, "verify_email", map[string]string{
+		"Name":      user.FullName,
+		"Email":     user.Email,
+		"Link":      cfg.publicLink("/app/", url.Values{"verify_token": {token}}),
+		"ExpiresIn": "24 hours",
+	})
+	return nil
+}
+
+// handlerVerifyEmail confirms the address a verification link was sent to
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	userID, claims, err := auth.ValidateEmailToken(params.Token, auth.TokenTypeEmailVerification, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification link", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification link", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+	// The link is only valid for the address it was sent to
+	if user.Email != claims.Email {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification link", nil)
+		return
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := cfg.db.MarkUserEmailVerified(r.Context(), user.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+			return
+		}
+
+		event := auditUser(auditUserEmailVerify, user.ID)
+		event.ActorID = &user.ID
+		cfg.audit(r, event)
+	}
+	cfg.claimGrants(r, user.ID, user.Email)
+
+	respondWithSuccess(w, http.StatusOK, "Your email address has been verified.", nil)
+}
+
+// handlerResendVerification sends a fresh verification link to the caller
+func (cfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, "User", err)
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		respondWithError(w, http.StatusBadRequest, "Email is already verified", nil)
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(*user); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create verification link", err)
+		return
+	}
+
+	respondWithSuccess(w, http.StatusAccepted, "A verification link has been sent to "+user.Email+".", nil)
+}
+
+// handlerChangeEmail starts an email change by sending a confirmation link to the new address
+func (cfg *apiConfig) handlerChangeEmail(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		NewEmail string `json:"new_email"`
+		Password string `json:"password"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	newEmail, err := validateEmail(params.NewEmail)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, "User", err)
+		return
+	}
+
+	// Require the current password so a stolen access token can't take over the account
+	match, err := auth.CheckPasswordHash(params.Password, user.Password)
+	if err != nil || !match {
+		respondWithError(w, http.StatusUnauthorized, "Incorrect password", err)
+		return
+	}
+
+	if strings.EqualFold(newEmail, user.Email) {
+		respondWithError(w, http.StatusBadRequest, "New email is the same as the current one", nil)
+		return
+	}
+
+	_, err = cfg.db.GetUserByEmail(r.Context(), newEmail)
+	if err == nil {
+		respondWithError(w, http.StatusConflict, "Email is already in use", nil)
+		return
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	token, err := auth.MakeEmailToken(user.ID, newEmail, user.Email, auth.TokenTypeEmailChange, cfg.jwtKeys, emailChangeExpiry)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create confirmation link", err)
+		return
+	}
+
+	cfg.sendEmail(newEmail, "email_change_confirm", map[string]string{
+		"Name":      user.FullName,
+		"Email":     newEmail,
+		"Link":      cfg.publicLink("/app/", url.Values{"email_change_token": {token}}),
+		"ExpiresIn": "1 hour",
+	})
+
+	respondWithSuccess(w, http.StatusAccepted, "A confirmation link has been sent to "+newEmail+".", nil)
+}
+
+// handlerConfirmEmailChange applies a pending email change and notifies the old address
+func (cfg *apiConfig) handlerConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	userID, claims, err := auth.ValidateEmailToken(params.Token, auth.TokenTypeEmailChange, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired confirmation link", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, "User", err)
+		return
+	}
+	// Reject links issued before a later email change
+	if user.Email != claims.PreviousEmail {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired confirmation link", nil)
+		return
+	}
+
+	_, err = cfg.db.GetUserByEmail(r.Context(), claims.Email)
+	if err == nil {
+		respondWithError(w, http.StatusConflict, "Email is already in use", nil)
+		return
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	if err := cfg.db.UpdateUserEmail(r.Context(), user.ID, claims.Email); err != nil {
+		respondWithDBError(w, "User", err)
+		return
+	}
+	cfg.claimGrants(r, user.ID, claims.Email)
+
+	event := auditUser(auditUserEmailChange, user.ID)
+	event.ActorID = &user.ID
+	event.Details = map[string]any{"previous_email": claims.PreviousEmail, "email": claims.Email}
+	cfg.audit(r, event)
+
+	cfg.sendEmail(claims.PreviousEmail, "email_changed", map[string]string{
+		"Name":          user.FullName,
+		"Email":         claims.Email,
+		"PreviousEmail": claims.PreviousEmail,
+	})
+
+	respondWithSuccess(w, http.StatusOK, "Your email address has been changed.", nil)
+}
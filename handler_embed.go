@@ -0,0 +1,266 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+//go:embed templates/*.html
+var pageTemplateFS embed.FS
+
+var pageTemplates = template.Must(template.ParseFS(pageTemplateFS, "templates/*.html"))
+
+const (
+	// sharePageURLExpiry is how long presigned URLs for the share and embed
+	// page players last. A page can't resolve again, so it has to cover
+	// watching.
+	sharePageURLExpiry = 2 * time.Hour
+
+	defaultEmbedWidth = 640
+)
+
+// sharePage is what the share and embed page templates render. Video only
+// has the thumbnail, for link previews; the player resolves the link for the
+// rest.
+type sharePage struct {
+	Video      sharedVideo
+	PageURL    string
+	EmbedURL   string
+	OEmbedURL  string
+	Embeddable bool
+	Width      int
+	Height     int
+	// ResolveURL is where the player's script, allowed by ScriptNonce, gets
+	// the video and captions, counting a view. EventsURL is where it reports
+	// playback for analytics.
+	ResolveURL  string
+	EventsURL   string
+	ScriptNonce string
+}
+
+// embedSize is the player size for a video with the given aspect ratio,
+// scaled down to fit maxWidth and maxHeight when they are set
+func embedSize(aspectRatio *string, maxWidth, maxHeight int) (int, int) {
+	width, height := defaultEmbedWidth, defaultEmbedWidth*9/16
+	if aspectRatio != nil && *aspectRatio == "9:16" {
+		width, height = defaultEmbedWidth*9/16, defaultEmbedWidth
+	}
+	if maxWidth > 0 && width > maxWidth {
+		width, height = maxWidth, height*maxWidth/width
+	}
+	if maxHeight > 0 && height > maxHeight {
+		width, height = width*maxHeight/height, maxHeight
+	}
+	return width, height
+}
+
+// pageSecurityPolicy is the Content-Security-Policy for a share or embed page.
+// frameAncestors decides who may show the page in an iframe. The page's
+// player script is the only script allowed to run, and only to resolve the
+// link and report to its events URL.
+func pageSecurityPolicy(frameAncestors []string, page sharePage) string {
+	ancestors := "'none'"
+	if len(frameAncestors) > 0 {
+		ancestors = strings.Join(frameAncestors, " ")
+	}
+	policy := "default-src 'none'; img-src * data:; media-src *; style-src 'unsafe-inline'; base-uri 'none'; frame-ancestors " + ancestors
+	if page.ScriptNonce != "" {
+		policy += "; script-src 'nonce-" + page.ScriptNonce + "'; connect-src " + page.ResolveURL + " " + page.EventsURL
+	}
+	return policy
+}
+
+func renderPage(w http.ResponseWriter, code int, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := pageTemplates.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("%s[ERROR]%s couldn't render %s: %v", colorRed, colorReset, name, err)
+	}
+}
+
+func renderPageError(w http.ResponseWriter, code int, message string, err error) {
+	if err != nil {
+		log.Printf("%s[ERROR]%s %s: %v", colorRed, colorReset, message, err)
+	}
+	renderPage(w, code, "share_error.html", message)
+}
+
+// openSharePage looks up the share link in the path for the share or embed
+// page. Serving the page doesn't count a view, so link previews don't use up
+// max_views; the player counts one when it resolves the link. Pages can't
+// send a password, so only unprotected video links open. The link is
+// returned whenever it was found, even if it couldn't be opened.
+func (cfg *apiConfig) openSharePage(r *http.Request) (database.ShareLink, sharePage, *shareLinkFailure) {
+	link, fail := cfg.usableShareLink(r, r.PathValue("token"))
+	if fail != nil {
+		return database.ShareLink{}, sharePage{}, fail
+	}
+	if link.VideoID == nil {
+		cfg.auditShareAccessFailure(r, link, "not_a_video")
+		return link, sharePage{}, &shareLinkFailure{code: http.StatusNotFound, message: "Only video share links have a player page"}
+	}
+	if link.PasswordHash != nil {
+		cfg.auditShareAccessFailure(r, link, "password_required")
+		return link, sharePage{}, &shareLinkFailure{code: http.StatusUnauthorized, message: "This video is password protected. Open it in the Vaultstream app."}
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), *link.VideoID)
+	if err != nil {
+		return link, sharePage{}, &shareLinkFailure{code: http.StatusInternalServerError, message: "Couldn't retrieve video", err: err}
+	}
+	shared, err := cfg.sharedVideo(video, shareLinkURLExpiry(link, sharePageURLExpiry, time.Now()))
+	if err != nil {
+		return link, sharePage{}, &shareLinkFailure{code: http.StatusInternalServerError, message: "Couldn't generate presigned URL", err: err}
+	}
+	shared.VideoURL, shared.CaptionsURL = nil, nil
+
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		return link, sharePage{}, &shareLinkFailure{code: http.StatusInternalServerError, message: "Couldn't render page", err: err}
+	}
+
+	width, height := embedSize(video.AspectRatio, 0, 0)
+	pageURL := cfg.publicLink("/s/"+link.Token, nil)
+	return link, sharePage{
+		Video:       shared,
+		PageURL:     pageURL,
+		EmbedURL:    cfg.publicLink("/embed/"+link.Token, nil),
+		OEmbedURL:   cfg.publicLink("/oembed", url.Values{"url": {pageURL}, "format": {"json"}}),
+		Embeddable:  len(link.EmbedOrigins) > 0,
+		Width:       width,
+		Height:      height,
+		ResolveURL:  cfg.publicLink("/api/public/shares/"+link.Token, nil),
+		EventsURL:   cfg.publicLink("/api/public/shares/"+link.Token+"/events", nil),
+		ScriptNonce: nonce,
+	}, nil
+}
+
+// handlerSharePage is the public web page for a video share link, with Open
+// Graph and Twitter tags so the link previews well when pasted elsewhere
+func (cfg *apiConfig) handlerSharePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+
+	_, page, fail := cfg.openSharePage(r)
+	w.Header().Set("Content-Security-Policy", pageSecurityPolicy(nil, page))
+	if fail != nil {
+		renderPageError(w, fail.code, fail.message, fail.err)
+		return
+	}
+	renderPage(w, http.StatusOK, "share.html", page)
+}
+
+// handlerEmbedPage is the bare player for a video share link, meant for an
+// iframe. Only the link's embed origins may frame it.
+func (cfg *apiConfig) handlerEmbedPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	link, page, fail := cfg.openSharePage(r)
+	w.Header().Set("Content-Security-Policy", pageSecurityPolicy(link.EmbedOrigins, page))
+	if fail != nil {
+		renderPageError(w, fail.code, fail.message, fail.err)
+		return
+	}
+	renderPage(w, http.StatusOK, "embed.html", page)
+}
+
+// handlerOEmbed describes a share page to oEmbed consumers, such as chat apps
+// unfurling a pasted link. It reveals only the title and player size, so it
+// doesn't count as a view.
+func (cfg *apiConfig) handlerOEmbed(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Type         string `json:"type"`
+		Version      string `json:"version"`
+		Title        string `json:"title"`
+		ProviderName string `json:"provider_name"`
+		ProviderURL  string `json:"provider_url"`
+		HTML         string `json:"html"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+	}
+
+	query := r.URL.Query()
+	if format := query.Get("format"); format != "" && format != "json" {
+		respondWithError(w, http.StatusNotImplemented, "Only the json format is supported", nil)
+		return
+	}
+	maxWidth, _ := strconv.Atoi(query.Get("maxwidth"))
+	maxHeight, _ := strconv.Atoi(query.Get("maxheight"))
+
+	token, ok := cfg.sharePageToken(query.Get("url"))
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Not a Vaultstream share page", nil)
+		return
+	}
+	link, fail := cfg.usableShareLink(r, token)
+	if fail != nil {
+		respondWithError(w, fail.code, fail.message, fail.err)
+		return
+	}
+	if link.VideoID == nil {
+		respondWithError(w, http.StatusNotFound, "Only video share links can be embedded", nil)
+		return
+	}
+	if link.PasswordHash != nil {
+		respondWithError(w, http.StatusUnauthorized, "This video is password protected", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), *link.VideoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Share link not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve video", err)
+		return
+	}
+
+	width, height := embedSize(video.AspectRatio, maxWidth, maxHeight)
+	embedURL := cfg.publicLink("/embed/"+link.Token, nil)
+	respondWithJSON(w, http.StatusOK, response{
+		Type:         "video",
+		Version:      "1.0",
+		Title:        video.Title,
+		ProviderName: "Vaultstream",
+		ProviderURL:  cfg.publicLink("/", nil),
+		HTML: fmt.Sprintf(
+			`<iframe src="%s" width="%d" height="%d" title="%s" frameborder="0" allow="fullscreen; picture-in-picture" allowfullscreen></iframe>`,
+			html.EscapeString(embedURL), width, height, html.EscapeString(video.Title),
+		),
+		Width:  width,
+		Height: height,
+	})
+}
+
+// sharePageToken extracts the token from the URL of a share or embed page on
+// this server
+func (cfg *apiConfig) sharePageToken(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	base, err := url.Parse(cfg.publicBaseURL)
+	if err != nil || !strings.EqualFold(u.Host, base.Host) {
+		return "", false
+	}
+	path := strings.TrimPrefix(u.Path, strings.TrimSuffix(base.Path, "/"))
+	for _, prefix := range []string{"/s/", "/embed/"} {
+		if token, ok := strings.CutPrefix(path, prefix); ok && token != "" && !strings.Contains(token, "/") {
+			return token, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// grantTarget is the video or collection a grant request is about
+type grantTarget struct {
+	Kind         string // "video" or "collection"
+	Title        string
+	OwnerID      uuid.UUID
+	VideoID      *uuid.UUID
+	CollectionID *uuid.UUID
+}
+
+func videoGrantTarget(video database.Video) grantTarget {
+	return grantTarget{Kind: "video", Title: video.Title, OwnerID: video.UserID, VideoID: &video.ID}
+}
+
+func collectionGrantTarget(collection database.Collection) grantTarget {
+	return grantTarget{Kind: "collection", Title: collection.Title, OwnerID: collection.UserID, CollectionID: &collection.ID}
+}
+
+func (t grantTarget) holds(grant database.Grant) bool {
+	if t.VideoID != nil {
+		return grant.VideoID != nil && *grant.VideoID == *t.VideoID
+	}
+	return grant.CollectionID != nil && *grant.CollectionID == *t.CollectionID
+}
+
+func isGrantRole(role string) bool {
+	return database.GrantRoleRank(role) > 0
+}
+
+func (cfg *apiConfig) handlerVideoGrantsList(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.authorizeVideo(w, r, actionManage, "")
+	if !ok {
+		return
+	}
+	grants, err := cfg.db.ListVideoGrants(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list grants", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, grants)
+}
+
+func (cfg *apiConfig) handlerVideoGrantCreate(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.authorizeVideo(w, r, actionManage, auditGrantCreate)
+	if !ok {
+		return
+	}
+	cfg.upsertGrant(w, r, videoGrantTarget(video))
+}
+
+func (cfg *apiConfig) handlerVideoGrantDelete(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.authorizeVideo(w, r, actionManage, auditGrantDelete)
+	if !ok {
+		return
+	}
+	cfg.deleteGrant(w, r, videoGrantTarget(video))
+}
+
+func (cfg *apiConfig) handlerCollectionGrantsList(w http.ResponseWriter, r *http.Request) {
+	collection, _, ok := cfg.authorizeCollection(w, r, actionManage, "")
+	if !ok {
+		return
+	}
+	grants, err := cfg.db.ListCollectionGrants(r.Context(), collection.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list grants", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, grants)
+}
+
+func (cfg *apiConfig) handlerCollectionGrantCreate(w http.ResponseWriter, r *http.Request) {
+	collection, _, ok := cfg.authorizeCollection(w, r, actionManage, auditGrantCreate)
+	if !ok {
+		return
+	}
+	cfg.upsertGrant(w, r, collectionGrantTarget(collection))
+}
+
+func (cfg *apiConfig) handlerCollectionGrantDelete(w http.ResponseWriter, r *http.Request) {
+	collection, _, ok := cfg.authorizeCollection(w, r, actionManage, auditGrantDelete)
+	if !ok {
+		return
+	}
+	cfg.deleteGrant(w, r, collectionGrantTarget(collection))
+}
+
+// upsertGrant shares the target with the user or email address in the body,
+// or changes their role if it is already shared with them. New grantees are
+// emailed, including people who don't have an account yet.
+func (cfg *apiConfig) upsertGrant(w http.ResponseWriter, r *http.Request, target grantTarget) {
+	type parameters struct {
+		Email  string     `json:"email"`
+		UserID *uuid.UUID `json:"user_id"`
+		Role   string     `json:"role"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if !isGrantRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, "role must be viewer, commenter or editor", nil)
+		return
+	}
+	if (params.Email == "") == (params.UserID == nil) {
+		respondWithError(w, http.StatusBadRequest, "Set exactly one of email and user_id", nil)
+		return
+	}
+
+	upsertParams := database.UpsertGrantParams{
+		OwnerID:      target.OwnerID,
+		VideoID:      target.VideoID,
+		CollectionID: target.CollectionID,
+		Role:         params.Role,
+	}
+	if params.UserID != nil {
+		grantee, err := cfg.db.GetUser(r.Context(), *params.UserID)
+		if err != nil {
+			respondWithDBError(w, "User", err)
+			return
+		}
+		upsertParams.GranteeEmail = grantee.Email
+		upsertParams.GranteeUserID = &grantee.ID
+	} else {
+		email, err := validateEmail(params.Email)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid email address", err)
+			return
+		}
+		upsertParams.GranteeEmail = email
+
+		// An existing account only gets the grant now if it has proven it owns
+		// the address; otherwise it is claimed on verification
+		grantee, err := cfg.db.GetUserByEmail(r.Context(), email)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't look up user", err)
+			return
+		}
+		if err == nil && (grantee.EmailVerifiedAt != nil || !cfg.requireEmailVerification) {
+			upsertParams.GranteeUserID = &grantee.ID
+		}
+	}
+	if upsertParams.GranteeUserID != nil && *upsertParams.GranteeUserID == target.OwnerID {
+		respondWithError(w, http.StatusBadRequest, "You can't share with yourself", nil)
+		return
+	}
+
+	grant, created, err := cfg.db.UpsertGrant(r.Context(), upsertParams)
+	if err != nil {
+		respondWithDBError(w, "Grant", err)
+		return
+	}
+
+	action, code := auditGrantUpdate, http.StatusOK
+	if created {
+		action, code = auditGrantCreate, http.StatusCreated
+	}
+	event := auditGrant(action, grant.ID)
+	event.Details = map[string]any{
+		"video_id":      grant.VideoID,
+		"collection_id": grant.CollectionID,
+		"grantee_email": grant.GranteeEmail,
+		"role":          grant.Role,
+	}
+	cfg.audit(r, event)
+
+	if created {
+		cfg.notifyGrantee(r, grant, target)
+	}
+
+	respondWithJSON(w, code, grant)
+}
+
+// notifyGrantee emails the grantee that something was shared with them
+func (cfg *apiConfig) notifyGrantee(r *http.Request, grant database.Grant, target grantTarget) {
+	owner, err := cfg.db.GetUser(r.Context(), target.OwnerID)
+	if err != nil {
+		log.Printf("%s[ERROR]%s couldn't load owner for share notification: %v", colorRed, colorReset, err)
+		return
+	}
+	cfg.sendEmail(grant.GranteeEmail, "shared_with_you", map[string]any{
+		"OwnerName":    owner.FullName,
+		"Kind":         target.Kind,
+		"Title":        target.Title,
+		"Role":         grant.Role,
+		"Email":        grant.GranteeEmail,
+		"NeedsAccount": grant.GranteeUserID == nil,
+		"Link":         cfg.publicLink("/app/", nil),
+	})
+}
+
+// deleteGrant stops sharing the target with the grantee in the path
+func (cfg *apiConfig) deleteGrant(w http.ResponseWriter, r *http.Request, target grantTarget) {
+	grantID, err := uuid.Parse(r.PathValue("grantID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid grant ID", err)
+		return
+	}
+
+	grant, err := cfg.db.GetGrant(r.Context(), grantID)
+	if err == nil && !target.holds(grant) {
+		err = database.ErrNotFound
+	}
+	if err != nil {
+		respondWithDBError(w, "Grant", err)
+		return
+	}
+
+	if err := cfg.db.DeleteGrant(r.Context(), grantID); err != nil {
+		respondWithDBError(w, "Grant", err)
+		return
+	}
+	event := auditGrant(auditGrantDelete, grantID)
+	event.Details = map[string]any{
+		"video_id":      grant.VideoID,
+		"collection_id": grant.CollectionID,
+		"grantee_email": grant.GranteeEmail,
+	}
+	cfg.audit(r, event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// claimGrants gives the user what was shared with their address before they
+// had proven they own it. Failures are logged; the grants stay claimable.
+func (cfg *apiConfig) claimGrants(r *http.Request, userID uuid.UUID, email string) {
+	if err := cfg.db.ClaimGrants(r.Context(), userID, email); err != nil {
+		log.Printf("%s[ERROR]%s couldn't claim grants for %s: %v", colorRed, colorReset, userID, err)
+	}
+}
+
+// handlerSharedWithMe lists the videos and collections other users have
+// shared with the caller, newest first, with the caller's role on each
+func (cfg *apiConfig) handlerSharedWithMe(w http.ResponseWriter, r *http.Request) {
+	type sharedVideo struct {
+		GrantID  uuid.UUID      `json:"grant_id"`
+		Role     string         `json:"role"`
+		SharedAt time.Time      `json:"shared_at"`
+		Video    database.Video `json:"video"`
+	}
+	type sharedCollection struct {
+		GrantID    uuid.UUID           `json:"grant_id"`
+		Role       string              `json:"role"`
+		SharedAt   time.Time           `json:"shared_at"`
+		Collection database.Collection `json:"collection"`
+	}
+	type response struct {
+		Videos      []sharedVideo      `json:"videos"`
+		Collections []sharedCollection `json:"collections"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	grants, err := cfg.db.ListGrantsForUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list shared items", err)
+		return
+	}
+
+	resp := response{Videos: []sharedVideo{}, Collections: []sharedCollection{}}
+	for _, grant := range grants {
+		if grant.VideoID != nil {
+			video, err := cfg.db.GetVideo(r.Context(), *grant.VideoID)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve shared video", err)
+				return
+			}
+			video, err = cfg.dbVideoToSignedVideo(video)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+				return
+			}
+			resp.Videos = append(resp.Videos, sharedVideo{GrantID: grant.ID, Role: grant.Role, SharedAt: grant.CreatedAt, Video: video})
+			continue
+		}
+
+		collection, err := cfg.db.GetCollection(r.Context(), *grant.CollectionID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve shared collection", err)
+			return
+		}
+		collection, err = cfg.signCollection(collection)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+			return
+		}
+		resp.Collections = append(resp.Collections, sharedCollection{GrantID: grant.ID, Role: grant.Role, SharedAt: grant.CreatedAt, Collection: collection})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
 )
 
+// dummyPasswordHash is an argon2id hash of a random password nobody knows,
+// with the same parameters as HashPassword, for logins to unknown emails
+const dummyPasswordHash = "$argon2id$v=19$m=65536,t=1,p=1$UvFPE23RDtXVSwqa68IpOA$AC8bkq/72yCUC7AnOwJE0KzNZrK+O3F6cXpHFvsuhx0"
+
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Password string `json:"password"`
@@ -28,51 +37,128 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByEmail(params.Email)
+	// Check lockouts before running argon2id so locked callers can't burn CPU
+	accountKey := loginAccountKey(params.Email)
+	ipKey := loginIPKey(cfg.clientIP(r))
+	retryAfter, err := cfg.checkThrottle(r.Context(), accountKey, ipKey)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+	if retryAfter > 0 {
+		cfg.audit(r, auditEvent{
+			Action:  auditLogin,
+			Outcome: database.AuditOutcomeDenied,
+			Details: map[string]any{"email": params.Email, "reason": "throttled"},
+		})
+		respondThrottled(w, retryAfter)
 		return
 	}
 
-	match, err := auth.CheckPasswordHash(params.Password, user.Password)
-	if err != nil {
+	// An unknown email is checked against dummyPasswordHash, so it takes as
+	// long as a wrong password, fails the same way and counts against the
+	// throttle
+	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+	passwordHash := user.Password
+	if errors.Is(err, database.ErrNotFound) {
+		passwordHash = dummyPasswordHash
+	}
+
+	match, err := auth.CheckPasswordHash(params.Password, passwordHash)
+	if err != nil || !match {
+		cfg.recordLoginFailure(r.Context(), accountKey, ipKey)
+		event := auditEvent{
+			Action:  auditLogin,
+			Outcome: database.AuditOutcomeFailure,
+			Details: map[string]any{"email": params.Email, "reason": "bad_credentials"},
+		}
+		if user.ID != uuid.Nil {
+			event.TargetType, event.TargetID = "user", user.ID.String()
+		}
+		cfg.audit(r, event)
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
-	if !match {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", nil)
+
+	if err := cfg.db.ClearAuthThrottle(r.Context(), accountKey); err != nil {
+		log.Printf("%s[ERROR]%s couldn't clear login throttle: %v", colorRed, colorReset, err)
+	}
+
+	if user.DisabledAt != nil {
+		cfg.auditLoginDenied(r, user.ID, "disabled")
+		respondWithError(w, http.StatusForbidden, "This account has been disabled", nil)
+		return
+	}
+	if user.PasswordResetRequired {
+		cfg.auditLoginDenied(r, user.ID, "password_reset_required")
+		respondWithError(w, http.StatusForbidden, "A password reset is required. Check your email for a reset link.", nil)
+		return
+	}
+
+	accessToken, refreshToken, err := cfg.issueSession(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create session", err)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
+	event := auditUser(auditLogin, user.ID)
+	event.ActorID = &user.ID
+	cfg.audit(r, event)
+
+	respondWithJSON(w, http.StatusOK, response{
+		User:         user,
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+	})
+}
+
+// issueSession creates a short-lived access token and a persisted refresh token for the user
+func (cfg *apiConfig) issueSession(ctx context.Context, userID uuid.UUID) (accessToken, refreshToken string, err error) {
+	accessToken, err = auth.MakeJWT(
+		userID,
+		cfg.jwtKeys,
 		time.Minute*15, // Short-lived access token (15 minutes)
 	)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
-		return
+		return "", "", fmt.Errorf("couldn't create access JWT: %w", err)
 	}
 
-	refreshToken, err := auth.MakeRefreshToken()
+	refreshToken, err = auth.MakeRefreshToken()
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
-		return
+		return "", "", fmt.Errorf("couldn't create refresh token: %w", err)
 	}
 
-	_, err = cfg.db.CreateRefreshToken(database.CreateRefreshTokenParams{
-		UserID:    user.ID,
+	_, err = cfg.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		UserID:    userID,
 		Token:     refreshToken,
 		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't save refresh token", err)
-		return
+		return "", "", fmt.Errorf("couldn't save refresh token: %w", err)
 	}
 
-	respondWithJSON(w, http.StatusOK, response{
-		User:         user,
-		Token:        accessToken,
-		RefreshToken: refreshToken,
-	})
+	return accessToken, refreshToken, nil
+}
+
+// recordLoginFailure counts a failed login against both the account and the caller's IP
+func (cfg *apiConfig) recordLoginFailure(ctx context.Context, accountKey, ipKey string) {
+	if err := cfg.recordThrottleFailure(ctx, accountKey, loginAccountPolicy); err != nil {
+		log.Printf("%s[ERROR]%s couldn't record login failure: %v", colorRed, colorReset, err)
+	}
+	if err := cfg.recordThrottleFailure(ctx, ipKey, loginIPPolicy); err != nil {
+		log.Printf("%s[ERROR]%s couldn't record login failure: %v", colorRed, colorReset, err)
+	}
+}
+
+// auditLoginDenied records a correct password that was refused because of account state
+func (cfg *apiConfig) auditLoginDenied(r *http.Request, userID uuid.UUID, reason string) {
+	event := auditUser(auditLogin, userID)
+	event.ActorID = &userID
+	event.Outcome = database.AuditOutcomeDenied
+	event.Details = map[string]any{"reason": reason}
+	cfg.audit(r, event)
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerNotesList returns the caller's private notes on a video, oldest first
+func (cfg *apiConfig) handlerNotesList(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.authorizeVideo(w, r, actionView, "")
+	if !ok {
+		return
+	}
+	userID, _ := GetUserIDFromContext(r.Context())
+
+	notes, err := cfg.db.ListNotes(r.Context(), video.ID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list notes", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, notes)
+}
+
+// handlerNoteCreate adds a private note to a video the caller can see
+func (cfg *apiConfig) handlerNoteCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body      string   `json:"body"`
+		AtSeconds *float64 `json:"at_seconds"`
+	}
+
+	video, _, ok := cfg.authorizeVideo(w, r, actionView, auditNoteCreate)
+	if !ok {
+		return
+	}
+	userID, _ := GetUserIDFromContext(r.Context())
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	body, err := validateCommentBody(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if err := validateAtSeconds(params.AtSeconds, video); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	note, err := cfg.db.CreateNote(r.Context(), database.CreateNoteParams{
+		VideoID:   video.ID,
+		UserID:    userID,
+		Body:      body,
+		AtSeconds: params.AtSeconds,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create note", err)
+		return
+	}
+	event := auditNote(auditNoteCreate, note.ID)
+	event.Details = map[string]any{"video_id": video.ID}
+	cfg.audit(r, event)
+
+	respondWithJSON(w, http.StatusCreated, note)
+}
+
+// videoNote loads the note named in the path. Notes are private, so anyone
+// but their author gets the same 404 as for a note that doesn't exist.
+func (cfg *apiConfig) videoNote(w http.ResponseWriter, r *http.Request, video database.Video, auditAction string) (database.Note, bool) {
+	userID, _ := GetUserIDFromContext(r.Context())
+	noteID, err := uuid.Parse(r.PathValue("noteID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid note ID", err)
+		return database.Note{}, false
+	}
+	note, err := cfg.db.GetNote(r.Context(), noteID)
+	if err == nil && note.VideoID != video.ID {
+		err = database.ErrNotFound
+	}
+	if err != nil {
+		respondWithDBError(w, "Note", err)
+		return database.Note{}, false
+	}
+	if !cfg.enforce(w, r, "Note", ownerRole(note.UserID, userID), actionManage, auditNote(auditAction, noteID)) {
+		return database.Note{}, false
+	}
+	return note, true
+}
+
+func (cfg *apiConfig) handlerNoteUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body      string   `json:"body"`
+		AtSeconds *float64 `json:"at_seconds"`
+	}
+
+	video, _, ok := cfg.authorizeVideo(w, r, actionView, auditNoteUpdate)
+	if !ok {
+		return
+	}
+	note, ok := cfg.videoNote(w, r, video, auditNoteUpdate)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	body, err := validateCommentBody(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if err := validateAtSeconds(params.AtSeconds, video); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if err := cfg.db.UpdateNote(r.Context(), note.ID, body, params.AtSeconds); err != nil {
+		respondWithDBError(w, "Note", err)
+		return
+	}
+	cfg.audit(r, auditNote(auditNoteUpdate, note.ID))
+
+	note, err = cfg.db.GetNote(r.Context(), note.ID)
+	if err != nil {
+		respondWithDBError(w, "Note", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, note)
+}
+
+func (cfg *apiConfig) handlerNoteDelete(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.authorizeVideo(w, r, actionView, auditNoteDelete)
+	if !ok {
+		return
+	}
+	note, ok := cfg.videoNote(w, r, video, auditNoteDelete)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.DeleteNote(r.Context(), note.ID); err != nil {
+		respondWithDBError(w, "Note", err)
+		return
+	}
+	cfg.audit(r, auditNote(auditNoteDelete, note.ID))
+
+	w.WriteHeader(http.StatusNoContent)
+}
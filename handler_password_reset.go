@@ -2,20 +2,22 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"net/url"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
-// handlerForgotPassword initiates the password reset process
-// In a real app, this would send an email with the reset link
+// handlerForgotPassword initiates the password reset process by emailing a reset link
 func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Email string `json:"email"`
 	}
 	type response struct {
 		Message string `json:"message"`
-		Token   string `json:"token,omitempty"` // Only for demo; in production, send via email
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -30,15 +32,46 @@ func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Find user by email
-	user, err := cfg.db.GetUserByEmail(params.Email)
+	// Every request counts towards the limit so reset emails can't be spammed
+	accountKey := forgotAccountKey(params.Email)
+	ipKey := forgotIPKey(cfg.clientIP(r))
+	retryAfter, err := cfg.checkThrottle(r.Context(), accountKey, ipKey)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Database error", err)
 		return
 	}
+	if retryAfter > 0 {
+		cfg.audit(r, auditEvent{
+			Action:  auditPasswordResetRequest,
+			Outcome: database.AuditOutcomeDenied,
+			Details: map[string]any{"email": params.Email, "reason": "throttled"},
+		})
+		respondThrottled(w, retryAfter)
+		return
+	}
+	if err := cfg.recordThrottleFailure(r.Context(), accountKey, forgotAccountPolicy); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+	if err := cfg.recordThrottleFailure(r.Context(), ipKey, forgotIPPolicy); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	// Find user by email
+	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
 
 	// Always return success to prevent email enumeration attacks
-	if user.ID.String() == "00000000-0000-0000-0000-000000000000" {
+	if errors.Is(err, database.ErrNotFound) {
+		cfg.audit(r, auditEvent{
+			Action:  auditPasswordResetRequest,
+			Outcome: database.AuditOutcomeFailure,
+			Details: map[string]any{"email": params.Email, "reason": "unknown_email"},
+		})
 		respondWithJSON(w, http.StatusOK, response{
 			Message: "If an account with that email exists, a password reset link has been sent.",
 		})
@@ -46,17 +79,21 @@ func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Create password reset token
-	resetToken, err := cfg.db.CreatePasswordResetToken(user.ID)
+	resetToken, err := cfg.db.CreatePasswordResetToken(r.Context(), user.ID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create reset token", err)
 		return
 	}
 
-	// In a real app, you would send this token via email
-	// For demo purposes, we return it in the response
+	cfg.sendEmail(user.Email, "password_reset", map[string]string{
+		"Name":      user.FullName,
+		"Link":      cfg.publicLink("/app/", url.Values{"reset_token": {resetToken.Token}}),
+		"ExpiresIn": "1 hour",
+	})
+	cfg.audit(r, auditUser(auditPasswordResetRequest, user.ID))
+
 	respondWithJSON(w, http.StatusOK, response{
 		Message: "If an account with that email exists, a password reset link has been sent.",
-		Token:   resetToken.Token, // Remove this in production!
 	})
 }
 
@@ -82,22 +119,31 @@ func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if len(params.NewPassword) < 6 {
-		respondWithError(w, http.StatusBadRequest, "Password must be at least 6 characters", nil)
+	// Validate the reset token
+	resetToken, err := cfg.db.GetPasswordResetToken(r.Context(), params.Token)
+	if errors.Is(err, database.ErrNotFound) {
+		cfg.audit(r, auditEvent{Action: auditPasswordReset, Outcome: database.AuditOutcomeFailure})
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token", nil)
 		return
 	}
-
-	// Validate the reset token
-	resetToken, err := cfg.db.GetPasswordResetToken(params.Token)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Database error", err)
 		return
 	}
 
-	if resetToken == nil {
+	user, err := cfg.db.GetUser(r.Context(), resetToken.UserID)
+	if errors.Is(err, database.ErrNotFound) {
 		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token", nil)
 		return
 	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	if !cfg.checkPassword(w, params.NewPassword, user.Email, user.FullName) {
+		return
+	}
 
 	// Hash the new password
 	hashedPassword, err := auth.HashPassword(params.NewPassword)
@@ -107,16 +153,26 @@ func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Update the user's password
-	if err := cfg.db.UpdateUserPassword(resetToken.UserID, hashedPassword); err != nil {
+	if err := cfg.db.UpdateUserPassword(r.Context(), resetToken.UserID, hashedPassword); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update password", err)
 		return
 	}
 
-	// Mark the token as used
-	if err := cfg.db.MarkPasswordResetTokenUsed(params.Token); err != nil {
-		// Log but don't fail - password was already updated
+	// Whoever had the old password may be signed in, so end every session
+	if err := cfg.db.RevokeUserRefreshTokens(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	// Mark the token as used. The password is already changed, so don't fail.
+	if err := cfg.db.MarkPasswordResetTokenUsed(r.Context(), params.Token); err != nil {
+		log.Printf("%s[ERROR]%s couldn't mark password reset token used for %s: %v", colorRed, colorReset, user.ID, err)
 	}
 
+	event := auditUser(auditPasswordReset, user.ID)
+	event.ActorID = &user.ID
+	cfg.audit(r, event)
+
 	respondWithJSON(w, http.StatusOK, response{
 		Message: "Password has been reset successfully. You can now log in with your new password.",
 	})
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// watchedFraction is how much of a video has to be played for it to count as watched
+const watchedFraction = 0.9
+
+// handlerPlaybackHeartbeat records where the caller is in a video. Players
+// send it every few seconds while playing, with "ended" once playback reaches
+// the end. Heartbeats are buffered, see playbackRecorder.
+func (cfg *apiConfig) handlerPlaybackHeartbeat(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		PositionSeconds *float64 `json:"position_seconds"`
+		Ended           bool     `json:"ended"`
+	}
+
+	video, _, ok := cfg.authorizeVideo(w, r, actionView, "")
+	if !ok {
+		return
+	}
+	userID, _ := GetUserIDFromContext(r.Context())
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if params.PositionSeconds == nil || *params.PositionSeconds < 0 {
+		respondWithError(w, http.StatusBadRequest, "position_seconds must be zero or more", nil)
+		return
+	}
+
+	position := *params.PositionSeconds
+	finished := params.Ended
+	if video.DurationSeconds != nil && *video.DurationSeconds > 0 {
+		// Players can report a little past the end
+		position = min(position, *video.DurationSeconds)
+		finished = finished || position >= *video.DurationSeconds*watchedFraction
+	}
+
+	cfg.playback.record(database.PlaybackHeartbeat{
+		UserID:          userID,
+		VideoID:         video.ID,
+		PositionSeconds: position,
+		Finished:        finished,
+		At:              time.Now(),
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPlaybackGet returns the caller's position in a video, for resuming it
+func (cfg *apiConfig) handlerPlaybackGet(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.authorizeVideo(w, r, actionView, "")
+	if !ok {
+		return
+	}
+	userID, _ := GetUserIDFromContext(r.Context())
+
+	if err := cfg.playback.flushUser(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save playback progress", err)
+		return
+	}
+	progress, err := cfg.db.GetPlaybackProgress(r.Context(), userID, video.ID)
+	if err != nil {
+		respondWithDBError(w, "Playback progress", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, progress)
+}
+
+// handlerVideoWatched marks a video watched or unwatched for the caller
+func (cfg *apiConfig) handlerVideoWatched(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Watched *bool `json:"watched"`
+	}
+
+	video, _, ok := cfg.authorizeVideo(w, r, actionView, "")
+	if !ok {
+		return
+	}
+	userID, _ := GetUserIDFromContext(r.Context())
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if params.Watched == nil {
+		respondWithError(w, http.StatusBadRequest, "watched must be true or false", nil)
+		return
+	}
+
+	// A buffered heartbeat from the end of the video would undo "unwatched"
+	if err := cfg.playback.flushUser(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save playback progress", err)
+		return
+	}
+	if err := cfg.db.SetVideoWatched(r.Context(), userID, video.ID, *params.Watched); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update watched status", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerContinueWatching lists videos the caller started but hasn't
+// finished, most recently watched first. ?limit= caps the list.
+func (cfg *apiConfig) handlerContinueWatching(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Videos []database.WatchedVideo `json:"videos"`
+		Limit  int                     `json:"limit"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+	limit, err := queryInt(r.URL.Query(), "limit", 20)
+	if err != nil || limit < 1 || limit > 50 {
+		respondWithError(w, http.StatusBadRequest, "limit must be between 1 and 50", err)
+		return
+	}
+
+	if err := cfg.playback.flushUser(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save playback progress", err)
+		return
+	}
+	entries, err := cfg.db.ListContinueWatching(r.Context(), userID, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list videos", err)
+		return
+	}
+	entries, err = cfg.visibleWatchedVideos(r.Context(), userID, entries)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list videos", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{Videos: entries, Limit: limit})
+}
+
+// handlerWatchHistory lists every video the caller has played, most recently
+// watched first. Page with ?limit= and ?offset=; a page can come back short
+// when videos on it are no longer shared with the caller.
+func (cfg *apiConfig) handlerWatchHistory(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Videos []database.WatchedVideo `json:"videos"`
+		Limit  int                     `json:"limit"`
+		Offset int                     `json:"offset"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+	query := r.URL.Query()
+	limit, err := queryInt(query, "limit", 50)
+	if err != nil || limit < 1 || limit > 200 {
+		respondWithError(w, http.StatusBadRequest, "limit must be between 1 and 200", err)
+		return
+	}
+	offset, err := queryInt(query, "offset", 0)
+	if err != nil || offset < 0 {
+		respondWithError(w, http.StatusBadRequest, "offset must be a positive number", err)
+		return
+	}
+
+	if err := cfg.playback.flushUser(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save playback progress", err)
+		return
+	}
+	entries, err := cfg.db.ListWatchHistory(r.Context(), userID, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list watch history", err)
+		return
+	}
+	entries, err = cfg.visibleWatchedVideos(r.Context(), userID, entries)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list watch history", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{Videos: entries, Limit: limit, Offset: offset})
+}
+
+// handlerWatchHistoryClear forgets everything the caller has watched: their
+// positions and watched flags go too
+func (cfg *apiConfig) handlerWatchHistoryClear(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	cfg.playback.discard(userID, nil)
+	n, err := cfg.db.ClearPlaybackProgress(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't clear watch history", err)
+		return
+	}
+	event := auditUser(auditHistoryClear, userID)
+	event.Details = map[string]any{"videos": n}
+	cfg.audit(r, event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerWatchHistoryRemove forgets one video from the caller's history. It
+// needs no access to the video, so entries for unshared videos can go too.
+func (cfg *apiConfig) handlerWatchHistoryRemove(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	// Write anything buffered so it is found, rather than dropping it unseen
+	if err := cfg.playback.flushUser(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save playback progress", err)
+		return
+	}
+	cfg.playback.discard(userID, &videoID)
+	if err := cfg.db.DeletePlaybackProgress(r.Context(), userID, videoID); err != nil {
+		respondWithDBError(w, "History entry", err)
+		return
+	}
+	event := auditUser(auditHistoryClear, userID)
+	event.Details = map[string]any{"videos": 1, "video_id": videoID}
+	cfg.audit(r, event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// visibleWatchedVideos drops entries for videos the user can no longer view
+// and presigns the URLs of the rest
+func (cfg *apiConfig) visibleWatchedVideos(ctx context.Context, userID uuid.UUID, entries []database.WatchedVideo) ([]database.WatchedVideo, error) {
+	visible := []database.WatchedVideo{}
+	for _, entry := range entries {
+		role, err := cfg.videoRole(ctx, entry.Video, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !allows(role, actionView) {
+			continue
+		}
+		signedVideo, err := cfg.dbVideoToSignedVideo(entry.Video)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't generate presigned URL: %w", err)
+		}
+		entry.Video = signedVideo
+		visible = append(visible, entry)
+	}
+	return visible, nil
+}
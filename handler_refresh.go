@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
@@ -18,15 +20,28 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByRefreshToken(refreshToken)
+	user, err := cfg.db.GetUserByRefreshToken(r.Context(), refreshToken)
+	if errors.Is(err, database.ErrNotFound) {
+		cfg.audit(r, auditEvent{Action: auditTokenRefresh, Outcome: database.AuditOutcomeFailure})
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired refresh token", nil)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user for refresh token", err)
+		return
+	}
+	if user.DisabledAt != nil {
+		event := auditUser(auditTokenRefresh, user.ID)
+		event.Outcome = database.AuditOutcomeDenied
+		event.Details = map[string]any{"reason": "disabled"}
+		cfg.audit(r, event)
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired refresh token", nil)
 		return
 	}
 
 	accessToken, err := auth.MakeJWT(
 		user.ID,
-		cfg.jwtSecret,
+		cfg.jwtKeys,
 		time.Hour,
 	)
 	if err != nil {
@@ -34,6 +49,10 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	event := auditUser(auditTokenRefresh, user.ID)
+	event.ActorID = &user.ID
+	cfg.audit(r, event)
+
 	respondWithJSON(w, http.StatusOK, response{
 		Token: accessToken,
 	})
@@ -46,11 +65,25 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = cfg.db.RevokeRefreshToken(refreshToken)
+	// Look up the owner first so the audit event can name who signed out
+	user, err := cfg.db.GetUserByRefreshToken(r.Context(), refreshToken)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+
+	err = cfg.db.RevokeRefreshToken(r.Context(), refreshToken)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
 		return
 	}
 
+	event := auditEvent{Action: auditTokenRevoke}
+	if user != nil {
+		event = auditUser(auditTokenRevoke, user.ID)
+		event.ActorID = &user.ID
+	}
+	cfg.audit(r, event)
+
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
 )
 
 // handlerServeAssets serves files from the assets directory with support for
@@ -35,6 +36,13 @@ func (cfg *apiConfig) handlerServeAssets(w http.ResponseWriter, r *http.Request)
 			respondWithError(w, http.StatusUnauthorized, "Invalid or expired signature", nil)
 			return
 		}
+
+		// Count the bandwidth against the video the file belongs to
+		if videoID, ok := videoIDFromAssetKey(filePath); ok {
+			counter := &byteCounter{ResponseWriter: w}
+			defer func() { cfg.analytics.recordBytes(videoID, counter.n) }()
+			w = counter
+		}
 	}
 
 	// Build full file path
@@ -85,3 +93,23 @@ func (cfg *apiConfig) handlerServeAssets(w http.ResponseWriter, r *http.Request)
 	// - 206 Partial Content responses
 	http.ServeContent(w, r, fileInfo.Name(), fileInfo.ModTime(), file)
 }
+
+// videoIDFromAssetKey returns the video a stored file belongs to. Video,
+// thumbnail and captions files are all named after their video's ID.
+func videoIDFromAssetKey(key string) (uuid.UUID, bool) {
+	name := filepath.Base(key)
+	id, err := uuid.Parse(strings.TrimSuffix(name, filepath.Ext(name)))
+	return id, err == nil
+}
+
+// byteCounter counts the bytes of a response body
+type byteCounter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *byteCounter) Write(b []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,579 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// shareURLExpiry is how long presigned URLs handed out by a share link last
+	shareURLExpiry = 5 * time.Minute
+	// sharePasswordHeader carries the password for protected share links
+	sharePasswordHeader = "X-Share-Password"
+
+	maxSharePasswordLength = 128
+	maxShareViews          = 1_000_000
+	maxEmbedOrigins        = 20
+)
+
+// embedOriginHost matches the host of an embed origin, optionally with a
+// leading "*." wildcard and a port
+var embedOriginHost = regexp.MustCompile(`^(\*\.)?[a-z0-9]([a-z0-9.-]*[a-z0-9])?(:[0-9]{1,5})?$`)
+
+// normalizeEmbedOrigins checks the origins allowed to embed a share link and
+// returns them as scheme://host[:port], without duplicates
+func normalizeEmbedOrigins(origins []string) ([]string, error) {
+	if len(origins) > maxEmbedOrigins {
+		return nil, fmt.Errorf("at most %d embed origins are allowed", maxEmbedOrigins)
+	}
+	normalized := []string{}
+	for _, origin := range origins {
+		u, err := url.Parse(strings.TrimSpace(origin))
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.User != nil ||
+			(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" ||
+			!embedOriginHost.MatchString(strings.ToLower(u.Host)) {
+			return nil, fmt.Errorf("%q is not an origin like https://example.com", origin)
+		}
+		origin = u.Scheme + "://" + strings.ToLower(u.Host)
+		if !slices.Contains(normalized, origin) {
+			normalized = append(normalized, origin)
+		}
+	}
+	return normalized, nil
+}
+
+// shareLinkResponse is a share link as its owner sees it
+type shareLinkResponse struct {
+	database.ShareLink
+	URL string `json:"url"`
+	// PageURL and EmbedURL are the web page and iframe player for video links
+	PageURL     *string `json:"page_url"`
+	EmbedURL    *string `json:"embed_url"`
+	HasPassword bool    `json:"has_password"`
+	Active      bool    `json:"active"`
+}
+
+func (cfg *apiConfig) shareLinkResponse(link database.ShareLink) shareLinkResponse {
+	resp := shareLinkResponse{
+		ShareLink:   link,
+		URL:         cfg.publicLink("/api/public/shares/"+link.Token, nil),
+		HasPassword: link.PasswordHash != nil,
+		Active:      link.Usable(time.Now()),
+	}
+	if link.VideoID != nil {
+		pageURL := cfg.publicLink("/s/"+link.Token, nil)
+		embedURL := cfg.publicLink("/embed/"+link.Token, nil)
+		resp.PageURL, resp.EmbedURL = &pageURL, &embedURL
+	}
+	return resp
+}
+
+// handlerShareCreate makes a share link for one of the caller's videos or collections
+func (cfg *apiConfig) handlerShareCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoID      *uuid.UUID `json:"video_id"`
+		CollectionID *uuid.UUID `json:"collection_id"`
+		ExpiresAt    *time.Time `json:"expires_at"`
+		Password     string     `json:"password"`
+		MaxViews     *int       `json:"max_views"`
+		EmbedOrigins []string   `json:"embed_origins"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if (params.VideoID == nil) == (params.CollectionID == nil) {
+		respondWithError(w, http.StatusBadRequest, "Set exactly one of video_id and collection_id", nil)
+		return
+	}
+	if params.ExpiresAt != nil && !params.ExpiresAt.After(time.Now()) {
+		respondWithError(w, http.StatusBadRequest, "expires_at must be in the future", nil)
+		return
+	}
+	if params.MaxViews != nil && (*params.MaxViews < 1 || *params.MaxViews > maxShareViews) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("max_views must be between 1 and %d", maxShareViews), nil)
+		return
+	}
+	if len(params.Password) > maxSharePasswordLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("password must be at most %d characters", maxSharePasswordLength), nil)
+		return
+	}
+	embedOrigins, err := normalizeEmbedOrigins(params.EmbedOrigins)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if len(embedOrigins) > 0 && params.VideoID == nil {
+		respondWithError(w, http.StatusBadRequest, "Only video share links can be embedded", nil)
+		return
+	}
+
+	var resource, role string
+	if params.VideoID != nil {
+		video, err := cfg.db.GetVideo(r.Context(), *params.VideoID)
+		if err != nil {
+			respondWithDBError(w, "Video", err)
+			return
+		}
+		resource = "Video"
+		role, err = cfg.videoRole(r.Context(), video, userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check access to video", err)
+			return
+		}
+	} else {
+		collection, err := cfg.db.GetCollection(r.Context(), *params.CollectionID)
+		if err != nil {
+			respondWithDBError(w, "Collection", err)
+			return
+		}
+		resource = "Collection"
+		role, err = cfg.collectionRole(r.Context(), collection, userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check access to collection", err)
+			return
+		}
+	}
+	// Only owners may hand out public links, even to things shared with them
+	denied := auditEvent{Action: auditShareCreate}
+	denied.Details = map[string]any{"video_id": params.VideoID, "collection_id": params.CollectionID}
+	if !cfg.enforce(w, r, resource, role, actionManage, denied) {
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create share token", err)
+		return
+	}
+	createParams := database.CreateShareLinkParams{
+		Token:        token,
+		UserID:       userID,
+		VideoID:      params.VideoID,
+		CollectionID: params.CollectionID,
+		ExpiresAt:    params.ExpiresAt,
+		MaxViews:     params.MaxViews,
+		EmbedOrigins: embedOrigins,
+	}
+	if params.Password != "" {
+		hash, err := auth.HashPassword(params.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+			return
+		}
+		createParams.PasswordHash = &hash
+	}
+
+	link, err := cfg.db.CreateShareLink(r.Context(), createParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create share link", err)
+		return
+	}
+
+	event := auditShare(auditShareCreate, link.ID)
+	event.Details = map[string]any{
+		"video_id":      link.VideoID,
+		"collection_id": link.CollectionID,
+		"expires_at":    link.ExpiresAt,
+		"max_views":     link.MaxViews,
+		"has_password":  link.PasswordHash != nil,
+		"embed_origins": link.EmbedOrigins,
+	}
+	cfg.audit(r, event)
+
+	respondWithJSON(w, http.StatusCreated, cfg.shareLinkResponse(link))
+}
+
+// handlerSharesList lists the caller's share links, including expired and revoked ones
+func (cfg *apiConfig) handlerSharesList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	links, err := cfg.db.ListShareLinks(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list share links", err)
+		return
+	}
+
+	response := make([]shareLinkResponse, len(links))
+	for i, link := range links {
+		response[i] = cfg.shareLinkResponse(link)
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// handlerShareRevoke stops a share link from working
+func (cfg *apiConfig) handlerShareRevoke(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+	shareID, err := uuid.Parse(r.PathValue("shareID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid share link ID", err)
+		return
+	}
+
+	link, err := cfg.db.GetShareLink(r.Context(), shareID)
+	if err != nil {
+		respondWithDBError(w, "Share link", err)
+		return
+	}
+	if !cfg.enforce(w, r, "Share link", ownerRole(link.UserID, userID), actionManage, auditShare(auditShareRevoke, shareID)) {
+		return
+	}
+
+	if err := cfg.db.RevokeShareLink(r.Context(), shareID); err != nil {
+		respondWithDBError(w, "Share link", err)
+		return
+	}
+	cfg.audit(r, auditShare(auditShareRevoke, shareID))
+
+	link, err = cfg.db.GetShareLink(r.Context(), shareID)
+	if err != nil {
+		respondWithDBError(w, "Share link", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.shareLinkResponse(link))
+}
+
+// handlerShareEmbedOrigins replaces the origins allowed to embed a share link
+func (cfg *apiConfig) handlerShareEmbedOrigins(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		EmbedOrigins []string `json:"embed_origins"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+	shareID, err := uuid.Parse(r.PathValue("shareID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid share link ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	origins, err := normalizeEmbedOrigins(params.EmbedOrigins)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	link, err := cfg.db.GetShareLink(r.Context(), shareID)
+	if err != nil {
+		respondWithDBError(w, "Share link", err)
+		return
+	}
+	if !cfg.enforce(w, r, "Share link", ownerRole(link.UserID, userID), actionManage, auditShare(auditShareEmbedOrigins, shareID)) {
+		return
+	}
+	if len(origins) > 0 && link.VideoID == nil {
+		respondWithError(w, http.StatusBadRequest, "Only video share links can be embedded", nil)
+		return
+	}
+
+	if err := cfg.db.SetShareLinkEmbedOrigins(r.Context(), shareID, origins); err != nil {
+		respondWithDBError(w, "Share link", err)
+		return
+	}
+	event := auditShare(auditShareEmbedOrigins, shareID)
+	event.Details = map[string]any{"embed_origins": origins}
+	cfg.audit(r, event)
+
+	link.EmbedOrigins = origins
+	respondWithJSON(w, http.StatusOK, cfg.shareLinkResponse(link))
+}
+
+// sharedVideo is what a share link reveals about a video
+type sharedVideo struct {
+	ID              uuid.UUID `json:"id"`
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	DurationSeconds *float64  `json:"duration_seconds"`
+	AspectRatio     *string   `json:"aspect_ratio"`
+	VideoURL        *string   `json:"video_url"`
+	ThumbnailURL    *string   `json:"thumbnail_url"`
+	CaptionsURL     *string   `json:"captions_url"`
+}
+
+type sharedCollection struct {
+	Title             string        `json:"title"`
+	Description       string        `json:"description"`
+	CoverThumbnailURL *string       `json:"cover_thumbnail_url"`
+	Videos            []sharedVideo `json:"videos"`
+}
+
+// handlerShareResolve is the public side of a share link: anyone with the
+// token gets the metadata and presigned URLs, and uses one of its views.
+// Protected links need the password in the X-Share-Password header. The share
+// and embed page players resolve with ?player=page, and get URLs lasting as
+// long as the page's since they can't resolve again. Every attempt is audited.
+func (cfg *apiConfig) handlerShareResolve(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Video      *sharedVideo      `json:"video,omitempty"`
+		Collection *sharedCollection `json:"collection,omitempty"`
+		ExpiresAt  *time.Time        `json:"expires_at"`
+		// URLsExpireAt is when the presigned URLs stop working; resolve again for fresh ones
+		URLsExpireAt time.Time `json:"urls_expire_at"`
+		ViewsLeft    *int      `json:"views_left"`
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	link, fail := cfg.usableShareLink(r, r.PathValue("token"))
+	if fail != nil {
+		respondWithError(w, fail.code, fail.message, fail.err)
+		return
+	}
+
+	if link.PasswordHash != nil && !cfg.checkSharePassword(w, r, link) {
+		return
+	}
+
+	if fail := cfg.recordShareView(r, &link); fail != nil {
+		respondWithError(w, fail.code, fail.message, fail.err)
+		return
+	}
+
+	now := time.Now()
+	expiry := shareLinkURLExpiry(link, shareURLExpiry, now)
+	if r.URL.Query().Get("player") == "page" {
+		expiry = shareLinkURLExpiry(link, sharePageURLExpiry, now)
+	}
+	resp := response{ExpiresAt: link.ExpiresAt, URLsExpireAt: now.Add(expiry).UTC()}
+	if link.MaxViews != nil {
+		left := *link.MaxViews - link.ViewCount
+		resp.ViewsLeft = &left
+	}
+
+	if link.VideoID != nil {
+		video, err := cfg.db.GetVideo(r.Context(), *link.VideoID)
+		if err != nil {
+			respondWithDBError(w, "Video", err)
+			return
+		}
+		shared, err := cfg.sharedVideo(video, expiry)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+			return
+		}
+		resp.Video = &shared
+	} else {
+		collection, err := cfg.sharedCollection(r, *link.CollectionID, expiry)
+		if err != nil {
+			respondWithDBError(w, "Collection", err)
+			return
+		}
+		resp.Collection = &collection
+	}
+
+	event := auditShare(auditShareAccess, link.ID)
+	event.Details = map[string]any{"view_count": link.ViewCount}
+	cfg.audit(r, event)
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// shareLinkFailure is why a share link can't be opened, and how to respond
+type shareLinkFailure struct {
+	code    int
+	message string
+	err     error
+}
+
+var errShareLinkGone = &shareLinkFailure{code: http.StatusGone, message: "This share link is no longer available"}
+
+// usableShareLink looks up the share link for token and checks it can still be
+// used. Failures are audited.
+func (cfg *apiConfig) usableShareLink(r *http.Request, token string) (database.ShareLink, *shareLinkFailure) {
+	link, err := cfg.db.GetShareLinkByToken(r.Context(), token)
+	if errors.Is(err, database.ErrNotFound) {
+		cfg.audit(r, auditEvent{
+			Action:  auditShareAccess,
+			Outcome: database.AuditOutcomeFailure,
+			Details: map[string]any{"reason": "unknown_token"},
+		})
+		return database.ShareLink{}, &shareLinkFailure{code: http.StatusNotFound, message: "Share link not found"}
+	}
+	if err != nil {
+		return database.ShareLink{}, &shareLinkFailure{code: http.StatusInternalServerError, message: "Database error", err: err}
+	}
+
+	now := time.Now()
+	if !link.Usable(now) {
+		cfg.auditShareAccessFailure(r, link, shareUnusableReason(link, now))
+		return database.ShareLink{}, errShareLinkGone
+	}
+	return link, nil
+}
+
+// recordShareView counts a view of the link, failing if another viewer used
+// the last one, or it expired, since it was looked up
+func (cfg *apiConfig) recordShareView(r *http.Request, link *database.ShareLink) *shareLinkFailure {
+	if err := cfg.db.RecordShareLinkView(r.Context(), link.ID); errors.Is(err, database.ErrNotFound) {
+		cfg.auditShareAccessFailure(r, *link, "unavailable")
+		return errShareLinkGone
+	} else if err != nil {
+		return &shareLinkFailure{code: http.StatusInternalServerError, message: "Couldn't record view", err: err}
+	}
+	link.ViewCount++
+	return nil
+}
+
+// shareLinkURLExpiry is how long presigned URLs for the link should last:
+// expiry, or less so they never outlive the link itself
+func shareLinkURLExpiry(link database.ShareLink, expiry time.Duration, now time.Time) time.Duration {
+	if link.ExpiresAt != nil && link.ExpiresAt.Sub(now) < expiry {
+		return link.ExpiresAt.Sub(now)
+	}
+	return expiry
+}
+
+// checkSharePassword verifies the X-Share-Password header against a protected
+// link, throttled per link and per IP like logins. It writes the error
+// response and returns false when the caller may not continue.
+func (cfg *apiConfig) checkSharePassword(w http.ResponseWriter, r *http.Request, link database.ShareLink) bool {
+	password := r.Header.Get(sharePasswordHeader)
+	if password == "" {
+		cfg.auditShareAccessFailure(r, link, "password_required")
+		respondWithError(w, http.StatusUnauthorized, "This share link needs a password", nil)
+		return false
+	}
+
+	if !cfg.checkShareThrottle(w, r, link) {
+		return false
+	}
+
+	linkKey := shareLinkKey(link.ID)
+	ipKey := shareIPKey(cfg.clientIP(r))
+	match, err := auth.CheckPasswordHash(password, *link.PasswordHash)
+	if err != nil || !match {
+		for key, policy := range map[string]throttlePolicy{linkKey: sharePasswordLinkPolicy, ipKey: sharePasswordIPPolicy} {
+			if err := cfg.recordThrottleFailure(r.Context(), key, policy); err != nil {
+				log.Printf("%s[ERROR]%s couldn't record share password failure: %v", colorRed, colorReset, err)
+			}
+		}
+		cfg.auditShareAccessFailure(r, link, "bad_password")
+		respondWithError(w, http.StatusUnauthorized, "Incorrect password", err)
+		return false
+	}
+
+	if err := cfg.db.ClearAuthThrottle(r.Context(), linkKey); err != nil {
+		log.Printf("%s[ERROR]%s couldn't clear share password throttle: %v", colorRed, colorReset, err)
+	}
+	return true
+}
+
+// checkShareThrottle responds with a 429 and returns false while the link or
+// the caller's IP is locked out after too many wrong passwords
+func (cfg *apiConfig) checkShareThrottle(w http.ResponseWriter, r *http.Request, link database.ShareLink) bool {
+	retryAfter, err := cfg.checkThrottle(r.Context(), shareLinkKey(link.ID), shareIPKey(cfg.clientIP(r)))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return false
+	}
+	if retryAfter > 0 {
+		event := auditDenied(auditShare(auditShareAccess, link.ID))
+		event.Details = map[string]any{"reason": "throttled"}
+		cfg.audit(r, event)
+		respondThrottled(w, retryAfter)
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) auditShareAccessFailure(r *http.Request, link database.ShareLink, reason string) {
+	event := auditShare(auditShareAccess, link.ID)
+	event.Outcome = database.AuditOutcomeFailure
+	event.Details = map[string]any{"reason": reason}
+	cfg.audit(r, event)
+}
+
+// shareUnusableReason says why Usable returned false, for the audit log
+func shareUnusableReason(link database.ShareLink, now time.Time) string {
+	switch {
+	case link.RevokedAt != nil:
+		return "revoked"
+	case link.ExpiresAt != nil && !link.ExpiresAt.After(now):
+		return "expired"
+	default:
+		return "view_limit"
+	}
+}
+
+func (cfg *apiConfig) sharedVideo(video database.Video, expiry time.Duration) (sharedVideo, error) {
+	signed, err := cfg.signVideoURLs(video, expiry)
+	if err != nil {
+		return sharedVideo{}, err
+	}
+	return sharedVideo{
+		ID:              signed.ID,
+		Title:           signed.Title,
+		Description:     signed.Description,
+		DurationSeconds: signed.DurationSeconds,
+		AspectRatio:     signed.AspectRatio,
+		VideoURL:        signed.VideoURL,
+		ThumbnailURL:    signed.ThumbnailURL,
+		CaptionsURL:     signed.CaptionsURL,
+	}, nil
+}
+
+func (cfg *apiConfig) sharedCollection(r *http.Request, collectionID uuid.UUID, expiry time.Duration) (sharedCollection, error) {
+	collection, err := cfg.db.GetCollection(r.Context(), collectionID)
+	if err != nil {
+		return sharedCollection{}, err
+	}
+	items, err := cfg.db.GetCollectionItems(r.Context(), collectionID)
+	if err != nil {
+		return sharedCollection{}, err
+	}
+
+	cover, err := cfg.signVideoURLs(database.Video{ThumbnailURL: collection.CoverThumbnailURL}, expiry)
+	if err != nil {
+		return sharedCollection{}, err
+	}
+	shared := sharedCollection{
+		Title:             collection.Title,
+		Description:       collection.Description,
+		CoverThumbnailURL: cover.ThumbnailURL,
+		Videos:            make([]sharedVideo, len(items)),
+	}
+	for i, item := range items {
+		if shared.Videos[i], err = cfg.sharedVideo(item.Video, expiry); err != nil {
+			return sharedCollection{}, err
+		}
+	}
+	return shared, nil
+}
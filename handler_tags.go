@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxTagNameLength   = 64
+	maxBulkTagVideos   = 500
+	maxBulkTagNames    = 50
+	maxMergeTagSources = 50
+)
+
+// normalizeTagName trims the name and collapses runs of whitespace
+func normalizeTagName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", errors.New("tag name cannot be empty")
+	}
+	if utf8.RuneCountInString(name) > maxTagNameLength {
+		return "", fmt.Errorf("tag name must be at most %d characters", maxTagNameLength)
+	}
+	return name, nil
+}
+
+// normalizeTagNames normalizes each name and drops duplicates, ignoring case
+func normalizeTagNames(names []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, name := range names {
+		name, err := normalizeTagName(name)
+		if err != nil {
+			return nil, err
+		}
+		if key := strings.ToLower(name); !seen[key] {
+			seen[key] = true
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized, nil
+}
+
+// ownedTag loads the tag named in the path, responding with an error unless
+// it belongs to the caller
+func (cfg *apiConfig) ownedTag(w http.ResponseWriter, r *http.Request, action string) (database.Tag, bool) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return database.Tag{}, false
+	}
+	tagID, err := uuid.Parse(r.PathValue("tagID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid tag ID", err)
+		return database.Tag{}, false
+	}
+
+	tag, err := cfg.db.GetTag(r.Context(), tagID)
+	if err != nil {
+		respondWithDBError(w, "Tag", err)
+		return database.Tag{}, false
+	}
+	if !cfg.enforce(w, r, "Tag", ownerRole(tag.UserID, userID), actionManage, auditTag(action, tagID)) {
+		return database.Tag{}, false
+	}
+	return tag, true
+}
+
+// handlerTagsList lists the caller's tags with how many videos carry each one
+func (cfg *apiConfig) handlerTagsList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	tags, err := cfg.db.ListTags(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list tags", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tags)
+}
+
+func (cfg *apiConfig) handlerTagCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name string `json:"name"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	name, err := normalizeTagName(params.Name)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	tag, err := cfg.db.CreateTag(r.Context(), userID, name)
+	if err != nil {
+		respondWithDBError(w, "Tag", err)
+		return
+	}
+
+	event := auditTag(auditTagCreate, tag.ID)
+	event.Details = map[string]any{"name": tag.Name}
+	cfg.audit(r, event)
+
+	respondWithJSON(w, http.StatusCreated, tag)
+}
+
+// handlerTagRename changes a tag's name everywhere it is used
+func (cfg *apiConfig) handlerTagRename(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name string `json:"name"`
+	}
+
+	tag, ok := cfg.ownedTag(w, r, auditTagRename)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	name, err := normalizeTagName(params.Name)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if err := cfg.db.RenameTag(r.Context(), tag.ID, name); err != nil {
+		respondWithDBError(w, "Tag", err)
+		return
+	}
+
+	event := auditTag(auditTagRename, tag.ID)
+	event.Details = map[string]any{"previous_name": tag.Name, "name": name}
+	cfg.audit(r, event)
+
+	updated, err := cfg.db.GetTag(r.Context(), tag.ID)
+	if err != nil {
+		respondWithDBError(w, "Tag", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// handlerTagDelete removes a tag from every video and deletes it
+func (cfg *apiConfig) handlerTagDelete(w http.ResponseWriter, r *http.Request) {
+	tag, ok := cfg.ownedTag(w, r, auditTagDelete)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.DeleteTag(r.Context(), tag.ID); err != nil {
+		respondWithDBError(w, "Tag", err)
+		return
+	}
+
+	event := auditTag(auditTagDelete, tag.ID)
+	event.Details = map[string]any{"name": tag.Name}
+	cfg.audit(r, event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerTagMerge folds other tags into the one in the path: their videos get
+// this tag instead, and the other tags are deleted
+func (cfg *apiConfig) handlerTagMerge(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		SourceIDs []uuid.UUID `json:"source_ids"`
+	}
+
+	target, ok := cfg.ownedTag(w, r, auditTagMerge)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if len(params.SourceIDs) == 0 || len(params.SourceIDs) > maxMergeTagSources {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("source_ids must list 1 to %d tags", maxMergeTagSources), nil)
+		return
+	}
+
+	sourceNames := []string{}
+	for _, sourceID := range params.SourceIDs {
+		if sourceID == target.ID {
+			respondWithError(w, http.StatusBadRequest, "A tag can't be merged into itself", nil)
+			return
+		}
+		source, err := cfg.db.GetTag(r.Context(), sourceID)
+		if err != nil {
+			respondWithDBError(w, "Tag", err)
+			return
+		}
+		if !cfg.enforce(w, r, "Tag", ownerRole(source.UserID, target.UserID), actionManage, auditTag(auditTagMerge, sourceID)) {
+			return
+		}
+		sourceNames = append(sourceNames, source.Name)
+	}
+
+	if err := cfg.db.MergeTags(r.Context(), target.ID, params.SourceIDs); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't merge tags", err)
+		return
+	}
+
+	event := auditTag(auditTagMerge, target.ID)
+	event.Details = map[string]any{"merged": sourceNames}
+	cfg.audit(r, event)
+
+	updated, err := cfg.db.GetTag(r.Context(), target.ID)
+	if err != nil {
+		respondWithDBError(w, "Tag", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// handlerVideosBulkTag adds and removes tags on many videos at once. Tags to
+// add are created if the caller doesn't have them yet.
+func (cfg *apiConfig) handlerVideosBulkTag(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoIDs []uuid.UUID `json:"video_ids"`
+		Add      []string    `json:"add"`
+		Remove   []string    `json:"remove"`
+	}
+	type response struct {
+		VideoIDs []uuid.UUID    `json:"video_ids"`
+		Added    []database.Tag `json:"added"`
+		Removed  []database.Tag `json:"removed"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if len(params.VideoIDs) == 0 || len(params.VideoIDs) > maxBulkTagVideos {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("video_ids must list 1 to %d videos", maxBulkTagVideos), nil)
+		return
+	}
+	if len(params.Add)+len(params.Remove) == 0 || len(params.Add)+len(params.Remove) > maxBulkTagNames {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("add and remove must name 1 to %d tags between them", maxBulkTagNames), nil)
+		return
+	}
+	addNames, err := normalizeTagNames(params.Add)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	removeNames, err := normalizeTagNames(params.Remove)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	for _, videoID := range params.VideoIDs {
+		video, err := cfg.db.GetVideo(r.Context(), videoID)
+		if err != nil {
+			respondWithDBError(w, "Video", err)
+			return
+		}
+		// Tags belong to one user, so only the owner may tag their videos
+		role, err := cfg.videoRole(r.Context(), video, userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check access to video", err)
+			return
+		}
+		if !cfg.enforce(w, r, "Video", role, actionManage, auditVideo(auditVideoTag, videoID)) {
+			return
+		}
+	}
+
+	added, err := cfg.findOrCreateTags(r, userID, addNames)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create tags", err)
+		return
+	}
+	removed, err := cfg.db.GetTagsByName(r.Context(), userID, removeNames)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't load tags", err)
+		return
+	}
+
+	if err := cfg.db.TagVideos(r.Context(), params.VideoIDs, tagIDs(added)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't tag videos", err)
+		return
+	}
+	if err := cfg.db.UntagVideos(r.Context(), params.VideoIDs, tagIDs(removed)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't untag videos", err)
+		return
+	}
+
+	// Reload so the video counts reflect the change
+	if added, err = cfg.db.GetTagsByName(r.Context(), userID, addNames); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't load tags", err)
+		return
+	}
+	if removed, err = cfg.db.GetTagsByName(r.Context(), userID, removeNames); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't load tags", err)
+		return
+	}
+
+	cfg.audit(r, auditEvent{
+		Action:  auditVideoTag,
+		Details: map[string]any{"videos": len(params.VideoIDs), "added": addNames, "removed": removeNames},
+	})
+
+	respondWithJSON(w, http.StatusOK, response{
+		VideoIDs: params.VideoIDs,
+		Added:    added,
+		Removed:  removed,
+	})
+}
+
+// findOrCreateTags returns the caller's tags with these names, creating any that are missing
+func (cfg *apiConfig) findOrCreateTags(r *http.Request, userID uuid.UUID, names []string) ([]database.Tag, error) {
+	tags, err := cfg.db.GetTagsByName(r.Context(), userID, names)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	for _, tag := range tags {
+		existing[strings.ToLower(tag.Name)] = true
+	}
+
+	for _, name := range names {
+		if existing[strings.ToLower(name)] {
+			continue
+		}
+		tag, err := cfg.db.CreateTag(r.Context(), userID, name)
+		if errors.Is(err, database.ErrConflict) {
+			// Created by a concurrent request since we looked
+			found, err := cfg.db.GetTagsByName(r.Context(), userID, []string{name})
+			if err != nil || len(found) == 0 {
+				return nil, fmt.Errorf("couldn't load tag %q: %w", name, err)
+			}
+			tag = found[0]
+		} else if err != nil {
+			return nil, err
+		} else {
+			event := auditTag(auditTagCreate, tag.ID)
+			event.Details = map[string]any{"name": tag.Name}
+			cfg.audit(r, event)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func tagIDs(tags []database.Tag) []uuid.UUID {
+	ids := make([]uuid.UUID, len(tags))
+	for i, tag := range tags {
+		ids[i] = tag.ID
+	}
+	return ids
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+)
+
+const (
+	captionsMediaType = "text/vtt"
+	maxCaptionsSize   = 1 << 20
+)
+
+func init() {
+	// Browsers only load <track> files served as text/vtt, and not every
+	// system's MIME table knows the extension
+	mime.AddExtensionType(".vtt", captionsMediaType)
+}
+
+// handlerUploadCaptions stores a WebVTT captions file for the video, replacing any earlier one
+func (cfg *apiConfig) handlerUploadCaptions(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCaptionsSize+(64<<10))
+
+	// Owners and editors may replace the captions
+	video, _, ok := cfg.authorizeVideo(w, r, actionEdit, auditCaptionsUpload)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxCaptionsSize); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse form", err)
+		return
+	}
+
+	// "captions" should match the HTML form input name
+	file, header, err := r.FormFile("captions")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxCaptionsSize {
+		respondWithError(w, http.StatusBadRequest, "Captions file is too large (max 1 MB)", nil)
+		return
+	}
+	// Every WebVTT file starts with "WEBVTT", optionally after a byte order mark
+	reader := bufio.NewReader(file)
+	start, _ := reader.Peek(9)
+	if !bytes.HasPrefix(bytes.TrimPrefix(start, []byte("\ufeff")), []byte("WEBVTT")) {
+		respondWithError(w, http.StatusBadRequest, "Captions must be a WebVTT file", nil)
+		return
+	}
+
+	captionsKey := fmt.Sprintf("captions/%s.vtt", video.ID)
+	captionsURL, err := cfg.storage.Save(r.Context(), captionsKey, reader, captionsMediaType)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save captions", err)
+		return
+	}
+
+	video.CaptionsURL = &captionsURL
+	video.UpdatedAt = time.Now()
+	if err := cfg.db.UpdateVideo(r.Context(), video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video metadata in database", err)
+		return
+	}
+
+	event := auditVideo(auditCaptionsUpload, video.ID)
+	event.Details = map[string]any{"size": header.Size}
+	cfg.audit(r, event)
+	cfg.emitVideoEvent(r, webhookEventVideoUpdated, newWebhookVideo(video), []string{"captions"})
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
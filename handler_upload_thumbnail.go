@@ -5,35 +5,20 @@ import (
 	"mime"
 	"net/http"
 	"time"
-
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
-	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
-		return
-	}
-
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	// Owners and editors may replace the thumbnail
+	video, _, ok := cfg.authorizeVideo(w, r, actionEdit, auditThumbnailUpload)
+	if !ok {
 		return
 	}
+	videoID := video.ID
 
-	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
+	fmt.Println("uploading thumbnail for video", videoID)
 
 	const maxMemory = 10 << 20
-	err = r.ParseMultipartForm(maxMemory)
+	err := r.ParseMultipartForm(maxMemory)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Couldn't parse form", err)
 		return
@@ -63,16 +48,6 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	// 	return
 	// }
 
-	video, err := cfg.db.GetVideo(videoID)
-	if err != nil || video.ID == uuid.Nil {
-		respondWithError(w, http.StatusNotFound, "Video not found", nil)
-		return
-	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "Not authorized", nil)
-		return
-	}
-
 	fileExtension := mediaType[len("image/"):]
 	thumbnailKey := fmt.Sprintf("thumbnails/%s.%s", videoID.String(), fileExtension)
 
@@ -84,13 +59,19 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	}
 
 	video.ThumbnailURL = &thumbnailURL
+	video.ThumbnailSize = header.Size
 	video.UpdatedAt = time.Now()
 
-	err = cfg.db.UpdateVideo(video)
+	err = cfg.db.UpdateVideo(r.Context(), video)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update video metadata in database", err)
 		return
 	}
+
+	event := auditVideo(auditThumbnailUpload, video.ID)
+	event.Details = map[string]any{"size": video.ThumbnailSize, "content_type": mediaType}
+	cfg.audit(r, event)
+	cfg.emitVideoEvent(r, webhookEventVideoUpdated, newWebhookVideo(video), []string{"thumbnail"})
 	signedVideo, err := cfg.dbVideoToSignedVideo(video)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
@@ -8,48 +8,21 @@ import (
 	"os"
 	"time"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
-	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
 
 	// 	Set an upload limit of 1 GB (1 << 30 bytes) using http.MaxBytesReader.
 	r.Body = http.MaxBytesReader(w, r.Body, 1<<30)
-	// Extract the videoID from the URL path parameters and parse it as a UUID
-	videoIDString := r.PathValue("videoID")
-
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
-		return
-	}
-
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
-	}
-
-	video, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get video", err)
-		return
-	}
-
-	if video.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "You are not the owner of this video", nil)
+	// Owners and editors may replace the video file
+	video, _, ok := cfg.authorizeVideo(w, r, actionEdit, auditVideoUpload)
+	if !ok {
 		return
 	}
+	videoID := video.ID
 
-	fmt.Println("uploading video for video", videoID, "by user", userID)
+	fmt.Println("uploading video for video", videoID)
 
 	// "video" should match the HTML form input name
 	file, header, err := r.FormFile("video")
@@ -93,15 +66,15 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get aspect ratio and determine S3 key prefix
-	aspectRatio, err := getVideoAspectRatio(tempFile.Name())
+	// Get aspect ratio and duration, and determine S3 key prefix
+	metadata, err := getVideoMetadata(tempFile.Name())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't get video aspect ratio", err)
 		return
 	}
 
 	var prefix string
-	switch aspectRatio {
+	switch metadata.AspectRatio {
 	case "16:9":
 		prefix = "landscape/"
 	case "9:16":
@@ -112,6 +85,11 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 
 	s3Key := fmt.Sprintf("%s%s.mp4", prefix, videoID.String())
 
+	var duration *float64
+	if metadata.DurationSeconds > 0 {
+		duration = &metadata.DurationSeconds
+	}
+
 	// Validate file size before processing
 	fileInfo, err := tempFile.Stat()
 	if err != nil {
@@ -126,6 +104,15 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	// Close original temp file before processing
 	tempFile.Close()
 
+	// The file is in; video.processed follows once it is processed and stored.
+	// The video record still describes the previous file until then.
+	uploaded := newWebhookVideo(video)
+	uploaded.HasVideo = true
+	uploaded.VideoSize = fileInfo.Size()
+	uploaded.AspectRatio = &metadata.AspectRatio
+	uploaded.DurationSeconds = duration
+	cfg.emitVideoEvent(r, webhookEventVideoUploaded, uploaded, nil)
+
 	// Process video for fast start - creates a new processed file
 	processedFilePath, err := processVideoForFastStart(tempFile.Name())
 	if err != nil {
@@ -144,6 +131,12 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	}
 	defer processedFile.Close()
 
+	processedInfo, err := processedFile.Stat()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get processed file info", err)
+		return
+	}
+
 	// Upload processed video using our abstract storage interface
 	storageRef, err := cfg.storage.Save(r.Context(), s3Key, processedFile, mediaType)
 	if err != nil {
@@ -153,12 +146,20 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 
 	video.UpdatedAt = time.Now()
 	video.VideoURL = &storageRef
-	err = cfg.db.UpdateVideo(video)
+	video.VideoSize = processedInfo.Size()
+	video.AspectRatio = &metadata.AspectRatio
+	video.DurationSeconds = duration
+	err = cfg.db.UpdateVideo(r.Context(), video)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update video metadata in database", err)
 		return
 	}
 
+	event := auditVideo(auditVideoUpload, video.ID)
+	event.Details = map[string]any{"size": video.VideoSize, "content_type": mediaType}
+	cfg.audit(r, event)
+	cfg.emitVideoEvent(r, webhookEventVideoProcessed, newWebhookVideo(video), nil)
+
 	signedVideo, err := cfg.dbVideoToSignedVideo(video)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
@@ -170,8 +171,13 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 }
 
 func (cfg *apiConfig) dbVideoToSignedVideo(video database.Video) (database.Video, error) {
+	return cfg.signVideoURLs(video, 15*time.Minute)
+}
+
+// signVideoURLs replaces the video's file references with presigned URLs valid for expiry
+func (cfg *apiConfig) signVideoURLs(video database.Video, expiry time.Duration) (database.Video, error) {
 	if video.VideoURL != nil {
-		presignedURL, err := cfg.storage.GeneratePresignedURL(*video.VideoURL, 15*time.Minute)
+		presignedURL, err := cfg.storage.GeneratePresignedURL(*video.VideoURL, expiry)
 		if err != nil {
 			return database.Video{}, err
 		}
@@ -179,12 +185,20 @@ func (cfg *apiConfig) dbVideoToSignedVideo(video database.Video) (database.Video
 	}
 
 	if video.ThumbnailURL != nil {
-		presignedURL, err := cfg.storage.GeneratePresignedURL(*video.ThumbnailURL, 15*time.Minute)
+		presignedURL, err := cfg.storage.GeneratePresignedURL(*video.ThumbnailURL, expiry)
 		if err != nil {
 			return database.Video{}, err
 		}
 		video.ThumbnailURL = &presignedURL
 	}
 
+	if video.CaptionsURL != nil {
+		presignedURL, err := cfg.storage.GeneratePresignedURL(*video.CaptionsURL, expiry)
+		if err != nil {
+			return database.Video{}, err
+		}
+		video.CaptionsURL = &presignedURL
+	}
+
 	return video, nil
 }
@@ -2,7 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"net/mail"
 	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
@@ -33,13 +36,18 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	params.Email, err = validateEmail(params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address", err)
+		return
+	}
+
 	if params.FullName == "" {
 		respondWithError(w, http.StatusBadRequest, "Full name is required", nil)
 		return
 	}
 
-	if len(params.Password) < 6 {
-		respondWithError(w, http.StatusBadRequest, "Password must be at least 6 characters", nil)
+	if !cfg.checkPassword(w, params.Password, params.Email, params.FullName) {
 		return
 	}
 
@@ -49,15 +57,174 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := cfg.db.CreateUser(database.CreateUserParams{
+	user, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{
 		Email:    params.Email,
 		Password: hashedPassword,
 		FullName: params.FullName,
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create user", err)
+		respondWithDBError(w, "User", err)
 		return
 	}
 
+	if err := cfg.sendVerificationEmail(*user); err != nil {
+		log.Printf("%s[ERROR]%s couldn't send verification email: %v", colorRed, colorReset, err)
+	}
+	if !cfg.requireEmailVerification {
+		cfg.claimGrants(r, user.ID, user.Email)
+	}
+
+	event := auditUser(auditUserCreate, user.ID)
+	event.ActorID = &user.ID
+	cfg.audit(r, event)
+
 	respondWithJSON(w, http.StatusCreated, user)
 }
+
+// currentUser loads the authenticated caller, responding with an error if it can't
+func (cfg *apiConfig) currentUser(w http.ResponseWriter, r *http.Request) (*database.User, bool) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return nil, false
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, "User", err)
+		return nil, false
+	}
+	return user, true
+}
+
+// handlerUsersGetMe returns the authenticated user's profile
+func (cfg *apiConfig) handlerUsersGetMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.currentUser(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// handlerUsersUpdateMe updates profile fields. Email changes go through /api/change-email.
+func (cfg *apiConfig) handlerUsersUpdateMe(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		FullName *string `json:"full_name"`
+	}
+
+	user, ok := cfg.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	if params.FullName != nil {
+		fullName := strings.TrimSpace(*params.FullName)
+		if fullName == "" {
+			respondWithError(w, http.StatusBadRequest, "Full name cannot be empty", nil)
+			return
+		}
+		if err := cfg.db.UpdateUserProfile(r.Context(), user.ID, fullName); err != nil {
+			respondWithDBError(w, "User", err)
+			return
+		}
+	}
+
+	updated, err := cfg.db.GetUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithDBError(w, "User", err)
+		return
+	}
+
+	cfg.audit(r, auditUser(auditUserUpdate, user.ID))
+
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// handlerUsersChangePassword sets a new password after checking the current one.
+// All existing sessions are revoked and a fresh one is returned for the caller.
+func (cfg *apiConfig) handlerUsersChangePassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	type response struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	user, ok := cfg.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	match, err := auth.CheckPasswordHash(params.CurrentPassword, user.Password)
+	if err != nil || !match {
+		event := auditUser(auditUserPasswordChange, user.ID)
+		event.Outcome = database.AuditOutcomeFailure
+		cfg.audit(r, event)
+		respondWithError(w, http.StatusUnauthorized, "Current password is incorrect", err)
+		return
+	}
+
+	if !cfg.checkPassword(w, params.NewPassword, user.Email, user.FullName) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.NewPassword)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+
+	if err := cfg.db.UpdateUserPassword(r.Context(), user.ID, hashedPassword); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update password", err)
+		return
+	}
+
+	// Sign out every other device, then start a new session for this one
+	if err := cfg.db.RevokeUserRefreshTokens(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	accessToken, refreshToken, err := cfg.issueSession(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create session", err)
+		return
+	}
+
+	cfg.audit(r, auditUser(auditUserPasswordChange, user.ID))
+
+	respondWithJSON(w, http.StatusOK, response{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+	})
+}
+
+// validateEmail checks that the input is a bare email address (no display
+// name) and returns it lowercased, the form addresses are stored in
+func validateEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return "", err
+	}
+	if addr.Address != email {
+		return "", errors.New("email must not include a display name")
+	}
+	return strings.ToLower(email), nil
+}
@@ -2,7 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
@@ -19,7 +25,7 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
@@ -34,11 +40,12 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 	}
 	params.UserID = userID
 
-	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
+	video, err := cfg.db.CreateVideo(r.Context(), params.CreateVideoParams)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
 		return
 	}
+	cfg.audit(r, auditVideo(auditVideoCreate, video.ID))
 
 	signedVideo, err := cfg.dbVideoToSignedVideo(video)
 	if err != nil {
@@ -50,54 +57,27 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 }
 
 func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
-		return
-	}
-
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
-	}
-
-	video, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
-		return
-	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
+	// Only the owner may delete the video, whatever it is shared as
+	video, _, ok := cfg.authorizeVideo(w, r, actionManage, auditVideoDelete)
+	if !ok {
 		return
 	}
+	videoID := video.ID
 
-	err = cfg.db.DeleteVideo(videoID)
+	err := cfg.db.DeleteVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
 	}
+	cfg.audit(r, auditVideo(auditVideoDelete, videoID))
+	cfg.emitVideoEvent(r, webhookEventVideoDeleted, newWebhookVideo(video), nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
-		return
-	}
-
-	video, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+	video, _, ok := cfg.authorizeVideo(w, r, actionView, "")
+	if !ok {
 		return
 	}
 
@@ -110,33 +90,192 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, signedVideo)
 }
 
+// handlerVideosRetrieve lists the caller's videos a page at a time. Sorting:
+// ?sort=created|updated|title|duration|size, ?order=asc|desc. Filters:
+// ?has_video=, ?has_thumbnail=, ?watched=, ?aspect_ratio=, ?created_after=, ?created_before=,
+// ?updated_after=, ?updated_before= (RFC 3339), ?tag= (repeatable) with
+// ?tag_match=any|all. Paging: ?limit=, ?cursor=.
+// With ?q= it searches instead, see handlerVideosSearch.
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Videos     []database.Video `json:"videos"`
+		Total      int              `json:"total"`
+		Limit      int              `json:"limit"`
+		NextCursor string           `json:"next_cursor,omitempty"`
+	}
+
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	if q := r.URL.Query().Get("q"); strings.TrimSpace(q) != "" {
+		cfg.handlerVideosSearch(w, r, userID, q)
+		return
+	}
+
+	params, err := videoListParamsFromQuery(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	params.UserID = userID
+	if params.Watched != nil {
+		if err := cfg.playback.flushUser(r.Context(), userID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't save playback progress", err)
+			return
+		}
+	}
+
+	page, err := cfg.db.ListVideos(r.Context(), params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	signedVideos := make([]database.Video, len(videos))
-	for i, v := range videos {
+	// Only the videos on this page need presigned URLs
+	for i, v := range page.Videos {
 		signedVideo, err := cfg.dbVideoToSignedVideo(v)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
 			return
 		}
-		signedVideos[i] = signedVideo
+		page.Videos[i] = signedVideo
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Videos:     page.Videos,
+		Total:      page.Total,
+		Limit:      params.Limit,
+		NextCursor: page.NextCursor,
+	})
+}
+
+// videoListParamsFromQuery parses the sorting, filtering and paging options of GET /api/videos
+func videoListParamsFromQuery(query url.Values) (database.ListVideosParams, error) {
+	params := database.ListVideosParams{
+		Sort:        query.Get("sort"),
+		AspectRatio: query.Get("aspect_ratio"),
+		Cursor:      query.Get("cursor"),
+	}
+
+	if params.Sort != "" && !database.IsVideoSort(params.Sort) {
+		return params, errors.New("sort must be created, updated, title, duration or size")
+	}
+	switch order := query.Get("order"); order {
+	case "":
+		// Titles read best A to Z; everything else newest or largest first
+		params.Ascending = params.Sort == database.VideoSortTitle
+	case "asc", "desc":
+		params.Ascending = order == "asc"
+	default:
+		return params, errors.New("order must be asc or desc")
+	}
+
+	switch params.AspectRatio {
+	case "", "16:9", "9:16", "other":
+	default:
+		return params, errors.New("aspect_ratio must be 16:9, 9:16 or other")
+	}
+
+	if len(query["tag"]) > 0 {
+		tags, err := normalizeTagNames(query["tag"])
+		if err != nil {
+			return params, err
+		}
+		params.Tags = tags
+	}
+	switch query.Get("tag_match") {
+	case "", "any":
+	case "all":
+		params.MatchAllTags = true
+	default:
+		return params, errors.New("tag_match must be any or all")
+	}
+
+	for key, dest := range map[string]**bool{
+		"has_video":     &params.HasVideo,
+		"has_thumbnail": &params.HasThumbnail,
+		"watched":       &params.Watched,
+	} {
+		value := query.Get(key)
+		if value == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return params, fmt.Errorf("%s must be true or false", key)
+		}
+		*dest = &b
+	}
+
+	for key, dest := range map[string]**time.Time{
+		"created_after":  &params.CreatedAfter,
+		"created_before": &params.CreatedBefore,
+		"updated_after":  &params.UpdatedAfter,
+		"updated_before": &params.UpdatedBefore,
+	} {
+		value := query.Get(key)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return params, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+		}
+		*dest = &t
+	}
+
+	limit, err := queryInt(query, "limit", 50)
+	if err != nil || limit < 1 || limit > 200 {
+		return params, errors.New("limit must be between 1 and 200")
+	}
+	params.Limit = limit
+
+	return params, nil
+}
+
+// handlerVideosSearch serves GET /api/videos?q= with ranked, highlighted matches.
+// Every word must match, and each is treated as a prefix (?q=vac finds "vacation").
+func (cfg *apiConfig) handlerVideosSearch(w http.ResponseWriter, r *http.Request, userID uuid.UUID, q string) {
+	type response struct {
+		Videos []database.VideoSearchResult `json:"videos"`
+		Limit  int                          `json:"limit"`
+	}
+
+	limit, err := queryInt(r.URL.Query(), "limit", 20)
+	if err != nil || limit < 1 || limit > 100 {
+		respondWithError(w, http.StatusBadRequest, "limit must be between 1 and 100", err)
+		return
+	}
+
+	results, err := cfg.db.SearchVideos(r.Context(), userID, q, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+
+	for i, result := range results {
+		signedVideo, err := cfg.dbVideoToSignedVideo(result.Video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+			return
+		}
+		results[i].Video = signedVideo
 	}
 
-	respondWithJSON(w, http.StatusOK, signedVideos)
+	respondWithJSON(w, http.StatusOK, response{
+		Videos: results,
+		Limit:  limit,
+	})
 }
@@ -3,37 +3,14 @@ package main
 import (
 	"encoding/json"
 	"net/http"
-
-	"github.com/google/uuid"
+	"time"
 )
 
 // handlerVideoMetaUpdate updates video metadata (title, description)
 func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (set by AuthMiddleware)
-	userID, ok := GetUserIDFromContext(r.Context())
+	// Owners and editors may change the metadata
+	video, _, ok := cfg.authorizeVideo(w, r, actionEdit, auditVideoUpdate)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
-		return
-	}
-
-	// Parse video ID from URL
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID format", err)
-		return
-	}
-
-	// Get existing video
-	video, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Video not found", err)
-		return
-	}
-
-	// Check ownership
-	if video.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "You don't have permission to edit this video", nil)
 		return
 	}
 
@@ -63,11 +40,25 @@ func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Save updates
-	if err := cfg.db.UpdateVideo(video); err != nil {
+	video.UpdatedAt = time.Now()
+	if err := cfg.db.UpdateVideo(r.Context(), video); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update video", err)
 		return
 	}
 
+	event := auditVideo(auditVideoUpdate, video.ID)
+	event.Details = map[string]any{"title_changed": params.Title != nil, "description_changed": params.Description != nil}
+	cfg.audit(r, event)
+
+	changes := []string{}
+	if params.Title != nil {
+		changes = append(changes, "title")
+	}
+	if params.Description != nil {
+		changes = append(changes, "description")
+	}
+	cfg.emitVideoEvent(r, webhookEventVideoUpdated, newWebhookVideo(video), changes)
+
 	// Return updated video with presigned URLs
 	signedVideo, err := cfg.dbVideoToSignedVideo(video)
 	if err != nil {
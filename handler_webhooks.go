@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxWebhooks                  = 10
+	maxWebhookURLLength          = 2048
+	maxWebhookDescriptionLength  = 200
+	maxWebhookDeliveriesPageSize = 100
+)
+
+// webhookResponse is a webhook as its owner sees it. Secret is only set when
+// the webhook is created or its secret is rotated.
+type webhookResponse struct {
+	database.Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+// validateWebhookURL checks the URL events are posted to. Whether its address
+// is allowed is only known when it is dialled, see newWebhookDispatcher.
+func validateWebhookURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil || u.Fragment != "" {
+		return "", errors.New("url must be an http or https URL")
+	}
+	if len(u.String()) > maxWebhookURLLength {
+		return "", fmt.Errorf("url must be at most %d characters", maxWebhookURLLength)
+	}
+	return u.String(), nil
+}
+
+// normalizeWebhookEvents checks the event types a webhook subscribes to and
+// returns them without duplicates
+func normalizeWebhookEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, errors.New("events must list at least one event type")
+	}
+	normalized := []string{}
+	for _, event := range events {
+		if !slices.Contains(webhookEventTypes, event) {
+			return nil, fmt.Errorf("%q is not an event type; use %s", event, strings.Join(webhookEventTypes, ", "))
+		}
+		if !slices.Contains(normalized, event) {
+			normalized = append(normalized, event)
+		}
+	}
+	return normalized, nil
+}
+
+// authorizeWebhook loads the webhook in the path and checks the caller owns
+// it. Other users' webhooks are hidden behind 404 like missing ones.
+func (cfg *apiConfig) authorizeWebhook(w http.ResponseWriter, r *http.Request, auditAction string) (database.Webhook, bool) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return database.Webhook{}, false
+	}
+	webhookID, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook ID", err)
+		return database.Webhook{}, false
+	}
+
+	webhook, err := cfg.db.GetWebhook(r.Context(), webhookID)
+	if err != nil {
+		respondWithDBError(w, "Webhook", err)
+		return database.Webhook{}, false
+	}
+	event := auditEvent{}
+	if auditAction != "" {
+		event = auditWebhook(auditAction, webhookID)
+	}
+	if !cfg.enforce(w, r, "Webhook", ownerRole(webhook.UserID, userID), actionManage, event) {
+		return database.Webhook{}, false
+	}
+	return webhook, true
+}
+
+// handlerWebhooksList returns the caller's webhooks
+func (cfg *apiConfig) handlerWebhooksList(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Webhooks   []database.Webhook `json:"webhooks"`
+		EventTypes []string           `json:"event_types"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	webhooks, err := cfg.db.ListWebhooks(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list webhooks", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{Webhooks: webhooks, EventTypes: webhookEventTypes})
+}
+
+// handlerWebhookCreate adds a webhook for the caller's videos. The response
+// carries the signing secret, which isn't shown again.
+func (cfg *apiConfig) handlerWebhookCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		URL         string   `json:"url"`
+		Description string   `json:"description"`
+		Events      []string `json:"events"`
+	}
+
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	webhookURL, err := validateWebhookURL(params.URL)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	events, err := normalizeWebhookEvents(params.Events)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if len(params.Description) > maxWebhookDescriptionLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("description must be at most %d characters", maxWebhookDescriptionLength), nil)
+		return
+	}
+
+	existing, err := cfg.db.ListWebhooks(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list webhooks", err)
+		return
+	}
+	if len(existing) >= maxWebhooks {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("You can have at most %d webhooks", maxWebhooks), nil)
+		return
+	}
+
+	secret, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate webhook secret", err)
+		return
+	}
+	webhook, err := cfg.db.CreateWebhook(r.Context(), database.CreateWebhookParams{
+		UserID:      userID,
+		URL:         webhookURL,
+		Description: params.Description,
+		Secret:      secret,
+		Events:      events,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create webhook", err)
+		return
+	}
+	event := auditWebhook(auditWebhookCreate, webhook.ID)
+	event.Details = map[string]any{"events": events}
+	cfg.audit(r, event)
+
+	respondWithJSON(w, http.StatusCreated, webhookResponse{Webhook: webhook, Secret: secret})
+}
+
+func (cfg *apiConfig) handlerWebhookGet(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := cfg.authorizeWebhook(w, r, "")
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, webhook)
+}
+
+// handlerWebhookUpdate changes a webhook's URL, description, events or active
+// flag. "rotate_secret": true replaces its secret and returns the new one.
+// Deliveries already queued are sent to the new URL with the new secret.
+func (cfg *apiConfig) handlerWebhookUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		URL          *string  `json:"url"`
+		Description  *string  `json:"description"`
+		Events       []string `json:"events"`
+		Active       *bool    `json:"active"`
+		RotateSecret bool     `json:"rotate_secret"`
+	}
+
+	webhook, ok := cfg.authorizeWebhook(w, r, auditWebhookUpdate)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if params.URL != nil {
+		webhookURL, err := validateWebhookURL(*params.URL)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		webhook.URL = webhookURL
+	}
+	if params.Description != nil {
+		if len(*params.Description) > maxWebhookDescriptionLength {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("description must be at most %d characters", maxWebhookDescriptionLength), nil)
+			return
+		}
+		webhook.Description = *params.Description
+	}
+	if params.Events != nil {
+		events, err := normalizeWebhookEvents(params.Events)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		webhook.Events = events
+	}
+	if params.Active != nil {
+		webhook.Active = *params.Active
+	}
+	resp := webhookResponse{}
+	if params.RotateSecret {
+		secret, err := auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate webhook secret", err)
+			return
+		}
+		webhook.Secret, resp.Secret = secret, secret
+	}
+
+	if err := cfg.db.UpdateWebhook(r.Context(), webhook); err != nil {
+		respondWithDBError(w, "Webhook", err)
+		return
+	}
+	event := auditWebhook(auditWebhookUpdate, webhook.ID)
+	event.Details = map[string]any{
+		"url_changed":    params.URL != nil,
+		"events":         webhook.Events,
+		"active":         webhook.Active,
+		"secret_rotated": params.RotateSecret,
+	}
+	cfg.audit(r, event)
+
+	// Re-enabling a webhook sends the deliveries that were queued when it was turned off
+	if webhook.Active {
+		cfg.webhooks.notify()
+	}
+
+	webhook, err := cfg.db.GetWebhook(r.Context(), webhook.ID)
+	if err != nil {
+		respondWithDBError(w, "Webhook", err)
+		return
+	}
+	resp.Webhook = webhook
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerWebhookDelete deletes a webhook along with its delivery log and any
+// deliveries still queued
+func (cfg *apiConfig) handlerWebhookDelete(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := cfg.authorizeWebhook(w, r, auditWebhookDelete)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.DeleteWebhook(r.Context(), webhook.ID); err != nil {
+		respondWithDBError(w, "Webhook", err)
+		return
+	}
+	cfg.audit(r, auditWebhook(auditWebhookDelete, webhook.ID))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerWebhookDeliveries lists a webhook's deliveries, newest first, with
+// their status and the response to the latest attempt. Page with ?limit= and
+// ?offset=.
+func (cfg *apiConfig) handlerWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Deliveries []database.WebhookDelivery `json:"deliveries"`
+		Limit      int                        `json:"limit"`
+		Offset     int                        `json:"offset"`
+	}
+
+	webhook, ok := cfg.authorizeWebhook(w, r, "")
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	limit, err := queryInt(query, "limit", 20)
+	if err != nil || limit < 1 || limit > maxWebhookDeliveriesPageSize {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxWebhookDeliveriesPageSize), err)
+		return
+	}
+	offset, err := queryInt(query, "offset", 0)
+	if err != nil || offset < 0 {
+		respondWithError(w, http.StatusBadRequest, "offset must be a positive number", err)
+		return
+	}
+
+	deliveries, err := cfg.db.ListWebhookDeliveries(r.Context(), webhook.ID, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list deliveries", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{Deliveries: deliveries, Limit: limit, Offset: offset})
+}
+
+// webhookDelivery loads the delivery in the path, which must belong to the webhook
+func (cfg *apiConfig) webhookDelivery(w http.ResponseWriter, r *http.Request, webhook database.Webhook) (database.WebhookDelivery, bool) {
+	deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid delivery ID", err)
+		return database.WebhookDelivery{}, false
+	}
+	delivery, err := cfg.db.GetWebhookDelivery(r.Context(), deliveryID)
+	if err == nil && delivery.WebhookID != webhook.ID {
+		err = database.ErrNotFound
+	}
+	if err != nil {
+		respondWithDBError(w, "Delivery", err)
+		return database.WebhookDelivery{}, false
+	}
+	return delivery, true
+}
+
+func (cfg *apiConfig) handlerWebhookDeliveryGet(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := cfg.authorizeWebhook(w, r, "")
+	if !ok {
+		return
+	}
+	delivery, ok := cfg.webhookDelivery(w, r, webhook)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, delivery)
+}
+
+// handlerWebhookRedeliver queues a delivery's event to be sent again, as a new
+// delivery with its own attempts. The payload is the original one, so
+// receivers can spot the repeat by its event ID.
+func (cfg *apiConfig) handlerWebhookRedeliver(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := cfg.authorizeWebhook(w, r, auditWebhookRedeliver)
+	if !ok {
+		return
+	}
+	delivery, ok := cfg.webhookDelivery(w, r, webhook)
+	if !ok {
+		return
+	}
+
+	redelivery, err := cfg.db.RedeliverWebhookDelivery(r.Context(), delivery.ID)
+	if err != nil {
+		respondWithDBError(w, "Delivery", err)
+		return
+	}
+	event := auditWebhook(auditWebhookRedeliver, webhook.ID)
+	event.Details = map[string]any{"delivery_id": delivery.ID, "redelivery_id": redelivery.ID}
+	cfg.audit(r, event)
+	cfg.webhooks.notify()
+
+	respondWithJSON(w, http.StatusAccepted, redelivery)
+}
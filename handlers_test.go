@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestVideoLifecycle(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.createUser("owner@example.com")
+
+	rec := api.do(owner, http.MethodPost, "/api/videos", map[string]string{"title": "First", "description": "One"})
+	expect(t, rec, http.StatusCreated)
+	var video database.Video
+	decode(t, rec, &video)
+	if video.Title != "First" || video.UserID != owner.ID {
+		t.Fatalf("created %+v, want title First owned by %s", video, owner.ID)
+	}
+	path := "/api/videos/" + video.ID.String()
+
+	rec = api.do(owner, http.MethodPut, path, map[string]string{"title": "Renamed"})
+	expect(t, rec, http.StatusOK)
+	rec = api.do(owner, http.MethodGet, path, nil)
+	expect(t, rec, http.StatusOK)
+	decode(t, rec, &video)
+	if video.Title != "Renamed" || video.Description != "One" {
+		t.Errorf("after update got title %q, description %q; want Renamed, One", video.Title, video.Description)
+	}
+
+	expect(t, api.do(owner, http.MethodDelete, path, nil), http.StatusNoContent)
+	expect(t, api.do(owner, http.MethodGet, path, nil), http.StatusNotFound)
+	expect(t, api.do(owner, http.MethodDelete, path, nil), http.StatusNotFound)
+}
+
+func TestVideoGrants(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.createUser("owner@example.com")
+	viewer := api.createUser("viewer@example.com")
+	editor := api.createUser("editor@example.com")
+	stranger := api.createUser("stranger@example.com")
+	video := api.createVideo(owner, "Shared")
+	api.grant(owner, video.ID, viewer, database.GrantRoleViewer)
+	api.grant(owner, video.ID, editor, database.GrantRoleEditor)
+	path := "/api/videos/" + video.ID.String()
+	update := map[string]string{"title": "Changed"}
+
+	expect(t, api.do(viewer, http.MethodGet, path, nil), http.StatusOK)
+	expect(t, api.do(viewer, http.MethodPut, path, update), http.StatusForbidden)
+	expect(t, api.do(viewer, http.MethodDelete, path, nil), http.StatusForbidden)
+
+	expect(t, api.do(editor, http.MethodPut, path, update), http.StatusOK)
+	expect(t, api.do(editor, http.MethodDelete, path, nil), http.StatusForbidden)
+
+	expect(t, api.do(stranger, http.MethodGet, path, nil), http.StatusNotFound)
+	expect(t, api.do(stranger, http.MethodPut, path, update), http.StatusNotFound)
+
+	rec := api.do(viewer, http.MethodGet, "/api/shared-with-me", nil)
+	expect(t, rec, http.StatusOK)
+}
+
+func TestCommentAuthorship(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.createUser("owner@example.com")
+	author := api.createUser("author@example.com")
+	editor := api.createUser("editor@example.com")
+	video := api.createVideo(owner, "Discussed")
+	api.grant(owner, video.ID, author, database.GrantRoleCommenter)
+	api.grant(owner, video.ID, editor, database.GrantRoleEditor)
+	comments := "/api/videos/" + video.ID.String() + "/comments"
+
+	rec := api.do(author, http.MethodPost, comments, map[string]string{"body": "Nice shot"})
+	expect(t, rec, http.StatusCreated)
+	var comment database.Comment
+	decode(t, rec, &comment)
+	path := comments + "/" + comment.ID.String()
+	edit := map[string]string{"body": "Edited"}
+
+	// Only the author may change what a comment says, even the video's owner
+	expect(t, api.do(owner, http.MethodPut, path, edit), http.StatusForbidden)
+	expect(t, api.do(editor, http.MethodPut, path, edit), http.StatusForbidden)
+	expect(t, api.do(author, http.MethodPut, path, edit), http.StatusOK)
+
+	// Editors may resolve other people's comments but not delete them
+	expect(t, api.do(editor, http.MethodPost, path+"/resolve", nil), http.StatusOK)
+	expect(t, api.do(editor, http.MethodDelete, path, nil), http.StatusForbidden)
+	expect(t, api.do(owner, http.MethodDelete, path, nil), http.StatusNoContent)
+}
+
+func TestAuthMiddlewareRejectsInactiveAccounts(t *testing.T) {
+	api := newTestAPI(t)
+	disabled := api.createUser("disabled@example.com")
+	deleting := api.createUser("deleting@example.com")
+	ctx := context.Background()
+	if err := api.db.SetUserDisabled(ctx, disabled.ID, true); err != nil {
+		t.Fatalf("SetUserDisabled: %v", err)
+	}
+	if err := api.db.MarkUserForDeletion(ctx, deleting.ID); err != nil {
+		t.Fatalf("MarkUserForDeletion: %v", err)
+	}
+
+	expect(t, api.do(disabled, http.MethodGet, "/api/users/me", nil), http.StatusForbidden)
+	expect(t, api.do(deleting, http.MethodGet, "/api/users/me", nil), http.StatusUnauthorized)
+	expect(t, api.do(testUser{}, http.MethodGet, "/api/users/me", nil), http.StatusUnauthorized)
+
+	if err := api.db.SetUserDisabled(ctx, disabled.ID, false); err != nil {
+		t.Fatalf("SetUserDisabled: %v", err)
+	}
+	expect(t, api.do(disabled, http.MethodGet, "/api/users/me", nil), http.StatusOK)
+}
+
+func TestSignupEmailsAreCaseInsensitive(t *testing.T) {
+	api := newTestAPI(t)
+	signup := func(email string) *httptest.ResponseRecorder {
+		return api.do(testUser{}, http.MethodPost, "/api/users", map[string]string{
+			"email":     email,
+			"password":  "a long and unusual passphrase 4921",
+			"full_name": "Casey",
+		})
+	}
+
+	rec := signup("  Casey@Example.COM ")
+	expect(t, rec, http.StatusCreated)
+	var user database.User
+	decode(t, rec, &user)
+	if user.Email != "casey@example.com" {
+		t.Errorf("stored email %q, want it trimmed and lowercased", user.Email)
+	}
+
+	rec = signup("CASEY@example.com")
+	expect(t, rec, http.StatusConflict)
+	var apiErr APIError
+	decode(t, rec, &apiErr)
+	if apiErr.Message != "Email is already in use" {
+		t.Errorf("conflict message %q, want %q", apiErr.Message, "Email is already in use")
+	}
+}
+
+func TestUnknownResourcesAre404(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("user@example.com")
+
+	expect(t, api.do(user, http.MethodGet, "/api/videos/"+uuid.NewString(), nil), http.StatusNotFound)
+	expect(t, api.do(user, http.MethodGet, "/api/collections/"+uuid.NewString(), nil), http.StatusNotFound)
+	expect(t, api.do(user, http.MethodDelete, "/api/tags/"+uuid.NewString(), nil), http.StatusNotFound)
+	expect(t, api.do(user, http.MethodGet, "/api/webhooks/"+uuid.NewString(), nil), http.StatusNotFound)
+}
+
+func TestLoginUnknownEmailFailsLikeAWrongPassword(t *testing.T) {
+	api := newTestAPI(t)
+	const password = "a long and unusual passphrase 4921"
+	expect(t, api.do(testUser{}, http.MethodPost, "/api/users", map[string]string{
+		"email": "known@example.com", "password": password, "full_name": "Known",
+	}), http.StatusCreated)
+
+	// The dummy hash must cost as much to check as a real one
+	real, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "$argon2id$v=19$m=65536,t=1,p=1$<salt>$<key>" without the salt and key
+	params := func(hash string) string { return strings.Join(strings.Split(hash, "$")[:4], "$") }
+	if params(dummyPasswordHash) != params(real) {
+		t.Errorf("dummy hash parameters %q, want %q like HashPassword", params(dummyPasswordHash), params(real))
+	}
+	if match, err := auth.CheckPasswordHash(password, dummyPasswordHash); err != nil || match {
+		t.Errorf("CheckPasswordHash against the dummy hash = %v, %v; want a mismatch", match, err)
+	}
+
+	login := func(email, password string) APIError {
+		rec := api.do(testUser{}, http.MethodPost, "/api/login", map[string]string{"email": email, "password": password})
+		expect(t, rec, http.StatusUnauthorized)
+		var apiErr APIError
+		decode(t, rec, &apiErr)
+		return apiErr
+	}
+	if unknown, wrong := login("unknown@example.com", password), login("known@example.com", "wrong password"); unknown != wrong {
+		t.Errorf("unknown email got %+v, wrong password %+v; want the same", unknown, wrong)
+	}
+}
+
+func TestAdminDeleteUserRunsInTheBackground(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.createUser("admin@example.com")
+	if err := api.db.UpdateUserRole(context.Background(), admin.ID, database.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	target := api.createUser("target@example.com")
+	api.createVideo(target, "Doomed")
+	path := "/admin/users/" + target.ID.String()
+
+	expect(t, api.do(admin, http.MethodDelete, path, nil), http.StatusAccepted)
+	// Locked out at once, before the cascade finishes
+	expect(t, api.do(target, http.MethodGet, "/api/users/me", nil), http.StatusUnauthorized)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := api.db.GetUser(context.Background(), target.ID)
+		if errors.Is(err, database.ErrNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("user still there after 5s: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPasswordResetSignsOutEverySession(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("forgetful@example.com")
+	ctx := context.Background()
+	if _, err := api.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token: "stolen", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	reset, err := api.db.CreatePasswordResetToken(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, api.do(testUser{}, http.MethodPost, "/api/reset-password", map[string]string{
+		"token": reset.Token, "new_password": "a long and unusual passphrase 4921",
+	}), http.StatusOK)
+	if _, err := api.db.GetUserByRefreshToken(ctx, "stolen"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("refresh token after the reset: got %v, want ErrNotFound", err)
+	}
+	expect(t, api.do(testUser{}, http.MethodPost, "/api/reset-password", map[string]string{
+		"token": reset.Token, "new_password": "another long and unusual passphrase 7713",
+	}), http.StatusBadRequest)
+}
+
+func TestConfirmEmailChangeForADeletedUserIs404(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("leaving@example.com")
+	token, err := auth.MakeEmailToken(user.ID, "new@example.com", user.Email, auth.TokenTypeEmailChange, api.cfg.jwtKeys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.db.DeleteUser(context.Background(), user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, api.do(testUser{}, http.MethodPost, "/api/confirm-email-change", map[string]string{"token": token}), http.StatusNotFound)
+}
+
+func TestFileChangesSendVideoUpdated(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.createUser("owner@example.com")
+	ctx := context.Background()
+	if err := api.db.MarkUserEmailVerified(ctx, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+	video := api.createVideo(owner, "Captioned")
+	webhook, err := api.db.CreateWebhook(ctx, database.CreateWebhookParams{
+		UserID: owner.ID,
+		URL:    "https://hooks.example.com/updates",
+		Secret: "webhook-secret",
+		Events: []string{webhookEventVideoUpdated},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]string{"{videoID}": video.ID.String()}
+	path := "/api/videos/" + video.ID.String()
+
+	expect(t, api.serveAs(owner, routeRequest(t, "POST /api/thumbnail_upload/{videoID}", ids, "")), http.StatusOK)
+	expect(t, api.serveAs(owner, routeRequest(t, "POST /api/captions_upload/{videoID}", ids, "")), http.StatusOK)
+	expect(t, api.do(owner, http.MethodDelete, path+"/captions", nil), http.StatusOK)
+	expect(t, api.do(owner, http.MethodDelete, path+"/thumbnail", nil), http.StatusOK)
+	// There is no file to remove, so nothing changes
+	expect(t, api.do(owner, http.MethodDelete, path+"/video-file", nil), http.StatusOK)
+
+	deliveries, err := api.db.ListWebhookDeliveries(ctx, webhook.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, listed := range deliveries {
+		delivery, err := api.db.GetWebhookDelivery(ctx, listed.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payload webhookPayload
+		if err := json.Unmarshal(delivery.Payload, &payload); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, strings.Join(payload.Changes, ","))
+	}
+	// Deliveries made in the same instant have no order, so compare sorted
+	slices.Sort(got)
+	if want := []string{"captions", "captions", "thumbnail", "thumbnail"}; !slices.Equal(got, want) {
+		t.Errorf("video.updated changes %q, want %q", got, want)
+	}
+}
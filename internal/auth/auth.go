@@ -17,7 +17,9 @@ import (
 type TokenType string
 
 const (
-	TokenTypeAccess TokenType = "vaultstream-access"
+	TokenTypeAccess            TokenType = "vaultstream-access"
+	TokenTypeEmailVerification TokenType = "vaultstream-email-verification"
+	TokenTypeEmailChange       TokenType = "vaultstream-email-change"
 )
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
@@ -40,25 +42,23 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 
 func MakeJWT(
 	userID uuid.UUID,
-	tokenSecret string,
+	keys *KeySet,
 	expiresIn time.Duration,
 ) (string, error) {
-	signingKey := []byte(tokenSecret)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+	return keys.Sign(jwt.RegisteredClaims{
 		Issuer:    string(TokenTypeAccess),
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
 		Subject:   userID.String(),
 	})
-	return token.SignedString(signingKey)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+func ValidateJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
 	claimsStruct := jwt.RegisteredClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&claimsStruct,
-		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+		keys.Keyfunc,
 	)
 	if err != nil {
 		return uuid.Nil, err
@@ -84,6 +84,59 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	return id, nil
 }
 
+// EmailTokenClaims binds a signed email token to the address it was sent to.
+// PreviousEmail is set for email change tokens so a stale link can't be replayed
+// after the address has changed again.
+type EmailTokenClaims struct {
+	Email         string `json:"email"`
+	PreviousEmail string `json:"previous_email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// MakeEmailToken creates a signed token for email verification or email change links
+func MakeEmailToken(
+	userID uuid.UUID,
+	email string,
+	previousEmail string,
+	tokenType TokenType,
+	keys *KeySet,
+	expiresIn time.Duration,
+) (string, error) {
+	return keys.Sign(EmailTokenClaims{
+		Email:         email,
+		PreviousEmail: previousEmail,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(tokenType),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+	})
+}
+
+// ValidateEmailToken checks the signature, expiry and type of an email token
+func ValidateEmailToken(tokenString string, tokenType TokenType, keys *KeySet) (uuid.UUID, EmailTokenClaims, error) {
+	claims := EmailTokenClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&claims,
+		keys.Keyfunc,
+	)
+	if err != nil {
+		return uuid.Nil, EmailTokenClaims{}, err
+	}
+
+	if claims.Issuer != string(tokenType) {
+		return uuid.Nil, EmailTokenClaims{}, errors.New("invalid issuer")
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, EmailTokenClaims{}, fmt.Errorf("invalid user ID: %w", err)
+	}
+	return id, claims, nil
+}
+
 func GetBearerToken(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+	AlgHS256 = "HS256"
+
+	// LegacyKeyID identifies the HS256 JWT_SECRET key. Tokens issued before
+	// key rotation have no "kid" header and are verified against it.
+	LegacyKeyID = "legacy"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is a single signing/verification key identified by its kid
+type Key struct {
+	ID        string
+	Algorithm string
+	RetiredAt *time.Time
+
+	signingKey   interface{} // ed25519.PrivateKey, *rsa.PrivateKey or []byte
+	verifyingKey interface{} // ed25519.PublicKey, *rsa.PublicKey or []byte
+}
+
+// NewHMACKey creates an HS256 key from a shared secret
+func NewHMACKey(kid, secret string) *Key {
+	return &Key{
+		ID:           kid,
+		Algorithm:    AlgHS256,
+		signingKey:   []byte(secret),
+		verifyingKey: []byte(secret),
+	}
+}
+
+// ParsePrivateKeyPEM loads an Ed25519 (EdDSA) or RSA (RS256) private key from PEM
+func ParsePrivateKeyPEM(kid string, pemBytes []byte) (*Key, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM data found", kid)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", kid, err)
+	}
+
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		return &Key{ID: kid, Algorithm: AlgEdDSA, signingKey: k, verifyingKey: k.Public()}, nil
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("key %s: RSA keys must be at least 2048 bits", kid)
+		}
+		return &Key{ID: kid, Algorithm: AlgRS256, signingKey: k, verifyingKey: &k.PublicKey}, nil
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", kid, parsed)
+	}
+}
+
+func (k *Key) signingMethod() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
+
+// KeySet signs tokens with the active key and verifies them with any key that
+// is still valid. Retired keys keep verifying until RetiredAt + grace period.
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+	grace  time.Duration
+}
+
+func NewKeySet(active *Key, grace time.Duration, others ...*Key) (*KeySet, error) {
+	if active == nil {
+		return nil, errors.New("key set needs an active key")
+	}
+	if active.RetiredAt != nil {
+		return nil, fmt.Errorf("active key %s is retired", active.ID)
+	}
+
+	ks := &KeySet{
+		active: active,
+		keys:   map[string]*Key{active.ID: active},
+		grace:  grace,
+	}
+	for _, k := range others {
+		if _, exists := ks.keys[k.ID]; exists {
+			return nil, fmt.Errorf("duplicate key ID %s", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+	return ks, nil
+}
+
+// keySetFile is the on-disk format read by LoadKeySetFile
+type keySetFile struct {
+	Keys []struct {
+		ID             string     `json:"kid"`
+		Algorithm      string     `json:"alg"`
+		PrivateKeyFile string     `json:"private_key_file"`
+		Secret         string     `json:"secret"`
+		Active         bool       `json:"active"`
+		RetiredAt      *time.Time `json:"retired_at"`
+	} `json:"keys"`
+}
+
+// LoadKeySetFile reads a JSON key set. Key file paths are relative to the key set file.
+func LoadKeySetFile(path string, grace time.Duration) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keySetFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("couldn't parse key set: %w", err)
+	}
+
+	var active *Key
+	var others []*Key
+	for _, entry := range file.Keys {
+		if entry.ID == "" {
+			return nil, errors.New("every key needs a kid")
+		}
+
+		var key *Key
+		if entry.Algorithm == AlgHS256 {
+			if entry.Secret == "" {
+				return nil, fmt.Errorf("key %s: HS256 keys need a secret", entry.ID)
+			}
+			key = NewHMACKey(entry.ID, entry.Secret)
+		} else {
+			keyPath := entry.PrivateKeyFile
+			if !filepath.IsAbs(keyPath) {
+				keyPath = filepath.Join(filepath.Dir(path), keyPath)
+			}
+			pemBytes, err := os.ReadFile(keyPath)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", entry.ID, err)
+			}
+			key, err = ParsePrivateKeyPEM(entry.ID, pemBytes)
+			if err != nil {
+				return nil, err
+			}
+			if entry.Algorithm != "" && entry.Algorithm != key.Algorithm {
+				return nil, fmt.Errorf("key %s: alg %s doesn't match key type %s", entry.ID, entry.Algorithm, key.Algorithm)
+			}
+		}
+		key.RetiredAt = entry.RetiredAt
+
+		if entry.Active {
+			if active != nil {
+				return nil, fmt.Errorf("keys %s and %s are both active", active.ID, entry.ID)
+			}
+			active = key
+		} else {
+			others = append(others, key)
+		}
+	}
+
+	return NewKeySet(active, grace, others...)
+}
+
+// ActiveKeyID returns the kid new tokens are signed with
+func (ks *KeySet) ActiveKeyID() string {
+	return ks.active.ID
+}
+
+// Sign creates a signed token with the active key and a "kid" header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.signingMethod(), claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.signingKey)
+}
+
+// Keyfunc resolves the verification key for a token by its "kid" header,
+// rejecting unknown, expired or algorithm-mismatched keys
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = LegacyKeyID
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok || !ks.usable(key) {
+		return nil, ErrUnknownKey
+	}
+
+	// Never let the token pick the algorithm (e.g. HS256 signed with an RSA public key)
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+	}
+	return key.verifyingKey, nil
+}
+
+func (ks *KeySet) usable(key *Key) bool {
+	if key.RetiredAt == nil {
+		return true
+	}
+	return time.Now().Before(key.RetiredAt.Add(ks.grace))
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys other services can use to verify our tokens.
+// Symmetric (HS256) keys are never published.
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if !ks.usable(key) {
+			continue
+		}
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Algorithm}
+		switch pub := key.verifyingKey.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID })
+	return jwks
+}
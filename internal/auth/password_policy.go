@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy describes the rules new passwords must satisfy
+type PasswordPolicy struct {
+	MinLength      int     `json:"min_length"`
+	MaxLength      int     `json:"max_length"`
+	RequireLower   bool    `json:"require_lower"`
+	RequireUpper   bool    `json:"require_upper"`
+	RequireDigit   bool    `json:"require_digit"`
+	RequireSymbol  bool    `json:"require_symbol"`
+	MinEntropyBits float64 `json:"min_entropy_bits"`
+
+	// Breached is optional; when set, passwords found in the list are rejected
+	Breached *BreachedPasswordList `json:"-"`
+}
+
+// DefaultPasswordPolicy follows NIST 800-63B: length over composition rules
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:      8,
+	MaxLength:      128,
+	MinEntropyBits: 30,
+}
+
+// PasswordViolation is a single reason a password was rejected
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	ViolationTooShort         = "too_short"
+	ViolationTooLong          = "too_long"
+	ViolationMissingLower     = "missing_lowercase"
+	ViolationMissingUpper     = "missing_uppercase"
+	ViolationMissingDigit     = "missing_digit"
+	ViolationMissingSymbol    = "missing_symbol"
+	ViolationTooPredictable   = "too_predictable"
+	ViolationContainsPersonal = "contains_personal_info"
+	ViolationBreached         = "breached"
+)
+
+// Validate checks the password against the policy and returns every violation.
+// userInputs (e.g. email, name) are rejected if the password contains them.
+func (p PasswordPolicy) Validate(password string, userInputs ...string) ([]PasswordViolation, error) {
+	violations := []PasswordViolation{}
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{ViolationTooShort, fmt.Sprintf("Password must be at least %d characters", p.MinLength)})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PasswordViolation{ViolationTooLong, fmt.Sprintf("Password must be at most %d characters", p.MaxLength)})
+	}
+
+	classes := characterClasses(password)
+	if p.RequireLower && !classes.lower {
+		violations = append(violations, PasswordViolation{ViolationMissingLower, "Password must contain a lowercase letter"})
+	}
+	if p.RequireUpper && !classes.upper {
+		violations = append(violations, PasswordViolation{ViolationMissingUpper, "Password must contain an uppercase letter"})
+	}
+	if p.RequireDigit && !classes.digit {
+		violations = append(violations, PasswordViolation{ViolationMissingDigit, "Password must contain a number"})
+	}
+	if p.RequireSymbol && !classes.symbol {
+		violations = append(violations, PasswordViolation{ViolationMissingSymbol, "Password must contain a symbol"})
+	}
+
+	lowered := strings.ToLower(password)
+	for _, input := range userInputs {
+		// Use the local part of emails; short fragments are too likely to match by chance
+		input, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(input)), "@")
+		if len(input) >= 4 && strings.Contains(lowered, input) {
+			violations = append(violations, PasswordViolation{ViolationContainsPersonal, "Password must not contain your name or email"})
+			break
+		}
+	}
+
+	if p.MinEntropyBits > 0 && EstimateEntropy(password) < p.MinEntropyBits {
+		violations = append(violations, PasswordViolation{ViolationTooPredictable, "Password is too predictable; try a longer passphrase"})
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{ViolationBreached, "Password has appeared in a data breach; choose a different one"})
+		}
+	}
+
+	return violations, nil
+}
+
+type classSet struct {
+	lower, upper, digit, symbol, other bool
+}
+
+func characterClasses(password string) classSet {
+	var c classSet
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			c.lower = true
+		case r >= 'A' && r <= 'Z':
+			c.upper = true
+		case r >= '0' && r <= '9':
+			c.digit = true
+		case r < unicode.MaxASCII && (unicode.IsPunct(r) || unicode.IsSymbol(r) || r == ' '):
+			c.symbol = true
+		default:
+			c.other = true
+		}
+	}
+	return c
+}
+
+// EstimateEntropy gives a rough strength estimate in bits: log2 of the character pool
+// for each character, with repeats and sequential runs (e.g. "aaa", "1234") counting less
+func EstimateEntropy(password string) float64 {
+	classes := characterClasses(password)
+	pool := 0
+	if classes.lower {
+		pool += 26
+	}
+	if classes.upper {
+		pool += 26
+	}
+	if classes.digit {
+		pool += 10
+	}
+	if classes.symbol {
+		pool += 33
+	}
+	if classes.other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	bitsPerChar := math.Log2(float64(pool))
+
+	seen := map[rune]bool{}
+	var prev rune
+	var bits float64
+	for i, r := range []rune(password) {
+		weight := 1.0
+		switch {
+		case i > 0 && (r == prev || r == prev+1 || r == prev-1):
+			weight = 0.25
+		case seen[r]:
+			weight = 0.5
+		}
+		bits += bitsPerChar * weight
+		seen[r] = true
+		prev = r
+	}
+	return bits
+}
+
+// BreachedPasswordList checks passwords against a local copy of a breached
+// password corpus in k-anonymity range format: one file per 5-character SHA-1
+// prefix (e.g. "21BD1" or "21BD1.txt"), each line "SUFFIX:COUNT".
+type BreachedPasswordList struct {
+	dir string
+}
+
+func NewBreachedPasswordList(dir string) (*BreachedPasswordList, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &BreachedPasswordList{dir: dir}, nil
+}
+
+// Contains reports whether the password's SHA-1 hash appears in the list
+func (b *BreachedPasswordList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(b.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(b.dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+		// Padding entries (count 0) are decoys, not real breaches
+		if n, err := strconv.Atoi(count); err == nil && n == 0 {
+			return false, nil
+		}
+		return true, nil
+	}
+	return false, scanner.Err()
+}
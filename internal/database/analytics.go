@@ -0,0 +1,312 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Analytics event types reported by players
+const (
+	AnalyticsEventPlay     = "play"
+	AnalyticsEventProgress = "progress"
+	AnalyticsEventComplete = "complete"
+)
+
+// Where analytics events come from
+const (
+	AnalyticsSourceApp   = "app"
+	AnalyticsSourceShare = "share"
+)
+
+// AnalyticsDay is the UTC day t falls on, as stored in the analytics tables
+func AnalyticsDay(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// AnalyticsEvent is one raw playback report
+type AnalyticsEvent struct {
+	CreatedAt time.Time
+	VideoID   uuid.UUID
+	// ViewerKey identifies the viewer without naming them, to count unique viewers
+	ViewerKey    string
+	Source       string // one of the AnalyticsSource constants
+	Type         string // one of the AnalyticsEvent constants
+	WatchSeconds float64
+}
+
+// BandwidthUsage is bytes served for a video's files on one day
+type BandwidthUsage struct {
+	VideoID uuid.UUID
+	Day     string
+	Bytes   int64
+}
+
+// VideoStats are the rolled-up analytics of one or more videos
+type VideoStats struct {
+	Views         int     `json:"views"`
+	UniqueViewers int     `json:"unique_viewers"`
+	WatchSeconds  float64 `json:"watch_seconds"`
+	Completions   int     `json:"completions"`
+	BytesServed   int64   `json:"bytes_served"`
+}
+
+// Add sums other into s, except for unique viewers: someone who watched on
+// two days, or two videos, would be counted twice. Count those over the whole
+// range with CountVideoViewers or CountUserViewers.
+func (s *VideoStats) Add(other VideoStats) {
+	s.Views += other.Views
+	s.WatchSeconds += other.WatchSeconds
+	s.Completions += other.Completions
+	s.BytesServed += other.BytesServed
+}
+
+type DailyVideoStats struct {
+	Day string `json:"day"`
+	VideoStats
+}
+
+type VideoStatsSummary struct {
+	VideoID uuid.UUID `json:"video_id"`
+	Title   string    `json:"title"`
+	VideoStats
+}
+
+// statsSums totals video_daily_stats rows, with uniqueViewers as the
+// expression that counts their viewers
+func statsSums(uniqueViewers string) string {
+	return `SUM(s.views), ` + uniqueViewers + `, SUM(s.watch_seconds), SUM(s.completions), SUM(s.bytes_served)`
+}
+
+func statsFields(stats *VideoStats) []any {
+	return []any{&stats.Views, &stats.UniqueViewers, &stats.WatchSeconds, &stats.Completions, &stats.BytesServed}
+}
+
+// SaveAnalyticsEvents stores raw events. Events for videos deleted since they
+// were reported are dropped.
+func (c Client) SaveAnalyticsEvents(ctx context.Context, events []AnalyticsEvent) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	exists := map[uuid.UUID]bool{}
+	query := `
+	INSERT INTO analytics_events (id, created_at, day, video_id, viewer_key, source, type, watch_seconds)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, event := range events {
+		found, ok := exists[event.VideoID]
+		if !ok {
+			var n int
+			if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM videos WHERE id = ?", event.VideoID).Scan(&n); err != nil {
+				return err
+			}
+			found = n > 0
+			exists[event.VideoID] = found
+		}
+		if !found {
+			continue
+		}
+		t := event.CreatedAt.UTC()
+		_, err := tx.ExecContext(ctx, query, uuid.New(), t, AnalyticsDay(t), event.VideoID, event.ViewerKey, event.Source, event.Type, event.WatchSeconds)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AddBandwidthUsage adds bytes served to each video's daily stats, skipping
+// videos that have been deleted
+func (c Client) AddBandwidthUsage(ctx context.Context, usage []BandwidthUsage) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO video_daily_stats (video_id, day, bytes_served)
+	VALUES (?, ?, ?)
+	ON CONFLICT(video_id, day) DO UPDATE SET
+		bytes_served = video_daily_stats.bytes_served + excluded.bytes_served
+	`
+	for _, u := range usage {
+		var n int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM videos WHERE id = ?", u.VideoID).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, query, u.VideoID, u.Day, u.Bytes); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RollupAnalytics recomputes the event counts in video_daily_stats for every
+// day from fromDay on, and records who the viewers were in
+// video_daily_viewers. Raw events must still exist for those days.
+func (c Client) RollupAnalytics(ctx context.Context, fromDay string) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO video_daily_stats (video_id, day, views, unique_viewers, watch_seconds, completions)
+	SELECT video_id, day,
+		SUM(CASE WHEN type = ? THEN 1 ELSE 0 END),
+		COUNT(DISTINCT viewer_key),
+		SUM(watch_seconds),
+		SUM(CASE WHEN type = ? THEN 1 ELSE 0 END)
+	FROM analytics_events
+	WHERE day >= ?
+	GROUP BY video_id, day
+	ON CONFLICT(video_id, day) DO UPDATE SET
+		views = excluded.views,
+		unique_viewers = excluded.unique_viewers,
+		watch_seconds = excluded.watch_seconds,
+		completions = excluded.completions
+	`
+	if _, err := tx.ExecContext(ctx, query, AnalyticsEventPlay, AnalyticsEventComplete, fromDay); err != nil {
+		return err
+	}
+	viewers := `
+	INSERT INTO video_daily_viewers (video_id, day, viewer_key)
+	SELECT DISTINCT video_id, day, viewer_key
+	FROM analytics_events
+	WHERE day >= ?
+	ON CONFLICT(video_id, day, viewer_key) DO NOTHING
+	`
+	if _, err := tx.ExecContext(ctx, viewers, fromDay); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PruneAnalyticsEvents deletes raw events from before beforeDay
+func (c Client) PruneAnalyticsEvents(ctx context.Context, beforeDay string) error {
+	_, err := c.db.ExecContext(ctx, "DELETE FROM analytics_events WHERE day < ?", beforeDay)
+	return err
+}
+
+// ListVideoDailyStats returns the video's stats for each day from fromDay to
+// toDay inclusive that had any activity
+func (c Client) ListVideoDailyStats(ctx context.Context, videoID uuid.UUID, fromDay, toDay string) ([]DailyVideoStats, error) {
+	query := `
+	SELECT s.day, ` + statsSums(`SUM(s.unique_viewers)`) + `
+	FROM video_daily_stats s
+	WHERE s.video_id = ? AND s.day >= ? AND s.day <= ?
+	GROUP BY s.day
+	ORDER BY s.day
+	`
+	return c.listDailyStats(ctx, query, videoID, fromDay, toDay)
+}
+
+// ListUserDailyStats is ListVideoDailyStats summed over all the user's
+// videos. Someone who watched several of them on a day is one unique viewer.
+func (c Client) ListUserDailyStats(ctx context.Context, userID uuid.UUID, fromDay, toDay string) ([]DailyVideoStats, error) {
+	query := `
+	SELECT s.day, ` + statsSums(`COALESCE(MAX(dv.viewers), SUM(s.unique_viewers))`) + `
+	FROM video_daily_stats s
+	JOIN videos v ON v.id = s.video_id
+	LEFT JOIN (
+		SELECT d.day, COUNT(DISTINCT d.viewer_key) AS viewers
+		FROM video_daily_viewers d
+		JOIN videos vv ON vv.id = d.video_id
+		WHERE vv.user_id = ? AND d.day >= ? AND d.day <= ?
+		GROUP BY d.day
+	) dv ON dv.day = s.day
+	WHERE v.user_id = ? AND s.day >= ? AND s.day <= ?
+	GROUP BY s.day
+	ORDER BY s.day
+	`
+	return c.listDailyStats(ctx, query, userID, fromDay, toDay, userID, fromDay, toDay)
+}
+
+func (c Client) listDailyStats(ctx context.Context, query string, args ...any) ([]DailyVideoStats, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []DailyVideoStats{}
+	for rows.Next() {
+		var day DailyVideoStats
+		if err := rows.Scan(append([]any{&day.Day}, statsFields(&day.VideoStats)...)...); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// ListUserVideoStats totals each of the user's videos with any activity from
+// fromDay to toDay inclusive, most viewed first. Unique viewers are counted
+// over the whole range.
+func (c Client) ListUserVideoStats(ctx context.Context, userID uuid.UUID, fromDay, toDay string) ([]VideoStatsSummary, error) {
+	query := `
+	SELECT v.id, v.title, ` + statsSums(`COALESCE(MAX(dv.viewers), 0)`) + `
+	FROM video_daily_stats s
+	JOIN videos v ON v.id = s.video_id
+	LEFT JOIN (
+		SELECT d.video_id, COUNT(DISTINCT d.viewer_key) AS viewers
+		FROM video_daily_viewers d
+		WHERE d.day >= ? AND d.day <= ?
+		GROUP BY d.video_id
+	) dv ON dv.video_id = v.id
+	WHERE v.user_id = ? AND s.day >= ? AND s.day <= ?
+	GROUP BY v.id, v.title
+	ORDER BY SUM(s.views) DESC, SUM(s.watch_seconds) DESC, v.id
+	`
+	rows, err := c.db.QueryContext(ctx, query, fromDay, toDay, userID, fromDay, toDay)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []VideoStatsSummary{}
+	for rows.Next() {
+		var video VideoStatsSummary
+		if err := rows.Scan(append([]any{&video.VideoID, &video.Title}, statsFields(&video.VideoStats)...)...); err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// CountVideoViewers counts the distinct viewers of the video from fromDay to
+// toDay inclusive
+func (c Client) CountVideoViewers(ctx context.Context, videoID uuid.UUID, fromDay, toDay string) (int, error) {
+	query := `
+	SELECT COUNT(DISTINCT viewer_key)
+	FROM video_daily_viewers
+	WHERE video_id = ? AND day >= ? AND day <= ?
+	`
+	var n int
+	err := c.db.QueryRowContext(ctx, query, videoID, fromDay, toDay).Scan(&n)
+	return n, err
+}
+
+// CountUserViewers counts the distinct viewers of any of the user's videos
+// from fromDay to toDay inclusive
+func (c Client) CountUserViewers(ctx context.Context, userID uuid.UUID, fromDay, toDay string) (int, error) {
+	query := `
+	SELECT COUNT(DISTINCT d.viewer_key)
+	FROM video_daily_viewers d
+	JOIN videos v ON v.id = d.video_id
+	WHERE v.user_id = ? AND d.day >= ? AND d.day <= ?
+	`
+	var n int
+	err := c.db.QueryRowContext(ctx, query, userID, fromDay, toDay).Scan(&n)
+	return n, err
+}
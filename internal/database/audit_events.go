@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+	AuditOutcomeDenied  = "denied"
+)
+
+type AuditEvent struct {
+	ID         uuid.UUID      `json:"id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	ActorID    *uuid.UUID     `json:"actor_id"`
+	Action     string         `json:"action"`
+	TargetType string         `json:"target_type,omitempty"`
+	TargetID   string         `json:"target_id,omitempty"`
+	IP         string         `json:"ip"`
+	UserAgent  string         `json:"user_agent"`
+	Outcome    string         `json:"outcome"`
+	Details    map[string]any `json:"details,omitempty"`
+}
+
+type CreateAuditEventParams struct {
+	ActorID    *uuid.UUID
+	Action     string
+	TargetType string
+	TargetID   string
+	IP         string
+	UserAgent  string
+	Outcome    string
+	Details    map[string]any
+}
+
+// AuditEventFilter narrows ListAuditEvents. Zero values match everything.
+type AuditEventFilter struct {
+	ActorID    *uuid.UUID
+	TargetType string
+	TargetID   string
+	Action     string // exact match, or a prefix when it ends in "*" (e.g. "admin.*")
+	Outcome    string
+	Since      *time.Time
+	Until      *time.Time
+	// InvolvingUser matches events where the user is either the actor or the target
+	InvolvingUser *uuid.UUID
+	Limit         int // 0 means no limit
+	Offset        int
+}
+
+// CreateAuditEvent appends an event to the audit log
+func (c Client) CreateAuditEvent(ctx context.Context, params CreateAuditEventParams) error {
+	var actorID *string
+	if params.ActorID != nil {
+		id := params.ActorID.String()
+		actorID = &id
+	}
+
+	var details *string
+	if len(params.Details) > 0 {
+		encoded, err := json.Marshal(params.Details)
+		if err != nil {
+			return err
+		}
+		detailsStr := string(encoded)
+		details = &detailsStr
+	}
+
+	query := `
+		INSERT INTO audit_events
+			(id, created_at, actor_id, action, target_type, target_id, ip, user_agent, outcome, details)
+		VALUES
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.ExecContext(
+		ctx,
+		query,
+		uuid.New().String(),
+		time.Now().UTC(),
+		actorID,
+		params.Action,
+		params.TargetType,
+		params.TargetID,
+		params.IP,
+		params.UserAgent,
+		params.Outcome,
+		details,
+	)
+	return err
+}
+
+// ListAuditEvents returns matching events, newest first
+func (c Client) ListAuditEvents(ctx context.Context, filter AuditEventFilter) ([]AuditEvent, error) {
+	events := []AuditEvent{}
+	err := c.StreamAuditEvents(ctx, filter, func(event AuditEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+// StreamAuditEvents calls fn for each matching event, newest first, without
+// loading the whole result set into memory
+func (c Client) StreamAuditEvents(ctx context.Context, filter AuditEventFilter, fn func(AuditEvent) error) error {
+	conditions := []string{}
+	args := []any{}
+	if filter.ActorID != nil {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, filter.ActorID.String())
+	}
+	if filter.InvolvingUser != nil {
+		conditions = append(conditions, "(actor_id = ? OR (target_type = 'user' AND target_id = ?))")
+		args = append(args, filter.InvolvingUser.String(), filter.InvolvingUser.String())
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if prefix, ok := strings.CutSuffix(filter.Action, "*"); ok {
+		conditions = append(conditions, "action LIKE ? ESCAPE '\\'")
+		args = append(args, escapeLike(prefix)+"%")
+	} else if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.Outcome != "" {
+		conditions = append(conditions, "outcome = ?")
+		args = append(args, filter.Outcome)
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC())
+	}
+
+	query := `
+		SELECT id, created_at, actor_id, action, target_type, target_id, ip, user_agent, outcome, details
+		FROM audit_events
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event AuditEvent
+		var id string
+		var actorID, details sql.NullString
+		if err := rows.Scan(
+			&id,
+			&event.CreatedAt,
+			&actorID,
+			&event.Action,
+			&event.TargetType,
+			&event.TargetID,
+			&event.IP,
+			&event.UserAgent,
+			&event.Outcome,
+			&details,
+		); err != nil {
+			return err
+		}
+
+		event.ID, err = uuid.Parse(id)
+		if err != nil {
+			return err
+		}
+		if actorID.Valid {
+			parsed, err := uuid.Parse(actorID.String)
+			if err != nil {
+				return err
+			}
+			event.ActorID = &parsed
+		}
+		if details.Valid {
+			if err := json.Unmarshal([]byte(details.String), &event.Details); err != nil {
+				return err
+			}
+		}
+
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// escapeLike escapes LIKE wildcards so user input is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
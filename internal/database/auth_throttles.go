@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type AuthThrottle struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// GetAuthThrottle returns the throttle state for a key, or a zero value if there is none
+func (c Client) GetAuthThrottle(ctx context.Context, key string) (AuthThrottle, error) {
+	query := `
+		SELECT key, failures, last_failure_at, locked_until
+		FROM auth_throttles
+		WHERE key = ?
+	`
+	var t AuthThrottle
+	err := c.db.QueryRowContext(ctx, query, key).Scan(&t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return AuthThrottle{}, nil
+		}
+		return AuthThrottle{}, err
+	}
+	return t, nil
+}
+
+// IncrementAuthThrottle atomically records a failure and returns the new failure count.
+// Failures older than windowStart are forgotten and the count starts over.
+func (c Client) IncrementAuthThrottle(ctx context.Context, key string, windowStart time.Time) (int, error) {
+	now := time.Now().UTC()
+	query := `
+		INSERT INTO auth_throttles (key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			failures = CASE WHEN auth_throttles.last_failure_at < ? THEN 1 ELSE auth_throttles.failures + 1 END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures
+	`
+	var failures int
+	err := c.db.QueryRowContext(ctx, query, key, now, windowStart.UTC()).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+	return failures, nil
+}
+
+// LockAuthThrottle blocks further attempts for the key until the given time
+func (c Client) LockAuthThrottle(ctx context.Context, key string, until time.Time) error {
+	query := `
+		UPDATE auth_throttles
+		SET locked_until = ?
+		WHERE key = ?
+	`
+	_, err := c.db.ExecContext(ctx, query, until.UTC(), key)
+	return err
+}
+
+// ClearAuthThrottle resets the failure count and lockout for a key
+func (c Client) ClearAuthThrottle(ctx context.Context, key string) error {
+	query := `
+		DELETE FROM auth_throttles
+		WHERE key = ?
+	`
+	_, err := c.db.ExecContext(ctx, query, key)
+	return err
+}
@@ -0,0 +1,316 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Collection is an ordered playlist of one user's videos
+type Collection struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      uuid.UUID `json:"user_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	ItemCount   int       `json:"item_count"`
+	// CoverThumbnailURL is the first item's thumbnail, if it has one
+	CoverThumbnailURL *string `json:"cover_thumbnail_url"`
+}
+
+type CollectionItem struct {
+	Position int       `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+	Video    Video     `json:"video"`
+}
+
+type CreateCollectionParams struct {
+	UserID      uuid.UUID
+	Title       string
+	Description string
+}
+
+// CollectionPlacement says where an item goes: right before one item, right
+// after one, or at the end when neither is set
+type CollectionPlacement struct {
+	BeforeID *uuid.UUID
+	AfterID  *uuid.UUID
+}
+
+// ErrInvalidPlacement is returned when the item to place next to isn't in the
+// collection, or is the item being placed
+var ErrInvalidPlacement = errors.New("the item to place next to is not in this collection")
+
+// Apply inserts id into the ordered ids as the placement says. ids must not
+// already contain id.
+func (p CollectionPlacement) Apply(ids []uuid.UUID, id uuid.UUID) ([]uuid.UUID, error) {
+	at := len(ids)
+	if anchor, after := p.anchor(); anchor != nil {
+		at = -1
+		for i, existing := range ids {
+			if existing == *anchor {
+				at = i
+				break
+			}
+		}
+		if at < 0 || *anchor == id {
+			return nil, ErrInvalidPlacement
+		}
+		if after {
+			at++
+		}
+	}
+
+	placed := make([]uuid.UUID, 0, len(ids)+1)
+	placed = append(placed, ids[:at]...)
+	placed = append(placed, id)
+	return append(placed, ids[at:]...), nil
+}
+
+func (p CollectionPlacement) anchor() (id *uuid.UUID, after bool) {
+	if p.BeforeID != nil {
+		return p.BeforeID, false
+	}
+	return p.AfterID, p.AfterID != nil
+}
+
+// collectionColumns selects from collections along with the item count and
+// the first item's thumbnail
+const collectionColumns = `id, created_at, updated_at, user_id, title, description,
+	(SELECT COUNT(*) FROM collection_items ci WHERE ci.collection_id = collections.id),
+	(SELECT v.thumbnail_url FROM collection_items ci JOIN videos v ON v.id = ci.video_id
+	 WHERE ci.collection_id = collections.id ORDER BY ci.position LIMIT 1)`
+
+func scanCollection(row rowScanner) (Collection, error) {
+	var collection Collection
+	err := row.Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.UpdatedAt,
+		&collection.UserID,
+		&collection.Title,
+		&collection.Description,
+		&collection.ItemCount,
+		&collection.CoverThumbnailURL,
+	)
+	return collection, err
+}
+
+// ListCollections returns the user's collections, newest first
+func (c Client) ListCollections(ctx context.Context, userID uuid.UUID) ([]Collection, error) {
+	query := `
+	SELECT ` + collectionColumns + `
+	FROM collections
+	WHERE user_id = ?
+	ORDER BY created_at DESC, id DESC
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []Collection{}
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	return collections, rows.Err()
+}
+
+func (c Client) GetCollection(ctx context.Context, id uuid.UUID) (Collection, error) {
+	collection, err := scanCollection(c.db.QueryRowContext(ctx, "SELECT "+collectionColumns+" FROM collections WHERE id = ?", id))
+	if err != nil {
+		return Collection{}, notFoundIfNoRows(err)
+	}
+	return collection, nil
+}
+
+func (c Client) CreateCollection(ctx context.Context, params CreateCollectionParams) (Collection, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO collections (id, created_at, updated_at, user_id, title, description)
+	VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+	`
+	if _, err := c.db.ExecContext(ctx, query, id, params.UserID, params.Title, params.Description); err != nil {
+		return Collection{}, err
+	}
+	return c.GetCollection(ctx, id)
+}
+
+// UpdateCollection saves the title and description
+func (c Client) UpdateCollection(ctx context.Context, collection Collection) error {
+	query := `
+	UPDATE collections
+	SET title = ?, description = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, collection.Title, collection.Description, collection.ID))
+}
+
+// DeleteCollection deletes the collection with its share links and grants, but not the videos in it
+func (c Client) DeleteCollection(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM collection_items WHERE collection_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM share_links WHERE collection_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM grants WHERE collection_id = ?", id); err != nil {
+		return err
+	}
+	if err := requireRowsAffected(tx.ExecContext(ctx, "DELETE FROM collections WHERE id = ?", id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetCollectionItems returns the collection's videos in order
+func (c Client) GetCollectionItems(ctx context.Context, collectionID uuid.UUID) ([]CollectionItem, error) {
+	query := `
+	SELECT ci.created_at, ` + qualifiedVideoColumns + `
+	FROM collection_items ci
+	JOIN videos v ON v.id = ci.video_id
+	WHERE ci.collection_id = ?
+	ORDER BY ci.position
+	`
+	rows, err := c.db.QueryContext(ctx, query, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []CollectionItem{}
+	videos := []Video{}
+	for rows.Next() {
+		// Deleting a video leaves a gap in the stored positions, so number by order
+		item := CollectionItem{Position: len(items)}
+		if err := rows.Scan(append([]any{&item.AddedAt}, videoFields(&item.Video)...)...); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		videos = append(videos, item.Video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := c.attachTags(ctx, videos); err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].Video = videos[i]
+	}
+	return items, nil
+}
+
+// AddCollectionItem puts a video into the collection. It returns an error
+// wrapping ErrConflict if the video is already in it.
+func (c Client) AddCollectionItem(ctx context.Context, collectionID, videoID uuid.UUID, placement CollectionPlacement) error {
+	return c.reorderCollection(ctx, collectionID, func(tx *dbTx, ids []uuid.UUID) ([]uuid.UUID, error) {
+		if indexOfID(ids, videoID) >= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrConflict, itemConflict)
+		}
+		query := `
+		INSERT INTO collection_items (collection_id, video_id, position, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		`
+		if _, err := tx.ExecContext(ctx, query, collectionID, videoID, len(ids)); err != nil {
+			return nil, conflictIfUnique(err, itemConflict)
+		}
+		return placement.Apply(ids, videoID)
+	})
+}
+
+// MoveCollectionItem moves a video that is already in the collection
+func (c Client) MoveCollectionItem(ctx context.Context, collectionID, videoID uuid.UUID, placement CollectionPlacement) error {
+	return c.reorderCollection(ctx, collectionID, func(tx *dbTx, ids []uuid.UUID) ([]uuid.UUID, error) {
+		i := indexOfID(ids, videoID)
+		if i < 0 {
+			return nil, ErrNotFound
+		}
+		return placement.Apply(append(ids[:i:i], ids[i+1:]...), videoID)
+	})
+}
+
+func (c Client) RemoveCollectionItem(ctx context.Context, collectionID, videoID uuid.UUID) error {
+	return c.reorderCollection(ctx, collectionID, func(tx *dbTx, ids []uuid.UUID) ([]uuid.UUID, error) {
+		i := indexOfID(ids, videoID)
+		if i < 0 {
+			return nil, ErrNotFound
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM collection_items WHERE collection_id = ? AND video_id = ?", collectionID, videoID); err != nil {
+			return nil, err
+		}
+		return append(ids[:i:i], ids[i+1:]...), nil
+	})
+}
+
+const itemConflict = "the video is already in this collection"
+
+// reorderCollection loads the collection's video IDs in order, lets change
+// return the new order, and renumbers the items to match. Touching the
+// collection first locks it, so concurrent changes can't interleave.
+func (c Client) reorderCollection(ctx context.Context, collectionID uuid.UUID, change func(tx *dbTx, ids []uuid.UUID) ([]uuid.UUID, error)) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := requireRowsAffected(tx.ExecContext(ctx, "UPDATE collections SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", collectionID)); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT video_id FROM collection_items WHERE collection_id = ? ORDER BY position", collectionID)
+	if err != nil {
+		return err
+	}
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	ids, err = change(tx, ids)
+	if err != nil {
+		return err
+	}
+	for position, id := range ids {
+		query := "UPDATE collection_items SET position = ? WHERE collection_id = ? AND video_id = ?"
+		if _, err := tx.ExecContext(ctx, query, position, collectionID, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func indexOfID(ids []uuid.UUID, id uuid.UUID) int {
+	for i, existing := range ids {
+		if existing == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Comment is feedback on a video, optionally pinned to a moment in it.
+// Replies have a ParentID, which is always a top-level comment.
+type Comment struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	VideoID    uuid.UUID  `json:"video_id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	AuthorName string     `json:"author_name"`
+	ParentID   *uuid.UUID `json:"parent_id"`
+	Body       string     `json:"body"`
+	AtSeconds  *float64   `json:"at_seconds"`
+	EditedAt   *time.Time `json:"edited_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	ResolvedBy *uuid.UUID `json:"resolved_by"`
+}
+
+type CreateCommentParams struct {
+	VideoID   uuid.UUID
+	UserID    uuid.UUID
+	ParentID  *uuid.UUID
+	Body      string
+	AtSeconds *float64
+}
+
+// FeedComment is a comment on one of the owner's videos, for their feed
+type FeedComment struct {
+	Comment
+	VideoTitle string `json:"video_title"`
+}
+
+// CommentFeedParams selects comments other users left on the owner's videos
+type CommentFeedParams struct {
+	OwnerID uuid.UUID
+	Since   *time.Time
+	Limit   int
+	Offset  int
+}
+
+// commentColumns are qualified because comments are always read joined to their author
+const commentColumns = `c.id, c.created_at, c.updated_at, c.video_id, c.user_id, u.full_name, c.parent_id,
+	c.body, c.at_seconds, c.edited_at, c.resolved_at, c.resolved_by`
+
+const commentFrom = "FROM comments c JOIN users u ON u.id = c.user_id"
+
+func commentFields(comment *Comment) []any {
+	return []any{
+		&comment.ID,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+		&comment.VideoID,
+		&comment.UserID,
+		&comment.AuthorName,
+		&comment.ParentID,
+		&comment.Body,
+		&comment.AtSeconds,
+		&comment.EditedAt,
+		&comment.ResolvedAt,
+		&comment.ResolvedBy,
+	}
+}
+
+func (c Client) CreateComment(ctx context.Context, params CreateCommentParams) (Comment, error) {
+	id := uuid.New()
+	t := time.Now().UTC()
+	query := `
+	INSERT INTO comments (id, created_at, updated_at, video_id, user_id, parent_id, body, at_seconds)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.ExecContext(ctx, query, id, t, t, params.VideoID, params.UserID, params.ParentID, params.Body, params.AtSeconds)
+	if err != nil {
+		return Comment{}, err
+	}
+	return c.GetComment(ctx, id)
+}
+
+func (c Client) GetComment(ctx context.Context, id uuid.UUID) (Comment, error) {
+	var comment Comment
+	err := c.db.QueryRowContext(ctx, "SELECT "+commentColumns+" "+commentFrom+" WHERE c.id = ?", id).Scan(commentFields(&comment)...)
+	if err != nil {
+		return Comment{}, notFoundIfNoRows(err)
+	}
+	return comment, nil
+}
+
+// ListVideoComments returns every comment and reply on the video, oldest first
+func (c Client) ListVideoComments(ctx context.Context, videoID uuid.UUID) ([]Comment, error) {
+	query := "SELECT " + commentColumns + " " + commentFrom + " WHERE c.video_id = ? ORDER BY c.created_at, c.id"
+	rows, err := c.db.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var comment Comment
+		if err := rows.Scan(commentFields(&comment)...); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// UpdateComment replaces the comment's text and timestamp and marks it edited
+func (c Client) UpdateComment(ctx context.Context, id uuid.UUID, body string, atSeconds *float64) error {
+	t := time.Now().UTC()
+	query := "UPDATE comments SET body = ?, at_seconds = ?, edited_at = ?, updated_at = ? WHERE id = ?"
+	return requireRowsAffected(c.db.ExecContext(ctx, query, body, atSeconds, t, t, id))
+}
+
+// SetCommentResolved resolves the comment as resolvedBy, or reopens it when
+// resolvedBy is nil
+func (c Client) SetCommentResolved(ctx context.Context, id uuid.UUID, resolvedBy *uuid.UUID) error {
+	t := time.Now().UTC()
+	var resolvedAt *time.Time
+	if resolvedBy != nil {
+		resolvedAt = &t
+	}
+	query := "UPDATE comments SET resolved_at = ?, resolved_by = ?, updated_at = ? WHERE id = ?"
+	return requireRowsAffected(c.db.ExecContext(ctx, query, resolvedAt, resolvedBy, t, id))
+}
+
+// DeleteComment deletes the comment and any replies to it
+func (c Client) DeleteComment(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM comments WHERE parent_id = ?", id); err != nil {
+		return err
+	}
+	if err := requireRowsAffected(tx.ExecContext(ctx, "DELETE FROM comments WHERE id = ?", id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListCommentFeed returns comments other users left on the owner's videos,
+// newest first
+func (c Client) ListCommentFeed(ctx context.Context, params CommentFeedParams) ([]FeedComment, error) {
+	conditions := []string{"v.user_id = ?", "c.user_id <> ?"}
+	args := []any{params.OwnerID, params.OwnerID}
+	if params.Since != nil {
+		conditions = append(conditions, "c.created_at >= ?")
+		args = append(args, params.Since.UTC())
+	}
+
+	query := "SELECT " + commentColumns + ", v.title " + commentFrom + `
+	JOIN videos v ON v.id = c.video_id
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	ORDER BY c.created_at DESC, c.id DESC
+	LIMIT ? OFFSET ?
+	`
+	args = append(args, params.Limit, params.Offset)
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []FeedComment{}
+	for rows.Next() {
+		var comment FeedComment
+		if err := rows.Scan(append(commentFields(&comment.Comment), &comment.VideoTitle)...); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
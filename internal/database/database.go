@@ -1,111 +1,58 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Client struct {
-	db *sql.DB
+	db *dbConn
 }
 
-func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+// Open connects to the database without touching the schema. databaseURL is
+// either a postgres:// URL or a SQLite file path (optionally prefixed with sqlite://).
+func Open(databaseURL string) (Client, error) {
+	d, dataSource := parseDatabaseURL(databaseURL)
+	db, err := sql.Open(d.driverName(), dataSource)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
-	err = c.autoMigrate()
-	if err != nil {
-		return Client{}, err
-	}
-	return c, nil
-
+	return Client{&dbConn{DB: db, dialect: d}}, nil
 }
 
-func (c *Client) autoMigrate() error {
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL,
-		full_name TEXT DEFAULT ''
-	);
-	`
-	_, err := c.db.Exec(userTable)
+// NewClient connects to the database and applies any pending migrations
+func NewClient(ctx context.Context, databaseURL string) (Client, error) {
+	c, err := Open(databaseURL)
 	if err != nil {
-		return err
+		return Client{}, err
 	}
-
-	// Add full_name column if it doesn't exist (for existing databases)
-	_, _ = c.db.Exec("ALTER TABLE users ADD COLUMN full_name TEXT DEFAULT ''")
-
-	refreshTokenTable := `
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		token TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		revoked_at TIMESTAMP,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(refreshTokenTable)
-	if err != nil {
-		return err
+	if _, err := c.MigrateUp(ctx); err != nil {
+		return Client{}, err
 	}
+	return c, nil
+}
 
-	videoTable := `
-	CREATE TABLE IF NOT EXISTS videos (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		title TEXT NOT NULL,
-		description TEXT,
-		thumbnail_url TEXT,
-		video_url TEXT,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(videoTable)
-	if err != nil {
-		return err
-	}
+// Dialect names the SQL backend in use ("sqlite" or "postgres")
+func (c Client) Dialect() string {
+	return string(c.db.dialect)
+}
 
-	// Password reset tokens table
-	passwordResetTable := `
-	CREATE TABLE IF NOT EXISTS password_reset_tokens (
-		token TEXT PRIMARY KEY,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		used_at TIMESTAMP,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-	`
-	_, err = c.db.Exec(passwordResetTable)
-	if err != nil {
-		return err
+func (c Client) Reset(ctx context.Context) error {
+	// Children first so foreign keys are never violated
+	tables := []string{"refresh_tokens", "password_reset_tokens", "share_links", "grants", "playback_progress", "analytics_events", "video_daily_viewers", "video_daily_stats", "webhook_deliveries", "webhooks", "notes", "comments", "video_tags", "tags", "collection_items", "collections", "videos", "users", "auth_throttles"}
+	for _, table := range tables {
+		if _, err := c.db.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+			return fmt.Errorf("failed to reset table %s: %w", table, err)
+		}
 	}
-
 	return nil
 }
 
-func (c Client) Reset() error {
-	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
-		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
-	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
-		return fmt.Errorf("failed to reset table users: %w", err)
-	}
-	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
-		return fmt.Errorf("failed to reset table videos: %w", err)
-	}
-	return nil
+// Close releases the underlying connection pool
+func (c Client) Close() error {
+	return c.db.Close()
 }
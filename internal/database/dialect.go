@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type dialect string
+
+const (
+	dialectSQLite   dialect = "sqlite"
+	dialectPostgres dialect = "postgres"
+)
+
+// parseDatabaseURL picks the dialect from the connection string. postgres:// and
+// postgresql:// URLs use Postgres; sqlite:// URLs and plain file paths use SQLite.
+func parseDatabaseURL(databaseURL string) (dialect, string) {
+	switch {
+	case strings.HasPrefix(databaseURL, "postgres://"), strings.HasPrefix(databaseURL, "postgresql://"):
+		return dialectPostgres, databaseURL
+	case strings.HasPrefix(databaseURL, "sqlite://"):
+		return dialectSQLite, sqliteDataSource(strings.TrimPrefix(databaseURL, "sqlite://"))
+	default:
+		return dialectSQLite, sqliteDataSource(databaseURL)
+	}
+}
+
+// sqliteDataSource turns on foreign key enforcement, which SQLite leaves off
+// on every new connection unless asked, so ON DELETE CASCADE actually runs
+func sqliteDataSource(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "_foreign_keys=on"
+}
+
+func (d dialect) driverName() string {
+	if d == dialectPostgres {
+		return "postgres"
+	}
+	return "sqlite3"
+}
+
+// timeArg formats t for comparison with a timestamp column. SQLite stores
+// CURRENT_TIMESTAMP as "YYYY-MM-DD HH:MM:SS" text and compares it as a string.
+func (d dialect) timeArg(t time.Time) any {
+	if d == dialectPostgres {
+		return t.UTC()
+	}
+	return t.UTC().Format(time.DateTime)
+}
+
+// rebind rewrites ? placeholders into the dialect's native form ($1, $2, ...
+// for Postgres). Placeholders inside quoted strings are left alone.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// dbConn wraps *sql.DB so queries written with ? placeholders run on every dialect
+type dbConn struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (d *dbConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.DB.ExecContext(ctx, d.dialect.rebind(query), args...)
+}
+
+func (d *dbConn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.DB.QueryContext(ctx, d.dialect.rebind(query), args...)
+}
+
+func (d *dbConn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.DB.QueryRowContext(ctx, d.dialect.rebind(query), args...)
+}
+
+func (d *dbConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*dbTx, error) {
+	tx, err := d.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &dbTx{Tx: tx, dialect: d.dialect}, nil
+}
+
+// dbTx is the transaction counterpart of dbConn
+type dbTx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (t *dbTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.Tx.ExecContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *dbTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.QueryContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *dbTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.Tx.QueryRowContext(ctx, t.dialect.rebind(query), args...)
+}
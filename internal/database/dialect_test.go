@@ -0,0 +1,62 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"numbers placeholders in order", "SELECT * FROM t WHERE a = ? AND b IN (?, ?)", "SELECT * FROM t WHERE a = $1 AND b IN ($2, $3)"},
+		{"skips single-quoted strings", "SELECT '?' || ? FROM t", "SELECT '?' || $1 FROM t"},
+		{"skips double-quoted identifiers", `SELECT "a?b" FROM t WHERE c = ?`, `SELECT "a?b" FROM t WHERE c = $1`},
+		{"handles escaped quotes", "SELECT 'it''s ?' WHERE a = ?", "SELECT 'it''s ?' WHERE a = $1"},
+		{"leaves queries without placeholders alone", "SELECT 1", "SELECT 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dialectPostgres.rebind(tt.query); got != tt.want {
+				t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+			if got := dialectSQLite.rebind(tt.query); got != tt.query {
+				t.Errorf("SQLite rebind(%q) = %q, want it unchanged", tt.query, got)
+			}
+		})
+	}
+}
+
+func TestTimeArg(t *testing.T) {
+	at := time.Date(2024, 3, 9, 23, 30, 15, 500, time.FixedZone("UTC-2", -2*60*60))
+
+	if got, want := dialectSQLite.timeArg(at), "2024-03-10 01:30:15"; got != want {
+		t.Errorf("SQLite timeArg = %v, want %q, the format CURRENT_TIMESTAMP stores", got, want)
+	}
+	got, ok := dialectPostgres.timeArg(at).(time.Time)
+	if !ok || !got.Equal(at) || got.Location() != time.UTC {
+		t.Errorf("Postgres timeArg = %v, want %v in UTC", got, at)
+	}
+}
+
+func TestParseDatabaseURL(t *testing.T) {
+	tests := []struct {
+		url         string
+		wantDialect dialect
+		wantSource  string
+	}{
+		{"postgres://u:p@localhost/db", dialectPostgres, "postgres://u:p@localhost/db"},
+		{"postgresql://localhost/db?sslmode=disable", dialectPostgres, "postgresql://localhost/db?sslmode=disable"},
+		{"./vaultstream.db", dialectSQLite, "./vaultstream.db?_foreign_keys=on"},
+		{"sqlite://data/app.db", dialectSQLite, "data/app.db?_foreign_keys=on"},
+		{"file:app.db?cache=shared", dialectSQLite, "file:app.db?cache=shared&_foreign_keys=on"},
+	}
+	for _, tt := range tests {
+		d, source := parseDatabaseURL(tt.url)
+		if d != tt.wantDialect || source != tt.wantSource {
+			t.Errorf("parseDatabaseURL(%q) = %s, %q; want %s, %q", tt.url, d, source, tt.wantDialect, tt.wantSource)
+		}
+	}
+}
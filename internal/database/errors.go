@@ -0,0 +1,53 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// ErrNotFound is returned when a lookup, update or delete matches no row
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write would violate a uniqueness constraint
+	ErrConflict = errors.New("conflict")
+)
+
+// notFoundIfNoRows turns sql.ErrNoRows into ErrNotFound
+func notFoundIfNoRows(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// requireRowsAffected returns ErrNotFound when a write matched no rows
+func requireRowsAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// conflictIfUnique wraps unique-constraint violations from either driver in ErrConflict
+func conflictIfUnique(err error, what string) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return fmt.Errorf("%w: %s", ErrConflict, what)
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return fmt.Errorf("%w: %s", ErrConflict, what)
+	}
+	return err
+}
@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Grant roles, from least to most access
+const (
+	GrantRoleViewer    = "viewer"
+	GrantRoleCommenter = "commenter"
+	GrantRoleEditor    = "editor"
+)
+
+// GrantRoleRank orders roles by how much they allow. Unknown roles, including
+// "" for no grant, rank 0.
+func GrantRoleRank(role string) int {
+	switch role {
+	case GrantRoleViewer:
+		return 1
+	case GrantRoleCommenter:
+		return 2
+	case GrantRoleEditor:
+		return 3
+	}
+	return 0
+}
+
+// Grant gives another user a role on one of the owner's videos or collections.
+// GranteeUserID is nil until an account with GranteeEmail claims it.
+type Grant struct {
+	ID            uuid.UUID  `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	OwnerID       uuid.UUID  `json:"owner_id"`
+	VideoID       *uuid.UUID `json:"video_id"`
+	CollectionID  *uuid.UUID `json:"collection_id"`
+	GranteeEmail  string     `json:"grantee_email"`
+	GranteeUserID *uuid.UUID `json:"grantee_user_id"`
+	Role          string     `json:"role"`
+}
+
+// UpsertGrantParams needs exactly one of VideoID and CollectionID
+type UpsertGrantParams struct {
+	OwnerID       uuid.UUID
+	VideoID       *uuid.UUID
+	CollectionID  *uuid.UUID
+	GranteeEmail  string
+	GranteeUserID *uuid.UUID
+	Role          string
+}
+
+const grantColumns = `id, created_at, updated_at, owner_id, video_id, collection_id, grantee_email, grantee_user_id, role`
+
+func scanGrant(row rowScanner) (Grant, error) {
+	var grant Grant
+	err := row.Scan(
+		&grant.ID,
+		&grant.CreatedAt,
+		&grant.UpdatedAt,
+		&grant.OwnerID,
+		&grant.VideoID,
+		&grant.CollectionID,
+		&grant.GranteeEmail,
+		&grant.GranteeUserID,
+		&grant.Role,
+	)
+	return grant, err
+}
+
+func (c Client) queryGrants(ctx context.Context, query string, args ...any) ([]Grant, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []Grant{}
+	for rows.Next() {
+		grant, err := scanGrant(rows)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+// UpsertGrant gives the grantee a role on the video or collection, changing
+// the role if they already have one. created reports whether the grant is new.
+func (c Client) UpsertGrant(ctx context.Context, params UpsertGrantParams) (grant Grant, created bool, err error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Grant{}, false, err
+	}
+	defer tx.Rollback()
+
+	var id uuid.UUID
+	query := "SELECT id FROM grants WHERE (video_id = ? OR collection_id = ?) AND LOWER(grantee_email) = LOWER(?)"
+	err = tx.QueryRowContext(ctx, query, params.VideoID, params.CollectionID, params.GranteeEmail).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		id, created = uuid.New(), true
+		query := `
+		INSERT INTO grants (id, created_at, updated_at, owner_id, video_id, collection_id, grantee_email, grantee_user_id, role)
+		VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
+		`
+		_, err = tx.ExecContext(ctx, query,
+			id, params.OwnerID, params.VideoID, params.CollectionID,
+			params.GranteeEmail, params.GranteeUserID, params.Role,
+		)
+		err = conflictIfUnique(err, "that address was just granted access")
+	} else if err == nil {
+		query := `
+		UPDATE grants
+		SET role = ?, grantee_user_id = COALESCE(grantee_user_id, ?), updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+		`
+		_, err = tx.ExecContext(ctx, query, params.Role, params.GranteeUserID, id)
+	}
+	if err != nil {
+		return Grant{}, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Grant{}, false, err
+	}
+
+	grant, err = c.GetGrant(ctx, id)
+	return grant, created, err
+}
+
+func (c Client) GetGrant(ctx context.Context, id uuid.UUID) (Grant, error) {
+	grant, err := scanGrant(c.db.QueryRowContext(ctx, "SELECT "+grantColumns+" FROM grants WHERE id = ?", id))
+	if err != nil {
+		return Grant{}, notFoundIfNoRows(err)
+	}
+	return grant, nil
+}
+
+// ListVideoGrants returns who the video is shared with, oldest grant first
+func (c Client) ListVideoGrants(ctx context.Context, videoID uuid.UUID) ([]Grant, error) {
+	return c.queryGrants(ctx, "SELECT "+grantColumns+" FROM grants WHERE video_id = ? ORDER BY created_at, id", videoID)
+}
+
+// ListCollectionGrants returns who the collection is shared with, oldest grant first
+func (c Client) ListCollectionGrants(ctx context.Context, collectionID uuid.UUID) ([]Grant, error) {
+	return c.queryGrants(ctx, "SELECT "+grantColumns+" FROM grants WHERE collection_id = ? ORDER BY created_at, id", collectionID)
+}
+
+// ListGrantsForUser returns everything shared with the user, newest first
+func (c Client) ListGrantsForUser(ctx context.Context, userID uuid.UUID) ([]Grant, error) {
+	return c.queryGrants(ctx, "SELECT "+grantColumns+" FROM grants WHERE grantee_user_id = ? ORDER BY created_at DESC, id DESC", userID)
+}
+
+func (c Client) DeleteGrant(ctx context.Context, id uuid.UUID) error {
+	return requireRowsAffected(c.db.ExecContext(ctx, "DELETE FROM grants WHERE id = ?", id))
+}
+
+// GetVideoRole returns the best role the user holds on the video, either
+// directly or through a collection it is in, or "" if they hold none
+func (c Client) GetVideoRole(ctx context.Context, videoID, userID uuid.UUID) (string, error) {
+	query := `
+	SELECT role FROM grants
+	WHERE grantee_user_id = ?
+	  AND (video_id = ? OR collection_id IN (SELECT collection_id FROM collection_items WHERE video_id = ?))
+	`
+	return c.bestRole(ctx, query, userID, videoID, videoID)
+}
+
+// GetCollectionRole returns the role the user holds on the collection, or "" if none
+func (c Client) GetCollectionRole(ctx context.Context, collectionID, userID uuid.UUID) (string, error) {
+	return c.bestRole(ctx, "SELECT role FROM grants WHERE grantee_user_id = ? AND collection_id = ?", userID, collectionID)
+}
+
+func (c Client) bestRole(ctx context.Context, query string, args ...any) (string, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	best := ""
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return "", err
+		}
+		if GrantRoleRank(role) > GrantRoleRank(best) {
+			best = role
+		}
+	}
+	return best, rows.Err()
+}
+
+// ClaimGrants attaches grants made out to email, before anyone owned it, to
+// the user. Call it only once the user has proven they own the address.
+func (c Client) ClaimGrants(ctx context.Context, userID uuid.UUID, email string) error {
+	query := `
+	UPDATE grants
+	SET grantee_user_id = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE LOWER(grantee_email) = LOWER(?) AND grantee_user_id IS NULL
+	`
+	_, err := c.db.ExecContext(ctx, query, userID, email)
+	return err
+}
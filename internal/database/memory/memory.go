@@ -0,0 +1,2483 @@
+// Package memory is an in-memory implementation of database.Store for handler
+// tests. It mirrors the behaviour of the SQL client, including its
+// database.ErrNotFound and database.ErrConflict errors.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type Store struct {
+	mu              sync.Mutex
+	users           map[uuid.UUID]database.User
+	videos          map[uuid.UUID]database.Video
+	refreshTokens   map[string]database.RefreshToken
+	passwordResets  map[string]database.PasswordResetToken
+	throttles       map[string]database.AuthThrottle
+	tags            map[uuid.UUID]database.Tag
+	videoTags       map[uuid.UUID]map[uuid.UUID]bool // video ID -> tag IDs
+	collections     map[uuid.UUID]database.Collection
+	collectionItems map[uuid.UUID][]collectionItem // collection ID -> items in order
+	shareLinks      map[uuid.UUID]database.ShareLink
+	grants          map[uuid.UUID]database.Grant
+	comments        map[uuid.UUID]database.Comment
+	notes           map[uuid.UUID]database.Note
+	playback        map[playbackKey]database.PlaybackProgress
+	analyticsEvents []database.AnalyticsEvent
+	dailyStats      map[dailyStatsKey]database.VideoStats
+	dailyViewers    map[dailyStatsKey]map[string]bool // viewer keys seen each day
+	webhooks        map[uuid.UUID]database.Webhook
+	deliveries      map[uuid.UUID]database.WebhookDelivery
+	auditEvents     []database.AuditEvent
+}
+
+var _ database.Store = (*Store)(nil)
+
+func New() *Store {
+	s := &Store{}
+	s.reset()
+	return s
+}
+
+func (s *Store) reset() {
+	s.users = map[uuid.UUID]database.User{}
+	s.videos = map[uuid.UUID]database.Video{}
+	s.refreshTokens = map[string]database.RefreshToken{}
+	s.passwordResets = map[string]database.PasswordResetToken{}
+	s.throttles = map[string]database.AuthThrottle{}
+	s.tags = map[uuid.UUID]database.Tag{}
+	s.videoTags = map[uuid.UUID]map[uuid.UUID]bool{}
+	s.collections = map[uuid.UUID]database.Collection{}
+	s.collectionItems = map[uuid.UUID][]collectionItem{}
+	s.shareLinks = map[uuid.UUID]database.ShareLink{}
+	s.grants = map[uuid.UUID]database.Grant{}
+	s.comments = map[uuid.UUID]database.Comment{}
+	s.notes = map[uuid.UUID]database.Note{}
+	s.playback = map[playbackKey]database.PlaybackProgress{}
+	s.analyticsEvents = nil
+	s.dailyStats = map[dailyStatsKey]database.VideoStats{}
+	s.dailyViewers = map[dailyStatsKey]map[string]bool{}
+	s.webhooks = map[uuid.UUID]database.Webhook{}
+	s.deliveries = map[uuid.UUID]database.WebhookDelivery{}
+}
+
+// Reset clears everything except the append-only audit log, like Client.Reset
+func (s *Store) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+	return nil
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// ============================================
+// Users
+// ============================================
+
+func (s *Store) GetUsers(ctx context.Context, params database.ListUsersParams) ([]database.User, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	search := strings.ToLower(params.Search)
+	matches := []database.User{}
+	for _, user := range s.users {
+		if search == "" ||
+			strings.Contains(strings.ToLower(user.Email), search) ||
+			strings.Contains(strings.ToLower(user.FullName), search) {
+			matches = append(matches, user)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].CreatedAt.After(matches[j].CreatedAt) })
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	return paginate(matches, limit, params.Offset), len(matches), nil
+}
+
+func (s *Store) GetUser(ctx context.Context, id uuid.UUID) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return database.User{}, database.ErrNotFound
+}
+
+func (s *Store) GetUserByRefreshToken(ctx context.Context, token string) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.refreshTokens[token]
+	if !ok || rt.RevokedAt != nil || !rt.ExpiresAt.After(now()) {
+		return nil, database.ErrNotFound
+	}
+	user, ok := s.users[rt.UserID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, params database.CreateUserParams) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(params.Email, uuid.Nil) {
+		return nil, errEmailConflict
+	}
+
+	t := now()
+	user := database.User{
+		ID:        uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		Email:     params.Email,
+		Password:  params.Password,
+		FullName:  params.FullName,
+		Role:      database.RoleUser,
+	}
+	s.users[user.ID] = user
+	return &user, nil
+}
+
+var errEmailConflict = fmt.Errorf("%w: email is already in use", database.ErrConflict)
+
+// emailTaken mirrors the UNIQUE constraint on users.email
+func (s *Store) emailTaken(email string, except uuid.UUID) bool {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) && user.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+// updateUser applies fn to the user, like an UPDATE ... WHERE id = ?
+func (s *Store) updateUser(id uuid.UUID, fn func(*database.User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	fn(&user)
+	if s.emailTaken(user.Email, id) {
+		return errEmailConflict
+	}
+	user.UpdatedAt = now()
+	s.users[id] = user
+	return nil
+}
+
+func (s *Store) UpdateUserProfile(ctx context.Context, userID uuid.UUID, fullName string) error {
+	return s.updateUser(userID, func(u *database.User) { u.FullName = fullName })
+}
+
+func (s *Store) UpdateUserPassword(ctx context.Context, userID uuid.UUID, hashedPassword string) error {
+	return s.updateUser(userID, func(u *database.User) {
+		u.Password = hashedPassword
+		u.PasswordResetRequired = false
+	})
+}
+
+func (s *Store) MarkUserEmailVerified(ctx context.Context, userID uuid.UUID) error {
+	return s.updateUser(userID, func(u *database.User) {
+		t := now()
+		u.EmailVerifiedAt = &t
+	})
+}
+
+func (s *Store) UpdateUserEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	return s.updateUser(userID, func(u *database.User) {
+		t := now()
+		u.Email = email
+		u.EmailVerifiedAt = &t
+	})
+}
+
+func (s *Store) UpdateUserRole(ctx context.Context, userID uuid.UUID, role string) error {
+	return s.updateUser(userID, func(u *database.User) { u.Role = role })
+}
+
+func (s *Store) SetUserDisabled(ctx context.Context, userID uuid.UUID, disabled bool) error {
+	return s.updateUser(userID, func(u *database.User) {
+		u.DisabledAt = nil
+		if disabled {
+			t := now()
+			u.DisabledAt = &t
+		}
+	})
+}
+
+func (s *Store) RequirePasswordReset(ctx context.Context, userID uuid.UUID) error {
+	return s.updateUser(userID, func(u *database.User) { u.PasswordResetRequired = true })
+}
+
+func (s *Store) MarkUserForDeletion(ctx context.Context, userID uuid.UUID) error {
+	return s.updateUser(userID, func(u *database.User) {
+		t := now()
+		u.DeletionRequestedAt = &t
+		if u.DisabledAt == nil {
+			u.DisabledAt = &t
+		}
+	})
+}
+
+func (s *Store) GetUsersPendingDeletion(ctx context.Context) ([]database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []database.User{}
+	for _, user := range s.users {
+		if user.DeletionRequestedAt != nil {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return database.ErrNotFound
+	}
+
+	for token, rt := range s.refreshTokens {
+		if rt.UserID == id {
+			delete(s.refreshTokens, token)
+		}
+	}
+	for token, prt := range s.passwordResets {
+		if prt.UserID == id {
+			delete(s.passwordResets, token)
+		}
+	}
+	for tagID, tag := range s.tags {
+		if tag.UserID == id {
+			s.deleteTag(tagID)
+		}
+	}
+	s.deleteShareLinks(func(link database.ShareLink) bool { return link.UserID == id })
+	s.deleteGrants(func(grant database.Grant) bool {
+		return grant.OwnerID == id || (grant.GranteeUserID != nil && *grant.GranteeUserID == id)
+	})
+	s.deleteComments(func(comment database.Comment) bool {
+		return comment.UserID == id || s.videos[comment.VideoID].UserID == id
+	})
+	for commentID, comment := range s.comments {
+		if comment.ResolvedBy != nil && *comment.ResolvedBy == id {
+			comment.ResolvedBy = nil
+			s.comments[commentID] = comment
+		}
+	}
+	s.deleteNotes(func(note database.Note) bool {
+		return note.UserID == id || s.videos[note.VideoID].UserID == id
+	})
+	s.deletePlayback(func(key playbackKey) bool {
+		return key.userID == id || s.videos[key.videoID].UserID == id
+	})
+	s.deleteAnalytics(func(videoID uuid.UUID) bool { return s.videos[videoID].UserID == id })
+	s.deleteWebhooks(func(webhook database.Webhook) bool { return webhook.UserID == id })
+	for collectionID, collection := range s.collections {
+		if collection.UserID == id {
+			delete(s.collections, collectionID)
+			delete(s.collectionItems, collectionID)
+		}
+	}
+	for videoID, video := range s.videos {
+		if video.UserID == id {
+			delete(s.videos, videoID)
+			delete(s.videoTags, videoID)
+			s.removeFromCollections(videoID)
+		}
+	}
+	delete(s.users, id)
+	return nil
+}
+
+// ============================================
+// Videos
+// ============================================
+
+func (s *Store) GetVideos(ctx context.Context, userID uuid.UUID) ([]database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	videos := []database.Video{}
+	for _, video := range s.videos {
+		if video.UserID == userID {
+			videos = append(videos, s.withTags(video))
+		}
+	}
+	sort.Slice(videos, func(i, j int) bool { return videos[i].CreatedAt.After(videos[j].CreatedAt) })
+	return videos, nil
+}
+
+// ListVideos filters and sorts like Client.ListVideos. Its cursors are plain
+// offsets, which is enough for a store that only lives as long as a test.
+func (s *Store) ListVideos(ctx context.Context, params database.ListVideosParams) (database.VideoPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sortBy := params.Sort
+	if sortBy == "" {
+		sortBy = database.VideoSortCreated
+	}
+	if !database.IsVideoSort(sortBy) {
+		return database.VideoPage{}, fmt.Errorf("unknown video sort %q", sortBy)
+	}
+	order := "desc"
+	if params.Ascending {
+		order = "asc"
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	offset := 0
+	if params.Cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(params.Cursor)
+		if err != nil {
+			return database.VideoPage{}, database.ErrInvalidCursor
+		}
+		var cursorSort, cursorOrder string
+		if _, err := fmt.Sscanf(string(decoded), "%s %s %d", &cursorSort, &cursorOrder, &offset); err != nil || offset < 0 {
+			return database.VideoPage{}, database.ErrInvalidCursor
+		}
+		if cursorSort != sortBy || cursorOrder != order {
+			return database.VideoPage{}, database.ErrInvalidCursor
+		}
+	}
+
+	videos := []database.Video{}
+	for _, video := range s.videos {
+		if s.videoMatches(video, params) {
+			videos = append(videos, s.withTags(video))
+		}
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		a, b := videos[i], videos[j]
+		if params.Ascending {
+			a, b = b, a
+		}
+		// Descending by the sort key, then by ID, like the SQL query
+		if c := compareVideos(a, b, sortBy); c != 0 {
+			return c > 0
+		}
+		return a.ID.String() > b.ID.String()
+	})
+
+	page := database.VideoPage{Total: len(videos), Videos: paginate(videos, limit, offset)}
+	if offset+limit < len(videos) {
+		next := fmt.Sprintf("%s %s %d", sortBy, order, offset+limit)
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(next))
+	}
+	return page, nil
+}
+
+// compareVideos returns -1, 0 or 1 comparing a and b by the sort key
+func compareVideos(a, b database.Video, sortBy string) int {
+	switch sortBy {
+	case database.VideoSortUpdated:
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	case database.VideoSortTitle:
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	case database.VideoSortDuration:
+		return cmp.Compare(durationOf(a), durationOf(b))
+	case database.VideoSortSize:
+		return cmp.Compare(a.VideoSize, b.VideoSize)
+	default:
+		return a.CreatedAt.Compare(b.CreatedAt)
+	}
+}
+
+func durationOf(video database.Video) float64 {
+	if video.DurationSeconds == nil {
+		return 0
+	}
+	return *video.DurationSeconds
+}
+
+func (s *Store) videoMatches(video database.Video, params database.ListVideosParams) bool {
+	if video.UserID != params.UserID {
+		return false
+	}
+	if len(params.Tags) > 0 {
+		matched := map[string]bool{}
+		for tagID := range s.videoTags[video.ID] {
+			name := strings.ToLower(s.tags[tagID].Name)
+			for _, want := range params.Tags {
+				if strings.ToLower(want) == name {
+					matched[name] = true
+				}
+			}
+		}
+		if len(matched) == 0 {
+			return false
+		}
+		if params.MatchAllTags {
+			wanted := map[string]bool{}
+			for _, want := range params.Tags {
+				wanted[strings.ToLower(want)] = true
+			}
+			if len(matched) != len(wanted) {
+				return false
+			}
+		}
+	}
+	if params.HasVideo != nil && (video.VideoURL != nil) != *params.HasVideo {
+		return false
+	}
+	if params.HasThumbnail != nil && (video.ThumbnailURL != nil) != *params.HasThumbnail {
+		return false
+	}
+	if params.Watched != nil && (s.playback[playbackKey{params.UserID, video.ID}].WatchedAt != nil) != *params.Watched {
+		return false
+	}
+	if params.AspectRatio != "" && (video.AspectRatio == nil || *video.AspectRatio != params.AspectRatio) {
+		return false
+	}
+	if params.CreatedAfter != nil && video.CreatedAt.Before(*params.CreatedAfter) {
+		return false
+	}
+	if params.CreatedBefore != nil && !video.CreatedAt.Before(*params.CreatedBefore) {
+		return false
+	}
+	if params.UpdatedAfter != nil && video.UpdatedAt.Before(*params.UpdatedAfter) {
+		return false
+	}
+	if params.UpdatedBefore != nil && !video.UpdatedAt.Before(*params.UpdatedBefore) {
+		return false
+	}
+	return true
+}
+
+func (s *Store) GetVideo(ctx context.Context, id uuid.UUID) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[id]
+	if !ok {
+		return database.Video{}, database.ErrNotFound
+	}
+	return s.withTags(video), nil
+}
+
+// SearchVideos approximates the full-text index: every term must prefix a word
+// of the title or description, and title matches rank higher
+func (s *Store) SearchVideos(ctx context.Context, userID uuid.UUID, query string, limit int) ([]database.VideoSearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	terms := database.SearchTerms(query)
+	results := []database.VideoSearchResult{}
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	for _, video := range s.videos {
+		if video.UserID != userID {
+			continue
+		}
+		video = s.withTags(video)
+		titleWords := strings.FieldsFunc(video.Title, notWordRune)
+		descriptionWords := strings.FieldsFunc(video.Description, notWordRune)
+		var tagWords []string
+		for _, tag := range video.Tags {
+			tagWords = append(tagWords, strings.FieldsFunc(tag.Name, notWordRune)...)
+		}
+		rank, matchedAll := 0.0, true
+		for _, term := range terms {
+			hits := 0.0
+			for _, word := range titleWords {
+				if matchesTerm(word, []string{term}) {
+					hits += 10
+				}
+			}
+			for _, word := range descriptionWords {
+				if matchesTerm(word, []string{term}) {
+					hits++
+				}
+			}
+			for _, word := range tagWords {
+				if matchesTerm(word, []string{term}) {
+					hits += 5
+				}
+			}
+			if hits == 0 {
+				matchedAll = false
+				break
+			}
+			rank += hits
+		}
+		if !matchedAll {
+			continue
+		}
+		results = append(results, database.VideoSearchResult{
+			Video: video,
+			Rank:  rank,
+			Highlights: database.VideoHighlights{
+				Title:       highlightTerms(video.Title, terms),
+				Description: highlightTerms(video.Description, terms),
+			},
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].CreatedAt.After(results[j].CreatedAt)
+	})
+	return paginate(results, limit, 0), nil
+}
+
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// highlightTerms HTML-escapes text and wraps words starting with any of the
+// terms in <mark> tags, like the SQL stores' highlights
+func highlightTerms(text string, terms []string) string {
+	var b strings.Builder
+	inWord := func(r rune) bool { return !notWordRune(r) }
+	for len(text) > 0 {
+		i := strings.IndexFunc(text, func(r rune) bool { return !inWord(r) })
+		if i == 0 {
+			j := strings.IndexFunc(text, inWord)
+			if j < 0 {
+				j = len(text)
+			}
+			b.WriteString(html.EscapeString(text[:j]))
+			text = text[j:]
+			continue
+		}
+		if i < 0 {
+			i = len(text)
+		}
+		word := text[:i]
+		if matchesTerm(word, terms) {
+			b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+		text = text[i:]
+	}
+	return b.String()
+}
+
+// matchesTerm reports whether the word starts with any of the terms
+func matchesTerm(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) CreateVideo(ctx context.Context, params database.CreateVideoParams) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	video := database.Video{
+		ID:                uuid.New(),
+		CreatedAt:         t,
+		UpdatedAt:         t,
+		CreateVideoParams: params,
+	}
+	s.videos[video.ID] = video
+	return video, nil
+}
+
+func (s *Store) UpdateVideo(ctx context.Context, video database.Video) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.videos[video.ID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	// Only the columns written by Client.UpdateVideo change
+	existing.Title = video.Title
+	existing.Description = video.Description
+	existing.ThumbnailURL = video.ThumbnailURL
+	existing.VideoURL = video.VideoURL
+	existing.VideoSize = video.VideoSize
+	existing.ThumbnailSize = video.ThumbnailSize
+	existing.DurationSeconds = video.DurationSeconds
+	existing.AspectRatio = video.AspectRatio
+	existing.CaptionsURL = video.CaptionsURL
+	existing.UserID = video.UserID
+	existing.UpdatedAt = now()
+	s.videos[video.ID] = existing
+	return nil
+}
+
+func (s *Store) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.videos[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.videos, id)
+	delete(s.videoTags, id)
+	s.removeFromCollections(id)
+	s.deleteShareLinks(func(link database.ShareLink) bool { return link.VideoID != nil && *link.VideoID == id })
+	s.deleteGrants(func(grant database.Grant) bool { return grant.VideoID != nil && *grant.VideoID == id })
+	s.deleteComments(func(comment database.Comment) bool { return comment.VideoID == id })
+	s.deleteNotes(func(note database.Note) bool { return note.VideoID == id })
+	s.deletePlayback(func(key playbackKey) bool { return key.videoID == id })
+	s.deleteAnalytics(func(videoID uuid.UUID) bool { return videoID == id })
+	return nil
+}
+
+func (s *Store) GetUserStorageUsage(ctx context.Context, userID uuid.UUID) (database.StorageUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var usage database.StorageUsage
+	for _, video := range s.videos {
+		if video.UserID != userID {
+			continue
+		}
+		usage.Videos++
+		if video.VideoURL != nil {
+			usage.VideoFiles++
+		}
+		if video.ThumbnailURL != nil {
+			usage.Thumbnails++
+		}
+		usage.VideoBytes += video.VideoSize
+		usage.ThumbnailBytes += video.ThumbnailSize
+	}
+	usage.TotalBytes = usage.VideoBytes + usage.ThumbnailBytes
+	return usage, nil
+}
+
+// ============================================
+// Tags
+// ============================================
+
+// withTags fills in the video's tags sorted by name, like Client.attachTags
+func (s *Store) withTags(video database.Video) database.Video {
+	video.Tags = []database.VideoTag{}
+	for tagID := range s.videoTags[video.ID] {
+		video.Tags = append(video.Tags, database.VideoTag{ID: tagID, Name: s.tags[tagID].Name})
+	}
+	sort.Slice(video.Tags, func(i, j int) bool {
+		return strings.ToLower(video.Tags[i].Name) < strings.ToLower(video.Tags[j].Name)
+	})
+	return video
+}
+
+var errTagConflict = fmt.Errorf("%w: a tag with that name already exists", database.ErrConflict)
+
+// tagNameTaken mirrors the per-user, case-insensitive UNIQUE constraint on tags
+func (s *Store) tagNameTaken(userID uuid.UUID, name string, except uuid.UUID) bool {
+	for _, tag := range s.tags {
+		if tag.UserID == userID && tag.ID != except && strings.EqualFold(tag.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// withVideoCount counts the videos carrying the tag
+func (s *Store) withVideoCount(tag database.Tag) database.Tag {
+	tag.VideoCount = 0
+	for _, tagIDs := range s.videoTags {
+		if tagIDs[tag.ID] {
+			tag.VideoCount++
+		}
+	}
+	return tag
+}
+
+func (s *Store) ListTags(ctx context.Context, userID uuid.UUID) ([]database.Tag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tags := []database.Tag{}
+	for _, tag := range s.tags {
+		if tag.UserID != userID {
+			continue
+		}
+		tags = append(tags, s.withVideoCount(tag))
+	}
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i].Name) < strings.ToLower(tags[j].Name) })
+	return tags, nil
+}
+
+func (s *Store) GetTag(ctx context.Context, id uuid.UUID) (database.Tag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tag, ok := s.tags[id]
+	if !ok {
+		return database.Tag{}, database.ErrNotFound
+	}
+	return s.withVideoCount(tag), nil
+}
+
+func (s *Store) GetTagsByName(ctx context.Context, userID uuid.UUID, names []string) ([]database.Tag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tags := []database.Tag{}
+	for _, tag := range s.tags {
+		if tag.UserID != userID {
+			continue
+		}
+		for _, name := range names {
+			if strings.EqualFold(tag.Name, name) {
+				tags = append(tags, s.withVideoCount(tag))
+				break
+			}
+		}
+	}
+	return tags, nil
+}
+
+func (s *Store) CreateTag(ctx context.Context, userID uuid.UUID, name string) (database.Tag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tagNameTaken(userID, name, uuid.Nil) {
+		return database.Tag{}, errTagConflict
+	}
+	t := now()
+	tag := database.Tag{ID: uuid.New(), CreatedAt: t, UpdatedAt: t, UserID: userID, Name: name}
+	s.tags[tag.ID] = tag
+	return tag, nil
+}
+
+func (s *Store) RenameTag(ctx context.Context, id uuid.UUID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tag, ok := s.tags[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	if s.tagNameTaken(tag.UserID, name, id) {
+		return errTagConflict
+	}
+	tag.Name = name
+	tag.UpdatedAt = now()
+	s.tags[id] = tag
+	return nil
+}
+
+func (s *Store) DeleteTag(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tags[id]; !ok {
+		return database.ErrNotFound
+	}
+	s.deleteTag(id)
+	return nil
+}
+
+func (s *Store) deleteTag(id uuid.UUID) {
+	for _, tagIDs := range s.videoTags {
+		delete(tagIDs, id)
+	}
+	delete(s.tags, id)
+}
+
+func (s *Store) MergeTags(ctx context.Context, targetID uuid.UUID, sourceIDs []uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(sourceIDs) == 0 {
+		return nil
+	}
+	for _, tagIDs := range s.videoTags {
+		for _, sourceID := range sourceIDs {
+			if tagIDs[sourceID] {
+				tagIDs[targetID] = true
+			}
+		}
+	}
+	for _, sourceID := range sourceIDs {
+		s.deleteTag(sourceID)
+	}
+	if target, ok := s.tags[targetID]; ok {
+		target.UpdatedAt = now()
+		s.tags[targetID] = target
+	}
+	return nil
+}
+
+func (s *Store) TagVideos(ctx context.Context, videoIDs, tagIDs []uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, videoID := range videoIDs {
+		if s.videoTags[videoID] == nil {
+			s.videoTags[videoID] = map[uuid.UUID]bool{}
+		}
+		for _, tagID := range tagIDs {
+			s.videoTags[videoID][tagID] = true
+		}
+	}
+	return nil
+}
+
+func (s *Store) UntagVideos(ctx context.Context, videoIDs, tagIDs []uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, videoID := range videoIDs {
+		for _, tagID := range tagIDs {
+			delete(s.videoTags[videoID], tagID)
+		}
+	}
+	return nil
+}
+
+// ============================================
+// Collections
+// ============================================
+
+// collectionItem is one entry in a collection's ordered item list
+type collectionItem struct {
+	videoID uuid.UUID
+	addedAt time.Time
+}
+
+// withItemSummary fills in the item count and cover, like the subqueries in
+// the SQL client's collectionColumns
+func (s *Store) withItemSummary(collection database.Collection) database.Collection {
+	items := s.collectionItems[collection.ID]
+	collection.ItemCount = len(items)
+	collection.CoverThumbnailURL = nil
+	if len(items) > 0 {
+		collection.CoverThumbnailURL = s.videos[items[0].videoID].ThumbnailURL
+	}
+	return collection
+}
+
+func (s *Store) ListCollections(ctx context.Context, userID uuid.UUID) ([]database.Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collections := []database.Collection{}
+	for _, collection := range s.collections {
+		if collection.UserID == userID {
+			collections = append(collections, s.withItemSummary(collection))
+		}
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		if !collections[i].CreatedAt.Equal(collections[j].CreatedAt) {
+			return collections[i].CreatedAt.After(collections[j].CreatedAt)
+		}
+		return collections[i].ID.String() > collections[j].ID.String()
+	})
+	return collections, nil
+}
+
+func (s *Store) GetCollection(ctx context.Context, id uuid.UUID) (database.Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, ok := s.collections[id]
+	if !ok {
+		return database.Collection{}, database.ErrNotFound
+	}
+	return s.withItemSummary(collection), nil
+}
+
+func (s *Store) CreateCollection(ctx context.Context, params database.CreateCollectionParams) (database.Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	collection := database.Collection{
+		ID:          uuid.New(),
+		CreatedAt:   t,
+		UpdatedAt:   t,
+		UserID:      params.UserID,
+		Title:       params.Title,
+		Description: params.Description,
+	}
+	s.collections[collection.ID] = collection
+	return collection, nil
+}
+
+func (s *Store) UpdateCollection(ctx context.Context, collection database.Collection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.collections[collection.ID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	existing.Title = collection.Title
+	existing.Description = collection.Description
+	existing.UpdatedAt = now()
+	s.collections[collection.ID] = existing
+	return nil
+}
+
+func (s *Store) DeleteCollection(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.collections[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.collections, id)
+	delete(s.collectionItems, id)
+	s.deleteShareLinks(func(link database.ShareLink) bool { return link.CollectionID != nil && *link.CollectionID == id })
+	s.deleteGrants(func(grant database.Grant) bool { return grant.CollectionID != nil && *grant.CollectionID == id })
+	return nil
+}
+
+func (s *Store) GetCollectionItems(ctx context.Context, collectionID uuid.UUID) ([]database.CollectionItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := []database.CollectionItem{}
+	for i, item := range s.collectionItems[collectionID] {
+		items = append(items, database.CollectionItem{
+			Position: i,
+			AddedAt:  item.addedAt,
+			Video:    s.withTags(s.videos[item.videoID]),
+		})
+	}
+	return items, nil
+}
+
+func (s *Store) AddCollectionItem(ctx context.Context, collectionID, videoID uuid.UUID, placement database.CollectionPlacement) error {
+	return s.reorderCollection(collectionID, func(items []collectionItem) ([]collectionItem, error) {
+		if indexOfItem(items, videoID) >= 0 {
+			return nil, fmt.Errorf("%w: the video is already in this collection", database.ErrConflict)
+		}
+		return placeItem(items, collectionItem{videoID: videoID, addedAt: now()}, placement)
+	})
+}
+
+func (s *Store) MoveCollectionItem(ctx context.Context, collectionID, videoID uuid.UUID, placement database.CollectionPlacement) error {
+	return s.reorderCollection(collectionID, func(items []collectionItem) ([]collectionItem, error) {
+		i := indexOfItem(items, videoID)
+		if i < 0 {
+			return nil, database.ErrNotFound
+		}
+		return placeItem(append(items[:i:i], items[i+1:]...), items[i], placement)
+	})
+}
+
+func (s *Store) RemoveCollectionItem(ctx context.Context, collectionID, videoID uuid.UUID) error {
+	return s.reorderCollection(collectionID, func(items []collectionItem) ([]collectionItem, error) {
+		i := indexOfItem(items, videoID)
+		if i < 0 {
+			return nil, database.ErrNotFound
+		}
+		return append(items[:i:i], items[i+1:]...), nil
+	})
+}
+
+// reorderCollection replaces the collection's items with what change returns
+// and touches the collection
+func (s *Store) reorderCollection(collectionID uuid.UUID, change func([]collectionItem) ([]collectionItem, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, ok := s.collections[collectionID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	items, err := change(s.collectionItems[collectionID])
+	if err != nil {
+		return err
+	}
+	s.collectionItems[collectionID] = items
+	collection.UpdatedAt = now()
+	s.collections[collectionID] = collection
+	return nil
+}
+
+// placeItem positions item among items using the same rules as the SQL client
+func placeItem(items []collectionItem, item collectionItem, placement database.CollectionPlacement) ([]collectionItem, error) {
+	ids := make([]uuid.UUID, len(items))
+	byID := make(map[uuid.UUID]collectionItem, len(items)+1)
+	for i, existing := range items {
+		ids[i] = existing.videoID
+		byID[existing.videoID] = existing
+	}
+	byID[item.videoID] = item
+
+	ids, err := placement.Apply(ids, item.videoID)
+	if err != nil {
+		return nil, err
+	}
+	placed := make([]collectionItem, len(ids))
+	for i, id := range ids {
+		placed[i] = byID[id]
+	}
+	return placed, nil
+}
+
+func indexOfItem(items []collectionItem, videoID uuid.UUID) int {
+	for i, item := range items {
+		if item.videoID == videoID {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeFromCollections takes a deleted video out of every collection
+func (s *Store) removeFromCollections(videoID uuid.UUID) {
+	for collectionID, items := range s.collectionItems {
+		if i := indexOfItem(items, videoID); i >= 0 {
+			s.collectionItems[collectionID] = append(items[:i:i], items[i+1:]...)
+		}
+	}
+}
+
+// ============================================
+// Share links
+// ============================================
+
+func (s *Store) CreateShareLink(ctx context.Context, params database.CreateShareLinkParams) (database.ShareLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, link := range s.shareLinks {
+		if link.Token == params.Token {
+			return database.ShareLink{}, fmt.Errorf("%w: token already in use", database.ErrConflict)
+		}
+	}
+	t := now()
+	link := database.ShareLink{
+		ID:           uuid.New(),
+		Token:        params.Token,
+		CreatedAt:    t,
+		UpdatedAt:    t,
+		UserID:       params.UserID,
+		VideoID:      params.VideoID,
+		CollectionID: params.CollectionID,
+		ExpiresAt:    params.ExpiresAt,
+		PasswordHash: params.PasswordHash,
+		MaxViews:     params.MaxViews,
+		EmbedOrigins: append([]string{}, params.EmbedOrigins...),
+	}
+	s.shareLinks[link.ID] = link
+	return link, nil
+}
+
+func (s *Store) ListShareLinks(ctx context.Context, userID uuid.UUID) ([]database.ShareLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	links := []database.ShareLink{}
+	for _, link := range s.shareLinks {
+		if link.UserID == userID {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if !links[i].CreatedAt.Equal(links[j].CreatedAt) {
+			return links[i].CreatedAt.After(links[j].CreatedAt)
+		}
+		return links[i].ID.String() > links[j].ID.String()
+	})
+	return links, nil
+}
+
+func (s *Store) GetShareLink(ctx context.Context, id uuid.UUID) (database.ShareLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.shareLinks[id]
+	if !ok {
+		return database.ShareLink{}, database.ErrNotFound
+	}
+	return link, nil
+}
+
+func (s *Store) GetShareLinkByToken(ctx context.Context, token string) (database.ShareLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, link := range s.shareLinks {
+		if link.Token == token {
+			return link, nil
+		}
+	}
+	return database.ShareLink{}, database.ErrNotFound
+}
+
+func (s *Store) RevokeShareLink(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.shareLinks[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	t := now()
+	if link.RevokedAt == nil {
+		link.RevokedAt = &t
+	}
+	link.UpdatedAt = t
+	s.shareLinks[id] = link
+	return nil
+}
+
+func (s *Store) SetShareLinkEmbedOrigins(ctx context.Context, id uuid.UUID, origins []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.shareLinks[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	link.EmbedOrigins = append([]string{}, origins...)
+	link.UpdatedAt = now()
+	s.shareLinks[id] = link
+	return nil
+}
+
+func (s *Store) RecordShareLinkView(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.shareLinks[id]
+	t := now()
+	if !ok || !link.Usable(t) {
+		return database.ErrNotFound
+	}
+	link.ViewCount++
+	link.LastViewedAt = &t
+	s.shareLinks[id] = link
+	return nil
+}
+
+// deleteShareLinks removes the links matching fn
+func (s *Store) deleteShareLinks(fn func(database.ShareLink) bool) {
+	for id, link := range s.shareLinks {
+		if fn(link) {
+			delete(s.shareLinks, id)
+		}
+	}
+}
+
+// ============================================
+// Grants
+// ============================================
+
+func (s *Store) UpsertGrant(ctx context.Context, params database.UpsertGrantParams) (database.Grant, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	for id, grant := range s.grants {
+		if sameID(grant.VideoID, params.VideoID) && sameID(grant.CollectionID, params.CollectionID) && strings.EqualFold(grant.GranteeEmail, params.GranteeEmail) {
+			grant.Role = params.Role
+			if grant.GranteeUserID == nil {
+				grant.GranteeUserID = params.GranteeUserID
+			}
+			grant.UpdatedAt = t
+			s.grants[id] = grant
+			return grant, false, nil
+		}
+	}
+	grant := database.Grant{
+		ID:            uuid.New(),
+		CreatedAt:     t,
+		UpdatedAt:     t,
+		OwnerID:       params.OwnerID,
+		VideoID:       params.VideoID,
+		CollectionID:  params.CollectionID,
+		GranteeEmail:  params.GranteeEmail,
+		GranteeUserID: params.GranteeUserID,
+		Role:          params.Role,
+	}
+	s.grants[grant.ID] = grant
+	return grant, true, nil
+}
+
+// sameID reports whether two optional IDs are both unset or equal
+func sameID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func (s *Store) GetGrant(ctx context.Context, id uuid.UUID) (database.Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grant, ok := s.grants[id]
+	if !ok {
+		return database.Grant{}, database.ErrNotFound
+	}
+	return grant, nil
+}
+
+func (s *Store) ListVideoGrants(ctx context.Context, videoID uuid.UUID) ([]database.Grant, error) {
+	return s.listGrants(func(grant database.Grant) bool { return grant.VideoID != nil && *grant.VideoID == videoID }, false), nil
+}
+
+func (s *Store) ListCollectionGrants(ctx context.Context, collectionID uuid.UUID) ([]database.Grant, error) {
+	return s.listGrants(func(grant database.Grant) bool {
+		return grant.CollectionID != nil && *grant.CollectionID == collectionID
+	}, false), nil
+}
+
+func (s *Store) ListGrantsForUser(ctx context.Context, userID uuid.UUID) ([]database.Grant, error) {
+	return s.listGrants(func(grant database.Grant) bool {
+		return grant.GranteeUserID != nil && *grant.GranteeUserID == userID
+	}, true), nil
+}
+
+// listGrants returns the grants matching fn ordered by creation, like the SQL client
+func (s *Store) listGrants(fn func(database.Grant) bool, newestFirst bool) []database.Grant {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grants := []database.Grant{}
+	for _, grant := range s.grants {
+		if fn(grant) {
+			grants = append(grants, grant)
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		a, b := grants[i], grants[j]
+		if newestFirst {
+			a, b = b, a
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID.String() < b.ID.String()
+	})
+	return grants
+}
+
+func (s *Store) DeleteGrant(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.grants[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.grants, id)
+	return nil
+}
+
+func (s *Store) GetVideoRole(ctx context.Context, videoID, userID uuid.UUID) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bestRole(userID, func(grant database.Grant) bool {
+		if grant.VideoID != nil {
+			return *grant.VideoID == videoID
+		}
+		return indexOfItem(s.collectionItems[*grant.CollectionID], videoID) >= 0
+	}), nil
+}
+
+func (s *Store) GetCollectionRole(ctx context.Context, collectionID, userID uuid.UUID) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bestRole(userID, func(grant database.Grant) bool {
+		return grant.CollectionID != nil && *grant.CollectionID == collectionID
+	}), nil
+}
+
+// bestRole returns the highest-ranked role among the user's grants matching fn
+func (s *Store) bestRole(userID uuid.UUID, fn func(database.Grant) bool) string {
+	best := ""
+	for _, grant := range s.grants {
+		if grant.GranteeUserID != nil && *grant.GranteeUserID == userID && fn(grant) &&
+			database.GrantRoleRank(grant.Role) > database.GrantRoleRank(best) {
+			best = grant.Role
+		}
+	}
+	return best
+}
+
+func (s *Store) ClaimGrants(ctx context.Context, userID uuid.UUID, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, grant := range s.grants {
+		if strings.EqualFold(grant.GranteeEmail, email) && grant.GranteeUserID == nil {
+			grant.GranteeUserID = &userID
+			grant.UpdatedAt = now()
+			s.grants[id] = grant
+		}
+	}
+	return nil
+}
+
+// deleteGrants removes the grants matching fn
+func (s *Store) deleteGrants(fn func(database.Grant) bool) {
+	for id, grant := range s.grants {
+		if fn(grant) {
+			delete(s.grants, id)
+		}
+	}
+}
+
+// ============================================
+// Comments
+// ============================================
+
+func (s *Store) CreateComment(ctx context.Context, params database.CreateCommentParams) (database.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	comment := database.Comment{
+		ID:        uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		VideoID:   params.VideoID,
+		UserID:    params.UserID,
+		ParentID:  params.ParentID,
+		Body:      params.Body,
+		AtSeconds: params.AtSeconds,
+	}
+	s.comments[comment.ID] = comment
+	return s.withAuthor(comment), nil
+}
+
+// withAuthor fills in the author's name, which the SQL client joins in
+func (s *Store) withAuthor(comment database.Comment) database.Comment {
+	comment.AuthorName = s.users[comment.UserID].FullName
+	return comment
+}
+
+func (s *Store) GetComment(ctx context.Context, id uuid.UUID) (database.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[id]
+	if !ok {
+		return database.Comment{}, database.ErrNotFound
+	}
+	return s.withAuthor(comment), nil
+}
+
+func (s *Store) ListVideoComments(ctx context.Context, videoID uuid.UUID) ([]database.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comments := []database.Comment{}
+	for _, comment := range s.comments {
+		if comment.VideoID == videoID {
+			comments = append(comments, s.withAuthor(comment))
+		}
+	}
+	sortComments(comments, false)
+	return comments, nil
+}
+
+// sortComments orders comments by creation, like the SQL client
+func sortComments(comments []database.Comment, newestFirst bool) {
+	sort.Slice(comments, func(i, j int) bool {
+		a, b := comments[i], comments[j]
+		if newestFirst {
+			a, b = b, a
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID.String() < b.ID.String()
+	})
+}
+
+func (s *Store) UpdateComment(ctx context.Context, id uuid.UUID, body string, atSeconds *float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	t := now()
+	comment.Body = body
+	comment.AtSeconds = atSeconds
+	comment.EditedAt = &t
+	comment.UpdatedAt = t
+	s.comments[id] = comment
+	return nil
+}
+
+func (s *Store) SetCommentResolved(ctx context.Context, id uuid.UUID, resolvedBy *uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	t := now()
+	comment.ResolvedAt = nil
+	if resolvedBy != nil {
+		comment.ResolvedAt = &t
+	}
+	comment.ResolvedBy = resolvedBy
+	comment.UpdatedAt = t
+	s.comments[id] = comment
+	return nil
+}
+
+func (s *Store) DeleteComment(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.comments[id]; !ok {
+		return database.ErrNotFound
+	}
+	s.deleteComments(func(comment database.Comment) bool {
+		return comment.ID == id || (comment.ParentID != nil && *comment.ParentID == id)
+	})
+	return nil
+}
+
+func (s *Store) ListCommentFeed(ctx context.Context, params database.CommentFeedParams) ([]database.FeedComment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matches := []database.Comment{}
+	for _, comment := range s.comments {
+		video, ok := s.videos[comment.VideoID]
+		if !ok || video.UserID != params.OwnerID || comment.UserID == params.OwnerID {
+			continue
+		}
+		if params.Since != nil && comment.CreatedAt.Before(*params.Since) {
+			continue
+		}
+		matches = append(matches, s.withAuthor(comment))
+	}
+	sortComments(matches, true)
+
+	feed := []database.FeedComment{}
+	for i := params.Offset; i < len(matches) && len(feed) < params.Limit; i++ {
+		feed = append(feed, database.FeedComment{Comment: matches[i], VideoTitle: s.videos[matches[i].VideoID].Title})
+	}
+	return feed, nil
+}
+
+// deleteComments removes the comments matching fn, and replies to them
+func (s *Store) deleteComments(fn func(database.Comment) bool) {
+	for id, comment := range s.comments {
+		if fn(comment) {
+			delete(s.comments, id)
+		}
+	}
+	for id, comment := range s.comments {
+		if comment.ParentID != nil {
+			if _, ok := s.comments[*comment.ParentID]; !ok {
+				delete(s.comments, id)
+			}
+		}
+	}
+}
+
+// ============================================
+// Notes
+// ============================================
+
+func (s *Store) CreateNote(ctx context.Context, params database.CreateNoteParams) (database.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	note := database.Note{
+		ID:        uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		VideoID:   params.VideoID,
+		UserID:    params.UserID,
+		Body:      params.Body,
+		AtSeconds: params.AtSeconds,
+	}
+	s.notes[note.ID] = note
+	return note, nil
+}
+
+func (s *Store) GetNote(ctx context.Context, id uuid.UUID) (database.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[id]
+	if !ok {
+		return database.Note{}, database.ErrNotFound
+	}
+	return note, nil
+}
+
+func (s *Store) ListNotes(ctx context.Context, videoID, userID uuid.UUID) ([]database.Note, error) {
+	return s.listNotes(func(note database.Note) bool { return note.VideoID == videoID && note.UserID == userID }), nil
+}
+
+func (s *Store) ListUserNotes(ctx context.Context, userID uuid.UUID) ([]database.Note, error) {
+	return s.listNotes(func(note database.Note) bool { return note.UserID == userID }), nil
+}
+
+// listNotes returns the notes matching fn, oldest first
+func (s *Store) listNotes(fn func(database.Note) bool) []database.Note {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notes := []database.Note{}
+	for _, note := range s.notes {
+		if fn(note) {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if !notes[i].CreatedAt.Equal(notes[j].CreatedAt) {
+			return notes[i].CreatedAt.Before(notes[j].CreatedAt)
+		}
+		return notes[i].ID.String() < notes[j].ID.String()
+	})
+	return notes
+}
+
+func (s *Store) UpdateNote(ctx context.Context, id uuid.UUID, body string, atSeconds *float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	note.Body = body
+	note.AtSeconds = atSeconds
+	note.UpdatedAt = now()
+	s.notes[id] = note
+	return nil
+}
+
+func (s *Store) DeleteNote(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.notes[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.notes, id)
+	return nil
+}
+
+// deleteNotes removes the notes matching fn
+func (s *Store) deleteNotes(fn func(database.Note) bool) {
+	for id, note := range s.notes {
+		if fn(note) {
+			delete(s.notes, id)
+		}
+	}
+}
+
+// ============================================
+// Playback
+// ============================================
+
+type playbackKey struct {
+	userID  uuid.UUID
+	videoID uuid.UUID
+}
+
+func (s *Store) SavePlaybackProgress(ctx context.Context, heartbeats []database.PlaybackHeartbeat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, beat := range heartbeats {
+		if _, ok := s.videos[beat.VideoID]; !ok {
+			continue
+		}
+		if _, ok := s.users[beat.UserID]; !ok {
+			continue
+		}
+		at := beat.At.UTC()
+		key := playbackKey{beat.UserID, beat.VideoID}
+		progress, ok := s.playback[key]
+		if !ok {
+			progress = database.PlaybackProgress{VideoID: beat.VideoID, FirstWatchedAt: at}
+		}
+		progress.PositionSeconds = beat.PositionSeconds
+		progress.LastWatchedAt = at
+		if beat.Finished && progress.WatchedAt == nil {
+			progress.WatchedAt = &at
+		}
+		s.playback[key] = progress
+	}
+	return nil
+}
+
+func (s *Store) GetPlaybackProgress(ctx context.Context, userID, videoID uuid.UUID) (database.PlaybackProgress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	progress, ok := s.playback[playbackKey{userID, videoID}]
+	if !ok {
+		return database.PlaybackProgress{}, database.ErrNotFound
+	}
+	return progress, nil
+}
+
+func (s *Store) ListContinueWatching(ctx context.Context, userID uuid.UUID, limit int) ([]database.WatchedVideo, error) {
+	return s.listWatchedVideos(userID, func(progress database.PlaybackProgress) bool {
+		return progress.WatchedAt == nil && progress.PositionSeconds > 0
+	}, limit, 0), nil
+}
+
+func (s *Store) ListWatchHistory(ctx context.Context, userID uuid.UUID, limit, offset int) ([]database.WatchedVideo, error) {
+	return s.listWatchedVideos(userID, func(database.PlaybackProgress) bool { return true }, limit, offset), nil
+}
+
+// listWatchedVideos returns the user's history entries matching fn, most
+// recently watched first
+func (s *Store) listWatchedVideos(userID uuid.UUID, fn func(database.PlaybackProgress) bool, limit, offset int) []database.WatchedVideo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := []database.WatchedVideo{}
+	for key, progress := range s.playback {
+		video, ok := s.videos[key.videoID]
+		if key.userID != userID || !ok || !fn(progress) {
+			continue
+		}
+		entries = append(entries, database.WatchedVideo{PlaybackProgress: progress, Video: s.withTags(video)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].LastWatchedAt.Equal(entries[j].LastWatchedAt) {
+			return entries[i].LastWatchedAt.After(entries[j].LastWatchedAt)
+		}
+		return entries[i].VideoID.String() < entries[j].VideoID.String()
+	})
+	return paginate(entries, limit, offset)
+}
+
+func (s *Store) SetVideoWatched(ctx context.Context, userID, videoID uuid.UUID, watched bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := playbackKey{userID, videoID}
+	progress, ok := s.playback[key]
+	if !watched {
+		if ok {
+			progress.WatchedAt = nil
+			s.playback[key] = progress
+		}
+		return nil
+	}
+	t := now()
+	if !ok {
+		progress = database.PlaybackProgress{VideoID: videoID, FirstWatchedAt: t, LastWatchedAt: t}
+	}
+	if progress.WatchedAt == nil {
+		progress.WatchedAt = &t
+	}
+	s.playback[key] = progress
+	return nil
+}
+
+func (s *Store) DeletePlaybackProgress(ctx context.Context, userID, videoID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := playbackKey{userID, videoID}
+	if _, ok := s.playback[key]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.playback, key)
+	return nil
+}
+
+func (s *Store) ClearPlaybackProgress(ctx context.Context, userID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deletePlayback(func(key playbackKey) bool { return key.userID == userID }), nil
+}
+
+// deletePlayback removes the progress entries whose keys match fn and returns
+// how many there were
+func (s *Store) deletePlayback(fn func(playbackKey) bool) int {
+	n := 0
+	for key := range s.playback {
+		if fn(key) {
+			delete(s.playback, key)
+			n++
+		}
+	}
+	return n
+}
+
+// ============================================
+// Analytics
+// ============================================
+
+type dailyStatsKey struct {
+	videoID uuid.UUID
+	day     string
+}
+
+func (s *Store) SaveAnalyticsEvents(ctx context.Context, events []database.AnalyticsEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		if _, ok := s.videos[event.VideoID]; ok {
+			event.CreatedAt = event.CreatedAt.UTC()
+			s.analyticsEvents = append(s.analyticsEvents, event)
+		}
+	}
+	return nil
+}
+
+func (s *Store) AddBandwidthUsage(ctx context.Context, usage []database.BandwidthUsage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range usage {
+		if _, ok := s.videos[u.VideoID]; !ok {
+			continue
+		}
+		key := dailyStatsKey{u.VideoID, u.Day}
+		stats := s.dailyStats[key]
+		stats.BytesServed += u.Bytes
+		s.dailyStats[key] = stats
+	}
+	return nil
+}
+
+func (s *Store) RollupAnalytics(ctx context.Context, fromDay string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rollups := map[dailyStatsKey]database.VideoStats{}
+	for _, event := range s.analyticsEvents {
+		key := dailyStatsKey{event.VideoID, database.AnalyticsDay(event.CreatedAt)}
+		if key.day < fromDay {
+			continue
+		}
+		stats := rollups[key]
+		switch event.Type {
+		case database.AnalyticsEventPlay:
+			stats.Views++
+		case database.AnalyticsEventComplete:
+			stats.Completions++
+		}
+		stats.WatchSeconds += event.WatchSeconds
+		rollups[key] = stats
+		if s.dailyViewers[key] == nil {
+			s.dailyViewers[key] = map[string]bool{}
+		}
+		s.dailyViewers[key][event.ViewerKey] = true
+	}
+	for key, stats := range rollups {
+		stats.UniqueViewers = len(s.dailyViewers[key])
+		// Bytes served are added as they happen, not rolled up
+		stats.BytesServed = s.dailyStats[key].BytesServed
+		s.dailyStats[key] = stats
+	}
+	return nil
+}
+
+func (s *Store) PruneAnalyticsEvents(ctx context.Context, beforeDay string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.analyticsEvents[:0]
+	for _, event := range s.analyticsEvents {
+		if database.AnalyticsDay(event.CreatedAt) >= beforeDay {
+			kept = append(kept, event)
+		}
+	}
+	s.analyticsEvents = kept
+	return nil
+}
+
+func (s *Store) ListVideoDailyStats(ctx context.Context, videoID uuid.UUID, fromDay, toDay string) ([]database.DailyVideoStats, error) {
+	return s.listDailyStats(func(id uuid.UUID) bool { return id == videoID }, fromDay, toDay), nil
+}
+
+func (s *Store) ListUserDailyStats(ctx context.Context, userID uuid.UUID, fromDay, toDay string) ([]database.DailyVideoStats, error) {
+	return s.listDailyStats(func(id uuid.UUID) bool { return s.videos[id].UserID == userID }, fromDay, toDay), nil
+}
+
+// listDailyStats sums the stats of videos matching fn by day, oldest first
+func (s *Store) listDailyStats(fn func(uuid.UUID) bool, fromDay, toDay string) []database.DailyVideoStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byDay := map[string]database.VideoStats{}
+	for key, stats := range s.dailyStats {
+		if key.day < fromDay || key.day > toDay || !fn(key.videoID) {
+			continue
+		}
+		total := byDay[key.day]
+		total.Add(stats)
+		byDay[key.day] = total
+	}
+	days := []database.DailyVideoStats{}
+	for day, stats := range byDay {
+		stats.UniqueViewers = s.countViewers(fn, day, day)
+		days = append(days, database.DailyVideoStats{Day: day, VideoStats: stats})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day < days[j].Day })
+	return days
+}
+
+func (s *Store) ListUserVideoStats(ctx context.Context, userID uuid.UUID, fromDay, toDay string) ([]database.VideoStatsSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byVideo := map[uuid.UUID]database.VideoStats{}
+	for key, stats := range s.dailyStats {
+		video, ok := s.videos[key.videoID]
+		if !ok || video.UserID != userID || key.day < fromDay || key.day > toDay {
+			continue
+		}
+		total := byVideo[key.videoID]
+		total.Add(stats)
+		byVideo[key.videoID] = total
+	}
+	videos := []database.VideoStatsSummary{}
+	for videoID, stats := range byVideo {
+		stats.UniqueViewers = s.countViewers(func(id uuid.UUID) bool { return id == videoID }, fromDay, toDay)
+		videos = append(videos, database.VideoStatsSummary{VideoID: videoID, Title: s.videos[videoID].Title, VideoStats: stats})
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		a, b := videos[i], videos[j]
+		if a.Views != b.Views {
+			return a.Views > b.Views
+		}
+		if a.WatchSeconds != b.WatchSeconds {
+			return a.WatchSeconds > b.WatchSeconds
+		}
+		return a.VideoID.String() < b.VideoID.String()
+	})
+	return videos, nil
+}
+
+func (s *Store) CountVideoViewers(ctx context.Context, videoID uuid.UUID, fromDay, toDay string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.countViewers(func(id uuid.UUID) bool { return id == videoID }, fromDay, toDay), nil
+}
+
+func (s *Store) CountUserViewers(ctx context.Context, userID uuid.UUID, fromDay, toDay string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.countViewers(func(id uuid.UUID) bool { return s.videos[id].UserID == userID }, fromDay, toDay), nil
+}
+
+// countViewers counts the distinct viewers of videos matching fn from fromDay
+// to toDay inclusive
+func (s *Store) countViewers(fn func(uuid.UUID) bool, fromDay, toDay string) int {
+	viewers := map[string]bool{}
+	for key, keys := range s.dailyViewers {
+		if key.day < fromDay || key.day > toDay || !fn(key.videoID) {
+			continue
+		}
+		for viewer := range keys {
+			viewers[viewer] = true
+		}
+	}
+	return len(viewers)
+}
+
+// deleteAnalytics removes the events and stats of videos matching fn
+func (s *Store) deleteAnalytics(fn func(uuid.UUID) bool) {
+	kept := s.analyticsEvents[:0]
+	for _, event := range s.analyticsEvents {
+		if !fn(event.VideoID) {
+			kept = append(kept, event)
+		}
+	}
+	s.analyticsEvents = kept
+	for key := range s.dailyStats {
+		if fn(key.videoID) {
+			delete(s.dailyStats, key)
+		}
+	}
+	for key := range s.dailyViewers {
+		if fn(key.videoID) {
+			delete(s.dailyViewers, key)
+		}
+	}
+}
+
+// ============================================
+// Webhooks
+// ============================================
+
+func (s *Store) CreateWebhook(ctx context.Context, params database.CreateWebhookParams) (database.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	webhook := database.Webhook{
+		ID:          uuid.New(),
+		CreatedAt:   t,
+		UpdatedAt:   t,
+		UserID:      params.UserID,
+		URL:         params.URL,
+		Description: params.Description,
+		Secret:      params.Secret,
+		Events:      append([]string{}, params.Events...),
+		Active:      true,
+	}
+	s.webhooks[webhook.ID] = webhook
+	return webhook, nil
+}
+
+func (s *Store) GetWebhook(ctx context.Context, id uuid.UUID) (database.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return database.Webhook{}, database.ErrNotFound
+	}
+	return webhook, nil
+}
+
+func (s *Store) ListWebhooks(ctx context.Context, userID uuid.UUID) ([]database.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhooks := []database.Webhook{}
+	for _, webhook := range s.webhooks {
+		if webhook.UserID == userID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID.String() < webhooks[j].ID.String()
+	})
+	return webhooks, nil
+}
+
+func (s *Store) UpdateWebhook(ctx context.Context, webhook database.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.webhooks[webhook.ID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	existing.URL = webhook.URL
+	existing.Description = webhook.Description
+	existing.Secret = webhook.Secret
+	existing.Events = append([]string{}, webhook.Events...)
+	existing.Active = webhook.Active
+	existing.UpdatedAt = now()
+	s.webhooks[webhook.ID] = existing
+	return nil
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return database.ErrNotFound
+	}
+	s.deleteWebhooks(func(webhook database.Webhook) bool { return webhook.ID == id })
+	return nil
+}
+
+func (s *Store) EnqueueWebhookEvent(ctx context.Context, event database.WebhookEvent) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	n := 0
+	for _, webhook := range s.webhooks {
+		if webhook.UserID != event.UserID || !webhook.Subscribes(event.Type) {
+			continue
+		}
+		delivery := database.WebhookDelivery{
+			ID:            uuid.New(),
+			CreatedAt:     t,
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       append([]byte{}, event.Payload...),
+			Status:        database.WebhookDeliveryPending,
+			NextAttemptAt: &t,
+		}
+		s.deliveries[delivery.ID] = delivery
+		n++
+	}
+	return n, nil
+}
+
+func (s *Store) ClaimWebhookDeliveries(ctx context.Context, t time.Time, lease time.Duration, limit int) ([]database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := []database.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.Status == database.WebhookDeliveryPending && !delivery.NextAttemptAt.After(t) &&
+			s.webhooks[delivery.WebhookID].Active {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(*due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(*due[j].NextAttemptAt)
+		}
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	leaseUntil := t.Add(lease).UTC()
+	for i := range due {
+		due[i].NextAttemptAt = &leaseUntil
+		s.deliveries[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (s *Store) CountUntriedWebhookDeliveries(ctx context.Context, userID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, delivery := range s.deliveries {
+		webhook := s.webhooks[delivery.WebhookID]
+		if webhook.UserID == userID && webhook.Active && delivery.Status == database.WebhookDeliveryPending && delivery.Attempts == 0 {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) RecordWebhookAttempt(ctx context.Context, id uuid.UUID, attempt database.WebhookAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	at := attempt.At.UTC()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &at
+	delivery.ResponseCode = attempt.ResponseCode
+	delivery.LastError = attempt.Error
+	delivery.NextAttemptAt = nil
+	switch {
+	case attempt.Succeeded:
+		delivery.Status = database.WebhookDeliverySucceeded
+	case attempt.RetryAt != nil:
+		retryAt := attempt.RetryAt.UTC()
+		delivery.Status = database.WebhookDeliveryPending
+		delivery.NextAttemptAt = &retryAt
+	default:
+		delivery.Status = database.WebhookDeliveryFailed
+	}
+	s.deliveries[id] = delivery
+	return nil
+}
+
+func (s *Store) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit, offset int) ([]database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := []database.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID.String() > deliveries[j].ID.String()
+	})
+	if offset >= len(deliveries) {
+		return []database.WebhookDelivery{}, nil
+	}
+	return deliveries[offset:min(offset+limit, len(deliveries))], nil
+}
+
+func (s *Store) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return database.WebhookDelivery{}, database.ErrNotFound
+	}
+	return delivery, nil
+}
+
+func (s *Store) RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	original, ok := s.deliveries[id]
+	if !ok {
+		return database.WebhookDelivery{}, database.ErrNotFound
+	}
+	t := now()
+	delivery := database.WebhookDelivery{
+		ID:            uuid.New(),
+		CreatedAt:     t,
+		WebhookID:     original.WebhookID,
+		EventID:       original.EventID,
+		EventType:     original.EventType,
+		Payload:       original.Payload,
+		Status:        database.WebhookDeliveryPending,
+		NextAttemptAt: &t,
+		RedeliveryOf:  &original.ID,
+	}
+	s.deliveries[delivery.ID] = delivery
+	return delivery, nil
+}
+
+func (s *Store) PruneWebhookDeliveries(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, delivery := range s.deliveries {
+		if delivery.Status != database.WebhookDeliveryPending && delivery.CreatedAt.Before(before) {
+			delete(s.deliveries, id)
+		}
+	}
+	return nil
+}
+
+// deleteWebhooks removes the webhooks matching fn and all their deliveries
+func (s *Store) deleteWebhooks(fn func(database.Webhook) bool) {
+	for id, webhook := range s.webhooks {
+		if !fn(webhook) {
+			continue
+		}
+		delete(s.webhooks, id)
+		for deliveryID, delivery := range s.deliveries {
+			if delivery.WebhookID == id {
+				delete(s.deliveries, deliveryID)
+			}
+		}
+	}
+}
+
+// ============================================
+// Tokens
+// ============================================
+
+func (s *Store) CreateRefreshToken(ctx context.Context, params database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	rt := database.RefreshToken{
+		CreateRefreshTokenParams: params,
+		CreatedAt:                t,
+		UpdatedAt:                t,
+	}
+	s.refreshTokens[params.Token] = rt
+	return rt, nil
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.refreshTokens[token]
+	if !ok {
+		return database.RefreshToken{}, database.ErrNotFound
+	}
+	return rt, nil
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rt, ok := s.refreshTokens[token]; ok {
+		t := now()
+		rt.RevokedAt = &t
+		s.refreshTokens[token] = rt
+	}
+	return nil
+}
+
+func (s *Store) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	for token, rt := range s.refreshTokens {
+		if rt.UserID == userID && rt.RevokedAt == nil {
+			rt.RevokedAt = &t
+			rt.UpdatedAt = t
+			s.refreshTokens[token] = rt
+		}
+	}
+	return nil
+}
+
+func (s *Store) DeleteRefreshToken(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.refreshTokens, token)
+	return nil
+}
+
+func (s *Store) CreatePasswordResetToken(ctx context.Context, userID uuid.UUID) (*database.PasswordResetToken, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	prt := database.PasswordResetToken{
+		Token:     hex.EncodeToString(tokenBytes),
+		UserID:    userID,
+		ExpiresAt: t.Add(time.Hour),
+		CreatedAt: t,
+	}
+	s.passwordResets[prt.Token] = prt
+	return &prt, nil
+}
+
+func (s *Store) GetPasswordResetToken(ctx context.Context, token string) (*database.PasswordResetToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prt, ok := s.passwordResets[token]
+	if !ok || prt.UsedAt != nil || !prt.ExpiresAt.After(now()) {
+		return nil, database.ErrNotFound
+	}
+	return &prt, nil
+}
+
+func (s *Store) MarkPasswordResetTokenUsed(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if prt, ok := s.passwordResets[token]; ok {
+		t := now()
+		prt.UsedAt = &t
+		s.passwordResets[token] = prt
+	}
+	return nil
+}
+
+func (s *Store) DeleteExpiredPasswordResetTokens(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	for token, prt := range s.passwordResets {
+		if prt.ExpiresAt.Before(t) || prt.UsedAt != nil {
+			delete(s.passwordResets, token)
+		}
+	}
+	return nil
+}
+
+// ============================================
+// Auth throttles
+// ============================================
+
+func (s *Store) GetAuthThrottle(ctx context.Context, key string) (database.AuthThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.throttles[key], nil
+}
+
+func (s *Store) IncrementAuthThrottle(ctx context.Context, key string, windowStart time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	throttle, ok := s.throttles[key]
+	if !ok || throttle.LastFailureAt.Before(windowStart) {
+		throttle = database.AuthThrottle{Key: key, LockedUntil: throttle.LockedUntil}
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = now()
+	s.throttles[key] = throttle
+	return throttle.Failures, nil
+}
+
+func (s *Store) LockAuthThrottle(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if throttle, ok := s.throttles[key]; ok {
+		until = until.UTC()
+		throttle.LockedUntil = &until
+		s.throttles[key] = throttle
+	}
+	return nil
+}
+
+func (s *Store) ClearAuthThrottle(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.throttles, key)
+	return nil
+}
+
+// ============================================
+// Audit events
+// ============================================
+
+func (s *Store) CreateAuditEvent(ctx context.Context, params database.CreateAuditEventParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.auditEvents = append(s.auditEvents, database.AuditEvent{
+		ID:         uuid.New(),
+		CreatedAt:  now(),
+		ActorID:    params.ActorID,
+		Action:     params.Action,
+		TargetType: params.TargetType,
+		TargetID:   params.TargetID,
+		IP:         params.IP,
+		UserAgent:  params.UserAgent,
+		Outcome:    params.Outcome,
+		Details:    params.Details,
+	})
+	return nil
+}
+
+func (s *Store) ListAuditEvents(ctx context.Context, filter database.AuditEventFilter) ([]database.AuditEvent, error) {
+	events := []database.AuditEvent{}
+	err := s.StreamAuditEvents(ctx, filter, func(event database.AuditEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+func (s *Store) StreamAuditEvents(ctx context.Context, filter database.AuditEventFilter, fn func(database.AuditEvent) error) error {
+	s.mu.Lock()
+	matches := []database.AuditEvent{}
+	// Appended in time order, so walk backwards for newest first
+	for i := len(s.auditEvents) - 1; i >= 0; i-- {
+		if auditEventMatches(s.auditEvents[i], filter) {
+			matches = append(matches, s.auditEvents[i])
+		}
+	}
+	s.mu.Unlock()
+
+	if filter.Limit > 0 {
+		matches = paginate(matches, filter.Limit, filter.Offset)
+	}
+	for _, event := range matches {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func auditEventMatches(event database.AuditEvent, filter database.AuditEventFilter) bool {
+	sameID := func(a *uuid.UUID, b uuid.UUID) bool { return a != nil && *a == b }
+
+	if filter.ActorID != nil && !sameID(event.ActorID, *filter.ActorID) {
+		return false
+	}
+	if filter.InvolvingUser != nil &&
+		!sameID(event.ActorID, *filter.InvolvingUser) &&
+		!(event.TargetType == "user" && event.TargetID == filter.InvolvingUser.String()) {
+		return false
+	}
+	if filter.TargetType != "" && event.TargetType != filter.TargetType {
+		return false
+	}
+	if filter.TargetID != "" && event.TargetID != filter.TargetID {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(filter.Action, "*"); ok {
+		if !strings.HasPrefix(event.Action, prefix) {
+			return false
+		}
+	} else if filter.Action != "" && event.Action != filter.Action {
+		return false
+	}
+	if filter.Outcome != "" && event.Outcome != filter.Outcome {
+		return false
+	}
+	if filter.Since != nil && event.CreatedAt.Before(*filter.Since) {
+		return false
+	}
+	if filter.Until != nil && !event.CreatedAt.Before(*filter.Until) {
+		return false
+	}
+	return true
+}
+
+// paginate returns the items in [offset, offset+limit)
+func paginate[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	items = items[offset:]
+	if limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
@@ -0,0 +1,364 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is one numbered schema change with its up and down SQL
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a known migration has been applied
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// loadMigrations reads migrations/<dialect>/NNNN_name.{up,down}.sql, ordered by version.
+// Both dialects must define the same versions so status stays comparable.
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || !strings.HasSuffix(name, ".sql") || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("unexpected migration file %q", name)
+		}
+		versionStr, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration file %q must be named NNNN_name.%s.sql", name, direction)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration file %q has an invalid version", name)
+		}
+
+		contents, err := migrationFiles.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// migrationLockID is an arbitrary key for the Postgres advisory lock that
+// stops replicas starting at the same time from migrating concurrently
+const migrationLockID = 72616574
+
+// lockMigrations serializes migration transactions across processes. SQLite
+// already allows only one writer at a time, so it only matters on Postgres.
+func lockMigrations(ctx context.Context, tx *dbTx) error {
+	if tx.dialect != dialectPostgres {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(?)", migrationLockID)
+	return err
+}
+
+// ensureMigrationsTable creates schema_migrations, adopting SQLite databases
+// created by the old autoMigrate as version 1 so their existing data is kept
+func (c Client) ensureMigrationsTable(ctx context.Context) error {
+	exists, err := c.tableExists(ctx, "schema_migrations")
+	if err != nil || exists {
+		return err
+	}
+
+	legacy := false
+	if c.db.dialect == dialectSQLite {
+		legacy, err = c.tableExists(ctx, "users")
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockMigrations(ctx, tx); err != nil {
+		return err
+	}
+
+	appliedAtType := "TIMESTAMP"
+	if c.db.dialect == dialectPostgres {
+		appliedAtType = "TIMESTAMPTZ"
+	}
+	_, err = tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at `+appliedAtType+` NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	if legacy {
+		if err := adoptLegacySchema(ctx, tx); err != nil {
+			return fmt.Errorf("couldn't adopt existing schema: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// legacyColumns were added over time by ALTER TABLE statements whose errors
+// were ignored, so older databases may be missing any of them
+var legacyColumns = []struct {
+	table, column, definition string
+}{
+	{"users", "full_name", "TEXT DEFAULT ''"},
+	{"users", "email_verified_at", "TIMESTAMP"},
+	{"users", "role", "TEXT NOT NULL DEFAULT 'user'"},
+	{"users", "disabled_at", "TIMESTAMP"},
+	{"users", "password_reset_required", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"users", "deletion_requested_at", "TIMESTAMP"},
+	{"videos", "video_size", "INTEGER NOT NULL DEFAULT 0"},
+	{"videos", "thumbnail_size", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// adoptLegacySchema brings an autoMigrate-era SQLite database up to the
+// baseline schema and records migration 1 as applied
+func adoptLegacySchema(ctx context.Context, tx *dbTx) error {
+	migrations, err := loadMigrations(string(dialectSQLite))
+	if err != nil {
+		return err
+	}
+	baseline := migrations[0]
+
+	// The baseline only uses IF NOT EXISTS, so this just fills in missing tables
+	if _, err := tx.Tx.ExecContext(ctx, baseline.Up); err != nil {
+		return err
+	}
+
+	for _, col := range legacyColumns {
+		var count int
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", col.table, col.column).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.column, col.definition)
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("couldn't add %s.%s: %w", col.table, col.column, err)
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		baseline.Version, baseline.Name, time.Now().UTC(),
+	)
+	return err
+}
+
+func (c Client) tableExists(ctx context.Context, name string) (bool, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	if c.db.dialect == dialectPostgres {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+	var count int
+	err := c.db.QueryRowContext(ctx, query, name).Scan(&count)
+	return count > 0, err
+}
+
+// appliedMigrations returns applied versions mapped to when they were applied
+func (c Client) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// prepareMigrations loads this dialect's migrations and the set already applied
+func (c Client) prepareMigrations(ctx context.Context) ([]Migration, map[int]time.Time, error) {
+	if err := c.ensureMigrationsTable(ctx); err != nil {
+		return nil, nil, err
+	}
+	migrations, err := loadMigrations(string(c.db.dialect))
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return migrations, applied, nil
+}
+
+// MigrateUp applies every pending migration in order, each in its own
+// transaction, and returns the ones it applied
+func (c Client) MigrateUp(ctx context.Context) ([]Migration, error) {
+	if err := c.requireFTS5(ctx); err != nil {
+		return nil, err
+	}
+	migrations, applied, err := c.prepareMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		ran, err := c.runMigration(ctx, m, true)
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		if ran {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// MigrateDown rolls back the most recently applied migrations, newest first
+func (c Client) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, applied, err := c.prepareMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		ran, err := c.runMigration(ctx, m, false)
+		if err != nil {
+			return done, fmt.Errorf("rollback of %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		if ran {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// MigrationStatus lists every known migration and when it was applied
+func (c Client) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, applied, err := c.prepareMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// runMigration applies (up) or reverts (down) one migration together with its
+// schema_migrations bookkeeping in a single transaction. It reports false if
+// another process got there first.
+func (c Client) runMigration(ctx context.Context, m Migration, up bool) (bool, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := lockMigrations(ctx, tx); err != nil {
+		return false, err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version = ?", m.Version).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	if (count > 0) == up {
+		return false, nil
+	}
+
+	// Scripts run without placeholder rebinding; they take no arguments
+	script := m.Down
+	if up {
+		script = m.Up
+	}
+	if _, err := tx.Tx.ExecContext(ctx, script); err != nil {
+		return false, err
+	}
+
+	if up {
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			m.Version, m.Name, time.Now().UTC(),
+		)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,4 @@
+-- The column type fix only applies to SQLite; Postgres gets the matching indexes
+CREATE INDEX idx_videos_user_id ON videos(user_id, created_at);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
@@ -0,0 +1,21 @@
+-- Full-text index over video metadata, weighted so title matches rank first.
+-- The 'simple' configuration matches SQLite's unicode61 tokenizer: no stemming
+-- or stop words, so both backends find the same videos.
+ALTER TABLE videos ADD COLUMN search_vector TSVECTOR;
+
+CREATE FUNCTION videos_search_vector() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('simple', coalesce(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('simple', coalesce(NEW.description, '')), 'B');
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER videos_search_vector_update
+BEFORE INSERT OR UPDATE OF title, description ON videos
+	FOR EACH ROW EXECUTE FUNCTION videos_search_vector();
+
+UPDATE videos SET title = title;
+
+CREATE INDEX idx_videos_search_vector ON videos USING GIN (search_vector);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_videos_user_title;
+DROP INDEX IF EXISTS idx_videos_user_updated;
+ALTER TABLE videos DROP COLUMN IF EXISTS aspect_ratio;
+ALTER TABLE videos DROP COLUMN IF EXISTS duration_seconds;
@@ -0,0 +1,6 @@
+-- Filled in from ffprobe when a video file is uploaded
+ALTER TABLE videos ADD COLUMN duration_seconds DOUBLE PRECISION;
+ALTER TABLE videos ADD COLUMN aspect_ratio TEXT;
+
+CREATE INDEX idx_videos_user_updated ON videos(user_id, updated_at);
+CREATE INDEX idx_videos_user_title ON videos(user_id, LOWER(title));
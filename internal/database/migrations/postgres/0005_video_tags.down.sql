@@ -0,0 +1,21 @@
+DROP TRIGGER IF EXISTS tags_search ON tags;
+DROP FUNCTION IF EXISTS tags_refresh_search();
+DROP TRIGGER IF EXISTS video_tags_search ON video_tags;
+DROP FUNCTION IF EXISTS video_tags_refresh_search();
+
+DROP INDEX IF EXISTS idx_video_tags_tag_id;
+DROP TABLE IF EXISTS video_tags;
+DROP INDEX IF EXISTS idx_tags_user_name;
+DROP TABLE IF EXISTS tags;
+
+-- Restore the search vector from 0003
+CREATE OR REPLACE FUNCTION videos_search_vector() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('simple', coalesce(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('simple', coalesce(NEW.description, '')), 'B');
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+UPDATE videos SET title = title;
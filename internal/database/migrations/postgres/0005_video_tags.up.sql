@@ -0,0 +1,62 @@
+-- Tags belong to a user; names are unique per user, ignoring case
+CREATE TABLE tags (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_tags_user_name ON tags(user_id, LOWER(name));
+
+CREATE TABLE video_tags (
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	tag_id TEXT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(video_id, tag_id)
+);
+
+CREATE INDEX idx_video_tags_tag_id ON video_tags(tag_id);
+
+-- Tag names join the search vector between the title and the description
+CREATE OR REPLACE FUNCTION videos_search_vector() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('simple', coalesce(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('simple', coalesce((
+			SELECT string_agg(t.name, ' ')
+			FROM video_tags vt JOIN tags t ON t.id = vt.tag_id
+			WHERE vt.video_id = NEW.id
+		), '')), 'B') ||
+		setweight(to_tsvector('simple', coalesce(NEW.description, '')), 'C');
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Touching the title re-runs videos_search_vector for the affected videos
+CREATE FUNCTION video_tags_refresh_search() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		UPDATE videos SET title = title WHERE id = OLD.video_id;
+	ELSE
+		UPDATE videos SET title = title WHERE id = NEW.video_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER video_tags_search AFTER INSERT OR DELETE ON video_tags
+	FOR EACH ROW EXECUTE FUNCTION video_tags_refresh_search();
+
+CREATE FUNCTION tags_refresh_search() RETURNS trigger AS $$
+BEGIN
+	UPDATE videos SET title = title
+	WHERE id IN (SELECT video_id FROM video_tags WHERE tag_id = NEW.id);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tags_search AFTER UPDATE OF name ON tags
+	FOR EACH ROW EXECUTE FUNCTION tags_refresh_search();
+
+UPDATE videos SET title = title;
@@ -0,0 +1,25 @@
+-- Collections are ordered playlists of a user's videos. A video can be in
+-- any number of collections, once per collection.
+CREATE TABLE collections (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_collections_user_created ON collections(user_id, created_at);
+
+-- Items are ordered by position, which is renumbered from 0 whenever items
+-- are added, moved or removed
+CREATE TABLE collection_items (
+	collection_id TEXT NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(collection_id, video_id)
+);
+
+CREATE INDEX idx_collection_items_position ON collection_items(collection_id, position);
+CREATE INDEX idx_collection_items_video_id ON collection_items(video_id);
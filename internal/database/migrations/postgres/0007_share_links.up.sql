@@ -0,0 +1,22 @@
+-- Share links give outside viewers access to one video or collection without
+-- an account. Expiry, password and view limit are all optional.
+CREATE TABLE share_links (
+	id TEXT PRIMARY KEY,
+	token TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	video_id TEXT REFERENCES videos(id) ON DELETE CASCADE,
+	collection_id TEXT REFERENCES collections(id) ON DELETE CASCADE,
+	expires_at TIMESTAMPTZ,
+	password_hash TEXT,
+	max_views INTEGER,
+	view_count INTEGER NOT NULL DEFAULT 0,
+	last_viewed_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	CHECK ((video_id IS NULL) <> (collection_id IS NULL))
+);
+
+CREATE INDEX idx_share_links_user_created ON share_links(user_id, created_at);
+CREATE INDEX idx_share_links_video_id ON share_links(video_id);
+CREATE INDEX idx_share_links_collection_id ON share_links(collection_id);
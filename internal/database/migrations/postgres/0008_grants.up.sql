@@ -0,0 +1,20 @@
+-- Grants share one video or collection with another user. They are keyed by
+-- email so people without an account yet can be invited; grantee_user_id is
+-- filled in once an account owns that address.
+CREATE TABLE grants (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	owner_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	video_id TEXT REFERENCES videos(id) ON DELETE CASCADE,
+	collection_id TEXT REFERENCES collections(id) ON DELETE CASCADE,
+	grantee_email TEXT NOT NULL,
+	grantee_user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL CHECK (role IN ('viewer', 'commenter', 'editor')),
+	CHECK ((video_id IS NULL) <> (collection_id IS NULL)),
+	UNIQUE (video_id, grantee_email),
+	UNIQUE (collection_id, grantee_email)
+);
+
+CREATE INDEX idx_grants_grantee_user_id ON grants(grantee_user_id);
+CREATE INDEX idx_grants_grantee_email ON grants(grantee_email);
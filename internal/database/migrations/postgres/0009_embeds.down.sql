@@ -0,0 +1,2 @@
+ALTER TABLE share_links DROP COLUMN IF EXISTS embed_origins;
+ALTER TABLE videos DROP COLUMN IF EXISTS captions_url;
@@ -0,0 +1,33 @@
+-- Comments are feedback on a video from anyone allowed to comment on it,
+-- optionally pinned to a moment with at_seconds. Replies point at the
+-- top-level comment they answer; only top-level comments are resolved.
+CREATE TABLE comments (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	parent_id TEXT REFERENCES comments(id) ON DELETE CASCADE,
+	body TEXT NOT NULL,
+	at_seconds DOUBLE PRECISION,
+	edited_at TIMESTAMPTZ,
+	resolved_at TIMESTAMPTZ,
+	resolved_by TEXT REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_comments_video_created ON comments(video_id, created_at);
+CREATE INDEX idx_comments_parent_id ON comments(parent_id);
+CREATE INDEX idx_comments_created ON comments(created_at);
+
+-- Notes are private annotations on a video, only ever shown to their author
+CREATE TABLE notes (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	body TEXT NOT NULL,
+	at_seconds DOUBLE PRECISION
+);
+
+CREATE INDEX idx_notes_video_user ON notes(video_id, user_id);
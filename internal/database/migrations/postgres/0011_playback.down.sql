@@ -0,0 +1 @@
+DROP TABLE playback_progress;
@@ -0,0 +1,15 @@
+-- Playback progress is how far each user got in each video. A row is the
+-- user's watch history entry for the video; watched_at is set once they
+-- finish it or mark it watched.
+CREATE TABLE playback_progress (
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	position_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+	first_watched_at TIMESTAMPTZ NOT NULL,
+	last_watched_at TIMESTAMPTZ NOT NULL,
+	watched_at TIMESTAMPTZ,
+	PRIMARY KEY (user_id, video_id)
+);
+
+CREATE INDEX idx_playback_progress_user_last_watched ON playback_progress(user_id, last_watched_at);
+CREATE INDEX idx_playback_progress_video_id ON playback_progress(video_id);
@@ -0,0 +1,38 @@
+-- Webhooks post video lifecycle events to a URL of the user's choosing.
+-- events is a space-separated list of the event types it subscribes to.
+CREATE TABLE webhooks (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	secret TEXT NOT NULL,
+	events TEXT NOT NULL,
+	active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE INDEX idx_webhooks_user_id ON webhooks(user_id);
+
+-- Deliveries are the queue of events to post. Pending deliveries are sent once
+-- next_attempt_at has passed and retried with backoff until they succeed or
+-- run out of attempts. A redelivery is a new row pointing at the original.
+CREATE TABLE webhook_deliveries (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	webhook_id TEXT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL CHECK (status IN ('pending', 'succeeded', 'failed')),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ,
+	last_attempt_at TIMESTAMPTZ,
+	response_code INTEGER,
+	last_error TEXT,
+	redelivery_of TEXT
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX idx_webhook_deliveries_webhook_created ON webhook_deliveries(webhook_id, created_at);
+CREATE INDEX idx_webhook_deliveries_created_at ON webhook_deliveries(created_at);
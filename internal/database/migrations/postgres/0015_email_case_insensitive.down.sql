@@ -0,0 +1,4 @@
+DROP INDEX idx_grants_grantee_email;
+CREATE INDEX idx_grants_grantee_email ON grants(grantee_email);
+
+DROP INDEX idx_users_email_lower;
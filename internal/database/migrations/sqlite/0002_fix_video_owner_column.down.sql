@@ -0,0 +1,26 @@
+DROP INDEX IF EXISTS idx_password_reset_tokens_user_id;
+DROP INDEX IF EXISTS idx_refresh_tokens_user_id;
+DROP INDEX IF EXISTS idx_videos_user_id;
+
+CREATE TABLE videos_old (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id INTEGER,
+	video_size INTEGER NOT NULL DEFAULT 0,
+	thumbnail_size INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO videos_old
+	(id, created_at, updated_at, title, description, thumbnail_url, video_url, user_id, video_size, thumbnail_size)
+SELECT
+	id, created_at, updated_at, title, description, thumbnail_url, video_url, user_id, video_size, thumbnail_size
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_old RENAME TO videos;
@@ -0,0 +1,30 @@
+-- videos.user_id was declared INTEGER although it has always held UUID strings.
+-- SQLite can't change a column type in place, so rebuild the table. Videos
+-- without an existing owner can't be reached through the API and are dropped.
+CREATE TABLE videos_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id TEXT NOT NULL,
+	video_size INTEGER NOT NULL DEFAULT 0,
+	thumbnail_size INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO videos_new
+	(id, created_at, updated_at, title, description, thumbnail_url, video_url, user_id, video_size, thumbnail_size)
+SELECT
+	id, created_at, updated_at, title, description, thumbnail_url, video_url, CAST(user_id AS TEXT), video_size, thumbnail_size
+FROM videos
+WHERE user_id IN (SELECT id FROM users);
+
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
+
+CREATE INDEX idx_videos_user_id ON videos(user_id, created_at);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
@@ -0,0 +1,31 @@
+-- Full-text index over video metadata. videos has no INTEGER PRIMARY KEY, so
+-- its rowids can change on VACUUM; the index keeps its own copy of the text
+-- keyed by video_id instead of using external content.
+CREATE VIRTUAL TABLE videos_fts USING fts5(
+	video_id UNINDEXED,
+	title,
+	description,
+	tokenize = 'unicode61 remove_diacritics 2',
+	prefix = '2 3'
+);
+
+INSERT INTO videos_fts (video_id, title, description)
+SELECT id, title, COALESCE(description, '') FROM videos;
+
+CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos
+BEGIN
+	INSERT INTO videos_fts (video_id, title, description)
+	VALUES (new.id, new.title, COALESCE(new.description, ''));
+END;
+
+CREATE TRIGGER videos_fts_update AFTER UPDATE OF title, description ON videos
+BEGIN
+	UPDATE videos_fts
+	SET title = new.title, description = COALESCE(new.description, '')
+	WHERE video_id = old.id;
+END;
+
+CREATE TRIGGER videos_fts_delete AFTER DELETE ON videos
+BEGIN
+	DELETE FROM videos_fts WHERE video_id = old.id;
+END;
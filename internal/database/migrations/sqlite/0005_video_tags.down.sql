@@ -0,0 +1,41 @@
+DROP TRIGGER IF EXISTS tags_fts_rename;
+DROP TRIGGER IF EXISTS video_tags_fts_delete;
+DROP TRIGGER IF EXISTS video_tags_fts_insert;
+DROP TRIGGER IF EXISTS videos_fts_delete;
+DROP TRIGGER IF EXISTS videos_fts_update;
+DROP TRIGGER IF EXISTS videos_fts_insert;
+DROP TABLE IF EXISTS videos_fts;
+
+-- Restore the index from 0003 without the tags column
+CREATE VIRTUAL TABLE videos_fts USING fts5(
+	video_id UNINDEXED,
+	title,
+	description,
+	tokenize = 'unicode61 remove_diacritics 2',
+	prefix = '2 3'
+);
+
+INSERT INTO videos_fts (video_id, title, description)
+SELECT id, title, COALESCE(description, '') FROM videos;
+
+CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos
+BEGIN
+	INSERT INTO videos_fts (video_id, title, description)
+	VALUES (new.id, new.title, COALESCE(new.description, ''));
+END;
+
+CREATE TRIGGER videos_fts_update AFTER UPDATE OF title, description ON videos
+BEGIN
+	UPDATE videos_fts
+	SET title = new.title, description = COALESCE(new.description, '')
+	WHERE video_id = old.id;
+END;
+
+CREATE TRIGGER videos_fts_delete AFTER DELETE ON videos
+BEGIN
+	DELETE FROM videos_fts WHERE video_id = old.id;
+END;
+
+DROP INDEX IF EXISTS idx_video_tags_tag_id;
+DROP TABLE IF EXISTS video_tags;
+DROP TABLE IF EXISTS tags;
@@ -0,0 +1,91 @@
+-- Tags belong to a user; names are unique per user, ignoring case
+CREATE TABLE tags (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL COLLATE NOCASE,
+	UNIQUE(user_id, name),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE video_tags (
+	video_id TEXT NOT NULL,
+	tag_id TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(video_id, tag_id),
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY(tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_video_tags_tag_id ON video_tags(tag_id);
+
+-- Rebuild the search index with a tags column. FTS5 tables can't be altered.
+DROP TRIGGER videos_fts_delete;
+DROP TRIGGER videos_fts_update;
+DROP TRIGGER videos_fts_insert;
+DROP TABLE videos_fts;
+
+CREATE VIRTUAL TABLE videos_fts USING fts5(
+	video_id UNINDEXED,
+	title,
+	description,
+	tags,
+	tokenize = 'unicode61 remove_diacritics 2',
+	prefix = '2 3'
+);
+
+INSERT INTO videos_fts (video_id, title, description, tags)
+SELECT id, title, COALESCE(description, ''), '' FROM videos;
+
+CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos
+BEGIN
+	INSERT INTO videos_fts (video_id, title, description, tags)
+	VALUES (new.id, new.title, COALESCE(new.description, ''), '');
+END;
+
+CREATE TRIGGER videos_fts_update AFTER UPDATE OF title, description ON videos
+BEGIN
+	UPDATE videos_fts
+	SET title = new.title, description = COALESCE(new.description, '')
+	WHERE video_id = old.id;
+END;
+
+CREATE TRIGGER videos_fts_delete AFTER DELETE ON videos
+BEGIN
+	DELETE FROM videos_fts WHERE video_id = old.id;
+END;
+
+-- The tags column holds the video's tag names separated by spaces
+CREATE TRIGGER video_tags_fts_insert AFTER INSERT ON video_tags
+BEGIN
+	UPDATE videos_fts
+	SET tags = (
+		SELECT COALESCE(group_concat(t.name, ' '), '')
+		FROM video_tags vt JOIN tags t ON t.id = vt.tag_id
+		WHERE vt.video_id = new.video_id
+	)
+	WHERE video_id = new.video_id;
+END;
+
+CREATE TRIGGER video_tags_fts_delete AFTER DELETE ON video_tags
+BEGIN
+	UPDATE videos_fts
+	SET tags = (
+		SELECT COALESCE(group_concat(t.name, ' '), '')
+		FROM video_tags vt JOIN tags t ON t.id = vt.tag_id
+		WHERE vt.video_id = old.video_id
+	)
+	WHERE video_id = old.video_id;
+END;
+
+CREATE TRIGGER tags_fts_rename AFTER UPDATE OF name ON tags
+BEGIN
+	UPDATE videos_fts
+	SET tags = (
+		SELECT COALESCE(group_concat(t.name, ' '), '')
+		FROM video_tags vt JOIN tags t ON t.id = vt.tag_id
+		WHERE vt.video_id = videos_fts.video_id
+	)
+	WHERE video_id IN (SELECT video_id FROM video_tags WHERE tag_id = new.id);
+END;
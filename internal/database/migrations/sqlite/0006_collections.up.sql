@@ -0,0 +1,28 @@
+-- Collections are ordered playlists of a user's videos. A video can be in
+-- any number of collections, once per collection.
+CREATE TABLE collections (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_collections_user_created ON collections(user_id, created_at);
+
+-- Items are ordered by position, which is renumbered from 0 whenever items
+-- are added, moved or removed
+CREATE TABLE collection_items (
+	collection_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(collection_id, video_id),
+	FOREIGN KEY(collection_id) REFERENCES collections(id) ON DELETE CASCADE,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_collection_items_position ON collection_items(collection_id, position);
+CREATE INDEX idx_collection_items_video_id ON collection_items(video_id);
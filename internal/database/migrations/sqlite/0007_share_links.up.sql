@@ -0,0 +1,25 @@
+-- Share links give outside viewers access to one video or collection without
+-- an account. Expiry, password and view limit are all optional.
+CREATE TABLE share_links (
+	id TEXT PRIMARY KEY,
+	token TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL,
+	video_id TEXT,
+	collection_id TEXT,
+	expires_at TIMESTAMP,
+	password_hash TEXT,
+	max_views INTEGER,
+	view_count INTEGER NOT NULL DEFAULT 0,
+	last_viewed_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+	CHECK ((video_id IS NULL) <> (collection_id IS NULL)),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY(collection_id) REFERENCES collections(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_share_links_user_created ON share_links(user_id, created_at);
+CREATE INDEX idx_share_links_video_id ON share_links(video_id);
+CREATE INDEX idx_share_links_collection_id ON share_links(collection_id);
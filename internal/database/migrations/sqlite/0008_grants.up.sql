@@ -0,0 +1,24 @@
+-- Grants share one video or collection with another user. They are keyed by
+-- email so people without an account yet can be invited; grantee_user_id is
+-- filled in once an account owns that address.
+CREATE TABLE grants (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	owner_id TEXT NOT NULL,
+	video_id TEXT,
+	collection_id TEXT,
+	grantee_email TEXT NOT NULL,
+	grantee_user_id TEXT,
+	role TEXT NOT NULL CHECK (role IN ('viewer', 'commenter', 'editor')),
+	CHECK ((video_id IS NULL) <> (collection_id IS NULL)),
+	UNIQUE (video_id, grantee_email),
+	UNIQUE (collection_id, grantee_email),
+	FOREIGN KEY(owner_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY(collection_id) REFERENCES collections(id) ON DELETE CASCADE,
+	FOREIGN KEY(grantee_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_grants_grantee_user_id ON grants(grantee_user_id);
+CREATE INDEX idx_grants_grantee_email ON grants(grantee_email);
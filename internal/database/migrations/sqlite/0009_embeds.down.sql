@@ -0,0 +1,2 @@
+ALTER TABLE share_links DROP COLUMN embed_origins;
+ALTER TABLE videos DROP COLUMN captions_url;
@@ -0,0 +1,6 @@
+-- A WebVTT captions file shown by the player
+ALTER TABLE videos ADD COLUMN captions_url TEXT;
+
+-- Space-separated origins allowed to embed the share link in an iframe; empty
+-- means it can't be embedded anywhere
+ALTER TABLE share_links ADD COLUMN embed_origins TEXT NOT NULL DEFAULT '';
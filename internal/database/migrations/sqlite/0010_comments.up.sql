@@ -0,0 +1,39 @@
+-- Comments are feedback on a video from anyone allowed to comment on it,
+-- optionally pinned to a moment with at_seconds. Replies point at the
+-- top-level comment they answer; only top-level comments are resolved.
+CREATE TABLE comments (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	video_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	parent_id TEXT,
+	body TEXT NOT NULL,
+	at_seconds REAL,
+	edited_at TIMESTAMP,
+	resolved_at TIMESTAMP,
+	resolved_by TEXT,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(parent_id) REFERENCES comments(id) ON DELETE CASCADE,
+	FOREIGN KEY(resolved_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_comments_video_created ON comments(video_id, created_at);
+CREATE INDEX idx_comments_parent_id ON comments(parent_id);
+CREATE INDEX idx_comments_created ON comments(created_at);
+
+-- Notes are private annotations on a video, only ever shown to their author
+CREATE TABLE notes (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	video_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	body TEXT NOT NULL,
+	at_seconds REAL,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_notes_video_user ON notes(video_id, user_id);
@@ -0,0 +1,17 @@
+-- Playback progress is how far each user got in each video. A row is the
+-- user's watch history entry for the video; watched_at is set once they
+-- finish it or mark it watched.
+CREATE TABLE playback_progress (
+	user_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	position_seconds REAL NOT NULL DEFAULT 0,
+	first_watched_at TIMESTAMP NOT NULL,
+	last_watched_at TIMESTAMP NOT NULL,
+	watched_at TIMESTAMP,
+	PRIMARY KEY (user_id, video_id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_playback_progress_user_last_watched ON playback_progress(user_id, last_watched_at);
+CREATE INDEX idx_playback_progress_video_id ON playback_progress(video_id);
@@ -0,0 +1,2 @@
+DROP TABLE video_daily_stats;
+DROP TABLE analytics_events;
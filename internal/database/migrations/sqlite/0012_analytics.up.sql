@@ -0,0 +1,33 @@
+-- Analytics events are raw playback reports from players. They are kept for
+-- a few days, long enough to be rolled up into video_daily_stats.
+-- Days are UTC dates stored as YYYY-MM-DD text in both databases.
+CREATE TABLE analytics_events (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	day TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	viewer_key TEXT NOT NULL,
+	source TEXT NOT NULL,
+	type TEXT NOT NULL,
+	watch_seconds REAL NOT NULL DEFAULT 0,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_analytics_events_day_video ON analytics_events(day, video_id);
+CREATE INDEX idx_analytics_events_video_id ON analytics_events(video_id);
+
+-- One row per video per day. bytes_served is added to as assets are served;
+-- the other counts are recomputed from analytics_events by the rollup.
+CREATE TABLE video_daily_stats (
+	video_id TEXT NOT NULL,
+	day TEXT NOT NULL,
+	views INTEGER NOT NULL DEFAULT 0,
+	unique_viewers INTEGER NOT NULL DEFAULT 0,
+	watch_seconds REAL NOT NULL DEFAULT 0,
+	completions INTEGER NOT NULL DEFAULT 0,
+	bytes_served INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (video_id, day),
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_video_daily_stats_day ON video_daily_stats(day);
@@ -0,0 +1,15 @@
+-- Who watched each video on each day, so unique viewers can be counted over
+-- a range of days after the raw events are pruned. Days already pruned only
+-- have their per-day counts in video_daily_stats.
+CREATE TABLE video_daily_viewers (
+	video_id TEXT NOT NULL,
+	day TEXT NOT NULL,
+	viewer_key TEXT NOT NULL,
+	PRIMARY KEY (video_id, day, viewer_key),
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_video_daily_viewers_day ON video_daily_viewers(day);
+
+INSERT INTO video_daily_viewers (video_id, day, viewer_key)
+SELECT DISTINCT video_id, day, viewer_key FROM analytics_events;
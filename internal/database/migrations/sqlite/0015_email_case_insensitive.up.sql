@@ -0,0 +1,7 @@
+-- Email addresses are compared without regard to case, so two accounts can't
+-- share one in different spellings. This fails if they already do; merge or
+-- rename those accounts by hand first.
+CREATE UNIQUE INDEX idx_users_email_lower ON users(LOWER(email));
+
+DROP INDEX idx_grants_grantee_email;
+CREATE INDEX idx_grants_grantee_email ON grants(LOWER(grantee_email));
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Note is a private annotation on a video that only its author ever sees
+type Note struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	VideoID   uuid.UUID `json:"video_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Body      string    `json:"body"`
+	AtSeconds *float64  `json:"at_seconds"`
+}
+
+type CreateNoteParams struct {
+	VideoID   uuid.UUID
+	UserID    uuid.UUID
+	Body      string
+	AtSeconds *float64
+}
+
+const noteColumns = `id, created_at, updated_at, video_id, user_id, body, at_seconds`
+
+func scanNote(row rowScanner) (Note, error) {
+	var note Note
+	err := row.Scan(
+		&note.ID,
+		&note.CreatedAt,
+		&note.UpdatedAt,
+		&note.VideoID,
+		&note.UserID,
+		&note.Body,
+		&note.AtSeconds,
+	)
+	return note, err
+}
+
+func (c Client) CreateNote(ctx context.Context, params CreateNoteParams) (Note, error) {
+	id := uuid.New()
+	t := time.Now().UTC()
+	query := `
+	INSERT INTO notes (id, created_at, updated_at, video_id, user_id, body, at_seconds)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.ExecContext(ctx, query, id, t, t, params.VideoID, params.UserID, params.Body, params.AtSeconds)
+	if err != nil {
+		return Note{}, err
+	}
+	return c.GetNote(ctx, id)
+}
+
+func (c Client) GetNote(ctx context.Context, id uuid.UUID) (Note, error) {
+	note, err := scanNote(c.db.QueryRowContext(ctx, "SELECT "+noteColumns+" FROM notes WHERE id = ?", id))
+	if err != nil {
+		return Note{}, notFoundIfNoRows(err)
+	}
+	return note, nil
+}
+
+// ListNotes returns the user's notes on the video, oldest first
+func (c Client) ListNotes(ctx context.Context, videoID, userID uuid.UUID) ([]Note, error) {
+	query := "SELECT " + noteColumns + " FROM notes WHERE video_id = ? AND user_id = ? ORDER BY created_at, id"
+	rows, err := c.db.QueryContext(ctx, query, videoID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []Note{}
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+// ListUserNotes returns all of the user's notes, for their data export
+func (c Client) ListUserNotes(ctx context.Context, userID uuid.UUID) ([]Note, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT "+noteColumns+" FROM notes WHERE user_id = ? ORDER BY created_at, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []Note{}
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+func (c Client) UpdateNote(ctx context.Context, id uuid.UUID, body string, atSeconds *float64) error {
+	query := "UPDATE notes SET body = ?, at_seconds = ?, updated_at = ? WHERE id = ?"
+	return requireRowsAffected(c.db.ExecContext(ctx, query, body, atSeconds, time.Now().UTC(), id))
+}
+
+func (c Client) DeleteNote(ctx context.Context, id uuid.UUID) error {
+	return requireRowsAffected(c.db.ExecContext(ctx, "DELETE FROM notes WHERE id = ?", id))
+}
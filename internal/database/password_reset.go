@@ -1,10 +1,9 @@
 package database
 
 import (
+	"context"
 	"crypto/rand"
-	"database/sql"
 	"encoding/hex"
-	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,7 +18,7 @@ type PasswordResetToken struct {
 }
 
 // CreatePasswordResetToken creates a new password reset token valid for 1 hour
-func (c Client) CreatePasswordResetToken(userID uuid.UUID) (*PasswordResetToken, error) {
+func (c Client) CreatePasswordResetToken(ctx context.Context, userID uuid.UUID) (*PasswordResetToken, error) {
 	// Generate random token
 	tokenBytes := make([]byte, 32)
 	if _, err := rand.Read(tokenBytes); err != nil {
@@ -33,7 +32,7 @@ func (c Client) CreatePasswordResetToken(userID uuid.UUID) (*PasswordResetToken,
 		INSERT INTO password_reset_tokens (token, user_id, expires_at, created_at)
 		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
 	`
-	_, err := c.db.Exec(query, token, userID.String(), expiresAt)
+	_, err := c.db.ExecContext(ctx, query, token, userID.String(), expiresAt)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +46,7 @@ func (c Client) CreatePasswordResetToken(userID uuid.UUID) (*PasswordResetToken,
 }
 
 // GetPasswordResetToken retrieves a valid (not expired, not used) password reset token
-func (c Client) GetPasswordResetToken(token string) (*PasswordResetToken, error) {
+func (c Client) GetPasswordResetToken(ctx context.Context, token string) (*PasswordResetToken, error) {
 	query := `
 		SELECT token, user_id, expires_at, used_at, created_at
 		FROM password_reset_tokens
@@ -58,7 +57,7 @@ func (c Client) GetPasswordResetToken(token string) (*PasswordResetToken, error)
 
 	var prt PasswordResetToken
 	var userIDStr string
-	err := c.db.QueryRow(query, token).Scan(
+	err := c.db.QueryRowContext(ctx, query, token).Scan(
 		&prt.Token,
 		&userIDStr,
 		&prt.ExpiresAt,
@@ -66,10 +65,7 @@ func (c Client) GetPasswordResetToken(token string) (*PasswordResetToken, error)
 		&prt.CreatedAt,
 	)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil // Token not found or expired/used
-		}
-		return nil, err
+		return nil, notFoundIfNoRows(err) // Token not found or expired/used
 	}
 
 	prt.UserID, err = uuid.Parse(userIDStr)
@@ -81,22 +77,22 @@ func (c Client) GetPasswordResetToken(token string) (*PasswordResetToken, error)
 }
 
 // MarkPasswordResetTokenUsed marks a password reset token as used
-func (c Client) MarkPasswordResetTokenUsed(token string) error {
+func (c Client) MarkPasswordResetTokenUsed(ctx context.Context, token string) error {
 	query := `
 		UPDATE password_reset_tokens
 		SET used_at = CURRENT_TIMESTAMP
 		WHERE token = ?
 	`
-	_, err := c.db.Exec(query, token)
+	_, err := c.db.ExecContext(ctx, query, token)
 	return err
 }
 
 // DeleteExpiredPasswordResetTokens cleans up expired tokens
-func (c Client) DeleteExpiredPasswordResetTokens() error {
+func (c Client) DeleteExpiredPasswordResetTokens(ctx context.Context) error {
 	query := `
 		DELETE FROM password_reset_tokens
 		WHERE expires_at < CURRENT_TIMESTAMP OR used_at IS NOT NULL
 	`
-	_, err := c.db.Exec(query)
+	_, err := c.db.ExecContext(ctx, query)
 	return err
 }
@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PlaybackProgress is how far a user got in a video. It is also the video's
+// entry in the user's watch history.
+type PlaybackProgress struct {
+	VideoID         uuid.UUID  `json:"video_id"`
+	PositionSeconds float64    `json:"position_seconds"`
+	FirstWatchedAt  time.Time  `json:"first_watched_at"`
+	LastWatchedAt   time.Time  `json:"last_watched_at"`
+	WatchedAt       *time.Time `json:"watched_at"`
+}
+
+// PlaybackHeartbeat is a player's report of where it is in a video
+type PlaybackHeartbeat struct {
+	UserID          uuid.UUID
+	VideoID         uuid.UUID
+	PositionSeconds float64
+	// Finished marks the video watched
+	Finished bool
+	At       time.Time
+}
+
+// WatchedVideo is a watch history entry together with its video
+type WatchedVideo struct {
+	PlaybackProgress
+	Video Video `json:"video"`
+}
+
+const playbackColumns = `p.video_id, p.position_seconds, p.first_watched_at, p.last_watched_at, p.watched_at`
+
+func playbackFields(progress *PlaybackProgress) []any {
+	return []any{
+		&progress.VideoID,
+		&progress.PositionSeconds,
+		&progress.FirstWatchedAt,
+		&progress.LastWatchedAt,
+		&progress.WatchedAt,
+	}
+}
+
+// SavePlaybackProgress records a batch of heartbeats. Heartbeats for videos
+// or users deleted since they arrived are dropped. Once a video is watched it
+// stays watched until SetVideoWatched says otherwise.
+func (c Client) SavePlaybackProgress(ctx context.Context, heartbeats []PlaybackHeartbeat) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsert := `
+	INSERT INTO playback_progress (user_id, video_id, position_seconds, first_watched_at, last_watched_at, watched_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(user_id, video_id) DO UPDATE SET
+		position_seconds = excluded.position_seconds,
+		last_watched_at = excluded.last_watched_at,
+		watched_at = COALESCE(playback_progress.watched_at, excluded.watched_at)
+	`
+	for _, beat := range heartbeats {
+		var exists int
+		err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM videos
+		WHERE id = ? AND EXISTS (SELECT 1 FROM users WHERE id = ?)
+		`, beat.VideoID, beat.UserID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			continue
+		}
+
+		at := beat.At.UTC()
+		var watchedAt *time.Time
+		if beat.Finished {
+			watchedAt = &at
+		}
+		if _, err := tx.ExecContext(ctx, upsert, beat.UserID, beat.VideoID, beat.PositionSeconds, at, at, watchedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (c Client) GetPlaybackProgress(ctx context.Context, userID, videoID uuid.UUID) (PlaybackProgress, error) {
+	var progress PlaybackProgress
+	query := "SELECT " + playbackColumns + " FROM playback_progress p WHERE p.user_id = ? AND p.video_id = ?"
+	if err := c.db.QueryRowContext(ctx, query, userID, videoID).Scan(playbackFields(&progress)...); err != nil {
+		return PlaybackProgress{}, notFoundIfNoRows(err)
+	}
+	return progress, nil
+}
+
+// ListContinueWatching returns videos the user started but hasn't finished,
+// most recently watched first
+func (c Client) ListContinueWatching(ctx context.Context, userID uuid.UUID, limit int) ([]WatchedVideo, error) {
+	return c.listWatchedVideos(ctx, "AND p.watched_at IS NULL AND p.position_seconds > 0", []any{userID, limit, 0})
+}
+
+// ListWatchHistory returns every video the user has watched any of, most
+// recently watched first
+func (c Client) ListWatchHistory(ctx context.Context, userID uuid.UUID, limit, offset int) ([]WatchedVideo, error) {
+	return c.listWatchedVideos(ctx, "", []any{userID, limit, offset})
+}
+
+func (c Client) listWatchedVideos(ctx context.Context, condition string, args []any) ([]WatchedVideo, error) {
+	query := `
+	SELECT ` + playbackColumns + `, ` + qualifiedVideoColumns + `
+	FROM playback_progress p
+	JOIN videos v ON v.id = p.video_id
+	WHERE p.user_id = ? ` + condition + `
+	ORDER BY p.last_watched_at DESC, p.video_id
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []WatchedVideo{}
+	videos := []Video{}
+	for rows.Next() {
+		var entry WatchedVideo
+		if err := rows.Scan(append(playbackFields(&entry.PlaybackProgress), videoFields(&entry.Video)...)...); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		videos = append(videos, entry.Video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := c.attachTags(ctx, videos); err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].Video = videos[i]
+	}
+	return entries, nil
+}
+
+// SetVideoWatched marks the video watched or unwatched for the user, keeping
+// their position. Marking an unseen video watched adds it to their history.
+func (c Client) SetVideoWatched(ctx context.Context, userID, videoID uuid.UUID, watched bool) error {
+	if !watched {
+		_, err := c.db.ExecContext(ctx, "UPDATE playback_progress SET watched_at = NULL WHERE user_id = ? AND video_id = ?", userID, videoID)
+		return err
+	}
+	t := time.Now().UTC()
+	query := `
+	INSERT INTO playback_progress (user_id, video_id, position_seconds, first_watched_at, last_watched_at, watched_at)
+	VALUES (?, ?, 0, ?, ?, ?)
+	ON CONFLICT(user_id, video_id) DO UPDATE SET
+		watched_at = COALESCE(playback_progress.watched_at, excluded.watched_at)
+	`
+	_, err := c.db.ExecContext(ctx, query, userID, videoID, t, t, t)
+	return err
+}
+
+// DeletePlaybackProgress removes the video from the user's watch history
+func (c Client) DeletePlaybackProgress(ctx context.Context, userID, videoID uuid.UUID) error {
+	return requireRowsAffected(c.db.ExecContext(ctx, "DELETE FROM playback_progress WHERE user_id = ? AND video_id = ?", userID, videoID))
+}
+
+// ClearPlaybackProgress empties the user's watch history and returns how many
+// videos were in it
+func (c Client) ClearPlaybackProgress(ctx context.Context, userID uuid.UUID) (int, error) {
+	result, err := c.db.ExecContext(ctx, "DELETE FROM playback_progress WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareLink lets anyone holding Token view one video or collection
+type ShareLink struct {
+	ID           uuid.UUID  `json:"id"`
+	Token        string     `json:"token"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	UserID       uuid.UUID  `json:"user_id"`
+	VideoID      *uuid.UUID `json:"video_id"`
+	CollectionID *uuid.UUID `json:"collection_id"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	PasswordHash *string    `json:"-"`
+	MaxViews     *int       `json:"max_views"`
+	ViewCount    int        `json:"view_count"`
+	LastViewedAt *time.Time `json:"last_viewed_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	// EmbedOrigins may show the link in an iframe; none means it can't be embedded
+	EmbedOrigins []string `json:"embed_origins"`
+}
+
+// Usable reports whether the link can still be viewed at time t
+func (s ShareLink) Usable(t time.Time) bool {
+	return s.RevokedAt == nil &&
+		(s.ExpiresAt == nil || s.ExpiresAt.After(t)) &&
+		(s.MaxViews == nil || s.ViewCount < *s.MaxViews)
+}
+
+// CreateShareLinkParams needs exactly one of VideoID and CollectionID
+type CreateShareLinkParams struct {
+	Token        string
+	UserID       uuid.UUID
+	VideoID      *uuid.UUID
+	CollectionID *uuid.UUID
+	ExpiresAt    *time.Time
+	PasswordHash *string
+	MaxViews     *int
+	EmbedOrigins []string
+}
+
+const shareLinkColumns = `id, token, created_at, updated_at, user_id, video_id, collection_id,
+	expires_at, password_hash, max_views, view_count, last_viewed_at, revoked_at, embed_origins`
+
+func scanShareLink(row rowScanner) (ShareLink, error) {
+	var link ShareLink
+	var embedOrigins string
+	err := row.Scan(
+		&link.ID,
+		&link.Token,
+		&link.CreatedAt,
+		&link.UpdatedAt,
+		&link.UserID,
+		&link.VideoID,
+		&link.CollectionID,
+		&link.ExpiresAt,
+		&link.PasswordHash,
+		&link.MaxViews,
+		&link.ViewCount,
+		&link.LastViewedAt,
+		&link.RevokedAt,
+		&embedOrigins,
+	)
+	link.EmbedOrigins = strings.Fields(embedOrigins)
+	return link, err
+}
+
+func (c Client) CreateShareLink(ctx context.Context, params CreateShareLinkParams) (ShareLink, error) {
+	id := uuid.New()
+	var expiresAt any
+	if params.ExpiresAt != nil {
+		expiresAt = c.db.dialect.timeArg(*params.ExpiresAt)
+	}
+	query := `
+	INSERT INTO share_links (id, token, created_at, updated_at, user_id, video_id, collection_id, expires_at, password_hash, max_views, embed_origins)
+	VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.ExecContext(ctx, query,
+		id, params.Token, params.UserID, params.VideoID, params.CollectionID,
+		expiresAt, params.PasswordHash, params.MaxViews, strings.Join(params.EmbedOrigins, " "),
+	)
+	if err != nil {
+		return ShareLink{}, err
+	}
+	return c.GetShareLink(ctx, id)
+}
+
+// ListShareLinks returns the user's share links, newest first, including
+// expired and revoked ones
+func (c Client) ListShareLinks(ctx context.Context, userID uuid.UUID) ([]ShareLink, error) {
+	query := `
+	SELECT ` + shareLinkColumns + `
+	FROM share_links
+	WHERE user_id = ?
+	ORDER BY created_at DESC, id DESC
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (c Client) GetShareLink(ctx context.Context, id uuid.UUID) (ShareLink, error) {
+	link, err := scanShareLink(c.db.QueryRowContext(ctx, "SELECT "+shareLinkColumns+" FROM share_links WHERE id = ?", id))
+	if err != nil {
+		return ShareLink{}, notFoundIfNoRows(err)
+	}
+	return link, nil
+}
+
+func (c Client) GetShareLinkByToken(ctx context.Context, token string) (ShareLink, error) {
+	link, err := scanShareLink(c.db.QueryRowContext(ctx, "SELECT "+shareLinkColumns+" FROM share_links WHERE token = ?", token))
+	if err != nil {
+		return ShareLink{}, notFoundIfNoRows(err)
+	}
+	return link, nil
+}
+
+// RevokeShareLink stops the link from working. Revoking twice keeps the first time.
+func (c Client) RevokeShareLink(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE share_links
+	SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, id))
+}
+
+// SetShareLinkEmbedOrigins replaces the origins allowed to embed the link
+func (c Client) SetShareLinkEmbedOrigins(ctx context.Context, id uuid.UUID, origins []string) error {
+	query := "UPDATE share_links SET embed_origins = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+	return requireRowsAffected(c.db.ExecContext(ctx, query, strings.Join(origins, " "), id))
+}
+
+// RecordShareLinkView counts a view if the link is still usable, checking and
+// counting in one statement so concurrent views can't exceed max_views. It
+// returns ErrNotFound if the link can no longer be viewed.
+func (c Client) RecordShareLinkView(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE share_links
+	SET view_count = view_count + 1, last_viewed_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	  AND revoked_at IS NULL
+	  AND (expires_at IS NULL OR expires_at > ?)
+	  AND (max_views IS NULL OR view_count < max_views)
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, id, c.db.dialect.timeArg(time.Now())))
+}
@@ -0,0 +1,205 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserStore persists user accounts
+type UserStore interface {
+	GetUsers(ctx context.Context, params ListUsersParams) ([]User, int, error)
+	GetUser(ctx context.Context, id uuid.UUID) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserByRefreshToken(ctx context.Context, token string) (*User, error)
+	CreateUser(ctx context.Context, params CreateUserParams) (*User, error)
+	UpdateUserProfile(ctx context.Context, userID uuid.UUID, fullName string) error
+	UpdateUserPassword(ctx context.Context, userID uuid.UUID, hashedPassword string) error
+	MarkUserEmailVerified(ctx context.Context, userID uuid.UUID) error
+	UpdateUserEmail(ctx context.Context, userID uuid.UUID, email string) error
+	UpdateUserRole(ctx context.Context, userID uuid.UUID, role string) error
+	SetUserDisabled(ctx context.Context, userID uuid.UUID, disabled bool) error
+	RequirePasswordReset(ctx context.Context, userID uuid.UUID) error
+	MarkUserForDeletion(ctx context.Context, userID uuid.UUID) error
+	GetUsersPendingDeletion(ctx context.Context) ([]User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+}
+
+// VideoStore persists video metadata
+type VideoStore interface {
+	GetVideos(ctx context.Context, userID uuid.UUID) ([]Video, error)
+	ListVideos(ctx context.Context, params ListVideosParams) (VideoPage, error)
+	GetVideo(ctx context.Context, id uuid.UUID) (Video, error)
+	SearchVideos(ctx context.Context, userID uuid.UUID, query string, limit int) ([]VideoSearchResult, error)
+	CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error)
+	UpdateVideo(ctx context.Context, video Video) error
+	DeleteVideo(ctx context.Context, id uuid.UUID) error
+	GetUserStorageUsage(ctx context.Context, userID uuid.UUID) (StorageUsage, error)
+}
+
+// TagStore persists user-scoped tags and which videos carry them
+type TagStore interface {
+	ListTags(ctx context.Context, userID uuid.UUID) ([]Tag, error)
+	GetTag(ctx context.Context, id uuid.UUID) (Tag, error)
+	GetTagsByName(ctx context.Context, userID uuid.UUID, names []string) ([]Tag, error)
+	CreateTag(ctx context.Context, userID uuid.UUID, name string) (Tag, error)
+	RenameTag(ctx context.Context, id uuid.UUID, name string) error
+	DeleteTag(ctx context.Context, id uuid.UUID) error
+	MergeTags(ctx context.Context, targetID uuid.UUID, sourceIDs []uuid.UUID) error
+	TagVideos(ctx context.Context, videoIDs, tagIDs []uuid.UUID) error
+	UntagVideos(ctx context.Context, videoIDs, tagIDs []uuid.UUID) error
+}
+
+// CollectionStore persists ordered collections of a user's videos
+type CollectionStore interface {
+	ListCollections(ctx context.Context, userID uuid.UUID) ([]Collection, error)
+	GetCollection(ctx context.Context, id uuid.UUID) (Collection, error)
+	CreateCollection(ctx context.Context, params CreateCollectionParams) (Collection, error)
+	UpdateCollection(ctx context.Context, collection Collection) error
+	DeleteCollection(ctx context.Context, id uuid.UUID) error
+	GetCollectionItems(ctx context.Context, collectionID uuid.UUID) ([]CollectionItem, error)
+	AddCollectionItem(ctx context.Context, collectionID, videoID uuid.UUID, placement CollectionPlacement) error
+	MoveCollectionItem(ctx context.Context, collectionID, videoID uuid.UUID, placement CollectionPlacement) error
+	RemoveCollectionItem(ctx context.Context, collectionID, videoID uuid.UUID) error
+}
+
+// ShareLinkStore persists public share links and their view counts
+type ShareLinkStore interface {
+	CreateShareLink(ctx context.Context, params CreateShareLinkParams) (ShareLink, error)
+	ListShareLinks(ctx context.Context, userID uuid.UUID) ([]ShareLink, error)
+	GetShareLink(ctx context.Context, id uuid.UUID) (ShareLink, error)
+	GetShareLinkByToken(ctx context.Context, token string) (ShareLink, error)
+	RevokeShareLink(ctx context.Context, id uuid.UUID) error
+	SetShareLinkEmbedOrigins(ctx context.Context, id uuid.UUID, origins []string) error
+	RecordShareLinkView(ctx context.Context, id uuid.UUID) error
+}
+
+// GrantStore persists the roles owners give other users on their videos and collections
+type GrantStore interface {
+	UpsertGrant(ctx context.Context, params UpsertGrantParams) (Grant, bool, error)
+	GetGrant(ctx context.Context, id uuid.UUID) (Grant, error)
+	ListVideoGrants(ctx context.Context, videoID uuid.UUID) ([]Grant, error)
+	ListCollectionGrants(ctx context.Context, collectionID uuid.UUID) ([]Grant, error)
+	ListGrantsForUser(ctx context.Context, userID uuid.UUID) ([]Grant, error)
+	DeleteGrant(ctx context.Context, id uuid.UUID) error
+	GetVideoRole(ctx context.Context, videoID, userID uuid.UUID) (string, error)
+	GetCollectionRole(ctx context.Context, collectionID, userID uuid.UUID) (string, error)
+	ClaimGrants(ctx context.Context, userID uuid.UUID, email string) error
+}
+
+// CommentStore persists comments on videos and their replies
+type CommentStore interface {
+	CreateComment(ctx context.Context, params CreateCommentParams) (Comment, error)
+	GetComment(ctx context.Context, id uuid.UUID) (Comment, error)
+	ListVideoComments(ctx context.Context, videoID uuid.UUID) ([]Comment, error)
+	UpdateComment(ctx context.Context, id uuid.UUID, body string, atSeconds *float64) error
+	SetCommentResolved(ctx context.Context, id uuid.UUID, resolvedBy *uuid.UUID) error
+	DeleteComment(ctx context.Context, id uuid.UUID) error
+	ListCommentFeed(ctx context.Context, params CommentFeedParams) ([]FeedComment, error)
+}
+
+// NoteStore persists private per-user notes on videos
+type NoteStore interface {
+	CreateNote(ctx context.Context, params CreateNoteParams) (Note, error)
+	GetNote(ctx context.Context, id uuid.UUID) (Note, error)
+	ListNotes(ctx context.Context, videoID, userID uuid.UUID) ([]Note, error)
+	ListUserNotes(ctx context.Context, userID uuid.UUID) ([]Note, error)
+	UpdateNote(ctx context.Context, id uuid.UUID, body string, atSeconds *float64) error
+	DeleteNote(ctx context.Context, id uuid.UUID) error
+}
+
+// PlaybackStore persists each user's playback position and watch history
+type PlaybackStore interface {
+	SavePlaybackProgress(ctx context.Context, heartbeats []PlaybackHeartbeat) error
+	GetPlaybackProgress(ctx context.Context, userID, videoID uuid.UUID) (PlaybackProgress, error)
+	ListContinueWatching(ctx context.Context, userID uuid.UUID, limit int) ([]WatchedVideo, error)
+	ListWatchHistory(ctx context.Context, userID uuid.UUID, limit, offset int) ([]WatchedVideo, error)
+	SetVideoWatched(ctx context.Context, userID, videoID uuid.UUID, watched bool) error
+	DeletePlaybackProgress(ctx context.Context, userID, videoID uuid.UUID) error
+	ClearPlaybackProgress(ctx context.Context, userID uuid.UUID) (int, error)
+}
+
+// AnalyticsStore persists raw playback events and the daily stats rolled up from them
+type AnalyticsStore interface {
+	SaveAnalyticsEvents(ctx context.Context, events []AnalyticsEvent) error
+	AddBandwidthUsage(ctx context.Context, usage []BandwidthUsage) error
+	RollupAnalytics(ctx context.Context, fromDay string) error
+	PruneAnalyticsEvents(ctx context.Context, beforeDay string) error
+	ListVideoDailyStats(ctx context.Context, videoID uuid.UUID, fromDay, toDay string) ([]DailyVideoStats, error)
+	ListUserDailyStats(ctx context.Context, userID uuid.UUID, fromDay, toDay string) ([]DailyVideoStats, error)
+	ListUserVideoStats(ctx context.Context, userID uuid.UUID, fromDay, toDay string) ([]VideoStatsSummary, error)
+	CountVideoViewers(ctx context.Context, videoID uuid.UUID, fromDay, toDay string) (int, error)
+	CountUserViewers(ctx context.Context, userID uuid.UUID, fromDay, toDay string) (int, error)
+}
+
+// WebhookStore persists users' webhooks and the queue of deliveries to them
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, params CreateWebhookParams) (Webhook, error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (Webhook, error)
+	ListWebhooks(ctx context.Context, userID uuid.UUID) ([]Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook Webhook) error
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	EnqueueWebhookEvent(ctx context.Context, event WebhookEvent) (int, error)
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, id uuid.UUID, attempt WebhookAttempt) error
+	CountUntriedWebhookDeliveries(ctx context.Context, userID uuid.UUID) (int, error)
+	ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit, offset int) ([]WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error)
+	RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error)
+	PruneWebhookDeliveries(ctx context.Context, before time.Time) error
+}
+
+// TokenStore persists refresh tokens and password reset tokens
+type TokenStore interface {
+	CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error)
+	GetRefreshToken(ctx context.Context, token string) (RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error
+	DeleteRefreshToken(ctx context.Context, token string) error
+	CreatePasswordResetToken(ctx context.Context, userID uuid.UUID) (*PasswordResetToken, error)
+	GetPasswordResetToken(ctx context.Context, token string) (*PasswordResetToken, error)
+	MarkPasswordResetTokenUsed(ctx context.Context, token string) error
+	DeleteExpiredPasswordResetTokens(ctx context.Context) error
+}
+
+// AuthThrottleStore persists failed-attempt counters for login throttling
+type AuthThrottleStore interface {
+	GetAuthThrottle(ctx context.Context, key string) (AuthThrottle, error)
+	IncrementAuthThrottle(ctx context.Context, key string, windowStart time.Time) (int, error)
+	LockAuthThrottle(ctx context.Context, key string, until time.Time) error
+	ClearAuthThrottle(ctx context.Context, key string) error
+}
+
+// AuditStore persists the append-only audit log
+type AuditStore interface {
+	CreateAuditEvent(ctx context.Context, params CreateAuditEventParams) error
+	ListAuditEvents(ctx context.Context, filter AuditEventFilter) ([]AuditEvent, error)
+	StreamAuditEvents(ctx context.Context, filter AuditEventFilter, fn func(AuditEvent) error) error
+}
+
+// Store is everything the API needs from persistence. Client implements it on
+// SQLite and Postgres; the memory package implements it for handler tests.
+//
+// Lookups return ErrNotFound when nothing matches, as do updates and deletes
+// of a single row by ID. Writes that would duplicate a unique value (such as a
+// user's email) return an error wrapping ErrConflict.
+type Store interface {
+	UserStore
+	VideoStore
+	TagStore
+	CollectionStore
+	ShareLinkStore
+	GrantStore
+	CommentStore
+	NoteStore
+	PlaybackStore
+	AnalyticsStore
+	WebhookStore
+	TokenStore
+	AuthThrottleStore
+	AuditStore
+	Reset(ctx context.Context) error
+}
+
+var _ Store = Client{}
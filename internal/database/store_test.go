@@ -0,0 +1,449 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database/memory"
+	"github.com/google/uuid"
+)
+
+// storeBackend opens an empty, migrated store for one test
+type storeBackend struct {
+	name string
+	open func(t *testing.T) database.Store
+}
+
+var storeBackends = []storeBackend{
+	{"sqlite", openSQLite},
+	{"postgres", openPostgres},
+	// The handler tests' store must behave like the real ones
+	{"memory", func(*testing.T) database.Store { return memory.New() }},
+}
+
+// openSQLite opens a fresh SQLite database. SQLite needs FTS5 for search, so
+// without -tags sqlite_fts5 the test fails rather than quietly skipping.
+func openSQLite(t *testing.T) database.Store {
+	t.Helper()
+	c, err := database.NewClient(context.Background(), filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("couldn't open SQLite: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// openPostgres runs the test against DATABASE_URL when it is a Postgres URL.
+// Everything in that database is deleted, so point it at a scratch database.
+func openPostgres(t *testing.T) database.Store {
+	t.Helper()
+	databaseURL := os.Getenv("DATABASE_URL")
+	if !strings.HasPrefix(databaseURL, "postgres://") && !strings.HasPrefix(databaseURL, "postgresql://") {
+		t.Skip("DATABASE_URL is not a Postgres URL")
+	}
+	c, err := database.NewClient(context.Background(), databaseURL)
+	if err != nil {
+		t.Fatalf("couldn't open Postgres: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.Reset(context.Background()); err != nil {
+		t.Fatalf("couldn't reset Postgres: %v", err)
+	}
+	return c
+}
+
+// forEachStore runs test against a fresh store of every backend
+func forEachStore(t *testing.T, test func(t *testing.T, store database.Store)) {
+	for _, backend := range storeBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			test(t, backend.open(t))
+		})
+	}
+}
+
+func createUser(t *testing.T, store database.Store, email string) *database.User {
+	t.Helper()
+	user, err := store.CreateUser(context.Background(), database.CreateUserParams{
+		Email:    email,
+		Password: "hash",
+		FullName: "Test User",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", email, err)
+	}
+	return user
+}
+
+func createVideo(t *testing.T, store database.Store, userID uuid.UUID, title, description string) database.Video {
+	t.Helper()
+	video, err := store.CreateVideo(context.Background(), database.CreateVideoParams{
+		Title:       title,
+		Description: description,
+		UserID:      userID,
+	})
+	if err != nil {
+		t.Fatalf("CreateVideo(%s): %v", title, err)
+	}
+	return video
+}
+
+// listAllVideos follows cursors until the last page and returns the IDs in order
+func listAllVideos(t *testing.T, store database.Store, params database.ListVideosParams) []uuid.UUID {
+	t.Helper()
+	var ids []uuid.UUID
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("too many pages")
+		}
+		page, err := store.ListVideos(context.Background(), params)
+		if err != nil {
+			t.Fatalf("ListVideos: %v", err)
+		}
+		for _, video := range page.Videos {
+			ids = append(ids, video.ID)
+		}
+		if page.NextCursor == "" {
+			return ids
+		}
+		params.Cursor = page.NextCursor
+	}
+}
+
+func TestListVideosCursors(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		user := createUser(t, store, "owner@example.com")
+		sizes := []int64{300, 100, 500, 100, 200}
+		var videos []database.Video
+		for i, size := range sizes {
+			video := createVideo(t, store, user.ID, string(rune('a'+i))+" video", "")
+			video.VideoSize = size
+			if err := store.UpdateVideo(ctx, video); err != nil {
+				t.Fatalf("UpdateVideo: %v", err)
+			}
+			videos = append(videos, video)
+		}
+
+		for _, tc := range []struct {
+			sort      string
+			ascending bool
+		}{
+			{database.VideoSortCreated, false},
+			{database.VideoSortCreated, true},
+			{database.VideoSortUpdated, false},
+			{database.VideoSortTitle, true},
+			{database.VideoSortSize, false},
+			{database.VideoSortSize, true},
+		} {
+			params := database.ListVideosParams{UserID: user.ID, Sort: tc.sort, Ascending: tc.ascending}
+			page, err := store.ListVideos(ctx, params)
+			if err != nil {
+				t.Fatalf("ListVideos(%s): %v", tc.sort, err)
+			}
+			want := make([]uuid.UUID, 0, len(page.Videos))
+			for _, video := range page.Videos {
+				want = append(want, video.ID)
+			}
+			if len(want) != len(videos) || page.Total != len(videos) {
+				t.Fatalf("sort %s: got %d videos of %d, want %d", tc.sort, len(want), page.Total, len(videos))
+			}
+
+			params.Limit = 2
+			got := listAllVideos(t, store, params)
+			if !equalIDs(got, want) {
+				t.Errorf("sort %s ascending=%v: paged %v, want %v", tc.sort, tc.ascending, got, want)
+			}
+		}
+
+		bySize := listAllVideos(t, store, database.ListVideosParams{UserID: user.ID, Sort: database.VideoSortSize, Ascending: true})
+		if bySize[len(bySize)-1] != videos[2].ID {
+			t.Errorf("largest video is %v, want %v", bySize[len(bySize)-1], videos[2].ID)
+		}
+
+		page, err := store.ListVideos(ctx, database.ListVideosParams{UserID: user.ID, Sort: database.VideoSortSize, Limit: 2})
+		if err != nil {
+			t.Fatalf("ListVideos: %v", err)
+		}
+		_, err = store.ListVideos(ctx, database.ListVideosParams{UserID: user.ID, Sort: database.VideoSortTitle, Cursor: page.NextCursor})
+		if !errors.Is(err, database.ErrInvalidCursor) {
+			t.Errorf("cursor for another sort: got %v, want ErrInvalidCursor", err)
+		}
+	})
+}
+
+func equalIDs(a, b []uuid.UUID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestListVideosTimeFilters(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		user := createUser(t, store, "owner@example.com")
+		createVideo(t, store, user.ID, "one", "")
+		createVideo(t, store, user.ID, "two", "")
+
+		// Times in another zone must compare as the same instant
+		zone := time.FixedZone("UTC+5", 5*60*60)
+		hourAgo, inAnHour := time.Now().Add(-time.Hour).In(zone), time.Now().Add(time.Hour).In(zone)
+		for _, tc := range []struct {
+			name   string
+			params database.ListVideosParams
+			want   int
+		}{
+			{"created after an hour ago", database.ListVideosParams{CreatedAfter: &hourAgo}, 2},
+			{"created after an hour from now", database.ListVideosParams{CreatedAfter: &inAnHour}, 0},
+			{"created before an hour from now", database.ListVideosParams{CreatedBefore: &inAnHour}, 2},
+			{"created before an hour ago", database.ListVideosParams{CreatedBefore: &hourAgo}, 0},
+			{"updated between", database.ListVideosParams{UpdatedAfter: &hourAgo, UpdatedBefore: &inAnHour}, 2},
+		} {
+			tc.params.UserID = user.ID
+			page, err := store.ListVideos(ctx, tc.params)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			if page.Total != tc.want || len(page.Videos) != tc.want {
+				t.Errorf("%s: got %d videos (total %d), want %d", tc.name, len(page.Videos), page.Total, tc.want)
+			}
+		}
+	})
+}
+
+func TestSearchVideos(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		user := createUser(t, store, "owner@example.com")
+		other := createUser(t, store, "other@example.com")
+		rome := createVideo(t, store, user.ID, "Holiday in Rome", "A walking tour of the <old> forum")
+		createVideo(t, store, user.ID, "Cooking pasta", "Fresh tagliatelle")
+		createVideo(t, store, other.ID, "Rome again", "Someone else's video")
+
+		results, err := store.SearchVideos(ctx, user.ID, "rom", 10)
+		if err != nil {
+			t.Fatalf("SearchVideos: %v", err)
+		}
+		if len(results) != 1 || results[0].ID != rome.ID {
+			t.Fatalf("search for a prefix: got %v, want only %v", results, rome.ID)
+		}
+		if got := results[0].Highlights.Title; got != "Holiday in <mark>Rome</mark>" {
+			t.Errorf("title highlight = %q", got)
+		}
+
+		results, err = store.SearchVideos(ctx, user.ID, "FORUM walk", 10)
+		if err != nil {
+			t.Fatalf("SearchVideos: %v", err)
+		}
+		if len(results) != 1 || results[0].ID != rome.ID {
+			t.Fatalf("search for every word: got %d results, want only %v", len(results), rome.ID)
+		}
+		description := results[0].Highlights.Description
+		for _, want := range []string{"<mark>walking</mark>", "<mark>forum</mark>", "&lt;old&gt;"} {
+			if !strings.Contains(description, want) {
+				t.Errorf("description highlight %q doesn't contain %q", description, want)
+			}
+		}
+
+		results, err = store.SearchVideos(ctx, user.ID, "rome pasta", 10)
+		if err != nil {
+			t.Fatalf("SearchVideos: %v", err)
+		}
+		if len(results) != 0 {
+			t.Errorf("no video has both words, got %d results", len(results))
+		}
+	})
+}
+
+func TestSavePlaybackProgressUpserts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		user := createUser(t, store, "viewer@example.com")
+		video := createVideo(t, store, user.ID, "video", "")
+
+		start := time.Now().Add(-time.Minute).Truncate(time.Second)
+		beats := []database.PlaybackHeartbeat{
+			{UserID: user.ID, VideoID: video.ID, PositionSeconds: 10, At: start},
+			{UserID: user.ID, VideoID: video.ID, PositionSeconds: 50, Finished: true, At: start.Add(20 * time.Second)},
+		}
+		for _, beat := range beats {
+			if err := store.SavePlaybackProgress(ctx, []database.PlaybackHeartbeat{beat}); err != nil {
+				t.Fatalf("SavePlaybackProgress: %v", err)
+			}
+		}
+		// Rewatching from the start keeps the video watched
+		rewatch := database.PlaybackHeartbeat{UserID: user.ID, VideoID: video.ID, PositionSeconds: 5, At: start.Add(40 * time.Second)}
+		if err := store.SavePlaybackProgress(ctx, []database.PlaybackHeartbeat{rewatch}); err != nil {
+			t.Fatalf("SavePlaybackProgress: %v", err)
+		}
+
+		progress, err := store.GetPlaybackProgress(ctx, user.ID, video.ID)
+		if err != nil {
+			t.Fatalf("GetPlaybackProgress: %v", err)
+		}
+		if progress.PositionSeconds != 5 {
+			t.Errorf("position = %v, want 5", progress.PositionSeconds)
+		}
+		if !progress.FirstWatchedAt.Equal(start) {
+			t.Errorf("first watched at %v, want %v", progress.FirstWatchedAt, start)
+		}
+		if !progress.LastWatchedAt.Equal(rewatch.At) {
+			t.Errorf("last watched at %v, want %v", progress.LastWatchedAt, rewatch.At)
+		}
+		if progress.WatchedAt == nil || !progress.WatchedAt.Equal(beats[1].At) {
+			t.Errorf("watched at %v, want %v", progress.WatchedAt, beats[1].At)
+		}
+
+		history, err := store.ListWatchHistory(ctx, user.ID, 10, 0)
+		if err != nil {
+			t.Fatalf("ListWatchHistory: %v", err)
+		}
+		if len(history) != 1 {
+			t.Errorf("history has %d entries, want 1", len(history))
+		}
+	})
+}
+
+func TestAnalyticsUpserts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		owner := createUser(t, store, "owner@example.com")
+		video := createVideo(t, store, owner.ID, "video", "")
+
+		today := time.Now().UTC()
+		yesterday := today.AddDate(0, 0, -1)
+		fromDay, toDay := database.AnalyticsDay(yesterday), database.AnalyticsDay(today)
+
+		usage := []database.BandwidthUsage{{VideoID: video.ID, Day: toDay, Bytes: 100}}
+		for range 2 {
+			if err := store.AddBandwidthUsage(ctx, usage); err != nil {
+				t.Fatalf("AddBandwidthUsage: %v", err)
+			}
+		}
+		events := []database.AnalyticsEvent{
+			{CreatedAt: yesterday, VideoID: video.ID, ViewerKey: "a", Source: database.AnalyticsSourceApp, Type: database.AnalyticsEventPlay},
+			{CreatedAt: today, VideoID: video.ID, ViewerKey: "a", Source: database.AnalyticsSourceApp, Type: database.AnalyticsEventPlay},
+			{CreatedAt: today, VideoID: video.ID, ViewerKey: "a", Source: database.AnalyticsSourceApp, Type: database.AnalyticsEventProgress, WatchSeconds: 30},
+			{CreatedAt: today, VideoID: video.ID, ViewerKey: "b", Source: database.AnalyticsSourceShare, Type: database.AnalyticsEventPlay},
+			{CreatedAt: today, VideoID: video.ID, ViewerKey: "b", Source: database.AnalyticsSourceShare, Type: database.AnalyticsEventComplete},
+		}
+		if err := store.SaveAnalyticsEvents(ctx, events); err != nil {
+			t.Fatalf("SaveAnalyticsEvents: %v", err)
+		}
+		// Rolling up again recomputes the counts rather than adding to them
+		for range 2 {
+			if err := store.RollupAnalytics(ctx, fromDay); err != nil {
+				t.Fatalf("RollupAnalytics: %v", err)
+			}
+		}
+
+		days, err := store.ListVideoDailyStats(ctx, video.ID, fromDay, toDay)
+		if err != nil {
+			t.Fatalf("ListVideoDailyStats: %v", err)
+		}
+		if len(days) != 2 {
+			t.Fatalf("got %d days, want 2", len(days))
+		}
+		want := database.VideoStats{Views: 2, UniqueViewers: 2, WatchSeconds: 30, Completions: 1, BytesServed: 200}
+		if days[1].Day != toDay || days[1].VideoStats != want {
+			t.Errorf("today = %s %+v, want %s %+v", days[1].Day, days[1].VideoStats, toDay, want)
+		}
+		if days[0].Views != 1 || days[0].UniqueViewers != 1 {
+			t.Errorf("yesterday = %+v, want 1 view by 1 viewer", days[0].VideoStats)
+		}
+
+		// a watched on both days but is one viewer over the range
+		viewers, err := store.CountVideoViewers(ctx, video.ID, fromDay, toDay)
+		if err != nil {
+			t.Fatalf("CountVideoViewers: %v", err)
+		}
+		if viewers != 2 {
+			t.Errorf("CountVideoViewers = %d, want 2", viewers)
+		}
+		summaries, err := store.ListUserVideoStats(ctx, owner.ID, fromDay, toDay)
+		if err != nil {
+			t.Fatalf("ListUserVideoStats: %v", err)
+		}
+		if len(summaries) != 1 || summaries[0].Views != 3 || summaries[0].UniqueViewers != 2 {
+			t.Errorf("ListUserVideoStats = %+v, want 3 views by 2 viewers", summaries)
+		}
+
+		// Viewers outlive the raw events
+		if err := store.PruneAnalyticsEvents(ctx, database.AnalyticsDay(today.AddDate(0, 0, 1))); err != nil {
+			t.Fatalf("PruneAnalyticsEvents: %v", err)
+		}
+		viewers, err = store.CountUserViewers(ctx, owner.ID, fromDay, toDay)
+		if err != nil {
+			t.Fatalf("CountUserViewers: %v", err)
+		}
+		if viewers != 2 {
+			t.Errorf("CountUserViewers after pruning = %d, want 2", viewers)
+		}
+	})
+}
+
+func TestClaimWebhookDeliveries(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		user := createUser(t, store, "owner@example.com")
+		webhook, err := store.CreateWebhook(ctx, database.CreateWebhookParams{
+			UserID: user.ID,
+			URL:    "https://example.com/hook",
+			Secret: "secret",
+			Events: []string{"video.deleted"},
+		})
+		if err != nil {
+			t.Fatalf("CreateWebhook: %v", err)
+		}
+		n, err := store.EnqueueWebhookEvent(ctx, database.WebhookEvent{
+			ID:      uuid.New(),
+			Type:    "video.deleted",
+			UserID:  user.ID,
+			Payload: []byte(`{}`),
+		})
+		if err != nil || n != 1 {
+			t.Fatalf("EnqueueWebhookEvent = %d, %v; want 1 delivery", n, err)
+		}
+
+		// Deliveries are due from the second they were queued
+		now := time.Now().Add(time.Second)
+		claimed, err := store.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+		if err != nil || len(claimed) != 1 || claimed[0].WebhookID != webhook.ID {
+			t.Fatalf("ClaimWebhookDeliveries = %v, %v; want the delivery", claimed, err)
+		}
+		if again, err := store.ClaimWebhookDeliveries(ctx, now, time.Minute, 10); err != nil || len(again) != 0 {
+			t.Errorf("claimed again while leased: %v, %v", again, err)
+		}
+		if untried, err := store.CountUntriedWebhookDeliveries(ctx, user.ID); err != nil || untried != 1 {
+			t.Errorf("CountUntriedWebhookDeliveries = %d, %v; want 1", untried, err)
+		}
+
+		retryAt := now.Add(30 * time.Second)
+		message := "unexpected status 500"
+		err = store.RecordWebhookAttempt(ctx, claimed[0].ID, database.WebhookAttempt{At: now, Error: &message, RetryAt: &retryAt})
+		if err != nil {
+			t.Fatalf("RecordWebhookAttempt: %v", err)
+		}
+		if untried, err := store.CountUntriedWebhookDeliveries(ctx, user.ID); err != nil || untried != 0 {
+			t.Errorf("CountUntriedWebhookDeliveries after an attempt = %d, %v; want 0", untried, err)
+		}
+		if early, err := store.ClaimWebhookDeliveries(ctx, retryAt.Add(-time.Second), time.Minute, 10); err != nil || len(early) != 0 {
+			t.Errorf("claimed before the retry was due: %v, %v", early, err)
+		}
+		retry, err := store.ClaimWebhookDeliveries(ctx, retryAt.Add(time.Second), time.Minute, 10)
+		if err != nil || len(retry) != 1 || retry[0].Attempts != 1 {
+			t.Errorf("retry claim = %v, %v; want the delivery after 1 attempt", retry, err)
+		}
+	})
+}
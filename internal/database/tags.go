@@ -0,0 +1,283 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Tag struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	UserID     uuid.UUID `json:"user_id"`
+	Name       string    `json:"name"`
+	VideoCount int       `json:"video_count"`
+}
+
+// VideoTag is the short form of a tag embedded in videos
+type VideoTag struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// tagColumns selects from tags, counting the videos each tag is on
+const tagColumns = `id, created_at, updated_at, user_id, name,
+	(SELECT COUNT(*) FROM video_tags vt WHERE vt.tag_id = tags.id)`
+
+func scanTag(row rowScanner) (Tag, error) {
+	var tag Tag
+	err := row.Scan(&tag.ID, &tag.CreatedAt, &tag.UpdatedAt, &tag.UserID, &tag.Name, &tag.VideoCount)
+	return tag, err
+}
+
+// placeholders returns "?, ?, ..." for n arguments
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// lowerPlaceholders returns "LOWER(?), LOWER(?), ..." so names are case-folded
+// by the database, the same way as the LOWER(name) they are compared with
+func lowerPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("LOWER(?), ", n), ", ")
+}
+
+func stringArgs(values []string) []any {
+	args := make([]any, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+// uuidArgs converts IDs to query arguments
+func uuidArgs(ids []uuid.UUID) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id.String()
+	}
+	return args
+}
+
+// ListTags returns the user's tags alphabetically, with how many videos each is on
+func (c Client) ListTags(ctx context.Context, userID uuid.UUID) ([]Tag, error) {
+	query := `
+	SELECT ` + tagColumns + `
+	FROM tags
+	WHERE user_id = ?
+	ORDER BY LOWER(name)
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (c Client) GetTag(ctx context.Context, id uuid.UUID) (Tag, error) {
+	tag, err := scanTag(c.db.QueryRowContext(ctx, "SELECT "+tagColumns+" FROM tags WHERE id = ?", id))
+	if err != nil {
+		return Tag{}, notFoundIfNoRows(err)
+	}
+	return tag, nil
+}
+
+// GetTagsByName looks up the user's tags by name, ignoring case. Names
+// without a tag are left out.
+func (c Client) GetTagsByName(ctx context.Context, userID uuid.UUID, names []string) ([]Tag, error) {
+	if len(names) == 0 {
+		return []Tag{}, nil
+	}
+	query := `
+	SELECT ` + tagColumns + `
+	FROM tags
+	WHERE user_id = ? AND LOWER(name) IN (` + lowerPlaceholders(len(names)) + `)
+	`
+	rows, err := c.db.QueryContext(ctx, query, append([]any{userID}, stringArgs(names)...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// CreateTag returns an error wrapping ErrConflict if the user already has a
+// tag with that name
+func (c Client) CreateTag(ctx context.Context, userID uuid.UUID, name string) (Tag, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO tags (id, created_at, updated_at, user_id, name)
+	VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+	`
+	if _, err := c.db.ExecContext(ctx, query, id, userID, name); err != nil {
+		return Tag{}, conflictIfUnique(err, "a tag with that name already exists")
+	}
+	return c.GetTag(ctx, id)
+}
+
+func (c Client) RenameTag(ctx context.Context, id uuid.UUID, name string) error {
+	query := `
+	UPDATE tags
+	SET name = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	err := requireRowsAffected(c.db.ExecContext(ctx, query, name, id))
+	return conflictIfUnique(err, "a tag with that name already exists")
+}
+
+// DeleteTag removes the tag from every video and then deletes it
+func (c Client) DeleteTag(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM video_tags WHERE tag_id = ?", id); err != nil {
+		return err
+	}
+	if err := requireRowsAffected(tx.ExecContext(ctx, "DELETE FROM tags WHERE id = ?", id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MergeTags moves every video tagged with one of the sources onto the target
+// and deletes the sources. The caller checks they all belong to the same user.
+func (c Client) MergeTags(ctx context.Context, targetID uuid.UUID, sourceIDs []uuid.UUID) error {
+	if len(sourceIDs) == 0 {
+		return nil
+	}
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	in := placeholders(len(sourceIDs))
+	sources := uuidArgs(sourceIDs)
+	query := `
+	INSERT INTO video_tags (video_id, tag_id, created_at)
+	SELECT DISTINCT vt.video_id, CAST(? AS TEXT), CURRENT_TIMESTAMP
+	FROM video_tags vt
+	WHERE vt.tag_id IN (` + in + `)
+	  AND NOT EXISTS (
+		SELECT 1 FROM video_tags existing
+		WHERE existing.video_id = vt.video_id AND existing.tag_id = ?
+	  )
+	`
+	args := append(append([]any{targetID.String()}, sources...), targetID.String())
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM video_tags WHERE tag_id IN ("+in+")", sources...); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tags WHERE id IN ("+in+")", sources...); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE tags SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", targetID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TagVideos adds every tag to every video, skipping pairs that already exist
+func (c Client) TagVideos(ctx context.Context, videoIDs, tagIDs []uuid.UUID) error {
+	if len(videoIDs) == 0 || len(tagIDs) == 0 {
+		return nil
+	}
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO video_tags (video_id, tag_id, created_at)
+	SELECT CAST(? AS TEXT), CAST(? AS TEXT), CURRENT_TIMESTAMP
+	WHERE NOT EXISTS (SELECT 1 FROM video_tags WHERE video_id = ? AND tag_id = ?)
+	`
+	for _, videoID := range videoIDs {
+		for _, tagID := range tagIDs {
+			if _, err := tx.ExecContext(ctx, query, videoID.String(), tagID.String(), videoID.String(), tagID.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// UntagVideos removes the tags from the videos
+func (c Client) UntagVideos(ctx context.Context, videoIDs, tagIDs []uuid.UUID) error {
+	if len(videoIDs) == 0 || len(tagIDs) == 0 {
+		return nil
+	}
+	query := `
+	DELETE FROM video_tags
+	WHERE video_id IN (` + placeholders(len(videoIDs)) + `)
+	  AND tag_id IN (` + placeholders(len(tagIDs)) + `)
+	`
+	_, err := c.db.ExecContext(ctx, query, append(uuidArgs(videoIDs), uuidArgs(tagIDs)...)...)
+	return err
+}
+
+// attachTags fills in Tags on each video with one query
+func (c Client) attachTags(ctx context.Context, videos []Video) error {
+	if len(videos) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(videos))
+	byID := make(map[uuid.UUID]*Video, len(videos))
+	for i := range videos {
+		ids[i] = videos[i].ID
+		videos[i].Tags = []VideoTag{}
+		byID[videos[i].ID] = &videos[i]
+	}
+
+	query := `
+	SELECT vt.video_id, t.id, t.name
+	FROM video_tags vt
+	JOIN tags t ON t.id = vt.tag_id
+	WHERE vt.video_id IN (` + placeholders(len(ids)) + `)
+	ORDER BY LOWER(t.name)
+	`
+	rows, err := c.db.QueryContext(ctx, query, uuidArgs(ids)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var videoID uuid.UUID
+		var tag VideoTag
+		if err := rows.Scan(&videoID, &tag.ID, &tag.Name); err != nil {
+			return err
+		}
+		if video, ok := byID[videoID]; ok {
+			video.Tags = append(video.Tags, tag)
+		}
+	}
+	return rows.Err()
+}
@@ -1,20 +1,36 @@
 package database
 
 import (
-	"database/sql"
-	"errors"
+	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"` // Never expose password in JSON
-	FullName  string    `json:"full_name"`
+	ID                    uuid.UUID  `json:"id"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+	Email                 string     `json:"email"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at"`
+	Password              string     `json:"-"` // Never expose password in JSON
+	FullName              string     `json:"full_name"`
+	Role                  string     `json:"role"`
+	DisabledAt            *time.Time `json:"disabled_at"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	DeletionRequestedAt   *time.Time `json:"deletion_requested_at"`
+}
+
+// IsAdmin reports whether the user has the admin role
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
 }
 
 type CreateUserParams struct {
@@ -23,63 +39,109 @@ type CreateUserParams struct {
 	FullName string `json:"full_name"`
 }
 
-func (c Client) GetUsers() ([]User, error) {
-	query := `
-		SELECT
-			id,
-			email,
-			full_name
+type ListUsersParams struct {
+	Search string // matched against email and full name
+	Limit  int
+	Offset int
+}
+
+// userColumns is the column list scanned by scanUser
+const userColumns = `id, created_at, updated_at, email, email_verified_at, password, full_name, role, disabled_at, password_reset_required, deletion_requested_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (User, error) {
+	var user User
+	var id string
+	err := row.Scan(
+		&id,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.Email,
+		&user.EmailVerifiedAt,
+		&user.Password,
+		&user.FullName,
+		&user.Role,
+		&user.DisabledAt,
+		&user.PasswordResetRequired,
+		&user.DeletionRequestedAt,
+	)
+	if err != nil {
+		return User{}, err
+	}
+	user.ID, err = uuid.Parse(id)
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// GetUsers lists users matching the search, newest first, along with the total match count
+func (c Client) GetUsers(ctx context.Context, params ListUsersParams) ([]User, int, error) {
+	where := ""
+	args := []any{}
+	if params.Search != "" {
+		// LOWER keeps the match case-insensitive on Postgres as well as SQLite
+		where = "WHERE LOWER(email) LIKE ? OR LOWER(full_name) LIKE ?"
+		pattern := "%" + strings.ToLower(params.Search) + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	var total int
+	err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM users
-	`
+		%s
+		ORDER BY created_at DESC
+		LIMIT ? OFFSET ?
+	`, userColumns, where)
 
-	rows, err := c.db.Query(query)
+	rows, err := c.db.QueryContext(ctx, query, append(args, limit, params.Offset)...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	users := []User{}
 	for rows.Next() {
-		var user User
-		var id string
-		if err := rows.Scan(&id, &user.Email, &user.FullName); err != nil {
-			return nil, err
-		}
-		user.ID, err = uuid.Parse(id)
+		user, err := scanUser(rows)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		users = append(users, user)
 	}
 
-	return users, nil
+	return users, total, rows.Err()
 }
 
-func (c Client) GetUserByEmail(email string) (User, error) {
+// GetUserByEmail finds the user with the address, compared without regard to case
+func (c Client) GetUserByEmail(ctx context.Context, email string) (User, error) {
 	query := `
-		SELECT id, created_at, updated_at, email, password, full_name
+		SELECT ` + userColumns + `
 		FROM users
-		WHERE email = ?
+		WHERE LOWER(email) = LOWER(?)
 	`
-	var user User
-	var id string
-	err := c.db.QueryRow(query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password, &user.FullName)
+	user, err := scanUser(c.db.QueryRowContext(ctx, query, email))
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return User{}, nil
-		}
-		return User{}, err
-	}
-	user.ID, err = uuid.Parse(id)
-	if err != nil {
-		return User{}, err
+		return User{}, notFoundIfNoRows(err)
 	}
 	return user, nil
 }
 
-func (c Client) GetUserByRefreshToken(token string) (*User, error) {
+func (c Client) GetUserByRefreshToken(ctx context.Context, token string) (*User, error) {
 	query := `
-		SELECT u.id, u.email, u.created_at, u.updated_at, u.password, u.full_name
+		SELECT u.id, u.created_at, u.updated_at, u.email, u.email_verified_at, u.password, u.full_name, u.role, u.disabled_at, u.password_reset_required, u.deletion_requested_at
 		FROM users u
 		JOIN refresh_tokens rt ON u.id = rt.user_id
 		WHERE rt.token = ?
@@ -87,24 +149,15 @@ func (c Client) GetUserByRefreshToken(token string) (*User, error) {
 		  AND rt.expires_at > CURRENT_TIMESTAMP
 	`
 
-	var user User
-	var id string
-	err := c.db.QueryRow(query, token).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Password, &user.FullName)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, err
-	}
-	user.ID, err = uuid.Parse(id)
+	user, err := scanUser(c.db.QueryRowContext(ctx, query, token))
 	if err != nil {
-		return nil, err
+		return nil, notFoundIfNoRows(err)
 	}
 
 	return &user, nil
 }
 
-func (c Client) CreateUser(params CreateUserParams) (*User, error) {
+func (c Client) CreateUser(ctx context.Context, params CreateUserParams) (*User, error) {
 	id := uuid.New()
 
 	query := `
@@ -113,51 +166,176 @@ func (c Client) CreateUser(params CreateUserParams) (*User, error) {
 		VALUES
 		    (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id.String(), params.Email, params.Password, params.FullName)
+	_, err := c.db.ExecContext(ctx, query, id.String(), params.Email, params.Password, params.FullName)
 	if err != nil {
-		return nil, err
+		return nil, conflictIfUnique(err, "email is already in use")
 	}
 
-	return c.GetUser(id)
+	return c.GetUser(ctx, id)
 }
 
-func (c Client) GetUser(id uuid.UUID) (*User, error) {
+func (c Client) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
 	query := `
-		SELECT id, created_at, updated_at, email, password, full_name
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE id = ?
 	`
-	var user User
-	var idStr string
-	err := c.db.QueryRow(query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password, &user.FullName)
+	user, err := scanUser(c.db.QueryRowContext(ctx, query, id.String()))
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, err
-	}
-	user.ID, err = uuid.Parse(idStr)
-	if err != nil {
-		return nil, err
+		return nil, notFoundIfNoRows(err)
 	}
 	return &user, nil
 }
 
-func (c Client) UpdateUserPassword(userID uuid.UUID, hashedPassword string) error {
+// UpdateUserProfile updates the user's editable profile fields
+func (c Client) UpdateUserProfile(ctx context.Context, userID uuid.UUID, fullName string) error {
+	query := `
+		UPDATE users
+		SET full_name = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, fullName, userID.String()))
+}
+
+// UpdateUserPassword sets a new password hash and clears any forced reset
+func (c Client) UpdateUserPassword(ctx context.Context, userID uuid.UUID, hashedPassword string) error {
+	query := `
+		UPDATE users
+		SET password = ?, password_reset_required = FALSE, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, hashedPassword, userID.String()))
+}
+
+// MarkUserEmailVerified records that the user has confirmed their current email address
+func (c Client) MarkUserEmailVerified(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, userID.String()))
+}
+
+// UpdateUserEmail changes the user's email. The new address counts as verified
+// because it can only be set by following a link sent to it.
+func (c Client) UpdateUserEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	query := `
+		UPDATE users
+		SET email = ?, email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	err := requireRowsAffected(c.db.ExecContext(ctx, query, email, userID.String()))
+	return conflictIfUnique(err, "email is already in use")
+}
+
+func (c Client) UpdateUserRole(ctx context.Context, userID uuid.UUID, role string) error {
+	query := `
+		UPDATE users
+		SET role = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, role, userID.String()))
+}
+
+// SetUserDisabled disables or re-enables an account
+func (c Client) SetUserDisabled(ctx context.Context, userID uuid.UUID, disabled bool) error {
+	query := `
+		UPDATE users
+		SET disabled_at = CASE WHEN ? THEN CURRENT_TIMESTAMP ELSE NULL END, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, disabled, userID.String()))
+}
+
+// RequirePasswordReset blocks login until the user sets a new password
+func (c Client) RequirePasswordReset(ctx context.Context, userID uuid.UUID) error {
 	query := `
 		UPDATE users
-		SET password = ?, updated_at = CURRENT_TIMESTAMP
+		SET password_reset_required = TRUE, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := c.db.Exec(query, hashedPassword, userID.String())
-	return err
+	return requireRowsAffected(c.db.ExecContext(ctx, query, userID.String()))
 }
 
-func (c Client) DeleteUser(id uuid.UUID) error {
+// MarkUserForDeletion disables the account and records that it is waiting to be deleted
+func (c Client) MarkUserForDeletion(ctx context.Context, userID uuid.UUID) error {
 	query := `
-		DELETE FROM users
+		UPDATE users
+		SET deletion_requested_at = CURRENT_TIMESTAMP,
+		    disabled_at = COALESCE(disabled_at, CURRENT_TIMESTAMP),
+		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id.String())
-	return err
+	return requireRowsAffected(c.db.ExecContext(ctx, query, userID.String()))
+}
+
+// GetUsersPendingDeletion returns accounts whose deletion was requested but hasn't finished
+func (c Client) GetUsersPendingDeletion(ctx context.Context) ([]User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE deletion_requested_at IS NOT NULL
+	`
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// DeleteUser removes the user together with their videos, tokens and grants.
+// Files in storage must be deleted by the caller first.
+func (c Client) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"DELETE FROM refresh_tokens WHERE user_id = ?",
+		"DELETE FROM password_reset_tokens WHERE user_id = ?",
+		"DELETE FROM video_tags WHERE tag_id IN (SELECT id FROM tags WHERE user_id = ?)",
+		"DELETE FROM tags WHERE user_id = ?",
+		"DELETE FROM share_links WHERE user_id = ?",
+		"DELETE FROM grants WHERE owner_id = ?",
+		"DELETE FROM grants WHERE grantee_user_id = ?",
+		"DELETE FROM comments WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)",
+		"DELETE FROM comments WHERE parent_id IN (SELECT id FROM comments WHERE user_id = ?)",
+		"DELETE FROM comments WHERE user_id = ?",
+		"UPDATE comments SET resolved_by = NULL WHERE resolved_by = ?",
+		"DELETE FROM notes WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)",
+		"DELETE FROM notes WHERE user_id = ?",
+		"DELETE FROM playback_progress WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)",
+		"DELETE FROM playback_progress WHERE user_id = ?",
+		"DELETE FROM analytics_events WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)",
+		"DELETE FROM video_daily_stats WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)",
+		"DELETE FROM video_daily_viewers WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)",
+		"DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE user_id = ?)",
+		"DELETE FROM webhooks WHERE user_id = ?",
+		"DELETE FROM collection_items WHERE collection_id IN (SELECT id FROM collections WHERE user_id = ?)",
+		"DELETE FROM collections WHERE user_id = ?",
+		"DELETE FROM videos WHERE user_id = ?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, id.String()); err != nil {
+			return err
+		}
+	}
+	if err := requireRowsAffected(tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id.String())); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
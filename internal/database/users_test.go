@@ -0,0 +1,100 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestGettersReturnErrNotFound(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		user := createUser(t, store, "someone@example.com")
+		for _, rt := range []database.CreateRefreshTokenParams{
+			{Token: "expired", UserID: user.ID, ExpiresAt: time.Now().Add(-time.Hour)},
+			{Token: "revoked", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)},
+		} {
+			if _, err := store.CreateRefreshToken(ctx, rt); err != nil {
+				t.Fatalf("CreateRefreshToken: %v", err)
+			}
+		}
+		if err := store.RevokeRefreshToken(ctx, "revoked"); err != nil {
+			t.Fatalf("RevokeRefreshToken: %v", err)
+		}
+
+		checks := []struct {
+			name string
+			get  func() error
+		}{
+			{"GetVideo", func() error { _, err := store.GetVideo(ctx, uuid.New()); return err }},
+			{"GetUserByEmail", func() error { _, err := store.GetUserByEmail(ctx, "nobody@example.com"); return err }},
+			{"GetRefreshToken", func() error { _, err := store.GetRefreshToken(ctx, "unknown"); return err }},
+			{"GetUserByRefreshToken unknown", func() error { _, err := store.GetUserByRefreshToken(ctx, "unknown"); return err }},
+			{"GetUserByRefreshToken expired", func() error { _, err := store.GetUserByRefreshToken(ctx, "expired"); return err }},
+			{"GetUserByRefreshToken revoked", func() error { _, err := store.GetUserByRefreshToken(ctx, "revoked"); return err }},
+		}
+		for _, check := range checks {
+			if err := check.get(); !errors.Is(err, database.ErrNotFound) {
+				t.Errorf("%s: got %v, want ErrNotFound", check.name, err)
+			}
+		}
+	})
+}
+
+func TestEmailIsCaseInsensitive(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		alice := createUser(t, store, "alice@example.com")
+		bob := createUser(t, store, "bob@example.com")
+
+		found, err := store.GetUserByEmail(ctx, "Alice@Example.COM")
+		if err != nil || found.ID != alice.ID {
+			t.Errorf("GetUserByEmail in another case = %v, %v; want alice", found.ID, err)
+		}
+
+		_, err = store.CreateUser(ctx, database.CreateUserParams{Email: "ALICE@example.com", Password: "hash"})
+		if !errors.Is(err, database.ErrConflict) {
+			t.Errorf("CreateUser with a taken address in another case: got %v, want ErrConflict", err)
+		}
+		if err := store.UpdateUserEmail(ctx, bob.ID, "Alice@example.com"); !errors.Is(err, database.ErrConflict) {
+			t.Errorf("UpdateUserEmail to a taken address in another case: got %v, want ErrConflict", err)
+		}
+		if err := store.UpdateUserEmail(ctx, uuid.New(), "new@example.com"); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("UpdateUserEmail of an unknown user: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestGrantsMatchEmailsCaseInsensitively(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		owner := createUser(t, store, "owner@example.com")
+		video := createVideo(t, store, owner.ID, "Shared", "")
+
+		first, created, err := store.UpsertGrant(ctx, database.UpsertGrantParams{
+			OwnerID: owner.ID, VideoID: &video.ID, GranteeEmail: "Invitee@Example.com", Role: database.GrantRoleViewer,
+		})
+		if err != nil || !created {
+			t.Fatalf("UpsertGrant = %v, %v; want a new grant", created, err)
+		}
+		second, created, err := store.UpsertGrant(ctx, database.UpsertGrantParams{
+			OwnerID: owner.ID, VideoID: &video.ID, GranteeEmail: "invitee@example.com", Role: database.GrantRoleEditor,
+		})
+		if err != nil || created || second.ID != first.ID {
+			t.Fatalf("UpsertGrant in another case = %v, %v, %v; want grant %v updated", second.ID, created, err, first.ID)
+		}
+
+		invitee := createUser(t, store, "invitee@example.com")
+		if err := store.ClaimGrants(ctx, invitee.ID, "invitee@example.com"); err != nil {
+			t.Fatalf("ClaimGrants: %v", err)
+		}
+		role, err := store.GetVideoRole(ctx, video.ID, invitee.ID)
+		if err != nil || role != database.GrantRoleEditor {
+			t.Errorf("GetVideoRole after claiming = %q, %v; want editor", role, err)
+		}
+	})
+}
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sort orders accepted by ListVideos
+const (
+	VideoSortCreated  = "created"
+	VideoSortUpdated  = "updated"
+	VideoSortTitle    = "title"
+	VideoSortDuration = "duration"
+	VideoSortSize     = "size"
+)
+
+// ErrInvalidCursor is returned when a cursor is malformed or was issued for a
+// different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type ListVideosParams struct {
+	UserID    uuid.UUID
+	Sort      string // one of the VideoSort constants; defaults to VideoSortCreated
+	Ascending bool
+	// Filters; nil and empty values match everything
+	HasVideo      *bool
+	HasThumbnail  *bool
+	AspectRatio   string
+	Tags          []string // tag names; videos need any of them, or all with MatchAllTags
+	MatchAllTags  bool
+	Watched       *bool // whether the user has watched the video
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	// Cursor is the NextCursor of the previous page, or empty for the first page
+	Cursor string
+	Limit  int
+}
+
+type VideoPage struct {
+	Videos []Video
+	// Total counts every video matching the filters, across all pages
+	Total int
+	// NextCursor is empty on the last page
+	NextCursor string
+}
+
+// IsVideoSort reports whether sort is one of the VideoSort constants
+func IsVideoSort(sort string) bool {
+	switch sort {
+	case VideoSortCreated, VideoSortUpdated, VideoSortTitle, VideoSortDuration, VideoSortSize:
+		return true
+	}
+	return false
+}
+
+// videoSortKey returns the expression to order by and the one selected into
+// the cursor. Timestamps go into the cursor as text so SQLite compares them
+// in the format it stores.
+func (d dialect) videoSortKey(sort string) (orderExpr, selectExpr string) {
+	switch sort {
+	case VideoSortUpdated:
+		return "updated_at", "CAST(updated_at AS TEXT)"
+	case VideoSortTitle:
+		if d == dialectPostgres {
+			return "LOWER(title)", "LOWER(title)"
+		}
+		return "title COLLATE NOCASE", "title"
+	case VideoSortDuration:
+		// Videos without a known duration sort as zero length
+		return "COALESCE(duration_seconds, 0)", "COALESCE(duration_seconds, 0)"
+	case VideoSortSize:
+		return "video_size", "video_size"
+	default:
+		return "created_at", "CAST(created_at AS TEXT)"
+	}
+}
+
+// videoCursor is the decoded form of VideoPage.NextCursor: the sort key and
+// ID of the last video on the page
+type videoCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Key   any    `json:"k"`
+	ID    string `json:"id"`
+}
+
+func encodeVideoCursor(cursor videoCursor) (string, error) {
+	if b, ok := cursor.Key.([]byte); ok {
+		cursor.Key = string(b)
+	}
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeVideoCursor(encoded, sort, order string) (videoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return videoCursor{}, ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var cursor videoCursor
+	if err := decoder.Decode(&cursor); err != nil || cursor.ID == "" {
+		return videoCursor{}, ErrInvalidCursor
+	}
+	if cursor.Sort != sort || cursor.Order != order {
+		return videoCursor{}, fmt.Errorf("%w: it was issued for a different sort order", ErrInvalidCursor)
+	}
+	// Keep integer keys integral so they compare exactly
+	if n, ok := cursor.Key.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			cursor.Key = i
+		} else if f, err := n.Float64(); err == nil {
+			cursor.Key = f
+		} else {
+			return videoCursor{}, ErrInvalidCursor
+		}
+	}
+	return cursor, nil
+}
+
+// ListVideos returns one page of the user's videos. Pages are keyed on the
+// sort column and video ID, so they stay consistent while videos are added.
+func (c Client) ListVideos(ctx context.Context, params ListVideosParams) (VideoPage, error) {
+	sort := params.Sort
+	if sort == "" {
+		sort = VideoSortCreated
+	}
+	if !IsVideoSort(sort) {
+		return VideoPage{}, fmt.Errorf("unknown video sort %q", sort)
+	}
+	order, cmp := "desc", "<"
+	if params.Ascending {
+		order, cmp = "asc", ">"
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	conditions := []string{"user_id = ?"}
+	args := []any{params.UserID}
+	if params.HasVideo != nil {
+		conditions = append(conditions, nullCondition("video_url", *params.HasVideo))
+	}
+	if params.HasThumbnail != nil {
+		conditions = append(conditions, nullCondition("thumbnail_url", *params.HasThumbnail))
+	}
+	if params.AspectRatio != "" {
+		conditions = append(conditions, "aspect_ratio = ?")
+		args = append(args, params.AspectRatio)
+	}
+	if len(params.Tags) > 0 {
+		tagged := `
+		SELECT vt.video_id
+		FROM video_tags vt
+		JOIN tags t ON t.id = vt.tag_id
+		WHERE t.user_id = ? AND LOWER(t.name) IN (` + lowerPlaceholders(len(params.Tags)) + `)`
+		args = append(append(args, params.UserID), stringArgs(params.Tags)...)
+		if params.MatchAllTags {
+			tagged += " GROUP BY vt.video_id HAVING COUNT(DISTINCT t.id) = ?"
+			args = append(args, distinctFold(params.Tags))
+		}
+		conditions = append(conditions, "id IN ("+tagged+")")
+	}
+	if params.Watched != nil {
+		in := "IN"
+		if !*params.Watched {
+			in = "NOT IN"
+		}
+		conditions = append(conditions, "id "+in+" (SELECT video_id FROM playback_progress WHERE user_id = ? AND watched_at IS NOT NULL)")
+		args = append(args, params.UserID)
+	}
+	for _, r := range []struct {
+		column, op string
+		t          *time.Time
+	}{
+		{"created_at", ">=", params.CreatedAfter},
+		{"created_at", "<", params.CreatedBefore},
+		{"updated_at", ">=", params.UpdatedAfter},
+		{"updated_at", "<", params.UpdatedBefore},
+	} {
+		if r.t != nil {
+			conditions = append(conditions, r.column+" "+r.op+" ?")
+			args = append(args, c.db.dialect.timeArg(*r.t))
+		}
+	}
+
+	var page VideoPage
+	where := " WHERE " + strings.Join(conditions, " AND ")
+	if err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM videos"+where, args...).Scan(&page.Total); err != nil {
+		return VideoPage{}, err
+	}
+
+	orderExpr, selectExpr := c.db.dialect.videoSortKey(sort)
+	if params.Cursor != "" {
+		cursor, err := decodeVideoCursor(params.Cursor, sort, order)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		where += fmt.Sprintf(" AND (%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", orderExpr, cmp)
+		args = append(args, cursor.Key, cursor.Key, cursor.ID)
+	}
+
+	// Fetch one extra row to learn whether there is another page
+	query := fmt.Sprintf(`
+	SELECT %s, %s
+	FROM videos
+	%s
+	ORDER BY %s %s, id %s
+	LIMIT ?
+	`, videoColumns, selectExpr, where, orderExpr, order, order)
+	rows, err := c.db.QueryContext(ctx, query, append(args, limit+1)...)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	defer rows.Close()
+
+	page.Videos = []Video{}
+	var lastKey any
+	for rows.Next() {
+		if len(page.Videos) == limit {
+			next, err := encodeVideoCursor(videoCursor{
+				Sort:  sort,
+				Order: order,
+				Key:   lastKey,
+				ID:    page.Videos[limit-1].ID.String(),
+			})
+			if err != nil {
+				return VideoPage{}, err
+			}
+			page.NextCursor = next
+			break
+		}
+		var video Video
+		if err := rows.Scan(append(videoFields(&video), &lastKey)...); err != nil {
+			return VideoPage{}, err
+		}
+		page.Videos = append(page.Videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return VideoPage{}, err
+	}
+	return page, c.attachTags(ctx, page.Videos)
+}
+
+// distinctFold counts the names that are different ignoring case
+func distinctFold(names []string) int {
+	seen := map[string]bool{}
+	for _, name := range names {
+		seen[strings.ToLower(name)] = true
+	}
+	return len(seen)
+}
+
+func nullCondition(column string, notNull bool) string {
+	if notNull {
+		return column + " IS NOT NULL"
+	}
+	return column + " IS NULL"
+}
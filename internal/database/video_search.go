@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// maxSearchTerms caps how many words of a query are used for matching
+const maxSearchTerms = 16
+
+// Highlight markers are private-use characters that can't be confused with
+// markup, so the text can be HTML-escaped before <mark> tags are added
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+type VideoSearchResult struct {
+	Video
+	// Rank orders results by relevance; higher is better
+	Rank       float64         `json:"rank"`
+	Highlights VideoHighlights `json:"highlights"`
+}
+
+// VideoHighlights holds HTML-escaped text with matches wrapped in <mark> tags
+type VideoHighlights struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// qualifiedVideoColumns is videoColumns prefixed with the "v" table alias
+var qualifiedVideoColumns = "v." + strings.ReplaceAll(videoColumns, ", ", ", v.")
+
+// SearchTerms splits a query into lowercase words the way the full-text
+// tokenizer does. Punctuation and operators are dropped.
+func SearchTerms(query string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+// SearchVideos finds the user's videos matching every word of the query, each
+// treated as a prefix, best matches first
+func (c Client) SearchVideos(ctx context.Context, userID uuid.UUID, query string, limit int) ([]VideoSearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return []VideoSearchResult{}, nil
+	}
+
+	var (
+		sqlQuery string
+		args     []any
+	)
+	switch c.db.dialect {
+	case dialectPostgres:
+		// term:* & term:* ... (terms are letters and digits only)
+		tsQuery := strings.Join(terms, ":* & ") + ":*"
+		sqlQuery = fmt.Sprintf(`
+		SELECT
+			%s,
+			ts_headline('simple', v.title, q.query, ?),
+			ts_headline('simple', COALESCE(v.description, ''), q.query, ?),
+			ts_rank(v.search_vector, q.query) AS score
+		FROM videos v, to_tsquery('simple', ?) AS q(query)
+		WHERE v.user_id = ? AND v.search_vector @@ q.query
+		ORDER BY score DESC, v.created_at DESC
+		LIMIT ?
+		`, qualifiedVideoColumns)
+		markers := "StartSel=" + highlightStart + ", StopSel=" + highlightStop
+		args = []any{
+			markers + ", HighlightAll=true",
+			markers + ", MinWords=8, MaxWords=24",
+			tsQuery, userID, limit,
+		}
+	default:
+		// "term"* "term"* ... is an implicit AND of prefix queries
+		matchQuery := `"` + strings.Join(terms, `"* "`) + `"*`
+		// Column weights: video_id (unindexed), title, description, tags
+		sqlQuery = fmt.Sprintf(`
+		SELECT
+			%s,
+			highlight(videos_fts, 1, ?, ?),
+			snippet(videos_fts, 2, ?, ?, '…', 24),
+			-bm25(videos_fts, 0.0, 10.0, 1.0, 5.0) AS score
+		FROM videos_fts
+		JOIN videos v ON v.id = videos_fts.video_id
+		WHERE videos_fts MATCH ? AND v.user_id = ?
+		ORDER BY score DESC, v.created_at DESC
+		LIMIT ?
+		`, qualifiedVideoColumns)
+		args = []any{
+			highlightStart, highlightStop,
+			highlightStart, highlightStop,
+			matchQuery, userID, limit,
+		}
+	}
+
+	rows, err := c.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []VideoSearchResult{}
+	for rows.Next() {
+		var result VideoSearchResult
+		dest := append(videoFields(&result.Video), &result.Highlights.Title, &result.Highlights.Description, &result.Rank)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		result.Highlights.Title = highlightMarkup(result.Highlights.Title)
+		result.Highlights.Description = highlightMarkup(result.Highlights.Description)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	videos := make([]Video, len(results))
+	for i := range results {
+		videos[i] = results[i].Video
+	}
+	if err := c.attachTags(ctx, videos); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Video = videos[i]
+	}
+	return results, nil
+}
+
+// highlightMarkup HTML-escapes text and turns highlight markers into <mark> tags
+func highlightMarkup(text string) string {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, highlightStart, "<mark>")
+	return strings.ReplaceAll(text, highlightStop, "</mark>")
+}
+
+// requireFTS5 fails early with a useful message when go-sqlite3 was built
+// without full-text search, instead of "no such module: fts5" mid-migration
+func (c Client) requireFTS5(ctx context.Context) error {
+	if c.db.dialect != dialectSQLite {
+		return nil
+	}
+	var enabled bool
+	err := c.db.QueryRowContext(ctx, "SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return errors.New("SQLite was built without FTS5; build with -tags sqlite_fts5")
+	}
+	return nil
+}
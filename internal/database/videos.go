@@ -1,19 +1,25 @@
 package database
 
 import (
-	"database/sql"
-	"errors"
+	"context"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	ThumbnailURL    *string   `json:"thumbnail_url"`
+	VideoURL        *string   `json:"video_url"`
+	VideoSize       int64     `json:"video_size"`
+	ThumbnailSize   int64     `json:"thumbnail_size"`
+	DurationSeconds *float64  `json:"duration_seconds"`
+	AspectRatio     *string   `json:"aspect_ratio"`
+	CaptionsURL     *string   `json:"captions_url"`
+	// Tags is read-only here; change it with TagVideos and UntagVideos
+	Tags []VideoTag `json:"tags"`
 	CreateVideoParams
 }
 
@@ -23,23 +29,38 @@ type CreateVideoParams struct {
 	UserID      uuid.UUID `json:"user_id"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
+// videoColumns is the column list scanned by videoFields
+const videoColumns = `id, created_at, updated_at, title, description, thumbnail_url, video_url, video_size, thumbnail_size, duration_seconds, aspect_ratio, captions_url, user_id`
+
+// videoFields returns scan destinations matching videoColumns
+func videoFields(video *Video) []any {
+	return []any{
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.VideoSize,
+		&video.ThumbnailSize,
+		&video.DurationSeconds,
+		&video.AspectRatio,
+		&video.CaptionsURL,
+		&video.UserID,
+	}
+}
+
+// GetVideos returns all of the user's videos, newest first
+func (c Client) GetVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT ` + videoColumns + `
 	FROM videos
 	WHERE user_id = ?
 	ORDER BY created_at DESC
 	`
 
-	rows, err := c.db.Query(query, userID)
+	rows, err := c.db.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -48,25 +69,19 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 	videos := []Video{}
 	for rows.Next() {
 		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		if err := rows.Scan(videoFields(&video)...); err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return videos, nil
+	return videos, c.attachTags(ctx, videos)
 }
 
-func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
+func (c Client) CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error) {
 	id := uuid.New()
 	query := `
 	INSERT INTO videos (
@@ -78,78 +93,144 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		user_id
 	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	_, err := c.db.ExecContext(ctx, query, id, params.Title, params.Description, params.UserID)
 	if err != nil {
 		return Video{}, err
 	}
 
-	return c.GetVideo(id)
+	return c.GetVideo(ctx, id)
 }
 
-func (c Client) GetVideo(id uuid.UUID) (Video, error) {
+func (c Client) GetVideo(ctx context.Context, id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT ` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
 	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	err := c.db.QueryRowContext(ctx, query, id).Scan(videoFields(&video)...)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return Video{}, nil
-		}
-		return Video{}, err
+		return Video{}, notFoundIfNoRows(err)
 	}
 
-	return video, nil
+	videos := []Video{video}
+	if err := c.attachTags(ctx, videos); err != nil {
+		return Video{}, err
+	}
+	return videos[0], nil
 }
 
-func (c Client) UpdateVideo(video Video) error {
+func (c Client) UpdateVideo(ctx context.Context, video Video) error {
 	query := `
 	UPDATE videos
 	SET
+		updated_at = CURRENT_TIMESTAMP,
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
+		video_size = ?,
+		thumbnail_size = ?,
+		duration_seconds = ?,
+		aspect_ratio = ?,
+		captions_url = ?,
 		user_id = ?
 	WHERE id = ?
 	`
 
-	_, err := c.db.Exec(
+	return requireRowsAffected(c.db.ExecContext(
+		ctx,
 		query,
 		video.Title,
 		video.Description,
 		video.ThumbnailURL,
 		video.VideoURL,
+		video.VideoSize,
+		video.ThumbnailSize,
+		video.DurationSeconds,
+		video.AspectRatio,
+		video.CaptionsURL,
 		video.UserID,
 		video.ID,
-	)
-	return err
+	))
+}
+
+func (c Client) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM video_tags WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM collection_items WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM share_links WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM grants WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM comments WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM notes WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM playback_progress WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM analytics_events WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM video_daily_stats WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM video_daily_viewers WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if err := requireRowsAffected(tx.ExecContext(ctx, "DELETE FROM videos WHERE id = ?", id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type StorageUsage struct {
+	Videos         int   `json:"videos"`
+	VideoFiles     int   `json:"video_files"`
+	Thumbnails     int   `json:"thumbnails"`
+	VideoBytes     int64 `json:"video_bytes"`
+	ThumbnailBytes int64 `json:"thumbnail_bytes"`
+	TotalBytes     int64 `json:"total_bytes"`
 }
 
-func (c Client) DeleteVideo(id uuid.UUID) error {
+// GetUserStorageUsage sums the sizes of all files the user has uploaded
+func (c Client) GetUserStorageUsage(ctx context.Context, userID uuid.UUID) (StorageUsage, error) {
 	query := `
-	DELETE FROM videos
-	WHERE id = ?
+	SELECT
+		COUNT(*),
+		COUNT(video_url),
+		COUNT(thumbnail_url),
+		COALESCE(SUM(video_size), 0),
+		COALESCE(SUM(thumbnail_size), 0)
+	FROM videos
+	WHERE user_id = ?
 	`
-	_, err := c.db.Exec(query, id)
-	return err
+	var usage StorageUsage
+	err := c.db.QueryRowContext(ctx, query, userID).Scan(
+		&usage.Videos,
+		&usage.VideoFiles,
+		&usage.Thumbnails,
+		&usage.VideoBytes,
+		&usage.ThumbnailBytes,
+	)
+	if err != nil {
+		return StorageUsage{}, err
+	}
+	usage.TotalBytes = usage.VideoBytes + usage.ThumbnailBytes
+	return usage, nil
 }
@@ -0,0 +1,391 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook posts the user's video lifecycle events to URL
+type Webhook struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      uuid.UUID `json:"user_id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	// Secret signs each delivery. It is only shown when the webhook is created.
+	Secret string   `json:"-"`
+	Events []string `json:"events"`
+	// Inactive webhooks get no new events, and deliveries already queued wait
+	// until it is active again
+	Active bool `json:"active"`
+}
+
+// Subscribes reports whether the webhook receives events of eventType
+func (w Webhook) Subscribes(eventType string) bool {
+	return w.Active && slices.Contains(w.Events, eventType)
+}
+
+type CreateWebhookParams struct {
+	UserID      uuid.UUID
+	URL         string
+	Description string
+	Secret      string
+	Events      []string
+}
+
+// WebhookEvent is one lifecycle event, queued for every active webhook of
+// UserID that subscribes to Type
+type WebhookEvent struct {
+	ID      uuid.UUID
+	Type    string
+	UserID  uuid.UUID
+	Payload []byte // the JSON body to post
+}
+
+// WebhookDelivery is one event queued for one webhook, and how sending it went
+type WebhookDelivery struct {
+	ID        uuid.UUID       `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	WebhookID uuid.UUID       `json:"webhook_id"`
+	EventID   uuid.UUID       `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	// NextAttemptAt is when a pending delivery is next tried
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	LastAttemptAt *time.Time `json:"last_attempt_at"`
+	ResponseCode  *int       `json:"response_code"`
+	LastError     *string    `json:"last_error"`
+	// RedeliveryOf is the delivery this one resends
+	RedeliveryOf *uuid.UUID `json:"redelivery_of"`
+}
+
+// WebhookAttempt is the outcome of one try at sending a delivery
+type WebhookAttempt struct {
+	At           time.Time
+	Succeeded    bool
+	ResponseCode *int
+	Error        *string
+	// RetryAt schedules another try after a failure; nil gives up
+	RetryAt *time.Time
+}
+
+const webhookColumns = `id, created_at, updated_at, user_id, url, description, secret, events, active`
+
+func scanWebhook(row rowScanner) (Webhook, error) {
+	var webhook Webhook
+	var events string
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+		&webhook.UserID,
+		&webhook.URL,
+		&webhook.Description,
+		&webhook.Secret,
+		&events,
+		&webhook.Active,
+	)
+	webhook.Events = strings.Fields(events)
+	return webhook, err
+}
+
+const webhookDeliveryColumns = `id, created_at, webhook_id, event_id, event_type, payload, status, attempts,
+	next_attempt_at, last_attempt_at, response_code, last_error, redelivery_of`
+
+func scanWebhookDelivery(row rowScanner) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var payload string
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.CreatedAt,
+		&delivery.WebhookID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastAttemptAt,
+		&delivery.ResponseCode,
+		&delivery.LastError,
+		&delivery.RedeliveryOf,
+	)
+	delivery.Payload = json.RawMessage(payload)
+	return delivery, err
+}
+
+func (c Client) queryWebhookDeliveries(ctx context.Context, query string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (c Client) CreateWebhook(ctx context.Context, params CreateWebhookParams) (Webhook, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO webhooks (id, created_at, updated_at, user_id, url, description, secret, events, active)
+	VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.ExecContext(ctx, query,
+		id, params.UserID, params.URL, params.Description, params.Secret, strings.Join(params.Events, " "), true,
+	)
+	if err != nil {
+		return Webhook{}, err
+	}
+	return c.GetWebhook(ctx, id)
+}
+
+func (c Client) GetWebhook(ctx context.Context, id uuid.UUID) (Webhook, error) {
+	webhook, err := scanWebhook(c.db.QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id))
+	if err != nil {
+		return Webhook{}, notFoundIfNoRows(err)
+	}
+	return webhook, nil
+}
+
+// ListWebhooks returns the user's webhooks, oldest first
+func (c Client) ListWebhooks(ctx context.Context, userID uuid.UUID) ([]Webhook, error) {
+	query := "SELECT " + webhookColumns + " FROM webhooks WHERE user_id = ? ORDER BY created_at, id"
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// UpdateWebhook saves the webhook's URL, description, secret, events and active flag
+func (c Client) UpdateWebhook(ctx context.Context, webhook Webhook) error {
+	query := `
+	UPDATE webhooks
+	SET url = ?, description = ?, secret = ?, events = ?, active = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query,
+		webhook.URL, webhook.Description, webhook.Secret, strings.Join(webhook.Events, " "), webhook.Active, webhook.ID,
+	))
+}
+
+// DeleteWebhook deletes the webhook and its deliveries, including pending ones
+func (c Client) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		return err
+	}
+	if err := requireRowsAffected(tx.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?", id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// EnqueueWebhookEvent queues a delivery of the event, due now, for each of the
+// user's webhooks that subscribes to it, and returns how many were queued
+func (c Client) EnqueueWebhookEvent(ctx context.Context, event WebhookEvent) (int, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE user_id = ? AND active = ?", event.UserID, true)
+	if err != nil {
+		return 0, err
+	}
+	var webhookIDs []uuid.UUID
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if webhook.Subscribes(event.Type) {
+			webhookIDs = append(webhookIDs, webhook.ID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	query := `
+	INSERT INTO webhook_deliveries (id, created_at, webhook_id, event_id, event_type, payload, status, next_attempt_at)
+	VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
+	`
+	now := c.db.dialect.timeArg(time.Now())
+	for _, webhookID := range webhookIDs {
+		_, err := tx.ExecContext(ctx, query,
+			uuid.New(), webhookID, event.ID, event.Type, string(event.Payload), WebhookDeliveryPending, now,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(webhookIDs), tx.Commit()
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries to active
+// webhooks that are due by now, oldest first, and pushes their next attempt
+// back by lease so no other worker claims them meanwhile. A claimed delivery
+// whose attempt is never recorded, say because the server stopped, is tried
+// again once the lease runs out.
+func (c Client) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	query := `
+	SELECT ` + webhookDeliveryColumns + `
+	FROM webhook_deliveries
+	WHERE status = ? AND next_attempt_at <= ? AND webhook_id IN (SELECT id FROM webhooks WHERE active = ?)
+	ORDER BY next_attempt_at, created_at
+	LIMIT ?
+	`
+	due, err := c.queryWebhookDeliveries(ctx, query, WebhookDeliveryPending, c.db.dialect.timeArg(now), true, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := []WebhookDelivery{}
+	leaseUntil := now.Add(lease)
+	for _, delivery := range due {
+		// Another worker that got here first has already moved next_attempt_at past now
+		query := "UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ? AND status = ? AND next_attempt_at <= ?"
+		result, err := c.db.ExecContext(ctx, query,
+			c.db.dialect.timeArg(leaseUntil), delivery.ID, WebhookDeliveryPending, c.db.dialect.timeArg(now),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			continue
+		}
+		delivery.NextAttemptAt = &leaseUntil
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+// RecordWebhookAttempt counts an attempt at the delivery and saves its outcome
+func (c Client) RecordWebhookAttempt(ctx context.Context, id uuid.UUID, attempt WebhookAttempt) error {
+	status := WebhookDeliveryFailed
+	var retryAt any
+	switch {
+	case attempt.Succeeded:
+		status = WebhookDeliverySucceeded
+	case attempt.RetryAt != nil:
+		status = WebhookDeliveryPending
+		retryAt = c.db.dialect.timeArg(*attempt.RetryAt)
+	}
+	query := `
+	UPDATE webhook_deliveries
+	SET status = ?, attempts = attempts + 1, next_attempt_at = ?, last_attempt_at = ?, response_code = ?, last_error = ?
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query,
+		status, retryAt, c.db.dialect.timeArg(attempt.At), attempt.ResponseCode, attempt.Error, id,
+	))
+}
+
+// CountUntriedWebhookDeliveries counts the deliveries to the user's active
+// webhooks that haven't had their first attempt yet
+func (c Client) CountUntriedWebhookDeliveries(ctx context.Context, userID uuid.UUID) (int, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM webhook_deliveries d
+	JOIN webhooks w ON w.id = d.webhook_id
+	WHERE w.user_id = ? AND w.active = ? AND d.status = ? AND d.attempts = 0
+	`
+	var n int
+	err := c.db.QueryRowContext(ctx, query, userID, true, WebhookDeliveryPending).Scan(&n)
+	return n, err
+}
+
+// ListWebhookDeliveries returns a page of the webhook's deliveries, newest first
+func (c Client) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit, offset int) ([]WebhookDelivery, error) {
+	query := `
+	SELECT ` + webhookDeliveryColumns + `
+	FROM webhook_deliveries
+	WHERE webhook_id = ?
+	ORDER BY created_at DESC, id DESC
+	LIMIT ? OFFSET ?
+	`
+	return c.queryWebhookDeliveries(ctx, query, webhookID, limit, offset)
+}
+
+func (c Client) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error) {
+	query := "SELECT " + webhookDeliveryColumns + " FROM webhook_deliveries WHERE id = ?"
+	delivery, err := scanWebhookDelivery(c.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return WebhookDelivery{}, notFoundIfNoRows(err)
+	}
+	return delivery, nil
+}
+
+// RedeliverWebhookDelivery queues the delivery's event again, due now, as a
+// new delivery with a fresh set of attempts
+func (c Client) RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error) {
+	original, err := c.GetWebhookDelivery(ctx, id)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	newID := uuid.New()
+	query := `
+	INSERT INTO webhook_deliveries (id, created_at, webhook_id, event_id, event_type, payload, status, next_attempt_at, redelivery_of)
+	VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = c.db.ExecContext(ctx, query,
+		newID, original.WebhookID, original.EventID, original.EventType, string(original.Payload),
+		WebhookDeliveryPending, c.db.dialect.timeArg(time.Now()), original.ID,
+	)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	return c.GetWebhookDelivery(ctx, newID)
+}
+
+// PruneWebhookDeliveries deletes finished deliveries created before before
+func (c Client) PruneWebhookDeliveries(ctx context.Context, before time.Time) error {
+	query := "DELETE FROM webhook_deliveries WHERE status <> ? AND created_at < ?"
+	_, err := c.db.ExecContext(ctx, query, WebhookDeliveryPending, c.db.dialect.timeArg(before))
+	return err
+}
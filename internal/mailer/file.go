@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileMailer is a development sink that writes emails to disk instead of sending them.
+// If no directory is configured, emails are written to the server log.
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) *FileMailer {
+	return &FileMailer{dir: dir}
+}
+
+// Send writes the message to "<dir>/<timestamp>-<recipient>.eml" or logs it
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if msg.To == "" {
+		return ErrNoRecipient
+	}
+
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Text)
+
+	if m.dir == "" {
+		log.Printf("[MAIL] %s", content)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return fmt.Errorf("couldn't create outbox directory: %w", err)
+	}
+
+	// Keep the filename safe by stripping anything path-like from the recipient
+	recipient := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(msg.To)
+	name := fmt.Sprintf("%d-%s", time.Now().UnixNano(), recipient)
+
+	if err := os.WriteFile(filepath.Join(m.dir, name+".txt"), []byte(content), 0644); err != nil {
+		return fmt.Errorf("couldn't write email: %w", err)
+	}
+	if msg.HTML != "" {
+		if err := os.WriteFile(filepath.Join(m.dir, name+".html"), []byte(msg.HTML), 0644); err != nil {
+			return fmt.Errorf("couldn't write email: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+)
+
+// Message is a single outbound email with both plain-text and HTML bodies
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer defines an interface for delivering emails
+type Mailer interface {
+	// Send delivers the message or returns an error if it couldn't be handed off
+	Send(ctx context.Context, msg Message) error
+}
+
+var ErrNoRecipient = errors.New("message has no recipient")
@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+// Render builds a message from the named template pair ("<name>.txt" and "<name>.html").
+// The text template must define a "subject" block.
+func Render(name, to string, data any) (Message, error) {
+	subject := &bytes.Buffer{}
+	if err := textTemplates.ExecuteTemplate(subject, name+".subject", data); err != nil {
+		return Message{}, fmt.Errorf("couldn't render subject for %s: %w", name, err)
+	}
+
+	text := &bytes.Buffer{}
+	if err := textTemplates.ExecuteTemplate(text, name+".txt", data); err != nil {
+		return Message{}, fmt.Errorf("couldn't render text for %s: %w", name, err)
+	}
+
+	html := &bytes.Buffer{}
+	if err := htmlTemplates.ExecuteTemplate(html, name+".html", data); err != nil {
+		return Message{}, fmt.Errorf("couldn't render html for %s: %w", name, err)
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()),
+		HTML:    html.String(),
+	}, nil
+}
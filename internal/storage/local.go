@@ -15,16 +15,18 @@ import (
 )
 
 type LocalStorage struct {
-	baseDir   string
-	baseURL   string // e.g. "http://localhost:8080/assets"
-	secretKey string // used for signing presigned URLs
+	baseDir      string
+	baseURL      string   // e.g. "http://localhost:8080/assets"
+	secretKey    string   // used for signing presigned URLs
+	previousKeys []string // still accepted when verifying, to allow key rotation
 }
 
-func NewLocalStorage(baseDir, baseURL, secretKey string) *LocalStorage {
+func NewLocalStorage(baseDir, baseURL, secretKey string, previousKeys ...string) *LocalStorage {
 	return &LocalStorage{
-		baseDir:   baseDir,
-		baseURL:   baseURL,
-		secretKey: secretKey,
+		baseDir:      baseDir,
+		baseURL:      baseURL,
+		secretKey:    secretKey,
+		previousKeys: previousKeys,
 	}
 }
 
@@ -68,7 +70,7 @@ func (s *LocalStorage) GeneratePresignedURL(storageRef string, expireTime time.D
 
 	// Create signature: HMAC-SHA256(key + expires, secretKey)
 	message := fmt.Sprintf("%s:%d", key, expires)
-	signature := s.sign(message)
+	signature := sign(message, s.secretKey)
 
 	// Build presigned URL with query parameters
 	presignedURL := fmt.Sprintf("%s/%s?expires=%d&signature=%s", s.baseURL, key, expires, signature)
@@ -77,8 +79,8 @@ func (s *LocalStorage) GeneratePresignedURL(storageRef string, expireTime time.D
 }
 
 // sign creates an HMAC-SHA256 signature
-func (s *LocalStorage) sign(message string) string {
-	h := hmac.New(sha256.New, []byte(s.secretKey))
+func sign(message, secretKey string) string {
+	h := hmac.New(sha256.New, []byte(secretKey))
 	h.Write([]byte(message))
 	return hex.EncodeToString(h.Sum(nil))
 }
@@ -97,11 +99,14 @@ func (s *LocalStorage) VerifyPresignedURL(key string, expiresStr, signature stri
 		return false
 	}
 
-	// Verify signature
+	// Verify signature against the current key, then any previous keys
 	message := fmt.Sprintf("%s:%d", key, expires)
-	expectedSignature := s.sign(message)
-
-	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+	for _, secretKey := range append([]string{s.secretKey}, s.previousKeys...) {
+		if hmac.Equal([]byte(signature), []byte(sign(message, secretKey))) {
+			return true
+		}
+	}
+	return false
 }
 
 // DeleteFile removes a file from local storage
@@ -116,3 +121,15 @@ func (s *LocalStorage) DeleteFile(storageRef string) error {
 	filePath := filepath.Join(s.baseDir, key)
 	return os.Remove(filePath)
 }
+
+// Open returns the local file for reading
+func (s *LocalStorage) Open(ctx context.Context, storageRef string) (io.ReadCloser, error) {
+	// Parse storage reference "local,key"
+	parts := strings.SplitN(storageRef, ",", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid storage reference: %s", storageRef)
+	}
+	key := parts[1]
+
+	return os.Open(filepath.Join(s.baseDir, key))
+}
@@ -101,3 +101,23 @@ func (s *S3Storage) DeleteFile(storageRef string) error {
 	})
 	return err
 }
+
+// Open streams an object from S3
+func (s *S3Storage) Open(ctx context.Context, storageRef string) (io.ReadCloser, error) {
+	// Parse storage reference "bucket,key"
+	parts := strings.SplitN(storageRef, ",", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid storage reference: %s", storageRef)
+	}
+	bucket := parts[0]
+	key := parts[1]
+
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get object: %w", err)
+	}
+	return output.Body, nil
+}
@@ -19,4 +19,7 @@ type FileStorage interface {
 
 	// DeleteFile removes a file from storage
 	DeleteFile(storageRef string) error
+
+	// Open returns a reader for the file's contents. The caller must close it.
+	Open(ctx context.Context, storageRef string) (io.ReadCloser, error)
 }
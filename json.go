@@ -2,10 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"runtime"
 	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
 // APIError represents a structured error response
@@ -16,8 +19,35 @@ type APIError struct {
 }
 
 func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
+	writeError(w, 2, code, msg, err)
+}
+
+// respondWithDBError maps store errors to consistent responses: ErrNotFound
+// becomes a 404 naming the resource, ErrConflict a 409 and anything else a 500
+func respondWithDBError(w http.ResponseWriter, resource string, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		writeError(w, 2, http.StatusNotFound, resource+" not found", nil)
+	case errors.Is(err, database.ErrConflict):
+		writeError(w, 2, http.StatusConflict, conflictMessage(err), err)
+	default:
+		writeError(w, 2, http.StatusInternalServerError, "Database error", err)
+	}
+}
+
+// conflictMessage turns "conflict: email already in use" into "Email already in use"
+func conflictMessage(err error) string {
+	msg := strings.TrimPrefix(err.Error(), database.ErrConflict.Error()+": ")
+	if msg == "" || msg == err.Error() {
+		return "Resource already exists"
+	}
+	return strings.ToUpper(msg[:1]) + msg[1:]
+}
+
+// writeError logs and writes an APIError, attributing it to the caller skip frames up
+func writeError(w http.ResponseWriter, skip int, code int, msg string, err error) {
 	// Get caller info for better debugging
-	_, file, line, _ := runtime.Caller(1)
+	_, file, line, _ := runtime.Caller(skip)
 	// Extract just the filename
 	parts := strings.Split(file, "/")
 	filename := parts[len(parts)-1]
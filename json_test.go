@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestRespondWithDBError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantMessage string
+	}{
+		{"not found", database.ErrNotFound, http.StatusNotFound, "Video not found"},
+		{"wrapped not found", fmt.Errorf("loading video: %w", database.ErrNotFound), http.StatusNotFound, "Video not found"},
+		{"conflict with a reason", fmt.Errorf("%w: title is already in use", database.ErrConflict), http.StatusConflict, "Title is already in use"},
+		{"bare conflict", database.ErrConflict, http.StatusConflict, "Resource already exists"},
+		{"anything else", errors.New("disk I/O error"), http.StatusInternalServerError, "Database error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			respondWithDBError(rec, "Video", tt.err)
+
+			var body struct {
+				Message string `json:"message"`
+				Code    int    `json:"code"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("couldn't decode %q: %v", rec.Body.String(), err)
+			}
+			if rec.Code != tt.wantStatus || body.Code != tt.wantStatus || body.Message != tt.wantMessage {
+				t.Errorf("got %d %q (code %d), want %d %q", rec.Code, body.Message, body.Code, tt.wantStatus, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
+)
+
+// sendEmail renders the named template and delivers it in the background.
+// Failures are logged rather than returned so callers never reveal whether an account exists.
+func (cfg *apiConfig) sendEmail(to, templateName string, data any) {
+	msg, err := mailer.Render(templateName, to, data)
+	if err != nil {
+		log.Printf("%s[ERROR]%s couldn't render %s email: %v", colorRed, colorReset, templateName, err)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := cfg.mailer.Send(ctx, msg); err != nil {
+			log.Printf("%s[ERROR]%s couldn't send %s email: %v", colorRed, colorReset, templateName, err)
+		}
+	}()
+}
+
+// publicLink builds an absolute URL on the public base URL, e.g. for links in emails
+func (cfg *apiConfig) publicLink(path string, query url.Values) string {
+	link := strings.TrimSuffix(cfg.publicBaseURL, "/") + path
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
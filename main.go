@@ -2,44 +2,113 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 
 	"github.com/joho/godotenv"
 )
 
 type apiConfig struct {
-	db           database.Client
-	jwtSecret    string
+	db           database.Store
+	jwtKeys      *auth.KeySet
 	platform     string
 	filepathRoot string
 	assetsRoot   string
 	port         string
 	storage      storage.FileStorage
+
+	mailer        mailer.Mailer
+	publicBaseURL string
+
+	requireEmailVerification bool
+	trustProxy               bool
+	passwordPolicy           auth.PasswordPolicy
+
+	analyticsSecret string
+	playback        *playbackRecorder
+	analytics       *analyticsRecorder
+	webhooks        *webhookDispatcher
 }
 
 func main() {
 	godotenv.Load(".env")
 
-	pathToDB := os.Getenv("DB_PATH")
-	if pathToDB == "" {
-		log.Fatal("DB_URL must be set")
+	// DATABASE_URL selects the backend by scheme (postgres:// or a SQLite path);
+	// DB_PATH is kept for existing SQLite setups
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		databaseURL = os.Getenv("DB_PATH")
+	}
+	if databaseURL == "" {
+		log.Fatal("DATABASE_URL or DB_PATH must be set")
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(databaseURL, os.Args[2:]))
 	}
 
-	db, err := database.NewClient(pathToDB)
+	db, err := openDatabase(context.Background(), databaseURL)
 	if err != nil {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
+	log.Printf("Using %s database", db.Dialect())
 
+	// Retired JWT keys keep verifying tokens for this long after their retired_at
+	keyGracePeriod := 24 * time.Hour
+	if grace := os.Getenv("JWT_KEY_GRACE_PERIOD"); grace != "" {
+		keyGracePeriod, err = time.ParseDuration(grace)
+		if err != nil {
+			log.Fatalf("Invalid JWT_KEY_GRACE_PERIOD: %v", err)
+		}
+	}
+
+	// Sign JWTs with a rotatable key set if configured, otherwise fall back to HS256 with JWT_SECRET
 	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	var jwtKeys *auth.KeySet
+	if keySetFile := os.Getenv("JWT_KEYSET_FILE"); keySetFile != "" {
+		jwtKeys, err = auth.LoadKeySetFile(keySetFile, keyGracePeriod)
+		if err != nil {
+			log.Fatalf("Couldn't load JWT key set: %v", err)
+		}
+		log.Printf("Signing JWTs with key %s", jwtKeys.ActiveKeyID())
+	} else {
+		if jwtSecret == "" {
+			log.Fatal("JWT_SECRET or JWT_KEYSET_FILE environment variable must be set")
+		}
+		jwtKeys, err = auth.NewKeySet(auth.NewHMACKey(auth.LegacyKeyID, jwtSecret), keyGracePeriod)
+		if err != nil {
+			log.Fatalf("Couldn't create JWT key set: %v", err)
+		}
+	}
+
+	// Local presigned asset URLs use their own secret so JWT keys can rotate independently
+	assetSigningSecret := os.Getenv("ASSET_SIGNING_SECRET")
+	if assetSigningSecret == "" {
+		log.Fatal("ASSET_SIGNING_SECRET environment variable is not set")
+	}
+	var previousAssetSecrets []string
+	if previous := os.Getenv("ASSET_SIGNING_SECRET_PREVIOUS"); previous != "" {
+		previousAssetSecrets = strings.Split(previous, ",")
+	}
+
+	// Anonymous viewers are counted by an HMAC of their IP address and user
+	// agent under this secret, so the keys can't be reversed by guessing
+	analyticsSecret := os.Getenv("ANALYTICS_SECRET")
+	if analyticsSecret == "" {
+		log.Fatal("ANALYTICS_SECRET environment variable is not set")
 	}
 
 	platform := os.Getenv("PLATFORM")
@@ -78,19 +147,76 @@ func main() {
 		storageBackend = storage.NewS3Storage(s3Client, s3Bucket, s3Region)
 		log.Println("Using S3 storage")
 	} else {
-		// Use jwtSecret for signing local presigned URLs (mimics S3 behavior)
-		storageBackend = storage.NewLocalStorage(assetsRoot, "http://localhost:"+port+"/assets", jwtSecret)
+		// Sign local presigned URLs with the asset secret (mimics S3 behavior)
+		storageBackend = storage.NewLocalStorage(assetsRoot, "http://localhost:"+port+"/assets", assetSigningSecret, previousAssetSecrets...)
 		log.Println("Using local storage")
 	}
 
+	// Public base URL is used to build links in emails (e.g. password reset)
+	publicBaseURL := os.Getenv("PUBLIC_BASE_URL")
+	if publicBaseURL == "" {
+		publicBaseURL = "http://localhost:" + port
+	}
+
+	// Use SMTP when a host is configured, otherwise write emails to the outbox dir (or log)
+	var mailBackend mailer.Mailer
+	smtpHost := os.Getenv("SMTP_HOST")
+	if smtpHost != "" {
+		smtpPort := os.Getenv("SMTP_PORT")
+		if smtpPort == "" {
+			smtpPort = "587"
+		}
+		mailFrom := os.Getenv("MAIL_FROM")
+		if mailFrom == "" {
+			log.Fatal("MAIL_FROM environment variable is not set")
+		}
+		mailBackend = mailer.NewSMTPMailer(smtpHost, smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), mailFrom)
+		log.Println("Using SMTP mailer")
+	} else {
+		mailBackend = mailer.NewFileMailer(os.Getenv("MAIL_OUTBOX_DIR"))
+		log.Println("Using file mailer")
+	}
+
+	passwordPolicy, err := passwordPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Couldn't load password policy: %v", err)
+	}
+
 	cfg := apiConfig{
 		db:           db,
-		jwtSecret:    jwtSecret,
+		jwtKeys:      jwtKeys,
 		platform:     platform,
 		filepathRoot: filepathRoot,
 		assetsRoot:   assetsRoot,
 		port:         port,
 		storage:      storageBackend,
+
+		mailer:        mailBackend,
+		publicBaseURL: publicBaseURL,
+
+		// Block uploads until the user has verified their email
+		requireEmailVerification: os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true",
+		// Trust X-Forwarded-For for client IPs (only enable behind a reverse proxy)
+		trustProxy:     os.Getenv("TRUST_PROXY") == "true",
+		passwordPolicy: passwordPolicy,
+
+		analyticsSecret: analyticsSecret,
+		playback:        newPlaybackRecorder(db),
+		analytics:       newAnalyticsRecorder(db),
+		// Let webhooks reach private addresses (only enable for local development)
+		webhooks: newWebhookDispatcher(db, os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"),
+	}
+
+	// Bootstrap the first admin from config
+	if adminEmail := os.Getenv("ADMIN_EMAIL"); adminEmail != "" {
+		if err := cfg.bootstrapAdmin(context.Background(), adminEmail, os.Getenv("ADMIN_PASSWORD")); err != nil {
+			log.Fatalf("Couldn't bootstrap admin: %v", err)
+		}
+	}
+
+	// Finish account deletions interrupted by a restart
+	if err := cfg.resumePendingDeletions(context.Background()); err != nil {
+		log.Fatalf("Couldn't resume pending account deletions: %v", err)
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -115,6 +241,36 @@ func main() {
 		Handler: handler,
 	}
 
+	// Stop on SIGINT or SIGTERM, letting requests finish and writing any
+	// buffered playback progress and analytics before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go cfg.playback.run(ctx)
+	go cfg.analytics.run(ctx)
+	go cfg.webhooks.run(ctx)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("%s[ERROR]%s couldn't shut down cleanly: %v", colorRed, colorReset, err)
+		}
+	}()
+
 	log.Printf("🚀 Vaultstream server running on http://localhost:%s/app/\n", port)
-	log.Fatal(srv.ListenAndServe())
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-stopped
+
+	if err := cfg.playback.flushAll(context.Background()); err != nil {
+		log.Printf("%s[ERROR]%s couldn't save playback progress: %v", colorRed, colorReset, err)
+	}
+	if err := cfg.analytics.flush(context.Background()); err != nil {
+		log.Printf("%s[ERROR]%s couldn't save analytics: %v", colorRed, colorReset, err)
+	}
+	log.Println("Server stopped")
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database/memory"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// testAPI is the API on an in-memory store, with files and emails kept in
+// the test's temporary directory
+type testAPI struct {
+	t       *testing.T
+	cfg     *apiConfig
+	db      *memory.Store
+	handler http.Handler
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	db := memory.New()
+	keys, err := auth.NewKeySet(auth.NewHMACKey(auth.LegacyKeyID, "test-jwt-secret"), time.Hour)
+	if err != nil {
+		t.Fatalf("couldn't create key set: %v", err)
+	}
+	dir := t.TempDir()
+	cfg := &apiConfig{
+		db:              db,
+		jwtKeys:         keys,
+		platform:        "dev",
+		filepathRoot:    filepath.Join(dir, "app"),
+		assetsRoot:      filepath.Join(dir, "assets"),
+		port:            "8091",
+		storage:         storage.NewLocalStorage(filepath.Join(dir, "assets"), "http://localhost:8091/assets", "test-asset-secret"),
+		mailer:          mailer.NewFileMailer(filepath.Join(dir, "outbox")),
+		publicBaseURL:   "http://localhost:8091",
+		passwordPolicy:  auth.DefaultPasswordPolicy,
+		analyticsSecret: "test-analytics-secret",
+		playback:        newPlaybackRecorder(db),
+		analytics:       newAnalyticsRecorder(db),
+		webhooks:        newWebhookDispatcher(db, false),
+	}
+	mux := http.NewServeMux()
+	cfg.RegisterRoutes(mux)
+	return &testAPI{t: t, cfg: cfg, db: db, handler: mux}
+}
+
+// testUser is an account and an access token for it
+type testUser struct {
+	database.User
+	token string
+}
+
+// createUser adds an account straight to the store and signs a token for it
+func (api *testAPI) createUser(email string) testUser {
+	api.t.Helper()
+	user, err := api.db.CreateUser(context.Background(), database.CreateUserParams{
+		Email:    email,
+		Password: "not-a-real-hash",
+		FullName: "Test User",
+	})
+	if err != nil {
+		api.t.Fatalf("CreateUser(%s): %v", email, err)
+	}
+	token, err := auth.MakeJWT(user.ID, api.cfg.jwtKeys, time.Hour)
+	if err != nil {
+		api.t.Fatalf("MakeJWT: %v", err)
+	}
+	return testUser{User: *user, token: token}
+}
+
+func (api *testAPI) createVideo(owner testUser, title string) database.Video {
+	api.t.Helper()
+	video, err := api.db.CreateVideo(context.Background(), database.CreateVideoParams{
+		Title:       title,
+		Description: "A test video",
+		UserID:      owner.ID,
+	})
+	if err != nil {
+		api.t.Fatalf("CreateVideo(%s): %v", title, err)
+	}
+	return video
+}
+
+// grant gives grantee role on the owner's video
+func (api *testAPI) grant(owner testUser, videoID uuid.UUID, grantee testUser, role string) database.Grant {
+	api.t.Helper()
+	grant, _, err := api.db.UpsertGrant(context.Background(), database.UpsertGrantParams{
+		OwnerID:       owner.ID,
+		VideoID:       &videoID,
+		GranteeEmail:  grantee.Email,
+		GranteeUserID: &grantee.ID,
+		Role:          role,
+	})
+	if err != nil {
+		api.t.Fatalf("UpsertGrant: %v", err)
+	}
+	return grant
+}
+
+// do sends a request as user (anonymously for the zero testUser), with body
+// encoded as JSON unless it is nil
+func (api *testAPI) do(user testUser, method, path string, body any) *httptest.ResponseRecorder {
+	api.t.Helper()
+	return api.serveAs(user, newJSONRequest(api.t, method, path, body))
+}
+
+// serveAs sends req as user, anonymously for the zero testUser
+func (api *testAPI) serveAs(user testUser, req *http.Request) *httptest.ResponseRecorder {
+	if user.token != "" {
+		req.Header.Set("Authorization", "Bearer "+user.token)
+	}
+	return api.serve(req)
+}
+
+// serve sends req to the API
+func (api *testAPI) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	api.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// newJSONRequest builds a request with body encoded as JSON unless it is nil
+func newJSONRequest(t *testing.T, method, path string, body any) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("couldn't encode body: %v", err)
+		}
+	}
+	return httptest.NewRequest(method, path, &buf)
+}
+
+// expect fails the test unless the response has the wanted status
+func expect(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Errorf("got status %d, want %d: %s", rec.Code, want, rec.Body.String())
+	}
+}
+
+// decode reads a JSON response body into v
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("couldn't decode response %q: %v", rec.Body.String(), err)
+	}
+}
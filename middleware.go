@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -123,7 +125,7 @@ func getMethodColor(method string) string {
 // Auth Middleware
 // ============================================
 
-// AuthMiddleware validates JWT and adds user ID to context
+// AuthMiddleware validates JWT, checks the account is active and adds user ID to context
 func (cfg *apiConfig) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token, err := auth.GetBearerToken(r.Header)
@@ -132,12 +134,32 @@ func (cfg *apiConfig) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+		userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
 		if err != nil {
 			respondWithError(w, http.StatusUnauthorized, "Invalid or expired token", err)
 			return
 		}
 
+		// Tokens stay valid after an account is disabled or its deletion is
+		// requested, so check the account itself on every request
+		user, err := cfg.db.GetUser(r.Context(), userID)
+		if errors.Is(err, database.ErrNotFound) {
+			respondWithError(w, http.StatusUnauthorized, "Invalid or expired token", nil)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error", err)
+			return
+		}
+		if user.DeletionRequestedAt != nil {
+			respondWithError(w, http.StatusUnauthorized, "This account is being deleted", nil)
+			return
+		}
+		if user.DisabledAt != nil {
+			respondWithError(w, http.StatusForbidden, "This account has been disabled", nil)
+			return
+		}
+
 		// Add user ID to request context
 		ctx := context.WithValue(r.Context(), UserIDKey, userID)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -155,6 +177,72 @@ func (cfg *apiConfig) AuthHandler(handler http.HandlerFunc) http.Handler {
 	return cfg.AuthMiddleware(handler)
 }
 
+// RequireVerifiedEmail rejects requests from users who haven't verified their email.
+// It only applies when REQUIRE_EMAIL_VERIFICATION is enabled and must run after AuthMiddleware.
+func (cfg *apiConfig) RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.requireEmailVerification {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID, ok := GetUserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+			return
+		}
+
+		user, err := cfg.db.GetUser(r.Context(), userID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			respondWithError(w, http.StatusInternalServerError, "Database error", err)
+			return
+		}
+		if err != nil || user.EmailVerifiedAt == nil {
+			respondWithError(w, http.StatusForbidden, "Please verify your email address first", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// VerifiedHandler wraps a handler function that requires authentication and a verified email
+func (cfg *apiConfig) VerifiedHandler(handler http.HandlerFunc) http.Handler {
+	return cfg.AuthMiddleware(cfg.RequireVerifiedEmail(handler))
+}
+
+// RequireAdmin rejects requests from users without the admin role. Must run after AuthMiddleware.
+func (cfg *apiConfig) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := GetUserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+			return
+		}
+
+		user, err := cfg.db.GetUser(r.Context(), userID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			respondWithError(w, http.StatusInternalServerError, "Database error", err)
+			return
+		}
+		if err != nil || !user.IsAdmin() || user.DisabledAt != nil {
+			cfg.audit(r, auditDenied(auditEvent{
+				Action:  auditAdminAccess,
+				Details: map[string]any{"method": r.Method, "path": r.URL.Path},
+			}))
+			respondWithError(w, http.StatusForbidden, "Admin access required", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminHandler wraps a handler function that requires an authenticated admin
+func (cfg *apiConfig) AdminHandler(handler http.HandlerFunc) http.Handler {
+	return cfg.AuthMiddleware(cfg.RequireAdmin(handler))
+}
+
 // ============================================
 // CORS Middleware (optional)
 // ============================================
@@ -164,7 +252,7 @@ func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+sharePasswordHeader)
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
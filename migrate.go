@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const migrateUsage = `usage: vaultstream migrate <command>
+
+commands:
+  up         apply all pending migrations
+  down [n]   roll back the last n migrations (default 1)
+  status     list migrations and when they were applied`
+
+// runMigrateCommand implements the "migrate" subcommand and returns the exit code
+func runMigrateCommand(databaseURL string, args []string) int {
+	ctx := context.Background()
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	db, err := database.Open(databaseURL)
+	if err != nil {
+		log.Printf("Couldn't connect to database: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, "down expects a positive number of steps")
+				return 2
+			}
+		}
+		reverted, err := db.MigrateDown(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no migrations to roll back")
+		}
+
+	case "status":
+		statuses, err := db.MigrationStatus(ctx)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
+
+// openDatabase connects to the database for the server. Migrations run on
+// startup unless AUTO_MIGRATE=false, in which case the schema must already be
+// current (e.g. when several replicas share one database and a deploy step
+// runs "migrate up").
+func openDatabase(ctx context.Context, databaseURL string) (database.Client, error) {
+	if os.Getenv("AUTO_MIGRATE") != "false" {
+		return database.NewClient(ctx, databaseURL)
+	}
+
+	db, err := database.Open(databaseURL)
+	if err != nil {
+		return database.Client{}, err
+	}
+	statuses, err := db.MigrationStatus(ctx)
+	if err != nil {
+		return database.Client{}, err
+	}
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			return database.Client{}, fmt.Errorf("migration %04d_%s is pending; run \"migrate up\" first", s.Version, s.Name)
+		}
+	}
+	return db, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+// passwordPolicyFromEnv builds the password policy from PASSWORD_* settings,
+// starting from auth.DefaultPasswordPolicy
+func passwordPolicyFromEnv() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+
+	ints := map[string]*int{
+		"PASSWORD_MIN_LENGTH": &policy.MinLength,
+		"PASSWORD_MAX_LENGTH": &policy.MaxLength,
+	}
+	for key, target := range ints {
+		if value := os.Getenv(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return auth.PasswordPolicy{}, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			*target = n
+		}
+	}
+
+	bools := map[string]*bool{
+		"PASSWORD_REQUIRE_LOWER":  &policy.RequireLower,
+		"PASSWORD_REQUIRE_UPPER":  &policy.RequireUpper,
+		"PASSWORD_REQUIRE_DIGIT":  &policy.RequireDigit,
+		"PASSWORD_REQUIRE_SYMBOL": &policy.RequireSymbol,
+	}
+	for key, target := range bools {
+		if value := os.Getenv(key); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return auth.PasswordPolicy{}, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			*target = b
+		}
+	}
+
+	if value := os.Getenv("PASSWORD_MIN_ENTROPY"); value != "" {
+		bits, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("invalid PASSWORD_MIN_ENTROPY: %w", err)
+		}
+		policy.MinEntropyBits = bits
+	}
+
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		breached, err := auth.NewBreachedPasswordList(dir)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("couldn't load breached password list: %w", err)
+		}
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
+
+// passwordPolicyError is an APIError with the reasons a password was rejected
+type passwordPolicyError struct {
+	APIError
+	Violations []auth.PasswordViolation `json:"violations"`
+}
+
+// checkPassword validates a new password against the policy. On failure it responds
+// with 400 and the list of violations, and returns false.
+func (cfg *apiConfig) checkPassword(w http.ResponseWriter, password string, userInputs ...string) bool {
+	violations, err := cfg.passwordPolicy.Validate(password, userInputs...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check password", err)
+		return false
+	}
+	if len(violations) == 0 {
+		return true
+	}
+
+	respondWithJSON(w, http.StatusBadRequest, passwordPolicyError{
+		APIError: APIError{
+			Error:   http.StatusText(http.StatusBadRequest),
+			Message: violations[0].Message,
+			Code:    http.StatusBadRequest,
+		},
+		Violations: violations,
+	})
+	return false
+}
+
+// handlerPasswordPolicy describes the password rules so the UI can show them up front
+func (cfg *apiConfig) handlerPasswordPolicy(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		auth.PasswordPolicy
+		BreachCheck bool `json:"breach_check"`
+	}
+	respondWithJSON(w, http.StatusOK, response{
+		PasswordPolicy: cfg.passwordPolicy,
+		BreachCheck:    cfg.passwordPolicy.Breached != nil,
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// playbackFlushInterval is how often buffered playback heartbeats are written
+const playbackFlushInterval = 15 * time.Second
+
+type playbackKey struct {
+	userID  uuid.UUID
+	videoID uuid.UUID
+}
+
+// playbackRecorder debounces playback heartbeats. Players report their
+// position every few seconds; only the latest report per user and video is
+// kept, and the reports are written together every flush interval, so the
+// database sees one write per video per interval instead of one per heartbeat.
+// Anything reading a user's progress flushes their reports first.
+type playbackRecorder struct {
+	db database.Store
+
+	// writeMu is held while a batch is being written, so discard can't race
+	// a write of the reports it drops
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[playbackKey]database.PlaybackHeartbeat
+}
+
+func newPlaybackRecorder(db database.Store) *playbackRecorder {
+	return &playbackRecorder{
+		db:      db,
+		pending: map[playbackKey]database.PlaybackHeartbeat{},
+	}
+}
+
+// record buffers a heartbeat in place of any earlier one for the same video.
+// A video reported finished stays finished until the buffer is written.
+func (p *playbackRecorder) record(beat database.PlaybackHeartbeat) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := playbackKey{beat.UserID, beat.VideoID}
+	if earlier, ok := p.pending[key]; ok && earlier.Finished {
+		beat.Finished = true
+	}
+	p.pending[key] = beat
+}
+
+// flush writes the buffered heartbeats matching fn. If the write fails they
+// go back in the buffer, unless newer ones have arrived meanwhile.
+func (p *playbackRecorder) flush(ctx context.Context, fn func(playbackKey) bool) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	p.mu.Lock()
+	batch := []database.PlaybackHeartbeat{}
+	for key, beat := range p.pending {
+		if fn(key) {
+			batch = append(batch, beat)
+			delete(p.pending, key)
+		}
+	}
+	p.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	err := p.db.SavePlaybackProgress(ctx, batch)
+	if err != nil {
+		p.mu.Lock()
+		for _, beat := range batch {
+			key := playbackKey{beat.UserID, beat.VideoID}
+			if _, ok := p.pending[key]; !ok {
+				p.pending[key] = beat
+			}
+		}
+		p.mu.Unlock()
+	}
+	return err
+}
+
+// flushUser writes the user's buffered heartbeats, before their progress is read
+func (p *playbackRecorder) flushUser(ctx context.Context, userID uuid.UUID) error {
+	return p.flush(ctx, func(key playbackKey) bool { return key.userID == userID })
+}
+
+func (p *playbackRecorder) flushAll(ctx context.Context) error {
+	return p.flush(ctx, func(playbackKey) bool { return true })
+}
+
+// discard drops the user's buffered heartbeats for the video, or for every
+// video when videoID is nil, so clearing history doesn't bring them back
+func (p *playbackRecorder) discard(userID uuid.UUID, videoID *uuid.UUID) {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key := range p.pending {
+		if key.userID == userID && (videoID == nil || key.videoID == *videoID) {
+			delete(p.pending, key)
+		}
+	}
+}
+
+// run flushes the buffer every playbackFlushInterval until ctx is done. The
+// caller flushes once more after the server has stopped taking requests.
+func (p *playbackRecorder) run(ctx context.Context) {
+	ticker := time.NewTicker(playbackFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.flushAll(ctx); err != nil {
+				log.Printf("%s[ERROR]%s couldn't save playback progress: %v", colorRed, colorReset, err)
+			}
+		}
+	}
+}
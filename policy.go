@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// policyAction is something a caller can try to do to a resource
+type policyAction int
+
+const (
+	// actionView covers reading it and streaming its files
+	actionView policyAction = iota
+	actionComment
+	// actionEdit covers changing metadata and uploading or removing files
+	actionEdit
+	// actionManage covers deleting it and deciding who it is shared with
+	actionManage
+)
+
+// roleOwner is the caller's role on their own videos and collections
+const roleOwner = "owner"
+
+// allows reports whether a caller holding role may perform action. Owners may
+// do everything, grantees what their role allows, and everyone else nothing.
+func allows(role string, action policyAction) bool {
+	if role == roleOwner {
+		return true
+	}
+	switch action {
+	case actionView:
+		return database.GrantRoleRank(role) >= database.GrantRoleRank(database.GrantRoleViewer)
+	case actionComment:
+		return database.GrantRoleRank(role) >= database.GrantRoleRank(database.GrantRoleCommenter)
+	case actionEdit:
+		return database.GrantRoleRank(role) >= database.GrantRoleRank(database.GrantRoleEditor)
+	}
+	return false
+}
+
+// decision is the policy's answer to one access
+type decision int
+
+const (
+	decisionAllow decision = iota
+	// decisionForbid means the caller can see the resource but not do this to it
+	decisionForbid
+	// decisionHide means the caller can't see the resource at all
+	decisionHide
+)
+
+// decide is the authorization policy, evaluated for every access to a video,
+// collection, tag, share link or grant
+func decide(role string, action policyAction) decision {
+	switch {
+	case allows(role, action):
+		return decisionAllow
+	case allows(role, actionView):
+		return decisionForbid
+	}
+	return decisionHide
+}
+
+// ownerRole is the caller's role on resources that can't be shared, such as
+// tags and share links: owner, or nothing at all
+func ownerRole(ownerID, userID uuid.UUID) string {
+	if ownerID == userID {
+		return roleOwner
+	}
+	return ""
+}
+
+// enforce applies the policy to the caller's role on a resource and responds
+// if access is refused. Resources the caller can't see get the same 404 as
+// ones that don't exist, so IDs can't be probed; resources they can see get
+// 403. Refusals are audited as denied when event has an action.
+func (cfg *apiConfig) enforce(w http.ResponseWriter, r *http.Request, resource, role string, action policyAction, event auditEvent) bool {
+	d := decide(role, action)
+	if d == decisionAllow {
+		return true
+	}
+	if event.Action != "" {
+		cfg.audit(r, auditDenied(event))
+	}
+	if d == decisionHide {
+		respondWithDBError(w, resource, database.ErrNotFound)
+	} else {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to do that to this "+strings.ToLower(resource), nil)
+	}
+	return false
+}
+
+// videoRole returns the user's role on the video: owner, the best role they
+// were granted directly or through a collection, or "" for none
+func (cfg *apiConfig) videoRole(ctx context.Context, video database.Video, userID uuid.UUID) (string, error) {
+	if video.UserID == userID {
+		return roleOwner, nil
+	}
+	return cfg.db.GetVideoRole(ctx, video.ID, userID)
+}
+
+// collectionRole returns the user's role on the collection, or "" for none
+func (cfg *apiConfig) collectionRole(ctx context.Context, collection database.Collection, userID uuid.UUID) (string, error) {
+	if collection.UserID == userID {
+		return roleOwner, nil
+	}
+	return cfg.db.GetCollectionRole(ctx, collection.ID, userID)
+}
+
+// authorizeVideo loads the video named in the path and enforces the policy for
+// action on it. Refusals are audited under auditAction, if one is given. It
+// returns the caller's role too.
+func (cfg *apiConfig) authorizeVideo(w http.ResponseWriter, r *http.Request, action policyAction, auditAction string) (database.Video, string, bool) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return database.Video{}, "", false
+	}
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, "", false
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithDBError(w, "Video", err)
+		return database.Video{}, "", false
+	}
+	role, err := cfg.videoRole(r.Context(), video, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check access to video", err)
+		return database.Video{}, "", false
+	}
+	if !cfg.enforce(w, r, "Video", role, action, auditVideo(auditAction, videoID)) {
+		return database.Video{}, "", false
+	}
+	return video, role, true
+}
+
+// authorizeCollection is authorizeVideo for the collection named in the path
+func (cfg *apiConfig) authorizeCollection(w http.ResponseWriter, r *http.Request, action policyAction, auditAction string) (database.Collection, string, bool) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return database.Collection{}, "", false
+	}
+	collectionID, err := uuid.Parse(r.PathValue("collectionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid collection ID", err)
+		return database.Collection{}, "", false
+	}
+
+	collection, err := cfg.db.GetCollection(r.Context(), collectionID)
+	if err != nil {
+		respondWithDBError(w, "Collection", err)
+		return database.Collection{}, "", false
+	}
+	role, err := cfg.collectionRole(r.Context(), collection, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check access to collection", err)
+		return database.Collection{}, "", false
+	}
+	if !cfg.enforce(w, r, "Collection", role, action, auditCollection(auditAction, collectionID)) {
+		return database.Collection{}, "", false
+	}
+	return collection, role, true
+}
+
+// authorizeComment checks a change to a comment on a video the caller can
+// already see. Comments aren't shared, so the question is authorship: the
+// author may change their own comment, and anyone else only when othersMay,
+// which depends on the change and their role on the video. Refusals are 403s
+// and are audited as denied when event has an action.
+func (cfg *apiConfig) authorizeComment(w http.ResponseWriter, r *http.Request, comment database.Comment, othersMay bool, event auditEvent) bool {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return false
+	}
+	if comment.UserID == userID || othersMay {
+		return true
+	}
+	if event.Action != "" {
+		cfg.audit(r, auditDenied(event))
+	}
+	respondWithError(w, http.StatusForbidden, "You don't have permission to do that to this comment", nil)
+	return false
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// access is what a user should get from a route
+type access int
+
+const (
+	// allowed routes let the user through with a 2xx
+	allowed access = iota
+	// forbidden routes edit or manage the resource beyond the user's role, so
+	// they get 403
+	forbidden
+	// hidden routes reach things that are never shared, so the user gets the
+	// same 404 as a stranger
+	hidden
+)
+
+// routeAccess is what the owner, and the users granted the editor and viewer
+// roles on the owner's video and collection, should get from a route
+type routeAccess struct {
+	owner, editor, viewer access
+}
+
+// idRoutes is every route taking the ID of something a user owns, with what
+// each role gets from it. TestRoutesHideResourcesFromStrangers fails on
+// routes missing from here, so new ones have to be decided on.
+var idRoutes = map[string]routeAccess{
+	"GET /api/videos/{videoID}":    {allowed, allowed, allowed},
+	"PUT /api/videos/{videoID}":    {allowed, allowed, forbidden},
+	"DELETE /api/videos/{videoID}": {allowed, forbidden, forbidden},
+
+	"PUT /api/tags/{tagID}":        {allowed, hidden, hidden},
+	"DELETE /api/tags/{tagID}":     {allowed, hidden, hidden},
+	"POST /api/tags/{tagID}/merge": {allowed, hidden, hidden},
+
+	"GET /api/collections/{collectionID}":                              {allowed, allowed, allowed},
+	"PUT /api/collections/{collectionID}":                              {allowed, allowed, forbidden},
+	"DELETE /api/collections/{collectionID}":                           {allowed, forbidden, forbidden},
+	"POST /api/collections/{collectionID}/items":                       {allowed, allowed, forbidden},
+	"POST /api/collections/{collectionID}/items/{videoID}/move":        {allowed, allowed, forbidden},
+	"DELETE /api/collections/{collectionID}/items/{videoID}":           {allowed, allowed, forbidden},
+	"GET /api/collections/{collectionID}/grants":                       {allowed, forbidden, forbidden},
+	"POST /api/collections/{collectionID}/grants":                      {allowed, forbidden, forbidden},
+	"DELETE /api/collections/{collectionID}/grants/{grantID}":          {allowed, forbidden, forbidden},
+	"POST /api/shares/{shareID}/revoke":                                {allowed, hidden, hidden},
+	"PUT /api/shares/{shareID}/embed-origins":                          {allowed, hidden, hidden},
+	"GET /api/videos/{videoID}/grants":                                 {allowed, forbidden, forbidden},
+	"POST /api/videos/{videoID}/grants":                                {allowed, forbidden, forbidden},
+	"DELETE /api/videos/{videoID}/grants/{grantID}":                    {allowed, forbidden, forbidden},
+	"GET /api/videos/{videoID}/comments":                               {allowed, allowed, allowed},
+	"POST /api/videos/{videoID}/comments":                              {allowed, allowed, forbidden},
+	"PUT /api/videos/{videoID}/comments/{commentID}":                   {allowed, forbidden, forbidden},
+	"DELETE /api/videos/{videoID}/comments/{commentID}":                {allowed, forbidden, forbidden},
+	"POST /api/videos/{videoID}/comments/{commentID}/resolve":          {allowed, allowed, forbidden},
+	"POST /api/videos/{videoID}/comments/{commentID}/unresolve":        {allowed, allowed, forbidden},
+	"GET /api/videos/{videoID}/notes":                                  {allowed, allowed, allowed},
+	"POST /api/videos/{videoID}/notes":                                 {allowed, allowed, allowed},
+	"PUT /api/videos/{videoID}/notes/{noteID}":                         {allowed, hidden, hidden},
+	"DELETE /api/videos/{videoID}/notes/{noteID}":                      {allowed, hidden, hidden},
+	"POST /api/videos/{videoID}/progress":                              {allowed, allowed, allowed},
+	"GET /api/videos/{videoID}/progress":                               {allowed, allowed, allowed},
+	"PUT /api/videos/{videoID}/watched":                                {allowed, allowed, allowed},
+	"DELETE /api/history/{videoID}":                                    {allowed, allowed, allowed},
+	"POST /api/videos/{videoID}/events":                                {allowed, allowed, allowed},
+	"GET /api/videos/{videoID}/analytics":                              {allowed, forbidden, forbidden},
+	"GET /api/webhooks/{webhookID}":                                    {allowed, hidden, hidden},
+	"PUT /api/webhooks/{webhookID}":                                    {allowed, hidden, hidden},
+	"DELETE /api/webhooks/{webhookID}":                                 {allowed, hidden, hidden},
+	"GET /api/webhooks/{webhookID}/deliveries":                         {allowed, hidden, hidden},
+	"GET /api/webhooks/{webhookID}/deliveries/{deliveryID}":            {allowed, hidden, hidden},
+	"POST /api/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver": {allowed, hidden, hidden},
+	"POST /api/thumbnail_upload/{videoID}":                             {allowed, allowed, forbidden},
+	"POST /api/video_upload/{videoID}":                                 {allowed, allowed, forbidden},
+	"POST /api/captions_upload/{videoID}":                              {allowed, allowed, forbidden},
+	"DELETE /api/videos/{videoID}/thumbnail":                           {allowed, allowed, forbidden},
+	"DELETE /api/videos/{videoID}/video-file":                          {allowed, allowed, forbidden},
+	"DELETE /api/videos/{videoID}/captions":                            {allowed, allowed, forbidden},
+}
+
+// routeBodies are the JSON bodies routes need to succeed, given the IDs of the
+// resources they are sent to. Other routes get {}.
+var routeBodies = map[string]func(ids map[string]string) any{
+	"PUT /api/videos/{videoID}":    func(map[string]string) any { return map[string]any{"title": "Renamed"} },
+	"PUT /api/tags/{tagID}":        func(map[string]string) any { return map[string]any{"name": "renamed"} },
+	"POST /api/tags/{tagID}/merge": func(ids map[string]string) any { return map[string]any{"source_ids": []string{ids["{otherTagID}"]}} },
+	"PUT /api/collections/{collectionID}": func(map[string]string) any {
+		return map[string]any{"title": "Renamed"}
+	},
+	"POST /api/collections/{collectionID}/items": func(ids map[string]string) any {
+		return map[string]any{"video_id": ids["{otherVideoID}"]}
+	},
+	"POST /api/collections/{collectionID}/grants": func(map[string]string) any {
+		return map[string]any{"email": "invitee@example.com", "role": database.GrantRoleViewer}
+	},
+	"PUT /api/shares/{shareID}/embed-origins": func(map[string]string) any {
+		return map[string]any{"embed_origins": []string{"https://blog.example.com"}}
+	},
+	"POST /api/videos/{videoID}/grants": func(map[string]string) any {
+		return map[string]any{"email": "invitee@example.com", "role": database.GrantRoleViewer}
+	},
+	"POST /api/videos/{videoID}/comments":            func(map[string]string) any { return map[string]any{"body": "A comment"} },
+	"PUT /api/videos/{videoID}/comments/{commentID}": func(map[string]string) any { return map[string]any{"body": "Edited"} },
+	"POST /api/videos/{videoID}/notes":               func(map[string]string) any { return map[string]any{"body": "A note"} },
+	"PUT /api/videos/{videoID}/notes/{noteID}":       func(map[string]string) any { return map[string]any{"body": "Edited"} },
+	"POST /api/videos/{videoID}/progress":            func(map[string]string) any { return map[string]any{"position_seconds": 5} },
+	"PUT /api/videos/{videoID}/watched":              func(map[string]string) any { return map[string]any{"watched": true} },
+	"POST /api/videos/{videoID}/events":              func(map[string]string) any { return map[string]any{"type": "play"} },
+	"PUT /api/webhooks/{webhookID}":                  func(map[string]string) any { return map[string]any{"description": "Renamed"} },
+}
+
+// routeUploads are the form field, file name, content type and contents the
+// upload routes take
+var routeUploads = map[string]struct {
+	field, filename, contentType string
+	contents                     func(t *testing.T) []byte
+}{
+	"POST /api/thumbnail_upload/{videoID}": {"thumbnail", "thumbnail.png", "image/png", func(*testing.T) []byte { return []byte("\x89PNG\r\n\x1a\n") }},
+	"POST /api/video_upload/{videoID}":     {"video", "clip.mp4", "video/mp4", testClip},
+	"POST /api/captions_upload/{videoID}":  {"captions", "captions.vtt", "text/vtt", func(*testing.T) []byte { return []byte("WEBVTT\n\n00:00.000 --> 00:01.000\nHello\n") }},
+}
+
+// routeSetup is the route each of these needs the same user to have sent
+// first
+var routeSetup = map[string]string{
+	"GET /api/videos/{videoID}/progress":                        "POST /api/videos/{videoID}/progress",
+	"DELETE /api/history/{videoID}":                             "POST /api/videos/{videoID}/progress",
+	"POST /api/videos/{videoID}/comments/{commentID}/unresolve": "POST /api/videos/{videoID}/comments/{commentID}/resolve",
+}
+
+// routeTools are the programs a route runs, which it can't succeed without
+var routeTools = map[string][]string{
+	"POST /api/video_upload/{videoID}": {"ffprobe", "ffmpeg"},
+}
+
+// testClip makes a one second MP4 with ffmpeg
+func testClip(t *testing.T) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "testsrc=duration=1:size=160x90:rate=5", "-c:v", "mpeg4", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("couldn't make a test clip: %v: %s", err, out)
+	}
+	clip, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clip
+}
+
+// idParams are the path parameters naming something a user owns
+var idParams = []string{"{videoID}", "{collectionID}", "{tagID}", "{shareID}", "{grantID}", "{commentID}", "{noteID}", "{webhookID}"}
+
+// registeredIDRoutes reads the patterns in routes.go that take an ID param
+func registeredIDRoutes(t *testing.T) []string {
+	t.Helper()
+	src, err := os.ReadFile("routes.go")
+	if err != nil {
+		t.Fatalf("couldn't read routes.go: %v", err)
+	}
+	var patterns []string
+	for _, m := range regexp.MustCompile(`mux\.Handle(?:Func)?\("([^"]+)"`).FindAllStringSubmatch(string(src), -1) {
+		for _, param := range idParams {
+			if strings.Contains(m[1], param) {
+				patterns = append(patterns, m[1])
+				break
+			}
+		}
+	}
+	return patterns
+}
+
+// ownedResources creates one of everything the owner can have, shares the
+// video, a second video and the collection with editor and viewer, and
+// returns the path parameter values naming them. {otherVideoID} and
+// {otherTagID} name the second video, which isn't in the collection, and a
+// second tag. Grants are the viewer's, looked up by the resource they are on.
+func ownedResources(t *testing.T, api *testAPI, owner, editor, viewer testUser) (ids map[string]string, collectionGrantID string) {
+	t.Helper()
+	ctx := context.Background()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	video := api.createVideo(owner, "Owned")
+	otherVideo := api.createVideo(owner, "Other")
+	videoGrant := api.grant(owner, video.ID, viewer, database.GrantRoleViewer)
+	api.grant(owner, video.ID, editor, database.GrantRoleEditor)
+	api.grant(owner, otherVideo.ID, viewer, database.GrantRoleViewer)
+	api.grant(owner, otherVideo.ID, editor, database.GrantRoleEditor)
+
+	collection, err := api.db.CreateCollection(ctx, database.CreateCollectionParams{UserID: owner.ID, Title: "Owned"})
+	must(err)
+	must(api.db.AddCollectionItem(ctx, collection.ID, video.ID, database.CollectionPlacement{}))
+	var collectionGrant database.Grant
+	for _, grantee := range []struct {
+		user testUser
+		role string
+	}{{viewer, database.GrantRoleViewer}, {editor, database.GrantRoleEditor}} {
+		grant, _, err := api.db.UpsertGrant(ctx, database.UpsertGrantParams{
+			OwnerID:       owner.ID,
+			CollectionID:  &collection.ID,
+			GranteeEmail:  grantee.user.Email,
+			GranteeUserID: &grantee.user.ID,
+			Role:          grantee.role,
+		})
+		must(err)
+		if grantee.user.ID == viewer.ID {
+			collectionGrant = grant
+		}
+	}
+
+	tag, err := api.db.CreateTag(ctx, owner.ID, "owned "+video.ID.String())
+	must(err)
+	otherTag, err := api.db.CreateTag(ctx, owner.ID, "other "+video.ID.String())
+	must(err)
+	must(api.db.TagVideos(ctx, []uuid.UUID{video.ID}, []uuid.UUID{tag.ID, otherTag.ID}))
+
+	share, err := api.db.CreateShareLink(ctx, database.CreateShareLinkParams{Token: uuid.NewString(), UserID: owner.ID, VideoID: &video.ID})
+	must(err)
+	comment, err := api.db.CreateComment(ctx, database.CreateCommentParams{VideoID: video.ID, UserID: owner.ID, Body: "Owner's comment"})
+	must(err)
+	note, err := api.db.CreateNote(ctx, database.CreateNoteParams{VideoID: video.ID, UserID: owner.ID, Body: "Owner's note"})
+	must(err)
+
+	webhook, err := api.db.CreateWebhook(ctx, database.CreateWebhookParams{
+		UserID: owner.ID,
+		URL:    "https://hooks.example.com/owned",
+		Secret: "webhook-secret",
+		Events: []string{webhookEventVideoUploaded},
+	})
+	must(err)
+	_, err = api.db.EnqueueWebhookEvent(ctx, database.WebhookEvent{ID: uuid.New(), Type: webhookEventVideoUploaded, UserID: owner.ID, Payload: []byte(`{}`)})
+	must(err)
+	deliveries, err := api.db.ListWebhookDeliveries(ctx, webhook.ID, 1, 0)
+	must(err)
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(deliveries))
+	}
+
+	return map[string]string{
+		"{videoID}":      video.ID.String(),
+		"{otherVideoID}": otherVideo.ID.String(),
+		"{collectionID}": collection.ID.String(),
+		"{tagID}":        tag.ID.String(),
+		"{otherTagID}":   otherTag.ID.String(),
+		"{shareID}":      share.ID.String(),
+		"{grantID}":      videoGrant.ID.String(),
+		"{commentID}":    comment.ID.String(),
+		"{noteID}":       note.ID.String(),
+		"{webhookID}":    webhook.ID.String(),
+		"{deliveryID}":   deliveries[0].ID.String(),
+	}, collectionGrant.ID.String()
+}
+
+// routeRequest builds a request to the pattern with its path parameters filled
+// from ids and the body it needs
+func routeRequest(t *testing.T, pattern string, ids map[string]string, collectionGrantID string) *http.Request {
+	t.Helper()
+	method, path, _ := strings.Cut(pattern, " ")
+	if strings.Contains(path, "{collectionID}") {
+		path = strings.ReplaceAll(path, "{grantID}", collectionGrantID)
+	}
+	for param, id := range ids {
+		path = strings.ReplaceAll(path, param, id)
+	}
+
+	upload, ok := routeUploads[pattern]
+	if !ok {
+		var body any = map[string]any{}
+		if routeBody, ok := routeBodies[pattern]; ok {
+			body = routeBody(ids)
+		}
+		return newJSONRequest(t, method, path, body)
+	}
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	part, err := form.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="` + upload.field + `"; filename="` + upload.filename + `"`},
+		"Content-Type":        {upload.contentType},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without the tools the file can't be made or processed, but the route
+	// still decides on access first
+	if missingTool(pattern) == "" {
+		part.Write(upload.contents(t))
+	}
+	form.Close()
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+// missingTool is the first program the route runs that isn't installed
+func missingTool(pattern string) string {
+	for _, tool := range routeTools[pattern] {
+		if _, err := exec.LookPath(tool); err != nil {
+			return tool
+		}
+	}
+	return ""
+}
+
+func TestRoutesHideResourcesFromStrangers(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.createUser("owner@example.com")
+	editor := api.createUser("editor@example.com")
+	viewer := api.createUser("viewer@example.com")
+	stranger := api.createUser("stranger@example.com")
+	// Uploads need a verified email, which mustn't be what turns anyone away
+	for _, user := range []testUser{owner, editor, viewer, stranger} {
+		if err := api.db.MarkUserEmailVerified(context.Background(), user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	patterns := registeredIDRoutes(t)
+	if len(patterns) == 0 {
+		t.Fatal("found no routes with ID parameters in routes.go")
+	}
+	for _, pattern := range patterns {
+		if _, ok := idRoutes[pattern]; !ok {
+			t.Errorf("route %q takes an ID but isn't in idRoutes", pattern)
+		}
+	}
+
+	// Each route is sent to resources of its own, so ones deleting or
+	// changing them don't get in the way of the rest
+	send := func(user testUser, pattern string) *httptest.ResponseRecorder {
+		t.Helper()
+		ids, collectionGrantID := ownedResources(t, api, owner, editor, viewer)
+		// Setup a user isn't allowed is turned away like the route itself
+		if setup, ok := routeSetup[pattern]; ok {
+			api.serveAs(user, routeRequest(t, setup, ids, collectionGrantID))
+		}
+		return api.serveAs(user, routeRequest(t, pattern, ids, collectionGrantID))
+	}
+
+	// Strangers get 404 everywhere, so IDs can't be probed
+	for _, pattern := range patterns {
+		if rec := send(stranger, pattern); rec.Code != http.StatusNotFound {
+			t.Errorf("stranger: %s got %d, want 404: %s", pattern, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Everyone else gets what their role allows, and a 2xx where it is
+	// allowed, so a route turning everyone away fails too
+	for _, role := range []struct {
+		name string
+		user testUser
+		want func(routeAccess) access
+	}{
+		{"owner", owner, func(a routeAccess) access { return a.owner }},
+		{"editor", editor, func(a routeAccess) access { return a.editor }},
+		{"viewer", viewer, func(a routeAccess) access { return a.viewer }},
+	} {
+		for _, pattern := range patterns {
+			want := role.want(idRoutes[pattern])
+			if tool := missingTool(pattern); want == allowed && tool != "" {
+				t.Logf("%s: skipping %s, which needs %s", role.name, pattern, tool)
+				continue
+			}
+			rec := send(role.user, pattern)
+			switch {
+			case want == allowed && (rec.Code < 200 || rec.Code >= 300):
+				t.Errorf("%s: %s got %d, want 2xx: %s", role.name, pattern, rec.Code, rec.Body.String())
+			case want == forbidden && rec.Code != http.StatusForbidden:
+				t.Errorf("%s: %s got %d, want 403: %s", role.name, pattern, rec.Code, rec.Body.String())
+			case want == hidden && rec.Code != http.StatusNotFound:
+				t.Errorf("%s: %s got %d, want 404: %s", role.name, pattern, rec.Code, rec.Body.String())
+			}
+		}
+	}
+}
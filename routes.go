@@ -24,17 +24,46 @@ func (cfg *apiConfig) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
 
+	// Public signing keys for verifying our JWTs
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.handlerJWKS)
+
 	// User Registration
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("GET /api/password-policy", cfg.handlerPasswordPolicy)
 
 	// Password Reset
 	mux.HandleFunc("POST /api/forgot-password", cfg.handlerForgotPassword)
 	mux.HandleFunc("POST /api/reset-password", cfg.handlerResetPassword)
 
+	// Share Links (the token is the credential)
+	mux.HandleFunc("GET /api/public/shares/{token}", cfg.handlerShareResolve)
+	mux.HandleFunc("GET /s/{token}", cfg.handlerSharePage)
+	mux.HandleFunc("GET /embed/{token}", cfg.handlerEmbedPage)
+	mux.HandleFunc("GET /oembed", cfg.handlerOEmbed)
+	mux.HandleFunc("POST /api/public/shares/{token}/events", cfg.handlerShareEvent)
+
+	// Email Verification
+	mux.HandleFunc("POST /api/verify-email", cfg.handlerVerifyEmail)
+	mux.HandleFunc("POST /api/confirm-email-change", cfg.handlerConfirmEmailChange)
+
 	// ============================================
 	// Protected Routes (Auth Required)
 	// ============================================
 
+	// Account Email
+	mux.Handle("POST /api/resend-verification", cfg.AuthHandler(cfg.handlerResendVerification))
+	mux.Handle("POST /api/change-email", cfg.AuthHandler(cfg.handlerChangeEmail))
+
+	// Profile
+	mux.Handle("GET /api/users/me", cfg.AuthHandler(cfg.handlerUsersGetMe))
+	mux.Handle("PUT /api/users/me", cfg.AuthHandler(cfg.handlerUsersUpdateMe))
+	mux.Handle("POST /api/users/me/password", cfg.AuthHandler(cfg.handlerUsersChangePassword))
+
+	// Account Deletion & Data Export
+	mux.Handle("DELETE /api/users/me", cfg.AuthHandler(cfg.handlerDeleteAccount))
+	mux.Handle("GET /api/users/me/export", cfg.AuthHandler(cfg.handlerExportAccount))
+	mux.Handle("GET /api/users/me/activity", cfg.AuthHandler(cfg.handlerAccountActivity))
+
 	// Videos - CRUD
 	mux.Handle("POST /api/videos", cfg.AuthHandler(cfg.handlerVideoMetaCreate))
 	mux.Handle("GET /api/videos", cfg.AuthHandler(cfg.handlerVideosRetrieve))
@@ -42,16 +71,99 @@ func (cfg *apiConfig) RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("PUT /api/videos/{videoID}", cfg.AuthHandler(cfg.handlerVideoMetaUpdate))
 	mux.Handle("DELETE /api/videos/{videoID}", cfg.AuthHandler(cfg.handlerVideoMetaDelete))
 
+	// Tags
+	mux.Handle("GET /api/tags", cfg.AuthHandler(cfg.handlerTagsList))
+	mux.Handle("POST /api/tags", cfg.AuthHandler(cfg.handlerTagCreate))
+	mux.Handle("PUT /api/tags/{tagID}", cfg.AuthHandler(cfg.handlerTagRename))
+	mux.Handle("DELETE /api/tags/{tagID}", cfg.AuthHandler(cfg.handlerTagDelete))
+	mux.Handle("POST /api/tags/{tagID}/merge", cfg.AuthHandler(cfg.handlerTagMerge))
+	mux.Handle("POST /api/videos/tags", cfg.AuthHandler(cfg.handlerVideosBulkTag))
+
+	// Collections
+	mux.Handle("GET /api/collections", cfg.AuthHandler(cfg.handlerCollectionsList))
+	mux.Handle("POST /api/collections", cfg.AuthHandler(cfg.handlerCollectionCreate))
+	mux.Handle("GET /api/collections/{collectionID}", cfg.AuthHandler(cfg.handlerCollectionGet))
+	mux.Handle("PUT /api/collections/{collectionID}", cfg.AuthHandler(cfg.handlerCollectionUpdate))
+	mux.Handle("DELETE /api/collections/{collectionID}", cfg.AuthHandler(cfg.handlerCollectionDelete))
+	mux.Handle("POST /api/collections/{collectionID}/items", cfg.AuthHandler(cfg.handlerCollectionItemAdd))
+	mux.Handle("POST /api/collections/{collectionID}/items/{videoID}/move", cfg.AuthHandler(cfg.handlerCollectionItemMove))
+	mux.Handle("DELETE /api/collections/{collectionID}/items/{videoID}", cfg.AuthHandler(cfg.handlerCollectionItemRemove))
+
+	// Share Links
+	mux.Handle("GET /api/shares", cfg.AuthHandler(cfg.handlerSharesList))
+	mux.Handle("POST /api/shares", cfg.AuthHandler(cfg.handlerShareCreate))
+	mux.Handle("POST /api/shares/{shareID}/revoke", cfg.AuthHandler(cfg.handlerShareRevoke))
+	mux.Handle("PUT /api/shares/{shareID}/embed-origins", cfg.AuthHandler(cfg.handlerShareEmbedOrigins))
+
+	// Sharing With Other Users
+	mux.Handle("GET /api/videos/{videoID}/grants", cfg.AuthHandler(cfg.handlerVideoGrantsList))
+	mux.Handle("POST /api/videos/{videoID}/grants", cfg.AuthHandler(cfg.handlerVideoGrantCreate))
+	mux.Handle("DELETE /api/videos/{videoID}/grants/{grantID}", cfg.AuthHandler(cfg.handlerVideoGrantDelete))
+	mux.Handle("GET /api/collections/{collectionID}/grants", cfg.AuthHandler(cfg.handlerCollectionGrantsList))
+	mux.Handle("POST /api/collections/{collectionID}/grants", cfg.AuthHandler(cfg.handlerCollectionGrantCreate))
+	mux.Handle("DELETE /api/collections/{collectionID}/grants/{grantID}", cfg.AuthHandler(cfg.handlerCollectionGrantDelete))
+	mux.Handle("GET /api/shared-with-me", cfg.AuthHandler(cfg.handlerSharedWithMe))
+
+	// Comments & Private Notes
+	mux.Handle("GET /api/videos/{videoID}/comments", cfg.AuthHandler(cfg.handlerCommentsList))
+	mux.Handle("POST /api/videos/{videoID}/comments", cfg.AuthHandler(cfg.handlerCommentCreate))
+	mux.Handle("PUT /api/videos/{videoID}/comments/{commentID}", cfg.AuthHandler(cfg.handlerCommentUpdate))
+	mux.Handle("DELETE /api/videos/{videoID}/comments/{commentID}", cfg.AuthHandler(cfg.handlerCommentDelete))
+	mux.Handle("POST /api/videos/{videoID}/comments/{commentID}/resolve", cfg.AuthHandler(cfg.handlerCommentResolve))
+	mux.Handle("POST /api/videos/{videoID}/comments/{commentID}/unresolve", cfg.AuthHandler(cfg.handlerCommentUnresolve))
+	mux.Handle("GET /api/comments/feed", cfg.AuthHandler(cfg.handlerCommentFeed))
+	mux.Handle("GET /api/videos/{videoID}/notes", cfg.AuthHandler(cfg.handlerNotesList))
+	mux.Handle("POST /api/videos/{videoID}/notes", cfg.AuthHandler(cfg.handlerNoteCreate))
+	mux.Handle("PUT /api/videos/{videoID}/notes/{noteID}", cfg.AuthHandler(cfg.handlerNoteUpdate))
+	mux.Handle("DELETE /api/videos/{videoID}/notes/{noteID}", cfg.AuthHandler(cfg.handlerNoteDelete))
+
+	// Playback Progress & Watch History
+	mux.Handle("POST /api/videos/{videoID}/progress", cfg.AuthHandler(cfg.handlerPlaybackHeartbeat))
+	mux.Handle("GET /api/videos/{videoID}/progress", cfg.AuthHandler(cfg.handlerPlaybackGet))
+	mux.Handle("PUT /api/videos/{videoID}/watched", cfg.AuthHandler(cfg.handlerVideoWatched))
+	mux.Handle("GET /api/continue-watching", cfg.AuthHandler(cfg.handlerContinueWatching))
+	mux.Handle("GET /api/history", cfg.AuthHandler(cfg.handlerWatchHistory))
+	mux.Handle("DELETE /api/history", cfg.AuthHandler(cfg.handlerWatchHistoryClear))
+	mux.Handle("DELETE /api/history/{videoID}", cfg.AuthHandler(cfg.handlerWatchHistoryRemove))
+
+	// Analytics
+	mux.Handle("POST /api/videos/{videoID}/events", cfg.AuthHandler(cfg.handlerVideoEvent))
+	mux.Handle("GET /api/videos/{videoID}/analytics", cfg.AuthHandler(cfg.handlerVideoAnalytics))
+	mux.Handle("GET /api/analytics", cfg.AuthHandler(cfg.handlerAccountAnalytics))
+
+	// Webhooks
+	mux.Handle("GET /api/webhooks", cfg.AuthHandler(cfg.handlerWebhooksList))
+	mux.Handle("POST /api/webhooks", cfg.AuthHandler(cfg.handlerWebhookCreate))
+	mux.Handle("GET /api/webhooks/{webhookID}", cfg.AuthHandler(cfg.handlerWebhookGet))
+	mux.Handle("PUT /api/webhooks/{webhookID}", cfg.AuthHandler(cfg.handlerWebhookUpdate))
+	mux.Handle("DELETE /api/webhooks/{webhookID}", cfg.AuthHandler(cfg.handlerWebhookDelete))
+	mux.Handle("GET /api/webhooks/{webhookID}/deliveries", cfg.AuthHandler(cfg.handlerWebhookDeliveries))
+	mux.Handle("GET /api/webhooks/{webhookID}/deliveries/{deliveryID}", cfg.AuthHandler(cfg.handlerWebhookDeliveryGet))
+	mux.Handle("POST /api/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", cfg.AuthHandler(cfg.handlerWebhookRedeliver))
+
 	// Video File Uploads
-	mux.Handle("POST /api/thumbnail_upload/{videoID}", cfg.AuthHandler(cfg.handlerUploadThumbnail))
-	mux.Handle("POST /api/video_upload/{videoID}", cfg.AuthHandler(cfg.handlerUploadVideo))
+	mux.Handle("POST /api/thumbnail_upload/{videoID}", cfg.VerifiedHandler(cfg.handlerUploadThumbnail))
+	mux.Handle("POST /api/video_upload/{videoID}", cfg.VerifiedHandler(cfg.handlerUploadVideo))
+	mux.Handle("POST /api/captions_upload/{videoID}", cfg.VerifiedHandler(cfg.handlerUploadCaptions))
 
 	// Selective Deletion
 	mux.Handle("DELETE /api/videos/{videoID}/thumbnail", cfg.AuthHandler(cfg.handlerDeleteThumbnail))
 	mux.Handle("DELETE /api/videos/{videoID}/video-file", cfg.AuthHandler(cfg.handlerDeleteVideoFile))
+	mux.Handle("DELETE /api/videos/{videoID}/captions", cfg.AuthHandler(cfg.handlerDeleteCaptions))
 
 	// ============================================
 	// Admin Routes
 	// ============================================
-	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	mux.Handle("POST /admin/reset", cfg.AdminHandler(cfg.handlerReset))
+
+	// User Management
+	mux.Handle("GET /admin/users", cfg.AdminHandler(cfg.handlerAdminListUsers))
+	mux.Handle("GET /admin/users/{userID}", cfg.AdminHandler(cfg.handlerAdminGetUser))
+	mux.Handle("DELETE /admin/users/{userID}", cfg.AdminHandler(cfg.handlerAdminDeleteUser))
+	mux.Handle("PUT /admin/users/{userID}/role", cfg.AdminHandler(cfg.handlerAdminUpdateUserRole))
+	mux.Handle("POST /admin/users/{userID}/disable", cfg.AdminHandler(cfg.handlerAdminDisableUser))
+	mux.Handle("POST /admin/users/{userID}/enable", cfg.AdminHandler(cfg.handlerAdminEnableUser))
+	mux.Handle("POST /admin/users/{userID}/force-password-reset", cfg.AdminHandler(cfg.handlerAdminForcePasswordReset))
+	mux.Handle("POST /admin/users/{userID}/unlock", cfg.AdminHandler(cfg.handlerAdminUnlockUser))
+	mux.Handle("GET /admin/audit-events", cfg.AdminHandler(cfg.handlerAdminAuditEvents))
 }
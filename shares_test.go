@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestSharePagesDontCountViews(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.createUser("owner@example.com")
+	video := api.createVideo(owner, "Preview me")
+	videoURL := "local,videos/preview.mp4"
+	video.VideoURL = &videoURL
+	if err := api.db.UpdateVideo(context.Background(), video); err != nil {
+		t.Fatal(err)
+	}
+	maxViews := 1
+	link, err := api.db.CreateShareLink(context.Background(), database.CreateShareLinkParams{
+		Token:    "preview-token",
+		UserID:   owner.ID,
+		VideoID:  &video.ID,
+		MaxViews: &maxViews,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Link preview bots fetch the page, maybe more than once
+	for _, path := range []string{"/s/" + link.Token, "/embed/" + link.Token, "/s/" + link.Token} {
+		rec := api.do(testUser{}, http.MethodGet, path, nil)
+		expect(t, rec, http.StatusOK)
+		if strings.Contains(rec.Body.String(), "preview.mp4") {
+			t.Errorf("%s has the video URL in the page", path)
+		}
+		if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "/api/public/shares/"+link.Token+" ") {
+			t.Errorf("%s CSP %q doesn't let the player resolve the link", path, csp)
+		}
+	}
+
+	// The player resolving the link is the view
+	rec := api.do(testUser{}, http.MethodGet, "/api/public/shares/"+link.Token+"?player=page", nil)
+	expect(t, rec, http.StatusOK)
+	var resolved struct {
+		Video        sharedVideo `json:"video"`
+		URLsExpireAt time.Time   `json:"urls_expire_at"`
+		ViewsLeft    *int        `json:"views_left"`
+	}
+	decode(t, rec, &resolved)
+	if resolved.Video.VideoURL == nil || resolved.ViewsLeft == nil || *resolved.ViewsLeft != 0 {
+		t.Errorf("resolve got video URL %v, views left %v; want a URL and none left", resolved.Video.VideoURL, resolved.ViewsLeft)
+	}
+	// The page can't resolve again, so its URLs last long enough to finish watching
+	if left := time.Until(resolved.URLsExpireAt); left < sharePageURLExpiry-time.Minute {
+		t.Errorf("page player URLs expire in %v, want about %v", left, sharePageURLExpiry)
+	}
+
+	expect(t, api.do(testUser{}, http.MethodGet, "/s/"+link.Token, nil), http.StatusGone)
+	expect(t, api.do(testUser{}, http.MethodGet, "/api/public/shares/"+link.Token, nil), http.StatusGone)
+}
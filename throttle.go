@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// throttlePolicy describes how many failures are tolerated before backing off.
+// After FreeAttempts failures within Window, each further failure locks the key
+// for BaseLockout * 2^(extra failures), capped at MaxLockout.
+type throttlePolicy struct {
+	FreeAttempts int
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+	Window       time.Duration
+}
+
+var (
+	loginAccountPolicy  = throttlePolicy{FreeAttempts: 5, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Window: 24 * time.Hour}
+	loginIPPolicy       = throttlePolicy{FreeAttempts: 20, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Window: time.Hour}
+	forgotAccountPolicy = throttlePolicy{FreeAttempts: 3, BaseLockout: time.Minute, MaxLockout: 24 * time.Hour, Window: 24 * time.Hour}
+	forgotIPPolicy      = throttlePolicy{FreeAttempts: 10, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour}
+
+	sharePasswordLinkPolicy = throttlePolicy{FreeAttempts: 5, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Window: 24 * time.Hour}
+	sharePasswordIPPolicy   = throttlePolicy{FreeAttempts: 20, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Window: time.Hour}
+)
+
+// lockoutFor returns how long to lock a key after the given number of failures
+func (p throttlePolicy) lockoutFor(failures int) time.Duration {
+	extra := failures - p.FreeAttempts
+	if extra < 0 {
+		return 0
+	}
+	// Avoid overflowing the shift for very large counts
+	if extra > 30 {
+		return p.MaxLockout
+	}
+	lockout := p.BaseLockout * time.Duration(1<<extra)
+	if lockout > p.MaxLockout || lockout <= 0 {
+		return p.MaxLockout
+	}
+	return lockout
+}
+
+func loginAccountKey(email string) string  { return "login:account:" + strings.ToLower(email) }
+func loginIPKey(ip string) string          { return "login:ip:" + ip }
+func forgotAccountKey(email string) string { return "forgot:account:" + strings.ToLower(email) }
+func forgotIPKey(ip string) string         { return "forgot:ip:" + ip }
+func shareLinkKey(id uuid.UUID) string     { return "share:link:" + id.String() }
+func shareIPKey(ip string) string          { return "share:ip:" + ip }
+
+// checkThrottle returns how long the caller must wait if any of the keys is locked
+func (cfg *apiConfig) checkThrottle(ctx context.Context, keys ...string) (time.Duration, error) {
+	var retryAfter time.Duration
+	now := time.Now().UTC()
+	for _, key := range keys {
+		throttle, err := cfg.db.GetAuthThrottle(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+			if wait := throttle.LockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	return retryAfter, nil
+}
+
+// recordThrottleFailure counts a failure for the key and locks it if the policy says so
+func (cfg *apiConfig) recordThrottleFailure(ctx context.Context, key string, policy throttlePolicy) error {
+	failures, err := cfg.db.IncrementAuthThrottle(ctx, key, time.Now().Add(-policy.Window))
+	if err != nil {
+		return err
+	}
+
+	lockout := policy.lockoutFor(failures)
+	if lockout == 0 {
+		return nil
+	}
+	return cfg.db.LockAuthThrottle(ctx, key, time.Now().Add(lockout))
+}
+
+// respondThrottled sends a 429 with a Retry-After header in whole seconds
+func respondThrottled(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, http.StatusTooManyRequests, fmt.Sprintf("Too many attempts. Try again in %d seconds.", seconds), nil)
+}
+
+// clientIP returns the caller's IP address. X-Forwarded-For is only trusted
+// when the server runs behind a proxy (TRUST_PROXY=true).
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			ip, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(ip)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
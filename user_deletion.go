@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// deleteUserAndAssets removes every stored file belonging to the user, then
+// deletes the user and their database records. A video.deleted event is sent
+// for each video first, while the user's webhooks still exist; actorID is
+// whoever asked for the deletion.
+func (cfg *apiConfig) deleteUserAndAssets(ctx context.Context, userID, actorID uuid.UUID) error {
+	videos, err := cfg.db.GetVideos(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, video := range videos {
+		if err := cfg.queueVideoEvent(ctx, &actorID, webhookEventVideoDeleted, newWebhookVideo(video), nil); err != nil {
+			return err
+		}
+	}
+
+	for _, video := range videos {
+		for _, ref := range []*string{video.VideoURL, video.ThumbnailURL, video.CaptionsURL} {
+			if ref == nil || *ref == "" {
+				continue
+			}
+			// Keep going if a file is already gone so the account still gets deleted
+			if err := cfg.storage.DeleteFile(*ref); err != nil {
+				log.Printf("%s[WARN]%s couldn't delete %s: %v", colorYellow, colorReset, *ref, err)
+			}
+		}
+	}
+
+	// The deliveries go with the account, so they only get one try
+	if err := cfg.webhooks.awaitFirstAttempts(ctx, userID, webhookDeletionWait); err != nil {
+		log.Printf("%s[WARN]%s deleting account %s without sending all its webhooks: %v", colorYellow, colorReset, userID, err)
+	}
+
+	return cfg.db.DeleteUser(ctx, userID)
+}
+
+// scheduleAccountDeletion runs the deletion cascade in the background for a
+// user already marked for deletion, and emails them once it has finished if
+// they asked for it themselves. Interrupted deletions are resumed on startup.
+func (cfg *apiConfig) scheduleAccountDeletion(user database.User, actorID uuid.UUID) {
+	go func() {
+		// Not tied to the request: the deletion must finish after the 202 is sent
+		if err := cfg.deleteUserAndAssets(context.Background(), user.ID, actorID); err != nil {
+			log.Printf("%s[ERROR]%s couldn't delete account %s: %v", colorRed, colorReset, user.ID, err)
+			return
+		}
+		log.Printf("Deleted account %s", user.ID)
+
+		if actorID == user.ID {
+			cfg.sendEmail(user.Email, "account_deleted", map[string]string{
+				"Name": user.FullName,
+			})
+		}
+	}()
+}
+
+// resumePendingDeletions restarts account deletions that didn't finish before
+// the server stopped. Who asked isn't stored, so they are attributed to the user.
+func (cfg *apiConfig) resumePendingDeletions(ctx context.Context) error {
+	users, err := cfg.db.GetUsersPendingDeletion(ctx)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		log.Printf("Resuming deletion of account %s", user.ID)
+		cfg.scheduleAccountDeletion(user, user.ID)
+	}
+	return nil
+}
@@ -4,16 +4,23 @@ import (
 	"bytes"
 	"encoding/json"
 	"os/exec"
+	"strconv"
 )
 
-func getVideoAspectRatio(filePath string) (string, error) {
-	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
+// videoMetadata is what ffprobe tells us about an uploaded file
+type videoMetadata struct {
+	AspectRatio     string  // "16:9", "9:16" or "other"
+	DurationSeconds float64 // 0 when ffprobe doesn't report one
+}
+
+func getVideoMetadata(filePath string) (videoMetadata, error) {
+	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", "-show_format", filePath)
 
 	buff := &bytes.Buffer{}
 	cmd.Stdout = buff
 	err := cmd.Run()
 	if err != nil {
-		return "", err
+		return videoMetadata{}, err
 	}
 
 	output := buff.Bytes()
@@ -23,27 +30,35 @@ func getVideoAspectRatio(filePath string) (string, error) {
 			Width  int `json:"width"`
 			Height int `json:"height"`
 		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
 	}
 
 	err = json.Unmarshal(output, &ffprobeOutput)
 	if err != nil {
-		return "", err
+		return videoMetadata{}, err
+	}
+
+	metadata := videoMetadata{AspectRatio: "other"}
+	if duration, err := strconv.ParseFloat(ffprobeOutput.Format.Duration, 64); err == nil {
+		metadata.DurationSeconds = duration
 	}
 
 	if len(ffprobeOutput.Streams) == 0 {
-		return "other", nil
+		return metadata, nil
 	}
 
 	width := ffprobeOutput.Streams[0].Width
 	height := ffprobeOutput.Streams[0].Height
 
 	if width*9 == height*16 {
-		return "16:9", nil
+		metadata.AspectRatio = "16:9"
 	} else if width*16 == height*9 {
-		return "9:16", nil
+		metadata.AspectRatio = "9:16"
 	}
 
-	return "other", nil
+	return metadata, nil
 }
 
 func processVideoForFastStart(filePath string) (string, error) {
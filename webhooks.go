@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Webhook event types
+const (
+	webhookEventVideoUploaded  = "video.uploaded"
+	webhookEventVideoProcessed = "video.processed"
+	webhookEventVideoUpdated   = "video.updated"
+	webhookEventVideoDeleted   = "video.deleted"
+)
+
+var webhookEventTypes = []string{
+	webhookEventVideoUploaded,
+	webhookEventVideoProcessed,
+	webhookEventVideoUpdated,
+	webhookEventVideoDeleted,
+}
+
+const (
+	// webhookPollInterval is how often the queue is checked for retries that
+	// have come due. New events are sent straight away.
+	webhookPollInterval = 10 * time.Second
+	webhookTimeout      = 10 * time.Second
+	webhookBatchSize    = 20
+	// webhookClaimLease must outlast a batch of timeouts, so a batch still
+	// being sent isn't claimed again
+	webhookClaimLease = 5 * time.Minute
+	// maxWebhookAttempts and webhookRetryBase give retries after 30s, 1m, 2m
+	// and so on, about an hour in all, before a delivery fails for good
+	maxWebhookAttempts = 8
+	webhookRetryBase   = 30 * time.Second
+	// webhookDeliveryRetention is how long finished deliveries are kept
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+	// webhookDeletionWait bounds how long deleting an account waits for its
+	// video.deleted events to be sent
+	webhookDeletionWait = time.Minute
+
+	webhookEventHeader     = "X-Vaultstream-Event"
+	webhookDeliveryHeader  = "X-Vaultstream-Delivery"
+	webhookSignatureHeader = "X-Vaultstream-Signature"
+)
+
+// errWebhookAddressNotAllowed is returned when a webhook URL resolves to a
+// loopback, private or link-local address
+var errWebhookAddressNotAllowed = errors.New("webhook address is not on the public internet")
+
+// webhookPayload is the JSON body posted for every event
+type webhookPayload struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	// ActorID is the user whose request caused the event
+	ActorID *uuid.UUID   `json:"actor_id"`
+	Video   webhookVideo `json:"video"`
+	// Changes lists what a video.updated event changed: title, description,
+	// or the thumbnail, captions or video file
+	Changes []string `json:"changes,omitempty"`
+}
+
+// webhookVideo is a video as webhook payloads describe it, without the
+// storage references that only mean something inside Vaultstream
+type webhookVideo struct {
+	ID              uuid.UUID `json:"id"`
+	UserID          uuid.UUID `json:"user_id"`
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	DurationSeconds *float64  `json:"duration_seconds"`
+	AspectRatio     *string   `json:"aspect_ratio"`
+	VideoSize       int64     `json:"video_size"`
+	HasVideo        bool      `json:"has_video"`
+	HasThumbnail    bool      `json:"has_thumbnail"`
+	HasCaptions     bool      `json:"has_captions"`
+}
+
+func newWebhookVideo(video database.Video) webhookVideo {
+	return webhookVideo{
+		ID:              video.ID,
+		UserID:          video.UserID,
+		Title:           video.Title,
+		Description:     video.Description,
+		CreatedAt:       video.CreatedAt,
+		UpdatedAt:       video.UpdatedAt,
+		DurationSeconds: video.DurationSeconds,
+		AspectRatio:     video.AspectRatio,
+		VideoSize:       video.VideoSize,
+		HasVideo:        video.VideoURL != nil,
+		HasThumbnail:    video.ThumbnailURL != nil,
+		HasCaptions:     video.CaptionsURL != nil,
+	}
+}
+
+// emitVideoEvent queues an event about the video for its owner's webhooks.
+// Failures are logged rather than surfaced, like audit events, so a broken
+// queue never fails the request itself.
+func (cfg *apiConfig) emitVideoEvent(r *http.Request, eventType string, video webhookVideo, changes []string) {
+	var actorID *uuid.UUID
+	if userID, ok := GetUserIDFromContext(r.Context()); ok {
+		actorID = &userID
+	}
+	// Queue the event even if the client has already gone away
+	if err := cfg.queueVideoEvent(context.WithoutCancel(r.Context()), actorID, eventType, video, changes); err != nil {
+		log.Printf("%s[ERROR]%s couldn't queue webhook event %s: %v", colorRed, colorReset, eventType, err)
+	}
+}
+
+// queueVideoEvent is emitVideoEvent for events that don't come from a request
+func (cfg *apiConfig) queueVideoEvent(ctx context.Context, actorID *uuid.UUID, eventType string, video webhookVideo, changes []string) error {
+	payload := webhookPayload{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		ActorID:   actorID,
+		Video:     video,
+		Changes:   changes,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return cfg.webhooks.enqueue(ctx, database.WebhookEvent{
+		ID:      payload.ID,
+		Type:    eventType,
+		UserID:  video.UserID,
+		Payload: body,
+	})
+}
+
+// webhookDispatcher sends queued webhook deliveries. The queue lives in the
+// database, so deliveries survive restarts; each is sent at least once, and
+// failures are retried with exponential backoff.
+type webhookDispatcher struct {
+	db     database.Store
+	client *http.Client
+	// wake asks run to send new deliveries without waiting for the next poll
+	wake chan struct{}
+}
+
+// newWebhookDispatcher refuses to deliver to loopback, private and link-local
+// addresses unless allowPrivateNetworks is set, so webhooks can't be used to
+// reach services behind the server's firewall
+func newWebhookDispatcher(db database.Store, allowPrivateNetworks bool) *webhookDispatcher {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivateNetworks {
+		// Checked on the address actually dialled, after DNS resolution
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !publicWebhookAddr(addrPort.Addr()) {
+				return errWebhookAddressNotAllowed
+			}
+			return nil
+		}
+	}
+	return &webhookDispatcher{
+		db: db,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			// No Proxy: requests go straight to the checked address
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: webhookTimeout,
+				MaxIdleConnsPerHost: 2,
+			},
+			// A redirect could point anywhere, so it counts as a failed delivery
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+func publicWebhookAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// enqueue stores deliveries of the event and wakes the dispatcher if there are any
+func (d *webhookDispatcher) enqueue(ctx context.Context, event database.WebhookEvent) error {
+	n, err := d.db.EnqueueWebhookEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		d.notify()
+	}
+	return nil
+}
+
+// awaitFirstAttempts waits until every delivery queued for the user's active
+// webhooks has been tried once, or until timeout. Deleting an account uses it
+// so its video.deleted events go out before its webhooks are deleted with it.
+func (d *webhookDispatcher) awaitFirstAttempts(ctx context.Context, userID uuid.UUID, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	tick := time.NewTicker(250 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		n, err := d.db.CountUntriedWebhookDeliveries(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d deliveries still untried: %w", n, ctx.Err())
+		case <-tick.C:
+		}
+	}
+}
+
+func (d *webhookDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends due deliveries whenever it is woken and every poll interval, and
+// prunes old ones hourly, until ctx is done. Deliveries cut off by shutdown
+// are sent again after a restart.
+func (d *webhookDispatcher) run(ctx context.Context) {
+	poll := time.NewTicker(webhookPollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+	for {
+		if err := d.sendDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("%s[ERROR]%s couldn't send webhooks: %v", colorRed, colorReset, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		case <-d.wake:
+		case <-prune.C:
+			if err := d.db.PruneWebhookDeliveries(ctx, time.Now().Add(-webhookDeliveryRetention)); err != nil {
+				log.Printf("%s[ERROR]%s couldn't prune webhook deliveries: %v", colorRed, colorReset, err)
+			}
+		}
+	}
+}
+
+// sendDue claims and sends due deliveries a batch at a time until none are left
+func (d *webhookDispatcher) sendDue(ctx context.Context) error {
+	for {
+		deliveries, err := d.db.ClaimWebhookDeliveries(ctx, time.Now(), webhookClaimLease, webhookBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, delivery := range deliveries {
+			if err := d.send(ctx, delivery); err != nil {
+				return err
+			}
+		}
+		if len(deliveries) < webhookBatchSize {
+			return nil
+		}
+	}
+}
+
+// send posts one delivery and records the outcome. Only database errors are
+// returned; a failed post is recorded and retried later.
+func (d *webhookDispatcher) send(ctx context.Context, delivery database.WebhookDelivery) error {
+	webhook, err := d.db.GetWebhook(ctx, delivery.WebhookID)
+	if errors.Is(err, database.ErrNotFound) {
+		// Deleted since the batch was claimed, along with its deliveries
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	attempt := database.WebhookAttempt{At: time.Now()}
+	code, err := d.post(ctx, webhook, delivery)
+	if ctx.Err() != nil {
+		// Shutting down: leave the delivery for its lease to run out
+		return nil
+	}
+	if code != 0 {
+		attempt.ResponseCode = &code
+	}
+	if err == nil && (code < 200 || code > 299) {
+		err = fmt.Errorf("unexpected status %d", code)
+	}
+	if err != nil {
+		message := err.Error()
+		attempt.Error = &message
+		if delivery.Attempts+1 < maxWebhookAttempts {
+			retryAt := time.Now().Add(webhookRetryBase << delivery.Attempts)
+			attempt.RetryAt = &retryAt
+		}
+	} else {
+		attempt.Succeeded = true
+	}
+	return d.db.RecordWebhookAttempt(ctx, delivery.ID, attempt)
+}
+
+// post sends the delivery's payload to the webhook, signed with its secret,
+// and returns the response status
+func (d *webhookDispatcher) post(ctx context.Context, webhook database.Webhook, delivery database.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Vaultstream-Webhooks")
+	req.Header.Set(webhookEventHeader, delivery.EventType)
+	req.Header.Set(webhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(webhookSignatureHeader, signWebhookPayload(webhook.Secret, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Read a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// signWebhookPayload is the signature header value receivers check: the
+// hex HMAC-SHA256 of the raw body, keyed with the webhook's secret
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}